@@ -0,0 +1,189 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Error codes shared by REST responses and WebSocket error frames
+const (
+	CodeBadRequest       = "bad_request"
+	CodeValidation       = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeTooLarge         = "payload_too_large"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+
+	// Account sanctions
+	CodeSuspended = "suspended"
+	CodeMuted     = "muted"
+	CodeBlocked   = "blocked"
+
+	// Message filter rejections
+	CodeMessageTooLong = "message_too_long"
+	CodeBlockedWord    = "blocked_word"
+	CodeBlockedLink    = "blocked_link"
+	CodeDuplicate      = "duplicate_message"
+	CodeFlooding       = "flooding"
+
+	// WebSocket protocol errors
+	CodeProtocol           = "protocol_error"
+	CodeUnsupportedVersion = "unsupported_version"
+)
+
+// Postgres error codes mapped by From
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgCheckViolation      = "23514"
+	pgNotNullViolation    = "23502"
+)
+
+// FieldError points at one invalid request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is the JSON error envelope returned by the API
+type Error struct {
+	Status    int          `json:"-"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func New(status int, code string, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// Invalid reports a problem with a single request field
+func Invalid(field string, message string) *Error {
+	err := New(http.StatusBadRequest, CodeValidation, message)
+	err.Fields = []FieldError{{Field: field, Message: message}}
+	return err
+}
+
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+func TooLarge(message string) *Error {
+	return New(http.StatusRequestEntityTooLarge, CodeTooLarge, message)
+}
+
+func UnsupportedMedia(message string) *Error {
+	return New(http.StatusUnsupportedMediaType, CodeUnsupportedMedia, message)
+}
+
+func Internal(message string) *Error {
+	return New(http.StatusInternalServerError, CodeInternal, message)
+}
+
+// CodeForStatus returns the generic code of an HTTP status
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMedia
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	}
+	return CodeInternal
+}
+
+// keyPattern extracts the column from the detail of constraint violations,
+// such as `Key (username)=(bob) already exists.`
+var keyPattern = regexp.MustCompile(`Key \(([^)]+)\)=`)
+
+// From maps an error to an API error. Errors that already are API errors are returned as is,
+// constraint violations become client errors, anything else is an internal error with message.
+func From(err error, message string) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return NotFound("Not found")
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return Internal(message)
+	}
+
+	field := pgErr.ColumnName
+	if match := keyPattern.FindStringSubmatch(pgErr.Detail); match != nil {
+		field = match[1]
+	}
+
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		apiErr = Conflict(fmt.Sprintf("%s already exists", field))
+	case pgForeignKeyViolation:
+		apiErr = NotFound(fmt.Sprintf("%s refers to a record that does not exist", field))
+	case pgCheckViolation, pgNotNullViolation:
+		apiErr = BadRequest(fmt.Sprintf("Invalid %s", field))
+	default:
+		return Internal(message)
+	}
+
+	if field != "" {
+		apiErr.Fields = []FieldError{{Field: field, Message: apiErr.Message}}
+	}
+	return apiErr
+}
+
+// Write sends err as a JSON error envelope carrying the request id
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := From(err, "Internal server error")
+	response := *apiErr
+	response.RequestID = RequestIDFrom(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(response.Status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,125 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestFrom(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantFields []FieldError
+	}{
+		{"api error", Conflict("Taken"), http.StatusConflict, CodeConflict, nil},
+		{"wrapped api error", fmt.Errorf("creating user: %w", Invalid("username", "Too short")), http.StatusBadRequest, CodeValidation, []FieldError{{"username", "Too short"}}},
+		{"no rows", pgx.ErrNoRows, http.StatusNotFound, CodeNotFound, nil},
+		{
+			"unique violation",
+			&pgconn.PgError{Code: pgUniqueViolation, Detail: "Key (username)=(bob) already exists."},
+			http.StatusConflict, CodeConflict, []FieldError{{"username", "username already exists"}},
+		},
+		{
+			"foreign key violation",
+			&pgconn.PgError{Code: pgForeignKeyViolation, Detail: `Key (group_id)=(42) is not present in table "chat_groups".`},
+			http.StatusNotFound, CodeNotFound, []FieldError{{"group_id", "group_id refers to a record that does not exist"}},
+		},
+		{
+			"not null violation",
+			&pgconn.PgError{Code: pgNotNullViolation, ColumnName: "content"},
+			http.StatusBadRequest, CodeBadRequest, []FieldError{{"content", "Invalid content"}},
+		},
+		{"check violation without column", &pgconn.PgError{Code: pgCheckViolation}, http.StatusBadRequest, CodeBadRequest, nil},
+		{"other postgres error", &pgconn.PgError{Code: "42P01", Message: "relation does not exist"}, http.StatusInternalServerError, CodeInternal, nil},
+		{"other error", errors.New("connection refused"), http.StatusInternalServerError, CodeInternal, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := From(tt.err, "Unable to do it")
+			if got.Status != tt.wantStatus || got.Code != tt.wantCode {
+				t.Errorf("From() = %d %s, want %d %s", got.Status, got.Code, tt.wantStatus, tt.wantCode)
+			}
+			if !reflect.DeepEqual(got.Fields, tt.wantFields) {
+				t.Errorf("fields = %v, want %v", got.Fields, tt.wantFields)
+			}
+			if got.Status == http.StatusInternalServerError && got.Message != "Unable to do it" {
+				t.Errorf("internal error message = %q, the cause must not leak", got.Message)
+			}
+		})
+	}
+}
+
+func TestCodeForStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{http.StatusBadRequest, CodeBadRequest},
+		{http.StatusUnauthorized, CodeUnauthorized},
+		{http.StatusForbidden, CodeForbidden},
+		{http.StatusNotFound, CodeNotFound},
+		{http.StatusConflict, CodeConflict},
+		{http.StatusRequestEntityTooLarge, CodeTooLarge},
+		{http.StatusUnsupportedMediaType, CodeUnsupportedMedia},
+		{http.StatusTooManyRequests, CodeRateLimited},
+		{http.StatusTeapot, CodeInternal},
+		{http.StatusBadGateway, CodeInternal},
+	}
+	for _, tt := range tests {
+		if got := CodeForStatus(tt.status); got != tt.want {
+			t.Errorf("CodeForStatus(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestWriteCarriesRequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		wantSame  bool
+	}{
+		{"client id", "abc-123.DEF_4", true},
+		{"no id", "", false},
+		{"unsafe id", "bad id\nwith newline", false},
+		{"id too long", string(make([]byte, 65)), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := WithRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				Write(w, r, NotFound("User not found"))
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/api/users/1", nil)
+			if tt.requestID != "" {
+				r.Header.Set("X-Request-ID", tt.requestID)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			var body Error
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			header := w.Header().Get("X-Request-ID")
+			if w.Code != http.StatusNotFound || body.Code != CodeNotFound || body.Message != "User not found" {
+				t.Errorf("response = %d %+v", w.Code, body)
+			}
+			if header == "" || body.RequestID != header {
+				t.Errorf("request id header %q and body %q differ", header, body.RequestID)
+			}
+			if (header == tt.requestID) != tt.wantSame {
+				t.Errorf("request id = %q, want client id reused %t", header, tt.wantSame)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package bots
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/validation"
+	"github.com/clementus360/proxy-chat/webhooks"
+)
+
+// AuthScheme prefixes bot tokens in the Authorization header: "Bot <token>"
+const AuthScheme = "Bot"
+
+// NewToken generates a bot token, it is shown once and only its hash is stored
+func NewToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return "pcbot_" + hex.EncodeToString(token), nil
+}
+
+// HashToken is the stored form of a token
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// ErrNoToken is returned by Authenticate when the request carries no bot token
+var ErrNoToken = errors.New("no bot token")
+
+// Authenticate finds the bot of an Authorization header value. It returns ErrNoToken when the
+// header does not use the Bot scheme and database.ErrBotNotFound for unknown tokens.
+func Authenticate(ctx context.Context, authorization string) (models.Bot, error) {
+	scheme, token, _ := strings.Cut(authorization, " ")
+	if !strings.EqualFold(scheme, AuthScheme) || token == "" {
+		return models.Bot{}, ErrNoToken
+	}
+	return database.BotByTokenHash(ctx, HashToken(strings.TrimSpace(token)))
+}
+
+// Command is a slash command parsed from a message such as "/weather@forecast_bot tomorrow noon"
+type Command struct {
+	Name string `json:"name"`
+	// Bot is the username after the @, it addresses one bot when several registered the command
+	Bot  string   `json:"bot,omitempty"`
+	Args []string `json:"args"`
+	// Text is everything after the command, as typed
+	Text string `json:"text"`
+}
+
+// ParseCommand reads the slash command a message starts with
+func ParseCommand(content string) (Command, bool) {
+	rest, found := strings.CutPrefix(content, "/")
+	if !found {
+		return Command{}, false
+	}
+
+	word, text, _ := strings.Cut(rest, " ")
+	name, bot, _ := strings.Cut(word, "@")
+	name = strings.ToLower(name)
+	if !validation.CommandPattern.MatchString(name) {
+		return Command{}, false
+	}
+
+	text = strings.TrimSpace(text)
+	return Command{Name: name, Bot: bot, Args: strings.Fields(text), Text: text}, true
+}
+
+// Invocation is the data of command.invoked events
+type Invocation struct {
+	Command
+	GroupID   int `json:"group_id"`
+	UserID    int `json:"user_id"`
+	MessageID int `json:"message_id"`
+}
+
+// Dispatch sends the slash command of a group message to the bots of the group that registered
+// it. Bots connected over the WebSocket get the message itself like every member, bots with a
+// webhook also receive a command.invoked event with the parsed command.
+func Dispatch(ctx context.Context, msg models.Message) {
+	command, ok := ParseCommand(msg.Content)
+	if !ok || msg.GroupID == 0 {
+		return
+	}
+
+	botIDs, err := database.CommandBots(ctx, msg.GroupID, command.Name, command.Bot)
+	if err != nil {
+		log.Printf("Error finding bots for command /%s in group %d: %v", command.Name, msg.GroupID, err)
+		return
+	}
+
+	invocation := Invocation{Command: command, GroupID: msg.GroupID, UserID: msg.SenderID, MessageID: msg.ID}
+	for _, botID := range botIDs {
+		if botID == msg.SenderID {
+			continue // Bots do not invoke their own commands
+		}
+		webhooks.EmitToBot(ctx, botID, models.WebhookCommandInvoked, msg.GroupID, invocation)
+	}
+}
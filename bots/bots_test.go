@@ -0,0 +1,37 @@
+package bots
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Command
+		wantOK  bool
+	}{
+		{name: "bare command", content: "/help", want: Command{Name: "help", Args: []string{}}, wantOK: true},
+		{name: "arguments", content: "/mute @alice 10m  too loud ", want: Command{Name: "mute", Args: []string{"@alice", "10m", "too", "loud"}, Text: "@alice 10m  too loud"}, wantOK: true},
+		{name: "addressed to a bot", content: "/Weather@forecast_bot paris", want: Command{Name: "weather", Bot: "forecast_bot", Args: []string{"paris"}, Text: "paris"}, wantOK: true},
+		{name: "plain message", content: "hello /help", wantOK: false},
+		{name: "lone slash", content: "/", wantOK: false},
+		{name: "path", content: "/usr/bin is full", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseCommand(tt.content)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseCommand(%q) ok = %v, want %v", tt.content, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got.Name != tt.want.Name || got.Bot != tt.want.Bot || got.Text != tt.want.Text || !slices.Equal(got.Args, tt.want.Args) {
+				t.Errorf("ParseCommand(%q) = %+v, want %+v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
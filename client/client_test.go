@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientRequests(t *testing.T) {
+	var got *http.Request
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/users":
+			w.Write([]byte(`{"id": 7, "username": "bob", "latitude": 1.5, "longitude": 2.5}`))
+		case "/api/avatars/users/7":
+			w.Write([]byte(`{"image_url": "/api/avatars/users/7?v=1"}`))
+		default:
+			w.Write([]byte(`[]`))
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL + "/")
+	c.AdminToken, c.BotToken = "admin-secret", "bot-secret"
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+		// check inspects the request the server received
+		check func(t *testing.T)
+	}{
+		{
+			name: "json body",
+			call: func() error {
+				user, err := c.CreateUser(ctx, &User{Username: "bob", Latitude: 1.5, Longitude: 2.5})
+				if err == nil && (user.ID != 7 || user.Username != "bob") {
+					t.Errorf("CreateUser() = %+v", user)
+				}
+				return err
+			},
+			check: func(t *testing.T) {
+				var sent map[string]any
+				json.Unmarshal([]byte(body), &sent)
+				if got.Method != http.MethodPost || got.Header.Get("Content-Type") != "application/json" || sent["username"] != "bob" {
+					t.Errorf("request = %s %s %v", got.Method, got.Header.Get("Content-Type"), sent)
+				}
+				if got.Header.Get("Authorization") != "" {
+					t.Errorf("public route sent Authorization %q", got.Header.Get("Authorization"))
+				}
+			},
+		},
+		{
+			name: "admin route",
+			call: func() error {
+				_, err := c.GetWebhooks(ctx)
+				return err
+			},
+			check: func(t *testing.T) {
+				if got.Header.Get("Authorization") != "Bearer admin-secret" {
+					t.Errorf("Authorization = %q", got.Header.Get("Authorization"))
+				}
+			},
+		},
+		{
+			name: "bot route",
+			call: func() error {
+				_, err := c.SetBotCommands(ctx, &SetBotCommandsRequest{})
+				return err
+			},
+			check: func(t *testing.T) {
+				if got.Method != http.MethodPut || got.Header.Get("Authorization") != "Bot bot-secret" {
+					t.Errorf("request = %s with Authorization %q", got.Method, got.Header.Get("Authorization"))
+				}
+			},
+		},
+		{
+			name: "multipart form",
+			call: func() error {
+				_, err := c.UploadAvatar(ctx, "users", 7, UploadAvatarForm{File: strings.NewReader("png"), FileName: "a.png", UserID: 7})
+				return err
+			},
+			check: func(t *testing.T) {
+				if !strings.HasPrefix(got.Header.Get("Content-Type"), "multipart/form-data; boundary=") {
+					t.Errorf("Content-Type = %q", got.Header.Get("Content-Type"))
+				}
+				if !strings.Contains(body, `name="user_id"`) || !strings.Contains(body, `filename="a.png"`) {
+					t.Errorf("form = %q", body)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t)
+		})
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header string
+		body   string
+		want   APIError
+	}{
+		{
+			"error envelope", http.StatusBadRequest, "",
+			`{"code": "validation_failed", "message": "username: is required", "fields": [{"field": "username", "message": "is required"}], "request_id": "abc"}`,
+			APIError{StatusCode: 400, Code: "validation_failed", Message: "username: is required", Fields: []FieldError{{Field: "username", Message: "is required"}}, RequestID: "abc"},
+		},
+		{
+			"request id from header", http.StatusNotFound, "def",
+			`{"code": "not_found", "message": "User not found"}`,
+			APIError{StatusCode: 404, Code: "not_found", Message: "User not found", RequestID: "def"},
+		},
+		{
+			"not an envelope", http.StatusBadGateway, "",
+			`<html>bad gateway</html>`,
+			APIError{StatusCode: 502, Code: "unknown", Message: "Bad Gateway"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("X-Request-ID", tt.header)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			_, err := New(server.URL).CreateUser(context.Background(), &User{Username: "bob"})
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want an *APIError", err)
+			}
+			if apiErr.Error() != tt.want.Error() || len(apiErr.Fields) != len(tt.want.Fields) {
+				t.Errorf("error = %v %v, want %v %v", apiErr, apiErr.Fields, &tt.want, tt.want.Fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Package client is a typed Go client for the proxy chat REST API, used by integration tests
+// and internal tools. The operations and types in client.go are generated from openapi.json,
+// run `go generate ./openapi` after changing the document.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls the API of one server
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// AdminToken is sent as a bearer token to the admin routes
+	AdminToken string
+	// BotToken authenticates the bot API routes
+	BotToken string
+}
+
+// New returns a client for the server at baseURL, such as "http://localhost:8080"
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTPClient: http.DefaultClient}
+}
+
+// APIError is the error envelope returned by the server
+type APIError struct {
+	StatusCode int          `json:"-"`
+	Code       string       `json:"code"`
+	Message    string       `json:"message"`
+	Fields     []FieldError `json:"fields,omitempty"`
+	RequestID  string       `json:"request_id,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("%d %s: %s (request %s)", e.StatusCode, e.Code, e.Message, e.RequestID)
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// formFile is a file part of a multipart request
+type formFile struct {
+	field    string
+	filename string
+	content  io.Reader
+}
+
+// do sends a request and returns the response when its status is successful
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body io.Reader, contentType string, auth string) (*http.Response, error) {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	// auth is the security scheme of the route in the OpenAPI document
+	switch {
+	case auth == "adminToken" && c.AdminToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.AdminToken)
+	case auth == "botToken" && c.BotToken != "":
+		req.Header.Set("Authorization", "Bot "+c.BotToken)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, decodeError(resp)
+	}
+	return resp, nil
+}
+
+// doJSON sends in as a JSON body, when it is not nil, and decodes the response into out
+func (c *Client) doJSON(ctx context.Context, method string, path string, query url.Values, in interface{}, out interface{}, auth string) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(encoded), "application/json"
+	}
+
+	resp, err := c.do(ctx, method, path, query, body, contentType, auth)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// doMultipart sends files and fields as a multipart form and decodes the response into out
+func (c *Client) doMultipart(ctx context.Context, method string, path string, query url.Values, files []formFile, fields map[string]string, out interface{}, auth string) error {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, file := range files {
+		part, err := writer.CreateFormFile(file.field, file.filename)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(part, file.content); err != nil {
+			return err
+		}
+	}
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, method, path, query, &body, writer.FormDataContentType(), auth)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// doRaw returns the body of a binary response, the caller closes it
+func (c *Client) doRaw(ctx context.Context, method string, path string, query url.Values, auth string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, method, path, query, nil, "", auth)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func decodeError(resp *http.Response) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Code == "" {
+		apiErr.Code = "unknown"
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	return apiErr
+}
@@ -0,0 +1,432 @@
+// Command genclient generates the typed API client in package client from the OpenAPI document.
+//
+//	go run ./cmd/genclient -spec openapi/openapi.json -out client/client.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type spec struct {
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type schema struct {
+	Ref         string             `json:"$ref"`
+	Type        string             `json:"type"`
+	Format      string             `json:"format"`
+	Description string             `json:"description"`
+	Items       *schema            `json:"items"`
+	Properties  map[string]*schema `json:"properties"`
+	Required    []string           `json:"required"`
+	Enum        []string           `json:"enum"`
+	Nullable    bool               `json:"nullable"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required"`
+	Description string  `json:"description"`
+	Schema      *schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type operation struct {
+	OperationID string      `json:"operationId"`
+	Summary     string      `json:"summary"`
+	Parameters  []parameter `json:"parameters"`
+	RequestBody *struct {
+		Content map[string]mediaType `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]mediaType `json:"content"`
+	} `json:"responses"`
+	Security  []map[string][]string `json:"security"`
+	WebSocket json.RawMessage       `json:"x-websocket"`
+
+	method string
+	path   string
+}
+
+// handwritten schemas are defined in runtime.go
+var handwritten = map[string]bool{"Error": true}
+
+var initialisms = map[string]string{"id": "ID", "ids": "IDs", "url": "URL", "sha256": "SHA256", "km": "KM", "ws": "WS"}
+
+func main() {
+	specPath := flag.String("spec", "openapi/openapi.json", "OpenAPI document")
+	outPath := flag.String("out", "client/client.go", "generated file")
+	flag.Parse()
+
+	raw, err := os.ReadFile(*specPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	source, err := generate(raw)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*outPath, source, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate renders the client of an OpenAPI document
+func generate(raw []byte) ([]byte, error) {
+	var doc spec
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("parsing spec: %w", err)
+	}
+
+	g := &generator{}
+	for _, name := range sortedKeys(doc.Components.Schemas) {
+		if !handwritten[name] {
+			g.schema(name, doc.Components.Schemas[name])
+		}
+	}
+	for _, op := range operations(doc) {
+		g.operation(op)
+	}
+
+	var file bytes.Buffer
+	file.WriteString("// Code generated by genclient from openapi.json. DO NOT EDIT.\n\npackage client\n\nimport (\n")
+	for _, pkg := range []string{"context", "encoding/json", "fmt", "io", "net/url", "time"} {
+		if bytes.Contains(g.buf.Bytes(), []byte(pkg[strings.LastIndex(pkg, "/")+1:]+".")) {
+			fmt.Fprintf(&file, "%q\n", pkg)
+		}
+	}
+	file.WriteString(")\n\n")
+	file.Write(g.buf.Bytes())
+
+	source, err := format.Source(file.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w\n%s", err, file.Bytes())
+	}
+	return source, nil
+}
+
+// operations lists the REST operations ordered by path and method, the WebSocket route is skipped
+func operations(doc spec) []*operation {
+	var ops []*operation
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			if op.WebSocket != nil {
+				continue
+			}
+			op.method, op.path = strings.ToUpper(method), path
+			ops = append(ops, op)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].path != ops[j].path {
+			return ops[i].path < ops[j].path
+		}
+		return ops[i].method < ops[j].method
+	})
+	return ops
+}
+
+type generator struct {
+	buf bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) comment(text string) {
+	if text != "" {
+		g.printf("// %s\n", text)
+	}
+}
+
+// schema emits a named type for a component schema
+func (g *generator) schema(name string, s *schema) {
+	if s.Description != "" {
+		g.comment(name + ": " + s.Description)
+	}
+	if s.Type == "string" && len(s.Enum) > 0 {
+		g.printf("type %s string\n\nconst (\n", name)
+		for _, value := range s.Enum {
+			g.printf("%s%s %s = %q\n", name, goName(value), name, value)
+		}
+		g.printf(")\n\n")
+		return
+	}
+	if s.Type != "object" {
+		g.printf("type %s %s\n\n", name, goType(s))
+		return
+	}
+
+	g.printf("type %s struct {\n", name)
+	for _, prop := range sortedKeys(s.Properties) {
+		field := s.Properties[prop]
+		g.comment(field.Description)
+		tag := prop
+		if !slices.Contains(s.Required, prop) {
+			tag += ",omitempty"
+		}
+		g.printf("%s %s `json:\"%s\"`\n", goName(prop), goType(field), tag)
+	}
+	g.printf("}\n\n")
+}
+
+// operation emits a method of Client, and the structs holding its query parameters or form fields
+func (g *generator) operation(op *operation) {
+	name := goName(op.OperationID)
+	// auth names the security scheme of the operation, the client knows the credentials of each
+	auth := ""
+	for _, requirement := range op.Security {
+		for scheme := range requirement {
+			auth = scheme
+		}
+	}
+
+	args := []string{"ctx context.Context"}
+	var pathParams, queryParams []parameter
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			pathParams = append(pathParams, p)
+			args = append(args, lowerFirst(goName(p.Name))+" "+goType(p.Schema))
+		case "query":
+			queryParams = append(queryParams, p)
+		}
+	}
+
+	if len(queryParams) > 0 {
+		g.printf("// %sParams holds the query parameters of %s, optional parameters are nil when unset\n", name, name)
+		g.printf("type %sParams struct {\n", name)
+		for _, p := range queryParams {
+			g.comment(p.Description)
+			typ := goType(p.Schema)
+			if !p.Required {
+				typ = "*" + typ
+			}
+			g.printf("%s %s\n", goName(p.Name), typ)
+		}
+		g.printf("}\n\n")
+		args = append(args, "params "+name+"Params")
+	}
+
+	var jsonBody, formBody *schema
+	if op.RequestBody != nil {
+		if media, ok := op.RequestBody.Content["application/json"]; ok {
+			jsonBody = media.Schema
+			args = append(args, "body "+pointerTo(goType(media.Schema)))
+		}
+		if media, ok := op.RequestBody.Content["multipart/form-data"]; ok {
+			formBody = media.Schema
+			g.printf("// %sForm holds the multipart form of %s\n", name, name)
+			g.printf("type %sForm struct {\n", name)
+			for _, prop := range sortedKeys(formBody.Properties) {
+				field := formBody.Properties[prop]
+				if field.Format == "binary" {
+					g.printf("%s io.Reader\n%sName string\n", goName(prop), goName(prop))
+					continue
+				}
+				g.printf("%s %s\n", goName(prop), goType(field))
+			}
+			g.printf("}\n\n")
+			args = append(args, "form "+name+"Form")
+		}
+	}
+
+	result, binary := responseType(op)
+	g.printf("// %s calls %s %s: %s\n", name, op.method, op.path, op.Summary)
+	if binary {
+		g.printf("// The caller closes the returned body.\n")
+		g.printf("func (c *Client) %s(%s) (io.ReadCloser, error) {\n", name, strings.Join(args, ", "))
+	} else {
+		g.printf("func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(args, ", "), returnType(result))
+	}
+
+	g.printf("path := %s\n", pathExpr(op.path, pathParams))
+	g.printf("query := url.Values{}\n")
+	for _, p := range queryParams {
+		field := "params." + goName(p.Name)
+		if p.Required {
+			g.printf("query.Set(%q, fmt.Sprint(%s))\n", p.Name, field)
+		} else {
+			g.printf("if %s != nil {\nquery.Set(%q, fmt.Sprint(*%s))\n}\n", field, p.Name, field)
+		}
+	}
+
+	if binary {
+		g.printf("return c.doRaw(ctx, %q, path, query, %q)\n}\n\n", op.method, auth)
+		return
+	}
+
+	g.printf("var out %s\n", result)
+	switch {
+	case formBody != nil:
+		g.printf("files := []formFile{\n")
+		for _, prop := range sortedKeys(formBody.Properties) {
+			if formBody.Properties[prop].Format == "binary" {
+				g.printf("{%q, form.%sName, form.%s},\n", prop, goName(prop), goName(prop))
+			}
+		}
+		g.printf("}\nfields := map[string]string{\n")
+		for _, prop := range sortedKeys(formBody.Properties) {
+			if formBody.Properties[prop].Format != "binary" {
+				g.printf("%q: fmt.Sprint(form.%s),\n", prop, goName(prop))
+			}
+		}
+		g.printf("}\n")
+		g.printf("if err := c.doMultipart(ctx, %q, path, query, files, fields, &out, %q); err != nil {\n", op.method, auth)
+	case jsonBody != nil:
+		g.printf("if err := c.doJSON(ctx, %q, path, query, body, &out, %q); err != nil {\n", op.method, auth)
+	default:
+		g.printf("if err := c.doJSON(ctx, %q, path, query, nil, &out, %q); err != nil {\n", op.method, auth)
+	}
+	g.printf("return %s, err\n}\n", zeroValue(result))
+	if isNamed(result) {
+		g.printf("return &out, nil\n}\n\n")
+	} else {
+		g.printf("return out, nil\n}\n\n")
+	}
+}
+
+// responseType is the Go type of the first successful response, or reports a binary body
+func responseType(op *operation) (string, bool) {
+	var statuses []string
+	for status := range op.Responses {
+		if strings.HasPrefix(status, "2") {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Strings(statuses)
+	if len(statuses) == 0 {
+		log.Fatalf("%s has no successful response", op.OperationID)
+	}
+
+	for contentType, media := range op.Responses[statuses[0]].Content {
+		if contentType != "application/json" {
+			return "", true
+		}
+		return goType(media.Schema), false
+	}
+	log.Fatalf("%s has no response body", op.OperationID)
+	return "", false
+}
+
+// goType maps a schema to a Go type, nullable values become pointers
+func goType(s *schema) string {
+	var typ string
+	switch {
+	case s.Ref != "":
+		typ = s.Ref[strings.LastIndex(s.Ref, "/")+1:]
+	case s.Type == "array":
+		return "[]" + goType(s.Items)
+	case s.Type == "integer" && s.Format == "int64":
+		typ = "int64"
+	case s.Type == "integer":
+		typ = "int"
+	case s.Type == "number" && s.Format == "float":
+		typ = "float32"
+	case s.Type == "number":
+		typ = "float64"
+	case s.Type == "boolean":
+		typ = "bool"
+	case s.Type == "string" && s.Format == "date-time":
+		typ = "time.Time"
+	case s.Type == "string":
+		typ = "string"
+	case s.Type == "object":
+		return "json.RawMessage"
+	default:
+		log.Fatalf("unsupported schema %+v", s)
+	}
+
+	if s.Nullable {
+		return "*" + typ
+	}
+	return typ
+}
+
+// isNamed reports whether a type is a generated struct, returned by pointer
+func isNamed(typ string) bool {
+	return typ != "" && typ[0] >= 'A' && typ[0] <= 'Z'
+}
+
+func returnType(typ string) string {
+	if isNamed(typ) {
+		return "*" + typ
+	}
+	return typ
+}
+
+func pointerTo(typ string) string {
+	if strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "*") || typ == "json.RawMessage" {
+		return typ
+	}
+	return "*" + typ
+}
+
+func zeroValue(typ string) string {
+	if isNamed(typ) {
+		return "nil"
+	}
+	return "out"
+}
+
+// pathExpr builds the request path, escaping path parameters
+func pathExpr(path string, params []parameter) string {
+	if len(params) == 0 {
+		return strconv.Quote(path)
+	}
+
+	format := path
+	var args []string
+	for _, p := range params {
+		format = strings.Replace(format, "{"+p.Name+"}", "%s", 1)
+		args = append(args, fmt.Sprintf("url.PathEscape(fmt.Sprint(%s))", lowerFirst(goName(p.Name))))
+	}
+	return fmt.Sprintf("fmt.Sprintf(%q, %s)", format, strings.Join(args, ", "))
+}
+
+// goName turns snake_case and camelCase names into exported Go names
+func goName(name string) string {
+	var out strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return r == '_' || r == '-' || r == '.' }) {
+		if initialism, ok := initialisms[strings.ToLower(word)]; ok {
+			out.WriteString(initialism)
+			continue
+		}
+		out.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return out.String()
+}
+
+func lowerFirst(name string) string {
+	if upper := strings.ToUpper(name); upper == name {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
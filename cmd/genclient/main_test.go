@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestClientIsUpToDate fails when client/client.go was not regenerated after openapi.json
+// changed, run go generate ./openapi
+func TestClientIsUpToDate(t *testing.T) {
+	raw, err := os.ReadFile("../../openapi/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := generate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile("../../client/client.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("client/client.go is out of date, run go generate ./openapi")
+	}
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidAttachment is returned when a message references an attachment the sender
+// did not upload or that is already part of another message
+var ErrInvalidAttachment = errors.New("attachment not found or already used")
+
+// AttachmentURL is where clients download an attachment
+func AttachmentURL(attachmentID int) string {
+	return fmt.Sprintf("/api/uploads/%d", attachmentID)
+}
+
+// linkAttachments assigns uploaded attachments to a freshly inserted message
+func linkAttachments(ctx context.Context, tx pgx.Tx, message *models.Message) error {
+	if len(message.AttachmentIDs) == 0 {
+		return nil
+	}
+
+	query := `UPDATE attachments SET message_id = $1
+	          WHERE id = ANY($2) AND uploader_id = $3 AND message_id IS NULL`
+	tag, err := tx.Exec(ctx, query, message.ID, message.AttachmentIDs, message.SenderID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != int64(len(message.AttachmentIDs)) {
+		return ErrInvalidAttachment
+	}
+	return nil
+}
+
+// MessageAttachments loads the attachments of a set of messages keyed by message id
+func MessageAttachments(ctx context.Context, messageIDs []int) (map[int][]models.Attachment, error) {
+	attachments := make(map[int][]models.Attachment)
+	if len(messageIDs) == 0 {
+		return attachments, nil
+	}
+
+	query := `SELECT id, message_id, filename, content_type, size_bytes, COALESCE(width, 0), COALESCE(height, 0), sha256, created_at
+	          FROM attachments
+	          WHERE message_id = ANY($1)
+	          ORDER BY id`
+	rows, err := DB.Query(ctx, query, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		var attachment models.Attachment
+		err := rows.Scan(&attachment.ID, &messageID, &attachment.Filename, &attachment.ContentType, &attachment.Size, &attachment.Width, &attachment.Height, &attachment.SHA256, &attachment.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		attachment.URL = AttachmentURL(attachment.ID)
+		attachments[messageID] = append(attachments[messageID], attachment)
+	}
+
+	return attachments, rows.Err()
+}
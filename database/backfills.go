@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Backfills move existing data after the schema changes. Unlike the schema migrations they
+// are not idempotent statements, each runs once and is recorded in data_migrations.
+var backfills = []struct {
+	name string
+	run  func(ctx context.Context, tx pgx.Tx) error
+}{
+	{"group_memberships_from_redis", backfillGroupMemberships},
+}
+
+// runBackfills applies the backfills that were not applied yet
+func runBackfills(ctx context.Context) error {
+	for _, backfill := range backfills {
+		if err := runBackfill(ctx, backfill.name, backfill.run); err != nil {
+			return fmt.Errorf("backfill %s: %w", backfill.name, err)
+		}
+	}
+	return nil
+}
+
+// runBackfill runs a backfill in a transaction that records it. Servers starting together wait
+// on the row of a running backfill, then skip it.
+func runBackfill(ctx context.Context, name string, run func(ctx context.Context, tx pgx.Tx) error) error {
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "INSERT INTO data_migrations (name) VALUES ($1) ON CONFLICT (name) DO NOTHING", name)
+	if err != nil || tag.RowsAffected() == 0 {
+		return err
+	}
+	if err = run(ctx, tx); err != nil {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	log.Println("Applied backfill", name)
+	return nil
+}
+
+// backfillGroupMemberships records the members that joined groups when memberships were kept
+// in the Redis group:<id> sets only, and makes the creators of groups their owners. The Redis
+// fan-out sets are then filled from Postgres, creators were never added to them.
+func backfillGroupMemberships(ctx context.Context, tx pgx.Tx) error {
+	query := `INSERT INTO group_memberships (user_id, group_id, role)
+	          SELECT creator_id, id, $1 FROM chat_groups WHERE creator_id IS NOT NULL AND removed_at IS NULL
+	          ON CONFLICT (user_id, group_id) DO NOTHING`
+	if _, err := tx.Exec(ctx, query, RoleOwner); err != nil {
+		return err
+	}
+
+	// Members of deleted users and groups are left behind
+	query = `INSERT INTO group_memberships (user_id, group_id, role)
+	         SELECT u.id, g.id, $3 FROM users u JOIN chat_groups g ON g.id = $2 AND g.removed_at IS NULL
+	         WHERE u.id = ANY($1)
+	         ON CONFLICT (user_id, group_id) DO NOTHING`
+	iter := RedisClient.ScanType(ctx, 0, "group:*", 100, "set").Iterator()
+	for iter.Next(ctx) {
+		groupID, err := strconv.Atoi(strings.TrimPrefix(iter.Val(), "group:"))
+		if err != nil {
+			continue
+		}
+
+		members, err := RedisClient.SMembers(ctx, iter.Val()).Result()
+		if err != nil {
+			return err
+		}
+		userIDs := make([]int, 0, len(members))
+		for _, member := range members {
+			if userID, err := strconv.Atoi(member); err == nil {
+				userIDs = append(userIDs, userID)
+			}
+		}
+
+		if _, err = tx.Exec(ctx, query, userIDs, groupID, RoleMember); err != nil {
+			return err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, `SELECT m.group_id, m.user_id FROM group_memberships m
+	                            JOIN chat_groups g ON g.id = m.group_id WHERE g.removed_at IS NULL`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	pipe := RedisClient.Pipeline()
+	for rows.Next() {
+		var groupID, userID int
+		if err = rows.Scan(&groupID, &userID); err != nil {
+			return err
+		}
+		pipe.SAdd(ctx, fmt.Sprintf("group:%d", groupID), userID)
+		pipe.SAdd(ctx, fmt.Sprintf("user_groups:%d", userID), groupID)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
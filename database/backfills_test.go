@@ -0,0 +1,70 @@
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+)
+
+func TestBackfillGroupMemberships(t *testing.T) {
+	redis := testenv.Postgres(t)
+	ctx := context.Background()
+
+	creator := testenv.CreateUser(t)
+	legacy := testenv.CreateUser(t)
+	var groupID int
+	query := `INSERT INTO chat_groups (name, creator_id, latitude, longitude, location)
+	          VALUES ($1, $2, 0, 0, ST_GeographyFromText('POINT(0 0)')) RETURNING id`
+	if err := database.DB.QueryRow(ctx, query, testenv.Name("group"), creator).Scan(&groupID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Members who joined before memberships moved to Postgres, next to keys that are no group
+	redis.SAdd(fmt.Sprintf("group:%d", groupID), fmt.Sprint(legacy), "not-a-user")
+	redis.SAdd("group:2147483647", fmt.Sprint(legacy))
+	redis.Set("group:notanid", "x")
+
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+	if err = database.BackfillGroupMemberships(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		userID int
+		want   string
+	}{
+		{"creator", creator, database.RoleOwner},
+		{"redis member", legacy, database.RoleMember},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, err := database.GroupRole(ctx, groupID, tt.userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if role != tt.want {
+				t.Errorf("role = %q, want %q", role, tt.want)
+			}
+
+			member, err := database.RedisClient.SIsMember(ctx, fmt.Sprintf("group:%d", groupID), tt.userID).Result()
+			if err != nil || !member {
+				t.Errorf("user is not in the fan-out set of the group: %v", err)
+			}
+			joined, err := database.RedisClient.SIsMember(ctx, fmt.Sprintf("user_groups:%d", tt.userID), groupID).Result()
+			if err != nil || !joined {
+				t.Errorf("group is not in the reverse index of the user: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// blockCacheTTL bounds how long a user's block list stays cached in Redis
+const blockCacheTTL = time.Hour
+
+// blockCacheSentinel keeps the cached set alive when a user has not blocked anyone,
+// so an empty block list is still a cache hit
+const blockCacheSentinel = "-"
+
+// blockCacheAttempts bounds how often a block list is loaded again when it changed while loading
+const blockCacheAttempts = 3
+
+func blockCacheKey(userID int) string {
+	return fmt.Sprintf("blocks:%d", userID)
+}
+
+// blockVersionKey changes whenever the block list of a user does. Deleting a cache key that is
+// not there does not abort the transactions watching it, bumping the version does.
+func blockVersionKey(userID int) string {
+	return fmt.Sprintf("blocks:%d:version", userID)
+}
+
+// BlockUser records that blocker no longer wants to hear from blocked
+func BlockUser(ctx context.Context, blockerID int, blockedID int) error {
+	query := `INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2)
+	          ON CONFLICT (blocker_id, blocked_id) DO NOTHING`
+	if _, err := DB.Exec(ctx, query, blockerID, blockedID); err != nil {
+		return err
+	}
+	return invalidateBlockCache(ctx, blockerID)
+}
+
+// UnblockUser removes a block, it reports whether there was one
+func UnblockUser(ctx context.Context, blockerID int, blockedID int) (bool, error) {
+	tag, err := DB.Exec(ctx, "DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2", blockerID, blockedID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, invalidateBlockCache(ctx, blockerID)
+}
+
+// invalidateBlockCache drops the cached block list of a user after it changed in Postgres
+func invalidateBlockCache(ctx context.Context, userID int) error {
+	pipe := RedisClient.TxPipeline()
+	pipe.Incr(ctx, blockVersionKey(userID))
+	pipe.Expire(ctx, blockVersionKey(userID), blockCacheTTL)
+	pipe.Del(ctx, blockCacheKey(userID))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// blockedIDs reads the users blocked by userID from Postgres
+var blockedIDs = func(ctx context.Context, userID int) ([]int, error) {
+	rows, err := DB.Query(ctx, "SELECT blocked_id FROM user_blocks WHERE blocker_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// loadBlockCache fills the Redis set of users blocked by userID unless it is already cached.
+// The set is written in a transaction watching the version of the block list, so a list read
+// before a concurrent BlockUser or UnblockUser is not cached over its invalidation.
+func loadBlockCache(ctx context.Context, userID int) error {
+	key := blockCacheKey(userID)
+	load := func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil || exists == 1 {
+			return err
+		}
+
+		ids, err := blockedIDs(ctx, userID)
+		if err != nil {
+			return err
+		}
+		members := []interface{}{blockCacheSentinel}
+		for _, id := range ids {
+			members = append(members, id)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.SAdd(ctx, key, members...)
+			pipe.Expire(ctx, key, blockCacheTTL)
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for range blockCacheAttempts {
+		err = RedisClient.Watch(ctx, load, key, blockVersionKey(userID))
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return err
+}
+
+// HasBlocked reports whether blocker has blocked the other user
+func HasBlocked(ctx context.Context, blockerID int, blockedID int) (bool, error) {
+	if err := loadBlockCache(ctx, blockerID); err != nil {
+		return false, err
+	}
+	return RedisClient.SIsMember(ctx, blockCacheKey(blockerID), strconv.Itoa(blockedID)).Result()
+}
+
+// IsBlocked reports whether either user has blocked the other
+func IsBlocked(ctx context.Context, userID int, otherID int) (bool, error) {
+	blocked, err := HasBlocked(ctx, userID, otherID)
+	if err != nil || blocked {
+		return blocked, err
+	}
+	return HasBlocked(ctx, otherID, userID)
+}
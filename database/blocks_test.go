@@ -0,0 +1,125 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestBlockCacheIsNotFilledWithStaleLists(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// load answers each query of the block list of user 1, the i-th one gets i
+		load        func(i int) ([]int, error)
+		wantBlocked []int
+		wantQueries int
+		wantErr     error
+	}{
+		{
+			name:        "unchanged list",
+			load:        func(i int) ([]int, error) { return []int{2}, nil },
+			wantBlocked: []int{2},
+			wantQueries: 1,
+		},
+		{
+			name: "blocked while loading",
+			load: func(i int) ([]int, error) {
+				if i == 0 {
+					// BlockUser commits and invalidates between the query and the cache write
+					if err := database.InvalidateBlockCache(ctx, 1); err != nil {
+						return nil, err
+					}
+					return []int{2}, nil
+				}
+				return []int{2, 3}, nil
+			},
+			wantBlocked: []int{2, 3},
+			wantQueries: 2,
+		},
+		{
+			name: "changing on every attempt",
+			load: func(i int) ([]int, error) {
+				return []int{2}, database.InvalidateBlockCache(ctx, 1)
+			},
+			wantQueries: 3,
+			wantErr:     redis.TxFailedErr,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testenv.Redis(t)
+
+			queries := 0
+			previous := *database.BlockedIDs
+			*database.BlockedIDs = func(ctx context.Context, userID int) ([]int, error) {
+				queries++
+				return tt.load(queries - 1)
+			}
+			t.Cleanup(func() { *database.BlockedIDs = previous })
+
+			for _, blockedID := range []int{2, 3, 4} {
+				blocked, err := database.HasBlocked(ctx, 1, blockedID)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("HasBlocked(1, %d) error = %v, want %v", blockedID, err, tt.wantErr)
+				}
+				if tt.wantErr != nil {
+					break
+				}
+				want := false
+				for _, id := range tt.wantBlocked {
+					want = want || id == blockedID
+				}
+				if blocked != want {
+					t.Errorf("HasBlocked(1, %d) = %t, want %t", blockedID, blocked, want)
+				}
+			}
+			if queries != tt.wantQueries {
+				t.Errorf("block list queried %d times, want %d", queries, tt.wantQueries)
+			}
+		})
+	}
+}
+
+func TestIsBlocked(t *testing.T) {
+	testenv.Postgres(t)
+	ctx := context.Background()
+
+	blocker := testenv.CreateUser(t)
+	blocked := testenv.CreateUser(t)
+	other := testenv.CreateUser(t)
+
+	check := func(step string, want bool) {
+		t.Helper()
+		for _, pair := range [][2]int{{blocker, blocked}, {blocked, blocker}} {
+			got, err := database.IsBlocked(ctx, pair[0], pair[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("%s: IsBlocked(%d, %d) = %t, want %t", step, pair[0], pair[1], got, want)
+			}
+		}
+		if got, err := database.IsBlocked(ctx, blocker, other); err != nil || got {
+			t.Errorf("%s: IsBlocked with an unrelated user = %t, %v", step, got, err)
+		}
+	}
+
+	// The first check caches both lists, changes must show through the cache
+	check("before blocking", false)
+	if err := database.BlockUser(ctx, blocker, blocked); err != nil {
+		t.Fatal(err)
+	}
+	check("blocked", true)
+
+	removed, err := database.UnblockUser(ctx, blocker, blocked)
+	if err != nil || !removed {
+		t.Fatalf("UnblockUser() = %t, %v", removed, err)
+	}
+	check("unblocked", false)
+}
@@ -0,0 +1,188 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrBotNotFound is returned when looking up a missing bot or an unknown token
+var ErrBotNotFound = errors.New("bot not found")
+
+// CreateBot creates the user row of a bot and the bot itself, it sets the id and creation time.
+// Only the hash of the bot's token is stored.
+func CreateBot(ctx context.Context, bot *models.Bot, tokenHash string) error {
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Bots have no location and are hidden from nearby searches
+	query := "INSERT INTO users (username, visible, is_bot) VALUES ($1, FALSE, TRUE) RETURNING id, created_at"
+	err = tx.QueryRow(ctx, query, bot.Username).Scan(&bot.ID, &bot.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	query = "INSERT INTO bots (id, owner_id, description, token_hash) VALUES ($1, $2, NULLIF($3, ''), $4)"
+	_, err = tx.Exec(ctx, query, bot.ID, bot.OwnerID, bot.Description, tokenHash)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+const botColumns = "b.id, u.username, COALESCE(b.description, ''), b.owner_id, b.created_at FROM bots b JOIN users u ON u.id = b.id"
+
+func scanBot(row pgx.Row) (models.Bot, error) {
+	var bot models.Bot
+	err := row.Scan(&bot.ID, &bot.Username, &bot.Description, &bot.OwnerID, &bot.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return bot, ErrBotNotFound
+	}
+	return bot, err
+}
+
+// GetBot loads a bot and its commands
+func GetBot(ctx context.Context, id int) (models.Bot, error) {
+	bot, err := scanBot(DB.QueryRow(ctx, "SELECT "+botColumns+" WHERE b.id = $1", id))
+	if err != nil {
+		return bot, err
+	}
+	bot.Commands, err = BotCommands(ctx, bot.ID)
+	return bot, err
+}
+
+// BotByTokenHash finds the bot a token belongs to, without its commands
+func BotByTokenHash(ctx context.Context, tokenHash string) (models.Bot, error) {
+	return scanBot(DB.QueryRow(ctx, "SELECT "+botColumns+" WHERE b.token_hash = $1", tokenHash))
+}
+
+// BotsByOwner lists the bots of a user with their commands
+func BotsByOwner(ctx context.Context, ownerID int) ([]models.Bot, error) {
+	rows, err := DB.Query(ctx, "SELECT "+botColumns+" WHERE b.owner_id = $1 ORDER BY b.id", ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bots := []models.Bot{}
+	for rows.Next() {
+		bot, err := scanBot(rows)
+		if err != nil {
+			return nil, err
+		}
+		bots = append(bots, bot)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range bots {
+		bots[i].Commands, err = BotCommands(ctx, bots[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bots, nil
+}
+
+// IsBot reports whether a user is a bot
+func IsBot(ctx context.Context, userID int) (bool, error) {
+	var isBot bool
+	err := DB.QueryRow(ctx, "SELECT is_bot FROM users WHERE id = $1", userID).Scan(&isBot)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return isBot, err
+}
+
+// SetBotToken replaces the token of a bot, the previous token stops working
+func SetBotToken(ctx context.Context, id int, tokenHash string) error {
+	_, err := DB.Exec(ctx, "UPDATE bots SET token_hash = $1 WHERE id = $2", tokenHash, id)
+	return err
+}
+
+// DeleteBot removes a bot, its user row, its memberships and its webhook
+func DeleteBot(ctx context.Context, id int) error {
+	rows, err := DB.Query(ctx, "SELECT group_id FROM group_memberships WHERE user_id = $1", id)
+	if err != nil {
+		return err
+	}
+	groupIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return err
+	}
+
+	// Leave the groups first so the Redis fan-out sets forget the bot
+	for _, groupID := range groupIDs {
+		if err = RemoveGroupMember(ctx, groupID, id); err != nil {
+			return err
+		}
+	}
+
+	_, err = DB.Exec(ctx, "DELETE FROM users WHERE id = $1 AND is_bot", id)
+	return err
+}
+
+// BotCommands lists the slash commands of a bot
+func BotCommands(ctx context.Context, botID int) ([]models.BotCommand, error) {
+	query := "SELECT name, COALESCE(description, ''), COALESCE(usage, '') FROM bot_commands WHERE bot_id = $1 ORDER BY name"
+	rows, err := DB.Query(ctx, query, botID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commands := []models.BotCommand{}
+	for rows.Next() {
+		var command models.BotCommand
+		if err = rows.Scan(&command.Name, &command.Description, &command.Usage); err != nil {
+			return nil, err
+		}
+		commands = append(commands, command)
+	}
+	return commands, rows.Err()
+}
+
+// SetBotCommands replaces the slash commands of a bot
+func SetBotCommands(ctx context.Context, botID int, commands []models.BotCommand) error {
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM bot_commands WHERE bot_id = $1", botID)
+	if err != nil {
+		return err
+	}
+
+	query := "INSERT INTO bot_commands (bot_id, name, description, usage) VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))"
+	for _, command := range commands {
+		_, err = tx.Exec(ctx, query, botID, command.Name, command.Description, command.Usage)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// CommandBots returns the bots of a group that registered a command. When botUsername is set,
+// as in /command@bot, only that bot is returned.
+func CommandBots(ctx context.Context, groupID int, name string, botUsername string) ([]int, error) {
+	query := `SELECT c.bot_id
+	          FROM bot_commands c
+	          JOIN group_memberships m ON m.user_id = c.bot_id AND m.group_id = $1
+	          JOIN users u ON u.id = c.bot_id
+	          WHERE c.name = $2 AND ($3 = '' OR LOWER(u.username) = LOWER($3))`
+	rows, err := DB.Query(ctx, query, groupID, name, botUsername)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
@@ -0,0 +1,8 @@
+package database
+
+// Unexported functions used by the tests of package database_test
+var BackfillGroupMemberships = backfillGroupMemberships
+
+// BlockedIDs replaces the Postgres query of loadBlockCache
+var BlockedIDs = &blockedIDs
+var InvalidateBlockCache = invalidateBlockCache
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// filterSettingsTTL bounds how long group filter settings stay cached in Redis
+const filterSettingsTTL = time.Hour
+
+func filterSettingsKey(groupID int) string {
+	return fmt.Sprintf("group_filters:%d", groupID)
+}
+
+// GroupFilterSettings returns the filter overrides of a group, groups without overrides get empty settings.
+// Settings are read for every group message so they are cached in Redis.
+func GroupFilterSettings(ctx context.Context, groupID int) (models.GroupFilterSettings, error) {
+	settings := models.GroupFilterSettings{GroupID: groupID, BlockedWords: []string{}, AllowedDomains: []string{}, DeniedDomains: []string{}}
+
+	cached, err := RedisClient.Get(ctx, filterSettingsKey(groupID)).Bytes()
+	if err == nil {
+		err = json.Unmarshal(cached, &settings)
+		return settings, err
+	}
+	if !errors.Is(err, redis.Nil) {
+		return settings, err
+	}
+
+	query := `SELECT max_length, blocked_words, COALESCE(word_action, ''), links_allowed, allowed_domains, denied_domains, updated_at
+	          FROM group_filter_settings WHERE group_id = $1`
+	err = DB.QueryRow(ctx, query, groupID).Scan(&settings.MaxLength, &settings.BlockedWords, &settings.WordAction, &settings.LinksAllowed, &settings.AllowedDomains, &settings.DeniedDomains, &settings.UpdatedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return settings, err
+	}
+
+	encoded, err := json.Marshal(settings)
+	if err != nil {
+		return settings, err
+	}
+	return settings, RedisClient.Set(ctx, filterSettingsKey(groupID), encoded, filterSettingsTTL).Err()
+}
+
+// SaveGroupFilterSettings replaces the filter overrides of a group
+func SaveGroupFilterSettings(ctx context.Context, settings *models.GroupFilterSettings) error {
+	query := `INSERT INTO group_filter_settings (group_id, max_length, blocked_words, word_action, links_allowed, allowed_domains, denied_domains)
+	          VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)
+	          ON CONFLICT (group_id) DO UPDATE
+	          SET max_length = EXCLUDED.max_length, blocked_words = EXCLUDED.blocked_words, word_action = EXCLUDED.word_action,
+	              links_allowed = EXCLUDED.links_allowed, allowed_domains = EXCLUDED.allowed_domains,
+	              denied_domains = EXCLUDED.denied_domains, updated_at = NOW()
+	          RETURNING updated_at`
+	err := DB.QueryRow(ctx, query, settings.GroupID, settings.MaxLength, settings.BlockedWords, settings.WordAction, settings.LinksAllowed, settings.AllowedDomains, settings.DeniedDomains).Scan(&settings.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return RedisClient.Del(ctx, filterSettingsKey(settings.GroupID)).Err()
+}
@@ -0,0 +1,258 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// Group membership roles
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+var (
+	// ErrNotGroupMember is returned when a user is not a member of a group
+	ErrNotGroupMember = errors.New("not a member of the group")
+
+	// ErrGroupOwner is returned when the owner of a group tries to leave it
+	ErrGroupOwner = errors.New("the group owner cannot leave the group")
+
+	// ErrNicknameTaken is returned when a nickname is the username or nickname of another member
+	ErrNicknameTaken = errors.New("nickname already used in the group")
+)
+
+// Membership is what a group knows about one of its members
+type Membership struct {
+	Role       string
+	Nickname   string
+	MutedUntil *time.Time
+}
+
+// Muted reports whether the member may not post to the group right now
+func (m Membership) Muted() bool {
+	return m.MutedUntil != nil && m.MutedUntil.After(time.Now())
+}
+
+// AddGroupMember records a membership in Postgres and in the Redis sets used for fan-out
+func AddGroupMember(ctx context.Context, groupID int, userID int, role string) error {
+	query := `INSERT INTO group_memberships (user_id, group_id, role) VALUES ($1, $2, $3)
+	          ON CONFLICT (user_id, group_id) DO NOTHING`
+	_, err := DB.Exec(ctx, query, userID, groupID, role)
+	if err != nil {
+		return err
+	}
+
+	err = RedisClient.SAdd(ctx, fmt.Sprintf("group:%d", groupID), userID).Err()
+	if err != nil {
+		return err
+	}
+
+	// Keep a reverse index so presence updates can reach fellow group members
+	return RedisClient.SAdd(ctx, fmt.Sprintf("user_groups:%d", userID), groupID).Err()
+}
+
+// RemoveGroupMember deletes a membership from Postgres and from the Redis fan-out sets
+func RemoveGroupMember(ctx context.Context, groupID int, userID int) error {
+	_, err := DB.Exec(ctx, "DELETE FROM group_memberships WHERE group_id = $1 AND user_id = $2", groupID, userID)
+	if err != nil {
+		return err
+	}
+
+	err = RedisClient.SRem(ctx, fmt.Sprintf("group:%d", groupID), userID).Err()
+	if err != nil {
+		return err
+	}
+	return RedisClient.SRem(ctx, fmt.Sprintf("user_groups:%d", userID), groupID).Err()
+}
+
+// GroupRole returns the role of a user in a group, or an empty string if they are not a member.
+// Groups removed by an admin have no members.
+func GroupRole(ctx context.Context, groupID int, userID int) (string, error) {
+	var role string
+	query := `SELECT m.role FROM group_memberships m
+	          JOIN chat_groups g ON g.id = m.group_id AND g.removed_at IS NULL
+	          WHERE m.group_id = $1 AND m.user_id = $2`
+	err := DB.QueryRow(ctx, query, groupID, userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
+
+// IsGroupMember reports whether a user joined a group
+func IsGroupMember(ctx context.Context, groupID int, userID int) (bool, error) {
+	role, err := GroupRole(ctx, groupID, userID)
+	return role != "", err
+}
+
+// IsGroupModerator reports whether a user may moderate a group
+func IsGroupModerator(ctx context.Context, groupID int, userID int) (bool, error) {
+	role, err := GroupRole(ctx, groupID, userID)
+	if err != nil {
+		return false, err
+	}
+	return role == RoleOwner || role == RoleModerator, nil
+}
+
+// GroupMembership loads the membership of a user, its role is empty if they are not a member
+// or the group was removed
+func GroupMembership(ctx context.Context, groupID int, userID int) (Membership, error) {
+	var membership Membership
+	query := `SELECT m.role, COALESCE(m.nickname, ''), m.muted_until FROM group_memberships m
+	          JOIN chat_groups g ON g.id = m.group_id AND g.removed_at IS NULL
+	          WHERE m.group_id = $1 AND m.user_id = $2`
+	err := DB.QueryRow(ctx, query, groupID, userID).Scan(&membership.Role, &membership.Nickname, &membership.MutedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return membership, nil
+	}
+	return membership, err
+}
+
+// LeaveGroup removes a member other than the owner from a group and returns the role they had
+func LeaveGroup(ctx context.Context, groupID int, userID int) (string, error) {
+	role, err := GroupRole(ctx, groupID, userID)
+	if err != nil {
+		return "", err
+	}
+	if role == "" {
+		return "", ErrNotGroupMember
+	}
+
+	// Groups keep their owner
+	if role == RoleOwner {
+		return role, ErrGroupOwner
+	}
+	return role, RemoveGroupMember(ctx, groupID, userID)
+}
+
+// FindGroupMember looks up a member of a group by username or nickname, ignoring case.
+// A member whose username matches wins over one whose nickname does.
+func FindGroupMember(ctx context.Context, groupID int, name string) (int, Membership, error) {
+	var userID int
+	var membership Membership
+	query := `SELECT m.user_id, m.role, COALESCE(m.nickname, ''), m.muted_until
+	          FROM group_memberships m
+	          JOIN users u ON u.id = m.user_id
+	          WHERE m.group_id = $1 AND (LOWER(u.username) = LOWER($2) OR LOWER(m.nickname) = LOWER($2))
+	          ORDER BY LOWER(u.username) = LOWER($2) DESC
+	          LIMIT 1`
+	err := DB.QueryRow(ctx, query, groupID, name).Scan(&userID, &membership.Role, &membership.Nickname, &membership.MutedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, membership, ErrNotGroupMember
+	}
+	return userID, membership, err
+}
+
+// DisplayName returns the nickname of a user in a group, or their username outside of groups
+// and when they have no nickname
+func DisplayName(ctx context.Context, userID int, groupID int) (string, error) {
+	var name string
+	query := `SELECT COALESCE(m.nickname, u.username)
+	          FROM users u
+	          LEFT JOIN group_memberships m ON m.user_id = u.id AND m.group_id = $2
+	          WHERE u.id = $1`
+	err := DB.QueryRow(ctx, query, userID, groupID).Scan(&name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	return name, err
+}
+
+// SetGroupNickname sets the nickname of a member, an empty nickname clears it
+func SetGroupNickname(ctx context.Context, groupID int, userID int, nickname string) error {
+	if nickname != "" {
+		var taken bool
+		query := `SELECT EXISTS (
+		            SELECT 1 FROM group_memberships m JOIN users u ON u.id = m.user_id
+		            WHERE m.group_id = $1 AND m.user_id != $2
+		            AND (LOWER(u.username) = LOWER($3) OR LOWER(m.nickname) = LOWER($3)))`
+		err := DB.QueryRow(ctx, query, groupID, userID, nickname).Scan(&taken)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrNicknameTaken
+		}
+	}
+
+	query := "UPDATE group_memberships SET nickname = NULLIF($3, '') WHERE group_id = $1 AND user_id = $2"
+	tag, err := DB.Exec(ctx, query, groupID, userID, nickname)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotGroupMember
+	}
+	return nil
+}
+
+// MuteGroupMember stops a member from posting to a group until a time, nil lifts the mute
+func MuteGroupMember(ctx context.Context, groupID int, userID int, until *time.Time) error {
+	query := "UPDATE group_memberships SET muted_until = $3 WHERE group_id = $1 AND user_id = $2"
+	tag, err := DB.Exec(ctx, query, groupID, userID, until)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotGroupMember
+	}
+	return nil
+}
+
+// GroupName returns the name of a group
+func GroupName(ctx context.Context, groupID int) (string, error) {
+	var name string
+	err := DB.QueryRow(ctx, "SELECT name FROM chat_groups WHERE id = $1", groupID).Scan(&name)
+	return name, err
+}
+
+// GroupTopic returns the topic of a group, empty when none was set
+func GroupTopic(ctx context.Context, groupID int) (string, error) {
+	var topic string
+	err := DB.QueryRow(ctx, "SELECT COALESCE(topic, '') FROM chat_groups WHERE id = $1", groupID).Scan(&topic)
+	return topic, err
+}
+
+// SetGroupTopic replaces the topic of a group, an empty topic clears it
+func SetGroupTopic(ctx context.Context, groupID int, topic string) error {
+	_, err := DB.Exec(ctx, "UPDATE chat_groups SET topic = NULLIF($2, '') WHERE id = $1", groupID, topic)
+	return err
+}
+
+// NearbyGroupMembers lists the online and visible members of a group within radius kilometers
+// of a user, nearest first. Members who blocked the user or were blocked by them are left out,
+// and users without a location see no one.
+func NearbyGroupMembers(ctx context.Context, groupID int, userID int, radius int, limit int) ([]models.NearbyMember, error) {
+	query := `SELECT u.id, COALESCE(m.nickname, u.username), m.role, ST_Distance(u.location, me.location) / 1000
+	          FROM group_memberships m
+	          JOIN users u ON u.id = m.user_id
+	          JOIN users me ON me.id = $2
+	          WHERE m.group_id = $1 AND u.id != $2 AND u.visible = TRUE AND u.online = TRUE
+	          AND ST_DWithin(u.location, me.location, $3 * 1000)
+	          AND u.id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = $2)
+	          AND u.id NOT IN (SELECT blocker_id FROM user_blocks WHERE blocked_id = $2)
+	          ORDER BY 4
+	          LIMIT $4`
+	rows, err := DB.Query(ctx, query, groupID, userID, radius, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.NearbyMember{}
+	for rows.Next() {
+		var member models.NearbyMember
+		if err = rows.Scan(&member.UserID, &member.Name, &member.Role, &member.DistanceKm); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
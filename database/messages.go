@@ -0,0 +1,268 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidReply is returned when a reply or thread references a message from another conversation
+var ErrInvalidReply = errors.New("referenced message is not part of this conversation")
+
+// ErrDuplicateMessage is returned by InsertMessage when the sender already stored a message
+// under the same client_msg_id, the message is then replaced by the stored one
+var ErrDuplicateMessage = errors.New("message already sent")
+
+// previewLength is the number of characters quoted from the message being replied to
+const previewLength = 100
+
+// InsertMessage stores a message and, for direct messages, the receipt row of its recipient.
+// Zero group or receiver ids are stored as NULL so the messages CHECK constraint holds.
+// Replies get the preview of the quoted message filled in and attachments are linked to the message.
+func InsertMessage(ctx context.Context, message *models.Message) error {
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := resolveReplyReferences(ctx, tx, message); err != nil {
+		return err
+	}
+
+	// A conflicting client_msg_id inserts nothing, the sender is retrying a message already stored
+	query := `INSERT INTO messages (group_id, receiver_id, sender_id, content, reply_to_id, thread_root_id, client_msg_id)
+	          VALUES (NULLIF($1, 0), NULLIF($2, 0), $3, $4, NULLIF($5, 0), NULLIF($6, 0), NULLIF($7, ''))
+	          ON CONFLICT (sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL DO NOTHING
+	          RETURNING id, created_at`
+	err = tx.QueryRow(ctx, query, message.GroupID, message.ReceiverID, message.SenderID, message.Content, message.ReplyToID, message.ThreadRootID, message.ClientMsgID).Scan(&message.ID, &message.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		tx.Rollback(ctx)
+		stored, err := MessageByClientID(ctx, message.SenderID, message.ClientMsgID)
+		if err != nil {
+			return err
+		}
+		*message = stored
+		return ErrDuplicateMessage
+	}
+	if err != nil {
+		return err
+	}
+
+	if message.ReceiverID != 0 {
+		_, err = tx.Exec(ctx, "INSERT INTO message_receipts (message_id, user_id) VALUES ($1, $2)", message.ID, message.ReceiverID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := linkAttachments(ctx, tx, message); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	return loadMessageReferences(ctx, message)
+}
+
+// MessageByClientID loads the message a sender stored under a client_msg_id,
+// it returns pgx.ErrNoRows when there is none
+func MessageByClientID(ctx context.Context, senderID int, clientMsgID string) (models.Message, error) {
+	var message models.Message
+	query := `SELECT id, sender_id, COALESCE(receiver_id, 0), COALESCE(group_id, 0), content, COALESCE(reply_to_id, 0),
+	                 COALESCE(thread_root_id, 0), client_msg_id, edited_at, deleted_at IS NOT NULL, created_at
+	          FROM messages WHERE sender_id = $1 AND client_msg_id = $2`
+	err := DB.QueryRow(ctx, query, senderID, clientMsgID).Scan(&message.ID, &message.SenderID, &message.ReceiverID, &message.GroupID, &message.Content, &message.ReplyToID,
+		&message.ThreadRootID, &message.ClientMsgID, &message.EditedAt, &message.Deleted, &message.CreatedAt)
+	if err != nil {
+		return message, err
+	}
+	if message.Deleted {
+		message.Content = models.DeletedMessageContent
+	}
+
+	attachments, err := MessageAttachments(ctx, []int{message.ID})
+	if err != nil {
+		return message, err
+	}
+	for _, attachment := range attachments[message.ID] {
+		message.AttachmentIDs = append(message.AttachmentIDs, attachment.ID)
+	}
+
+	return message, loadMessageReferences(ctx, &message)
+}
+
+// loadMessageReferences fills in the attachments and the reply preview of a stored message
+func loadMessageReferences(ctx context.Context, message *models.Message) error {
+	if len(message.AttachmentIDs) > 0 {
+		attachments, err := MessageAttachments(ctx, []int{message.ID})
+		if err != nil {
+			return err
+		}
+		message.Attachments = attachments[message.ID]
+	}
+
+	if message.ReplyToID != 0 {
+		previews, err := ReplyPreviews(ctx, []int{message.ReplyToID})
+		if err != nil {
+			return err
+		}
+		message.ReplyTo = previews[message.ReplyToID]
+	}
+
+	return nil
+}
+
+// resolveReplyReferences checks that the quoted message and the thread root belong to the
+// same conversation as the new message. Threads are flat: replying inside a thread, or
+// naming a reply as the root, attaches the message to the thread's original root.
+func resolveReplyReferences(ctx context.Context, tx pgx.Tx, message *models.Message) error {
+	lookup := func(id int) (int, error) {
+		var receiverID, groupID, senderID, threadRootID int
+		query := `SELECT COALESCE(receiver_id, 0), COALESCE(group_id, 0), sender_id, COALESCE(thread_root_id, 0)
+		          FROM messages WHERE id = $1`
+		err := tx.QueryRow(ctx, query, id).Scan(&receiverID, &groupID, &senderID, &threadRootID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidReply
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		var sameConversation bool
+		if message.GroupID != 0 {
+			sameConversation = groupID == message.GroupID
+		} else {
+			sameConversation = groupID == 0 &&
+				(senderID == message.SenderID && receiverID == message.ReceiverID ||
+					senderID == message.ReceiverID && receiverID == message.SenderID)
+		}
+		if !sameConversation {
+			return 0, ErrInvalidReply
+		}
+		return threadRootID, nil
+	}
+
+	if message.ReplyToID != 0 {
+		threadRootID, err := lookup(message.ReplyToID)
+		if err != nil {
+			return err
+		}
+		// Quoting a thread reply keeps the new message in that thread
+		if message.ThreadRootID == 0 {
+			message.ThreadRootID = threadRootID
+		}
+	}
+
+	if message.ThreadRootID != 0 {
+		threadRootID, err := lookup(message.ThreadRootID)
+		if err != nil {
+			return err
+		}
+		if threadRootID != 0 {
+			message.ThreadRootID = threadRootID
+		}
+	}
+
+	return nil
+}
+
+// ReplyPreviews loads the quoted previews of a set of messages keyed by message id
+func ReplyPreviews(ctx context.Context, messageIDs []int) (map[int]*models.ReplyPreview, error) {
+	previews := make(map[int]*models.ReplyPreview)
+	if len(messageIDs) == 0 {
+		return previews, nil
+	}
+
+	query := "SELECT id, sender_id, content, deleted_at IS NOT NULL FROM messages WHERE id = ANY($1)"
+	rows, err := DB.Query(ctx, query, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var preview models.ReplyPreview
+		if err := rows.Scan(&preview.ID, &preview.SenderID, &preview.Content, &preview.Deleted); err != nil {
+			return nil, err
+		}
+
+		if preview.Deleted {
+			preview.Content = models.DeletedMessageContent
+		} else if runes := []rune(preview.Content); len(runes) > previewLength {
+			preview.Content = string(runes[:previewLength]) + "…"
+		}
+		previews[preview.ID] = &preview
+	}
+
+	return previews, rows.Err()
+}
+
+// ThreadReplyCounts counts the visible replies of each thread root
+func ThreadReplyCounts(ctx context.Context, rootIDs []int) (map[int]int, error) {
+	counts := make(map[int]int)
+	if len(rootIDs) == 0 {
+		return counts, nil
+	}
+
+	query := `SELECT thread_root_id, COUNT(*) FROM messages
+	          WHERE thread_root_id = ANY($1) AND deleted_at IS NULL
+	          GROUP BY thread_root_id`
+	rows, err := DB.Query(ctx, query, rootIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rootID, count int
+		if err := rows.Scan(&rootID, &count); err != nil {
+			return nil, err
+		}
+		counts[rootID] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// DirectUnreadCounts counts the unread direct messages of a user by sender, leaving out deleted
+// messages and messages from users they blocked
+func DirectUnreadCounts(ctx context.Context, userID int) (map[int]int, error) {
+	query := `SELECT m.sender_id, COUNT(*)
+	          FROM message_receipts r
+	          JOIN messages m ON m.id = r.message_id
+	          WHERE r.user_id = $1 AND r.read_at IS NULL AND m.deleted_at IS NULL
+	            AND m.sender_id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = $1)
+	          GROUP BY m.sender_id`
+	rows, err := DB.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var senderID, count int
+		if err := rows.Scan(&senderID, &count); err != nil {
+			return nil, err
+		}
+		counts[senderID] = count
+	}
+	return counts, rows.Err()
+}
+
+// GroupUnreadCount counts the group messages from other members past the user's read pointer.
+// Deleted messages and messages from senders the user blocked are left out, like in the history.
+func GroupUnreadCount(ctx context.Context, groupID int, userID int) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM messages
+	          WHERE group_id = $1 AND sender_id != $2 AND deleted_at IS NULL
+	            AND sender_id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = $2)
+	            AND id > COALESCE((SELECT last_read_message_id FROM group_read_pointers WHERE group_id = $1 AND user_id = $2), 0)`
+	err := DB.QueryRow(ctx, query, groupID, userID).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,308 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/jackc/pgx/v5"
+)
+
+func TestGroupUnreadCount(t *testing.T) {
+	testenv.Postgres(t)
+	ctx := context.Background()
+
+	reader := testenv.CreateUser(t)
+	friend := testenv.CreateUser(t)
+	blocked := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, friend)
+	for _, userID := range []int{reader, blocked} {
+		if err := database.AddGroupMember(ctx, groupID, userID, database.RoleMember); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.BlockUser(ctx, reader, blocked); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(senderID int, deleted bool) int {
+		var id int
+		query := `INSERT INTO messages (sender_id, group_id, content, deleted_at)
+		          VALUES ($1, $2, 'hello', CASE WHEN $3 THEN NOW() END) RETURNING id`
+		if err := database.DB.QueryRow(ctx, query, senderID, groupID, deleted).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	read := post(friend, false)
+	post(friend, false)
+	post(friend, true)
+	post(blocked, false)
+	post(reader, false)
+
+	tests := []struct {
+		name     string
+		readUpTo int
+		want     int
+	}{
+		{"nothing read", 0, 2},
+		{"first message read", read, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.readUpTo != 0 {
+				query := `INSERT INTO group_read_pointers (group_id, user_id, last_read_message_id) VALUES ($1, $2, $3)
+				          ON CONFLICT (group_id, user_id) DO UPDATE SET last_read_message_id = EXCLUDED.last_read_message_id`
+				if _, err := database.DB.Exec(ctx, query, groupID, reader, tt.readUpTo); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := database.GroupUnreadCount(ctx, groupID, reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("GroupUnreadCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertMessageDeduplicates(t *testing.T) {
+	testenv.Postgres(t)
+	ctx := context.Background()
+
+	sender := testenv.CreateUser(t)
+	other := testenv.CreateUser(t)
+	receiver := testenv.CreateUser(t)
+
+	first := models.Message{SenderID: sender, ReceiverID: receiver, Content: "hello", ClientMsgID: "retry-1"}
+	if err := database.InsertMessage(ctx, &first); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		message models.Message
+		wantDup bool
+	}{
+		{"retry", models.Message{SenderID: sender, ReceiverID: receiver, Content: "hello again", ClientMsgID: "retry-1"}, true},
+		{"new client id", models.Message{SenderID: sender, ReceiverID: receiver, Content: "hello", ClientMsgID: "retry-2"}, false},
+		{"same client id, other sender", models.Message{SenderID: other, ReceiverID: receiver, Content: "hello", ClientMsgID: "retry-1"}, false},
+		{"no client id", models.Message{SenderID: sender, ReceiverID: receiver, Content: "hello"}, false},
+		{"no client id again", models.Message{SenderID: sender, ReceiverID: receiver, Content: "hello"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := tt.message
+			err := database.InsertMessage(ctx, &message)
+			if tt.wantDup {
+				if !errors.Is(err, database.ErrDuplicateMessage) {
+					t.Fatalf("InsertMessage() error = %v, want ErrDuplicateMessage", err)
+				}
+				if message.ID != first.ID || message.Content != first.Content || !message.CreatedAt.Equal(first.CreatedAt) {
+					t.Errorf("duplicate = %+v, want the stored message %+v", message, first)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if message.ID == first.ID || message.CreatedAt.IsZero() {
+				t.Errorf("message = %+v, want a new message", message)
+			}
+		})
+	}
+
+	if _, err := database.MessageByClientID(ctx, sender, "unknown"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("MessageByClientID() error = %v, want pgx.ErrNoRows", err)
+	}
+}
+
+func TestInsertMessageReplies(t *testing.T) {
+	testenv.Postgres(t)
+	ctx := context.Background()
+
+	alice := testenv.CreateUser(t)
+	bob := testenv.CreateUser(t)
+	carol := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, alice)
+
+	insert := func(message models.Message) models.Message {
+		t.Helper()
+		if err := database.InsertMessage(ctx, &message); err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+	root := insert(models.Message{SenderID: alice, ReceiverID: bob, Content: "root"})
+	inThread := insert(models.Message{SenderID: bob, ReceiverID: alice, Content: "first reply", ThreadRootID: root.ID})
+	other := insert(models.Message{SenderID: alice, ReceiverID: carol, Content: "other chat"})
+	groupMessage := insert(models.Message{SenderID: alice, GroupID: groupID, Content: "group"})
+
+	tests := []struct {
+		name           string
+		message        models.Message
+		wantErr        error
+		wantThreadRoot int
+		wantQuote      int
+	}{
+		{"quote", models.Message{SenderID: bob, ReceiverID: alice, Content: "quote", ReplyToID: root.ID}, nil, 0, root.ID},
+		{"thread reply", models.Message{SenderID: bob, ReceiverID: alice, Content: "reply", ThreadRootID: root.ID}, nil, root.ID, 0},
+		{"reply naming a reply as the root", models.Message{SenderID: alice, ReceiverID: bob, Content: "nested", ThreadRootID: inThread.ID}, nil, root.ID, 0},
+		{"quote of a thread reply", models.Message{SenderID: alice, ReceiverID: bob, Content: "quoted reply", ReplyToID: inThread.ID}, nil, root.ID, inThread.ID},
+		{"quote in a group", models.Message{SenderID: alice, GroupID: groupID, Content: "group quote", ReplyToID: groupMessage.ID}, nil, 0, groupMessage.ID},
+		{"quote from another chat", models.Message{SenderID: bob, ReceiverID: alice, Content: "leak", ReplyToID: other.ID}, database.ErrInvalidReply, 0, 0},
+		{"thread of another chat", models.Message{SenderID: bob, ReceiverID: alice, Content: "leak", ThreadRootID: other.ID}, database.ErrInvalidReply, 0, 0},
+		{"direct message quoting a group", models.Message{SenderID: alice, ReceiverID: bob, Content: "leak", ReplyToID: groupMessage.ID}, database.ErrInvalidReply, 0, 0},
+		{"group quoting a direct message", models.Message{SenderID: alice, GroupID: groupID, Content: "leak", ReplyToID: root.ID}, database.ErrInvalidReply, 0, 0},
+		{"unknown message", models.Message{SenderID: bob, ReceiverID: alice, Content: "ghost", ReplyToID: other.ID + 1000000}, database.ErrInvalidReply, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := tt.message
+			err := database.InsertMessage(ctx, &message)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("InsertMessage() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if message.ThreadRootID != tt.wantThreadRoot {
+				t.Errorf("ThreadRootID = %d, want %d", message.ThreadRootID, tt.wantThreadRoot)
+			}
+			if tt.wantQuote == 0 {
+				if message.ReplyTo != nil {
+					t.Errorf("ReplyTo = %+v, want none", message.ReplyTo)
+				}
+				return
+			}
+			if message.ReplyTo == nil || message.ReplyTo.ID != tt.wantQuote {
+				t.Errorf("ReplyTo = %+v, want the preview of message %d", message.ReplyTo, tt.wantQuote)
+			}
+		})
+	}
+}
+
+func TestReplyPreviewsAndThreadCounts(t *testing.T) {
+	testenv.Postgres(t)
+	ctx := context.Background()
+
+	sender := testenv.CreateUser(t)
+	receiver := testenv.CreateUser(t)
+
+	post := func(content string, threadRootID int, deleted bool) int {
+		var id int
+		query := `INSERT INTO messages (sender_id, receiver_id, content, thread_root_id, deleted_at)
+		          VALUES ($1, $2, $3, NULLIF($4, 0), CASE WHEN $5 THEN NOW() END) RETURNING id`
+		if err := database.DB.QueryRow(ctx, query, sender, receiver, content, threadRootID, deleted).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	long := strings.Repeat("ü", 150)
+	short := post("short", 0, false)
+	shortened := post(long, 0, false)
+	deleted := post("secret", 0, true)
+	quiet := post("no replies", 0, false)
+	post("reply", short, false)
+	post("reply", short, false)
+	post("deleted reply", short, true)
+	post("reply", shortened, false)
+
+	previews, err := database.ReplyPreviews(ctx, []int{short, shortened, deleted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		id          int
+		wantContent string
+		wantDeleted bool
+	}{
+		{"short", short, "short", false},
+		{"shortened", shortened, strings.Repeat("ü", 100) + "…", false},
+		{"deleted", deleted, models.DeletedMessageContent, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preview := previews[tt.id]
+			if preview == nil || preview.SenderID != sender || preview.Content != tt.wantContent || preview.Deleted != tt.wantDeleted {
+				t.Errorf("preview = %+v, want %q deleted %v", preview, tt.wantContent, tt.wantDeleted)
+			}
+		})
+	}
+
+	counts, err := database.ThreadReplyCounts(ctx, []int{short, shortened, quiet})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[short] != 2 || counts[shortened] != 1 || counts[quiet] != 0 {
+		t.Errorf("ThreadReplyCounts() = %v, want 2 visible replies of %d and 1 of %d", counts, short, shortened)
+	}
+}
+
+func TestDirectUnreadCounts(t *testing.T) {
+	testenv.Postgres(t)
+	ctx := context.Background()
+
+	reader := testenv.CreateUser(t)
+	friend := testenv.CreateUser(t)
+	blocked := testenv.CreateUser(t)
+	quiet := testenv.CreateUser(t)
+	if err := database.BlockUser(ctx, reader, blocked); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(senderID int) models.Message {
+		message := models.Message{SenderID: senderID, ReceiverID: reader, Content: "hello"}
+		if err := database.InsertMessage(ctx, &message); err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+	read := send(friend)
+	send(friend)
+	deleted := send(friend)
+	send(blocked)
+	send(quiet)
+	if _, err := database.DB.Exec(ctx, "UPDATE messages SET deleted_at = NOW() WHERE id = $1", deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.DB.Exec(ctx, "UPDATE message_receipts SET read_at = NOW() WHERE message_id = $1 AND user_id = $2", read.ID, reader); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := database.DirectUnreadCounts(ctx, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		senderID int
+		want     int
+	}{
+		{"read and deleted messages left out", friend, 1},
+		{"blocked sender", blocked, 0},
+		{"unread message", quiet, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := counts[tt.senderID]; got != tt.want {
+				t.Errorf("unread from user %d = %d, want %d", tt.senderID, got, tt.want)
+			}
+		})
+	}
+	if len(counts) != 2 {
+		t.Errorf("DirectUnreadCounts() = %v, want two senders", counts)
+	}
+}
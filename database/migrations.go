@@ -57,6 +57,242 @@ func RunMigrations() {
 				(receiver_id IS NULL AND group_id IS NOT NULL) -- Ensures a message is either direct OR group-based
 			)
 		);`,
+
+		// Direct Message Receipts Table (one row per recipient)
+		`CREATE TABLE IF NOT EXISTS message_receipts (
+			message_id INT REFERENCES messages(id) ON DELETE CASCADE,
+			user_id INT REFERENCES users(id) ON DELETE CASCADE,
+			delivered_at TIMESTAMP,
+			read_at TIMESTAMP,
+			PRIMARY KEY (message_id, user_id)
+		);`,
+
+		// Group Read Pointers Table (last message each member has read)
+		`CREATE TABLE IF NOT EXISTS group_read_pointers (
+			group_id INT REFERENCES chat_groups(id) ON DELETE CASCADE,
+			user_id INT REFERENCES users(id) ON DELETE CASCADE,
+			last_read_message_id INT NOT NULL DEFAULT 0,
+			updated_at TIMESTAMP DEFAULT NOW(),
+			PRIMARY KEY (group_id, user_id)
+		);`,
+
+		// Group roles, moderators and owners may remove messages
+		`ALTER TABLE group_memberships ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'member';`,
+
+		// Message edits and soft-delete tombstones
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP;`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;`,
+
+		// Message Edit History Table (previous contents of edited messages)
+		`CREATE TABLE IF NOT EXISTS message_edits (
+			id SERIAL PRIMARY KEY,
+			message_id INT REFERENCES messages(id) ON DELETE CASCADE,
+			content TEXT NOT NULL,
+			edited_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		// Message Reactions Table (one row per user and emoji)
+		`CREATE TABLE IF NOT EXISTS message_reactions (
+			message_id INT REFERENCES messages(id) ON DELETE CASCADE,
+			user_id INT REFERENCES users(id) ON DELETE CASCADE,
+			emoji VARCHAR(32) NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW(),
+			PRIMARY KEY (message_id, user_id, emoji)
+		);`,
+
+		// Quote replies and threads
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS reply_to_id INT REFERENCES messages(id) ON DELETE SET NULL;`,
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS thread_root_id INT REFERENCES messages(id) ON DELETE CASCADE;`,
+		`CREATE INDEX IF NOT EXISTS messages_thread_root_id_idx ON messages (thread_root_id);`,
+
+		// Attachments Table (uploaded files, linked to a message once it is sent)
+		`CREATE TABLE IF NOT EXISTS attachments (
+			id SERIAL PRIMARY KEY,
+			uploader_id INT REFERENCES users(id) ON DELETE CASCADE,
+			message_id INT REFERENCES messages(id) ON DELETE CASCADE,
+			storage_key VARCHAR(255) NOT NULL,
+			filename VARCHAR(255) NOT NULL,
+			content_type VARCHAR(100) NOT NULL,
+			size_bytes BIGINT NOT NULL,
+			width INT,
+			height INT,
+			sha256 CHAR(64) NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		);`,
+		`CREATE INDEX IF NOT EXISTS attachments_message_id_idx ON attachments (message_id);`,
+
+		// Full-text search over message content, the simple configuration avoids
+		// language specific stemming since nearby users may write in any language
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS content_tsv tsvector
+			GENERATED ALWAYS AS (to_tsvector('simple', content)) STORED;`,
+		`CREATE INDEX IF NOT EXISTS messages_content_tsv_idx ON messages USING GIN (content_tsv);`,
+
+		// User Blocks Table
+		`CREATE TABLE IF NOT EXISTS user_blocks (
+			blocker_id INT REFERENCES users(id) ON DELETE CASCADE,
+			blocked_id INT REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMP DEFAULT NOW(),
+			PRIMARY KEY (blocker_id, blocked_id),
+			CHECK (blocker_id <> blocked_id)
+		);`,
+		`CREATE INDEX IF NOT EXISTS user_blocks_blocked_id_idx ON user_blocks (blocked_id);`,
+
+		// Abuse Reports Table (moderation queue)
+		`CREATE TABLE IF NOT EXISTS reports (
+			id SERIAL PRIMARY KEY,
+			reporter_id INT REFERENCES users(id) ON DELETE SET NULL,
+			target_type VARCHAR(20) NOT NULL CHECK (target_type IN ('message', 'user', 'group')),
+			target_id INT NOT NULL,
+			reason VARCHAR(50) NOT NULL,
+			details TEXT,
+			status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'triaged', 'resolved', 'dismissed')),
+			resolution TEXT,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW(),
+			resolved_at TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS reports_status_idx ON reports (status, created_at);`,
+		// A user can only have one pending report per target
+		`CREATE UNIQUE INDEX IF NOT EXISTS reports_pending_unique_idx ON reports (reporter_id, target_type, target_id)
+			WHERE status IN ('open', 'triaged');`,
+
+		// Account sanctions and removed groups
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS muted_until TIMESTAMP;`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_until TIMESTAMP;`,
+		`ALTER TABLE chat_groups ADD COLUMN IF NOT EXISTS removed_at TIMESTAMP;`,
+
+		// Moderation Audit Log Table (every moderation action, never updated)
+		`CREATE TABLE IF NOT EXISTS moderation_actions (
+			id SERIAL PRIMARY KEY,
+			moderator VARCHAR(100) NOT NULL,
+			action VARCHAR(30) NOT NULL,
+			target_type VARCHAR(20) NOT NULL,
+			target_id INT NOT NULL,
+			report_id INT REFERENCES reports(id) ON DELETE SET NULL,
+			reason TEXT,
+			expires_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		// Group Filter Settings Table (per-group overrides of the message filters, NULL keeps the default)
+		`CREATE TABLE IF NOT EXISTS group_filter_settings (
+			group_id INT PRIMARY KEY REFERENCES chat_groups(id) ON DELETE CASCADE,
+			max_length INT CHECK (max_length > 0),
+			blocked_words TEXT[] NOT NULL DEFAULT '{}',
+			word_action VARCHAR(10) CHECK (word_action IN ('mask', 'reject')),
+			links_allowed BOOLEAN,
+			allowed_domains TEXT[] NOT NULL DEFAULT '{}',
+			denied_domains TEXT[] NOT NULL DEFAULT '{}',
+			updated_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		// Client message ids make retried sends idempotent per sender
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS client_msg_id VARCHAR(64);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS messages_client_msg_id_idx ON messages (sender_id, client_msg_id)
+			WHERE client_msg_id IS NOT NULL;`,
+
+		// Webhooks Table (group_id is NULL for server wide webhooks)
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id SERIAL PRIMARY KEY,
+			group_id INT REFERENCES chat_groups(id) ON DELETE CASCADE,
+			url TEXT NOT NULL,
+			secret VARCHAR(100) NOT NULL,
+			events TEXT[] NOT NULL,
+			created_by INT REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		// Webhook Deliveries Table (one row per event and webhook, retried until delivered or dead)
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id SERIAL PRIMARY KEY,
+			webhook_id INT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+			event VARCHAR(30) NOT NULL,
+			payload JSONB NOT NULL,
+			status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'dead')),
+			attempts INT NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP DEFAULT NOW(),
+			last_status_code INT,
+			last_error TEXT,
+			created_at TIMESTAMP DEFAULT NOW(),
+			delivered_at TIMESTAMP
+		);`,
+		`CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at)
+			WHERE status = 'pending';`,
+		`CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, created_at DESC);`,
+
+		// Webhook Dead Letters Table (deliveries that ran out of attempts, kept after the webhook is deleted)
+		`CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+			id SERIAL PRIMARY KEY,
+			delivery_id INT NOT NULL,
+			webhook_id INT NOT NULL,
+			url TEXT NOT NULL,
+			event VARCHAR(30) NOT NULL,
+			payload JSONB NOT NULL,
+			attempts INT NOT NULL,
+			last_status_code INT,
+			last_error TEXT,
+			created_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		// Bots Table (a bot posts as its user row, which has no location)
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`CREATE TABLE IF NOT EXISTS bots (
+			id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			owner_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			description TEXT,
+			token_hash VARCHAR(64) UNIQUE NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW()
+		);`,
+
+		// Bot Commands Table (slash commands registered by bots)
+		`CREATE TABLE IF NOT EXISTS bot_commands (
+			bot_id INT REFERENCES bots(id) ON DELETE CASCADE,
+			name VARCHAR(32) NOT NULL,
+			description VARCHAR(200),
+			usage VARCHAR(200),
+			PRIMARY KEY (bot_id, name)
+		);`,
+		`CREATE INDEX IF NOT EXISTS bot_commands_name_idx ON bot_commands (name);`,
+
+		// Bot webhooks receive the events of the groups their bot joined
+		`ALTER TABLE webhooks ADD COLUMN IF NOT EXISTS bot_id INT REFERENCES bots(id) ON DELETE CASCADE;`,
+
+		// Group chat commands: nicknames and mutes within a group, and the group topic
+		`ALTER TABLE group_memberships ADD COLUMN IF NOT EXISTS nickname VARCHAR(30);`,
+		`ALTER TABLE group_memberships ADD COLUMN IF NOT EXISTS muted_until TIMESTAMP;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS group_memberships_nickname_idx ON group_memberships (group_id, LOWER(nickname))
+			WHERE nickname IS NOT NULL;`,
+		`ALTER TABLE chat_groups ADD COLUMN IF NOT EXISTS topic VARCHAR(200);`,
+
+		// Push Tokens Table (one token per device, a token moving to another device or user is reassigned)
+		`CREATE TABLE IF NOT EXISTS push_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			device_id VARCHAR(64) NOT NULL,
+			platform VARCHAR(10) NOT NULL CHECK (platform IN ('fcm', 'apns')),
+			token VARCHAR(4096) UNIQUE NOT NULL,
+			created_at TIMESTAMP DEFAULT NOW(),
+			updated_at TIMESTAMP DEFAULT NOW(),
+			UNIQUE (user_id, device_id)
+		);`,
+
+		// Notification Settings Table (quiet hours are times of day in the user's time zone)
+		`CREATE TABLE IF NOT EXISTS notification_settings (
+			user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			quiet_hours_start VARCHAR(5),
+			quiet_hours_end VARCHAR(5),
+			time_zone VARCHAR(64) NOT NULL DEFAULT 'UTC'
+		);`,
+
+		// Members mute the push notifications of a group, for a while or until they unmute it
+		`ALTER TABLE group_memberships ADD COLUMN IF NOT EXISTS push_muted BOOLEAN NOT NULL DEFAULT FALSE;`,
+		`ALTER TABLE group_memberships ADD COLUMN IF NOT EXISTS push_muted_until TIMESTAMP;`,
+
+		// Backfills applied once, see backfills.go
+		`CREATE TABLE IF NOT EXISTS data_migrations (
+			name VARCHAR(100) PRIMARY KEY,
+			applied_at TIMESTAMP DEFAULT NOW()
+		);`,
 	}
 
 	DB.Exec(ctx, `CREATE EXTENSION IF NOT EXISTS postgis;`)
@@ -69,5 +305,9 @@ func RunMigrations() {
 		}
 	}
 
+	if err := runBackfills(ctx); err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+
 	log.Println("Migrations applied successfully.")
 }
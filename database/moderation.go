@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrUserNotFound is returned when looking up the restrictions of a missing user
+var ErrUserNotFound = errors.New("user not found")
+
+// Restrictions are the moderation sanctions currently applied to a user
+type Restrictions struct {
+	MutedUntil     *time.Time
+	SuspendedUntil *time.Time
+}
+
+// Muted reports whether the user may not post messages right now
+func (r Restrictions) Muted() bool {
+	return r.MutedUntil != nil && r.MutedUntil.After(time.Now())
+}
+
+// Suspended reports whether the user may not use their account right now
+func (r Restrictions) Suspended() bool {
+	return r.SuspendedUntil != nil && r.SuspendedUntil.After(time.Now())
+}
+
+// UserRestrictions loads the sanctions of a user
+func UserRestrictions(ctx context.Context, userID int) (Restrictions, error) {
+	var restrictions Restrictions
+	query := "SELECT muted_until, suspended_until FROM users WHERE id = $1"
+	err := DB.QueryRow(ctx, query, userID).Scan(&restrictions.MutedUntil, &restrictions.SuspendedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return restrictions, ErrUserNotFound
+	}
+	return restrictions, err
+}
+
+// LogModerationAction appends an action to the audit log
+func LogModerationAction(ctx context.Context, tx pgx.Tx, action *models.ModerationAction) error {
+	query := `INSERT INTO moderation_actions (moderator, action, target_type, target_id, report_id, reason, expires_at)
+	          VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+	          RETURNING id, created_at`
+	return tx.QueryRow(ctx, query, action.Moderator, action.Action, action.TargetType, action.TargetID, action.ReportID, action.Reason, action.ExpiresAt).Scan(&action.ID, &action.CreatedAt)
+}
@@ -0,0 +1,36 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+)
+
+func TestRestrictions(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name          string
+		restrictions  database.Restrictions
+		wantMuted     bool
+		wantSuspended bool
+	}{
+		{"none", database.Restrictions{}, false, false},
+		{"muted", database.Restrictions{MutedUntil: &future}, true, false},
+		{"mute expired", database.Restrictions{MutedUntil: &past}, false, false},
+		{"suspended", database.Restrictions{SuspendedUntil: &future}, false, true},
+		{"suspension expired", database.Restrictions{SuspendedUntil: &past, MutedUntil: &future}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.restrictions.Muted(); got != tt.wantMuted {
+				t.Errorf("Muted() = %t, want %t", got, tt.wantMuted)
+			}
+			if got := tt.restrictions.Suspended(); got != tt.wantSuspended {
+				t.Errorf("Suspended() = %t, want %t", got, tt.wantSuspended)
+			}
+		})
+	}
+}
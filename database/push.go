@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// pushUsersKey is the Redis set of users with at least one push token, so messages for users
+// who cannot receive notifications are not queued for them
+const pushUsersKey = "push_users"
+
+// ErrPushTokenNotFound is returned when deleting a token that was not registered
+var ErrPushTokenNotFound = errors.New("push token not found")
+
+// SavePushToken registers the token of a device, replacing the previous token of the device.
+// A token registered by another device or user before moves to this one.
+func SavePushToken(ctx context.Context, token *models.PushToken) error {
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := "DELETE FROM push_tokens WHERE token = $1 OR (user_id = $2 AND device_id = $3) RETURNING user_id"
+	rows, err := tx.Query(ctx, query, token.Token, token.UserID, token.DeviceID)
+	if err != nil {
+		return err
+	}
+	previousOwners, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO push_tokens (user_id, device_id, platform, token) VALUES ($1, $2, $3, $4)
+	         RETURNING id, created_at, updated_at`
+	err = tx.QueryRow(ctx, query, token.UserID, token.DeviceID, token.Platform, token.Token).Scan(&token.ID, &token.CreatedAt, &token.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	if err = RedisClient.SAdd(ctx, pushUsersKey, token.UserID).Err(); err != nil {
+		return err
+	}
+	for _, userID := range previousOwners {
+		if userID != token.UserID {
+			if err = forgetPushUser(ctx, userID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// forgetPushUser drops a user from the push users once their last token is gone
+func forgetPushUser(ctx context.Context, userID int) error {
+	var remaining bool
+	err := DB.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM push_tokens WHERE user_id = $1)", userID).Scan(&remaining)
+	if err != nil || remaining {
+		return err
+	}
+	return RedisClient.SRem(ctx, pushUsersKey, userID).Err()
+}
+
+// PushTokens lists the tokens of a user
+func PushTokens(ctx context.Context, userID int) ([]models.PushToken, error) {
+	query := `SELECT id, user_id, device_id, platform, token, created_at, updated_at
+	          FROM push_tokens WHERE user_id = $1 ORDER BY id`
+	rows, err := DB.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []models.PushToken{}
+	for rows.Next() {
+		var token models.PushToken
+		err = rows.Scan(&token.ID, &token.UserID, &token.DeviceID, &token.Platform, &token.Token, &token.CreatedAt, &token.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// DeletePushToken removes the token of a device
+func DeletePushToken(ctx context.Context, userID int, deviceID string) error {
+	tag, err := DB.Exec(ctx, "DELETE FROM push_tokens WHERE user_id = $1 AND device_id = $2", userID, deviceID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPushTokenNotFound
+	}
+	return forgetPushUser(ctx, userID)
+}
+
+// DiscardPushToken removes a token the push platform no longer accepts
+func DiscardPushToken(ctx context.Context, userID int, token string) error {
+	_, err := DB.Exec(ctx, "DELETE FROM push_tokens WHERE user_id = $1 AND token = $2", userID, token)
+	if err != nil {
+		return err
+	}
+	return forgetPushUser(ctx, userID)
+}
+
+// HasPushTokens reports whether a user registered a push token, the answer comes from Redis
+func HasPushTokens(ctx context.Context, userID int) (bool, error) {
+	return RedisClient.SIsMember(ctx, pushUsersKey, userID).Result()
+}
+
+// GetNotificationSettings loads the push preferences of a user, users who never saved theirs
+// have no quiet hours
+func GetNotificationSettings(ctx context.Context, userID int) (models.NotificationSettings, error) {
+	settings := models.NotificationSettings{UserID: userID, TimeZone: "UTC"}
+	query := `SELECT COALESCE(quiet_hours_start, ''), COALESCE(quiet_hours_end, ''), time_zone
+	          FROM notification_settings WHERE user_id = $1`
+	err := DB.QueryRow(ctx, query, userID).Scan(&settings.QuietHoursStart, &settings.QuietHoursEnd, &settings.TimeZone)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return settings, nil
+	}
+	return settings, err
+}
+
+// SaveNotificationSettings replaces the push preferences of a user
+func SaveNotificationSettings(ctx context.Context, settings models.NotificationSettings) error {
+	query := `INSERT INTO notification_settings (user_id, quiet_hours_start, quiet_hours_end, time_zone)
+	          VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4)
+	          ON CONFLICT (user_id) DO UPDATE
+	          SET quiet_hours_start = EXCLUDED.quiet_hours_start, quiet_hours_end = EXCLUDED.quiet_hours_end, time_zone = EXCLUDED.time_zone`
+	_, err := DB.Exec(ctx, query, settings.UserID, settings.QuietHoursStart, settings.QuietHoursEnd, settings.TimeZone)
+	return err
+}
+
+// GetGroupNotificationSettings loads whether a member muted the notifications of a group.
+// Mutes that expired are reported as unmuted.
+func GetGroupNotificationSettings(ctx context.Context, groupID int, userID int) (models.GroupNotificationSettings, error) {
+	settings := models.GroupNotificationSettings{GroupID: groupID, UserID: userID}
+	query := `SELECT push_muted AND (push_muted_until IS NULL OR push_muted_until > NOW()), push_muted_until
+	          FROM group_memberships WHERE group_id = $1 AND user_id = $2`
+	err := DB.QueryRow(ctx, query, groupID, userID).Scan(&settings.Muted, &settings.MutedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return settings, ErrNotGroupMember
+	}
+	if !settings.Muted {
+		settings.MutedUntil = nil
+	}
+	return settings, err
+}
+
+// MuteGroupNotifications mutes the notifications of a group for a member until a time, or until
+// they unmute it when until is nil. Unmuting clears both.
+func MuteGroupNotifications(ctx context.Context, groupID int, userID int, muted bool, until *time.Time) error {
+	if !muted {
+		until = nil
+	}
+	query := "UPDATE group_memberships SET push_muted = $3, push_muted_until = $4 WHERE group_id = $1 AND user_id = $2"
+	tag, err := DB.Exec(ctx, query, groupID, userID, muted, until)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotGroupMember
+	}
+	return nil
+}
+
+// PushMutedGroups returns the groups whose notifications a user muted right now
+func PushMutedGroups(ctx context.Context, userID int) ([]int, error) {
+	query := `SELECT group_id FROM group_memberships
+	          WHERE user_id = $1 AND push_muted AND (push_muted_until IS NULL OR push_muted_until > NOW())`
+	rows, err := DB.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Username returns the display name of a user
+func Username(ctx context.Context, userID int) (string, error) {
+	var username string
+	err := DB.QueryRow(ctx, "SELECT username FROM users WHERE id = $1", userID).Scan(&username)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	return username, err
+}
+
+// IsOnline reports whether a user has a connected device, on any server
+func IsOnline(ctx context.Context, userID int) (bool, error) {
+	var online bool
+	err := DB.QueryRow(ctx, "SELECT COALESCE(online, FALSE) FROM users WHERE id = $1", userID).Scan(&online)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrUserNotFound
+	}
+	return online, err
+}
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrWebhookNotFound is returned when looking up a missing webhook
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// CreateWebhook stores a webhook and sets its id and creation time
+func CreateWebhook(ctx context.Context, hook *models.Webhook) error {
+	query := `INSERT INTO webhooks (group_id, bot_id, url, secret, events, created_by)
+	          VALUES ($1, $2, $3, $4, $5, $6)
+	          RETURNING id, created_at`
+	return DB.QueryRow(ctx, query, hook.GroupID, hook.BotID, hook.URL, hook.Secret, hook.Events, hook.CreatedBy).Scan(&hook.ID, &hook.CreatedAt)
+}
+
+// Webhooks lists the webhooks of a group, or the server wide webhooks when groupID is nil.
+// Bot webhooks and secrets are left out.
+func Webhooks(ctx context.Context, groupID *int) ([]models.Webhook, error) {
+	query := `SELECT id, group_id, bot_id, url, events, created_by, created_at
+	          FROM webhooks
+	          WHERE group_id IS NOT DISTINCT FROM $1 AND bot_id IS NULL
+	          ORDER BY id`
+	rows, err := DB.Query(ctx, query, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []models.Webhook{}
+	for rows.Next() {
+		var hook models.Webhook
+		err = rows.Scan(&hook.ID, &hook.GroupID, &hook.BotID, &hook.URL, &hook.Events, &hook.CreatedBy, &hook.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// GetWebhook loads a webhook without its secret
+func GetWebhook(ctx context.Context, id int) (models.Webhook, error) {
+	return scanWebhook(ctx, "id = $1", id)
+}
+
+// BotWebhook loads the webhook of a bot without its secret
+func BotWebhook(ctx context.Context, botID int) (models.Webhook, error) {
+	return scanWebhook(ctx, "bot_id = $1", botID)
+}
+
+func scanWebhook(ctx context.Context, condition string, arg int) (models.Webhook, error) {
+	var hook models.Webhook
+	query := "SELECT id, group_id, bot_id, url, events, created_by, created_at FROM webhooks WHERE " + condition
+	err := DB.QueryRow(ctx, query, arg).Scan(&hook.ID, &hook.GroupID, &hook.BotID, &hook.URL, &hook.Events, &hook.CreatedBy, &hook.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return hook, ErrWebhookNotFound
+	}
+	return hook, err
+}
+
+// DeleteWebhook removes a webhook and its pending deliveries, dead letters are kept
+func DeleteWebhook(ctx context.Context, id int) error {
+	_, err := DB.Exec(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	return err
+}
+
+// WebhookDeliveries returns the delivery log of a webhook, newest first, optionally filtered by status
+func WebhookDeliveries(ctx context.Context, webhookID int, status string, limit int, offset int) ([]models.WebhookDelivery, error) {
+	query := `SELECT id, webhook_id, event, status, attempts, CASE WHEN status = 'pending' THEN next_attempt_at END,
+	                 COALESCE(last_status_code, 0), COALESCE(last_error, ''), created_at, delivered_at
+	          FROM webhook_deliveries
+	          WHERE webhook_id = $1 AND ($2 = '' OR status = $2)
+	          ORDER BY created_at DESC, id DESC
+	          LIMIT $3 OFFSET $4`
+	rows, err := DB.Query(ctx, query, webhookID, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt,
+			&delivery.LastStatusCode, &delivery.LastError, &delivery.CreatedAt, &delivery.DeliveredAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// EnqueueWebhookDeliveries queues a payload for every webhook subscribed to the event: the server
+// wide webhooks and, when groupID is not zero, the webhooks of that group and of the bots in it.
+// It returns the number of deliveries queued.
+func EnqueueWebhookDeliveries(ctx context.Context, event string, groupID int, payload []byte) (int64, error) {
+	query := `INSERT INTO webhook_deliveries (webhook_id, event, payload)
+	          SELECT id, $1, $2 FROM webhooks
+	          WHERE $1 = ANY(events) AND (
+	              (group_id IS NULL AND bot_id IS NULL)
+	              OR group_id = NULLIF($3, 0)
+	              OR bot_id IN (SELECT user_id FROM group_memberships WHERE group_id = NULLIF($3, 0))
+	          )`
+	tag, err := DB.Exec(ctx, query, event, payload, groupID)
+	return tag.RowsAffected(), err
+}
+
+// EnqueueBotWebhookDelivery queues a payload for the webhook of a bot if it subscribed to the event
+func EnqueueBotWebhookDelivery(ctx context.Context, event string, botID int, payload []byte) (int64, error) {
+	query := `INSERT INTO webhook_deliveries (webhook_id, event, payload)
+	          SELECT id, $1, $2 FROM webhooks
+	          WHERE $1 = ANY(events) AND bot_id = $3`
+	tag, err := DB.Exec(ctx, query, event, payload, botID)
+	return tag.RowsAffected(), err
+}
+
+// PendingDelivery is a delivery claimed by a webhook worker
+type PendingDelivery struct {
+	ID       int
+	URL      string
+	Secret   string
+	Event    string
+	Payload  []byte
+	Attempts int
+}
+
+// ClaimWebhookDeliveries takes up to limit due deliveries and counts the attempt. The deliveries
+// are not due again before the lease expires, so concurrent workers skip them.
+func ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]PendingDelivery, error) {
+	query := `UPDATE webhook_deliveries d
+	          SET attempts = d.attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+	          FROM webhooks h
+	          WHERE h.id = d.webhook_id AND d.id IN (
+	              SELECT id FROM webhook_deliveries
+	              WHERE status = 'pending' AND next_attempt_at <= NOW()
+	              ORDER BY next_attempt_at
+	              LIMIT $1
+	              FOR UPDATE SKIP LOCKED
+	          )
+	          RETURNING d.id, h.url, h.secret, d.event, d.payload::text, d.attempts`
+	rows, err := DB.Query(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []PendingDelivery
+	for rows.Next() {
+		var delivery PendingDelivery
+		var payload string
+		err = rows.Scan(&delivery.ID, &delivery.URL, &delivery.Secret, &delivery.Event, &payload, &delivery.Attempts)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = []byte(payload)
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// CompleteWebhookDelivery marks a delivery as delivered
+func CompleteWebhookDelivery(ctx context.Context, id int, statusCode int) error {
+	query := `UPDATE webhook_deliveries
+	          SET status = 'delivered', delivered_at = NOW(), last_status_code = $2, last_error = NULL
+	          WHERE id = $1`
+	_, err := DB.Exec(ctx, query, id, statusCode)
+	return err
+}
+
+// RetryWebhookDelivery records a failed attempt and schedules the next one after delay
+func RetryWebhookDelivery(ctx context.Context, id int, statusCode int, lastError string, delay time.Duration) error {
+	query := `UPDATE webhook_deliveries
+	          SET next_attempt_at = NOW() + make_interval(secs => $4), last_status_code = NULLIF($2, 0), last_error = $3
+	          WHERE id = $1`
+	_, err := DB.Exec(ctx, query, id, statusCode, lastError, delay.Seconds())
+	return err
+}
+
+// KillWebhookDelivery records the last failed attempt of a delivery and copies it to the dead letters
+func KillWebhookDelivery(ctx context.Context, id int, statusCode int, lastError string) error {
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE webhook_deliveries
+	          SET status = 'dead', last_status_code = NULLIF($2, 0), last_error = $3
+	          WHERE id = $1`
+	_, err = tx.Exec(ctx, query, id, statusCode, lastError)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO webhook_dead_letters (delivery_id, webhook_id, url, event, payload, attempts, last_status_code, last_error)
+	         SELECT d.id, d.webhook_id, h.url, d.event, d.payload, d.attempts, d.last_status_code, d.last_error
+	         FROM webhook_deliveries d JOIN webhooks h ON h.id = d.webhook_id
+	         WHERE d.id = $1`
+	_, err = tx.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,89 @@
+package filters
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/clementus360/proxy-chat/models"
+)
+
+// linkPattern finds links with a scheme or a www. prefix. Bare domains are not matched
+// because ordinary text such as file names would be mistaken for links.
+var linkPattern = regexp.MustCompile(`(?i)(?:https?://([^\s/?#:]+)|\b(www\.[a-z0-9-]+(?:\.[a-z0-9-]+)+))`)
+
+// wordPatterns caches the compiled pattern of each blocked word list
+var wordPatterns sync.Map
+
+// wordPattern matches any of the words as a whole word, ignoring case
+func wordPattern(words []string) *regexp.Regexp {
+	key := strings.Join(words, "\x00")
+	if pattern, ok := wordPatterns.Load(key); ok {
+		return pattern.(*regexp.Regexp)
+	}
+
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	pattern := regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	wordPatterns.Store(key, pattern)
+	return pattern
+}
+
+// filterLength rejects messages longer than the policy allows, counted in characters
+func filterLength(ctx context.Context, msg *Message, policy *Policy) error {
+	if utf8.RuneCountInString(msg.Content) > policy.MaxLength {
+		return &Rejection{Code: CodeMessageTooLong, Reason: fmt.Sprintf("Messages are limited to %d characters", policy.MaxLength)}
+	}
+	return nil
+}
+
+// filterWords masks blocked words with asterisks or rejects the message
+func filterWords(ctx context.Context, msg *Message, policy *Policy) error {
+	if len(policy.BlockedWords) == 0 {
+		return nil
+	}
+
+	pattern := wordPattern(policy.BlockedWords)
+	if !pattern.MatchString(msg.Content) {
+		return nil
+	}
+
+	if policy.WordAction == models.WordActionReject {
+		return &Rejection{Code: CodeBlockedWord, Reason: "Message contains a blocked word"}
+	}
+	msg.Content = pattern.ReplaceAllStringFunc(msg.Content, func(word string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	})
+	return nil
+}
+
+// filterLinks enforces the domain lists. Denied domains are always refused,
+// when links are not allowed only the allowed domains get through.
+func filterLinks(ctx context.Context, msg *Message, policy *Policy) error {
+	for _, match := range linkPattern.FindAllStringSubmatch(msg.Content, -1) {
+		host := strings.ToLower(match[1] + match[2])
+
+		if matchesDomain(host, policy.DeniedDomains) {
+			return &Rejection{Code: CodeBlockedLink, Reason: fmt.Sprintf("Links to %s are not allowed", host)}
+		}
+		if !policy.LinksAllowed && !matchesDomain(host, policy.AllowedDomains) {
+			return &Rejection{Code: CodeBlockedLink, Reason: "Links are not allowed here"}
+		}
+	}
+	return nil
+}
+
+// matchesDomain reports whether host is one of the domains or a subdomain of one
+func matchesDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
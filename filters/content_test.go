@@ -0,0 +1,141 @@
+package filters
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/models"
+)
+
+// rejectionCode returns the code of a rejection, or "" when the message went through
+func rejectionCode(t *testing.T, err error) string {
+	t.Helper()
+
+	if err == nil {
+		return ""
+	}
+	var rejection *Rejection
+	if !errors.As(err, &rejection) {
+		t.Fatalf("error = %v, want a *Rejection", err)
+	}
+	return rejection.Code
+}
+
+func TestFilterLength(t *testing.T) {
+	policy := &Policy{MaxLength: 5}
+
+	tests := []struct {
+		content  string
+		wantCode string
+	}{
+		{"hello", ""},
+		{"héllo", ""},
+		{"👋👋👋👋👋", ""},
+		{"hello!", CodeMessageTooLong},
+	}
+	for _, tt := range tests {
+		msg := &Message{Content: tt.content}
+		if got := rejectionCode(t, filterLength(context.Background(), msg, policy)); got != tt.wantCode {
+			t.Errorf("filterLength(%q) = %q, want %q", tt.content, got, tt.wantCode)
+		}
+	}
+}
+
+func TestFilterWords(t *testing.T) {
+	tests := []struct {
+		name        string
+		words       []string
+		action      string
+		content     string
+		wantContent string
+		wantCode    string
+	}{
+		{"no blocked words", nil, models.WordActionMask, "darn it", "darn it", ""},
+		{"masked", []string{"darn"}, models.WordActionMask, "darn it", "**** it", ""},
+		{"masked ignoring case", []string{"darn"}, models.WordActionMask, "Darn, DARN!", "****, ****!", ""},
+		{"whole words only", []string{"ass"}, models.WordActionMask, "a classic assessment", "a classic assessment", ""},
+		{"masked in characters", []string{"zut"}, models.WordActionMask, "zut alors", "*** alors", ""},
+		{"words with metacharacters", []string{"a.b"}, models.WordActionMask, "a.b axb", "*** axb", ""},
+		{"rejected", []string{"darn"}, models.WordActionReject, "darn it", "darn it", CodeBlockedWord},
+		{"clean message with reject", []string{"darn"}, models.WordActionReject, "hello", "hello", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &Message{Content: tt.content}
+			err := filterWords(context.Background(), msg, &Policy{BlockedWords: tt.words, WordAction: tt.action})
+			if got := rejectionCode(t, err); got != tt.wantCode {
+				t.Errorf("code = %q, want %q", got, tt.wantCode)
+			}
+			if msg.Content != tt.wantContent {
+				t.Errorf("content = %q, want %q", msg.Content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestFilterLinks(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		content  string
+		wantCode string
+	}{
+		{"links allowed", Policy{LinksAllowed: true}, "see https://example.com/page", ""},
+		{"denied domain", Policy{LinksAllowed: true, DeniedDomains: []string{"evil.com"}}, "see https://evil.com", CodeBlockedLink},
+		{"denied subdomain", Policy{LinksAllowed: true, DeniedDomains: []string{"evil.com"}}, "see http://www.EVIL.com/x", CodeBlockedLink},
+		{"lookalike domain", Policy{LinksAllowed: true, DeniedDomains: []string{"evil.com"}}, "see https://notevil.com", ""},
+		{"www link denied", Policy{LinksAllowed: true, DeniedDomains: []string{"evil.com"}}, "go to www.evil.com now", CodeBlockedLink},
+		{"links not allowed", Policy{}, "see https://example.com", CodeBlockedLink},
+		{"allowed domain", Policy{AllowedDomains: []string{"example.com"}}, "see https://docs.example.com:443/a", ""},
+		{"one link outside the allowed domains", Policy{AllowedDomains: []string{"example.com"}}, "https://example.com and https://other.org", CodeBlockedLink},
+		{"file names are not links", Policy{}, "open report.pdf", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := filterLinks(context.Background(), &Message{Content: tt.content}, &tt.policy)
+			if got := rejectionCode(t, err); got != tt.wantCode {
+				t.Errorf("code = %q, want %q", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	previousChain, previousDefaults := chain, defaults
+	t.Cleanup(func() { chain, defaults = previousChain, previousDefaults })
+
+	defaults = Policy{MaxLength: 20, BlockedWords: []string{"darn"}, WordAction: models.WordActionMask, LinksAllowed: true}
+	chain = []MessageFilter{FilterFunc(filterLength), FilterFunc(filterWords)}
+
+	// Registered filters run after the built in ones and see the rewritten content
+	var seen string
+	Register(FilterFunc(func(ctx context.Context, msg *Message, policy *Policy) error {
+		seen = msg.Content
+		if strings.Contains(msg.Content, "forbidden") {
+			return &Rejection{Code: "custom", Reason: "Custom rejection"}
+		}
+		return nil
+	}))
+
+	tests := []struct {
+		content     string
+		wantContent string
+		wantCode    string
+	}{
+		{"darn it", "**** it", ""},
+		{"forbidden", "forbidden", "custom"},
+		{"far too long for the limit", "", CodeMessageTooLong},
+	}
+	for _, tt := range tests {
+		seen = ""
+		msg := &Message{Content: tt.content}
+		if got := rejectionCode(t, Run(context.Background(), msg)); got != tt.wantCode {
+			t.Errorf("Run(%q) code = %q, want %q", tt.content, got, tt.wantCode)
+		}
+		if seen != tt.wantContent {
+			t.Errorf("Run(%q) passed %q to the registered filter, want %q", tt.content, seen, tt.wantContent)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package filters
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/config"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/models"
+)
+
+// Rejection codes, sent to clients in error frames
+const (
+	CodeMessageTooLong = apierror.CodeMessageTooLong
+	CodeBlockedWord    = apierror.CodeBlockedWord
+	CodeBlockedLink    = apierror.CodeBlockedLink
+	CodeDuplicate      = apierror.CodeDuplicate
+	CodeFlooding       = apierror.CodeFlooding
+)
+
+// Rejection is returned by a filter that refuses a message
+type Rejection struct {
+	Code   string
+	Reason string
+}
+
+func (r *Rejection) Error() string {
+	return r.Reason
+}
+
+// Message is the part of an outgoing message the filters look at.
+// Filters may rewrite Content, for instance to mask blocked words.
+type Message struct {
+	SenderID   int
+	GroupID    int
+	ReceiverID int
+	Content    string
+	// Edit is set when an existing message is edited, the spam heuristics skip edits
+	Edit bool
+	// Bot is set for messages sent through the bot API, bots have their own rate limits
+	// instead of the spam heuristics
+	Bot bool
+}
+
+// MessageFilter inspects a message before it is stored and delivered.
+// It returns a *Rejection to refuse the message, any other error aborts sending.
+type MessageFilter interface {
+	Filter(ctx context.Context, msg *Message, policy *Policy) error
+}
+
+// FilterFunc adapts a function to the MessageFilter interface
+type FilterFunc func(ctx context.Context, msg *Message, policy *Policy) error
+
+func (f FilterFunc) Filter(ctx context.Context, msg *Message, policy *Policy) error {
+	return f(ctx, msg, policy)
+}
+
+// Policy is the filter configuration applied to one message: the server defaults
+// merged with the settings of the group the message is sent to
+type Policy struct {
+	MaxLength      int
+	BlockedWords   []string
+	WordAction     string
+	LinksAllowed   bool
+	AllowedDomains []string
+	DeniedDomains  []string
+
+	DuplicateWindow time.Duration
+	FloodLimit      int
+	FloodWindow     time.Duration
+}
+
+// defaults is the server wide policy loaded by InitFilters
+var defaults = Policy{
+	MaxLength:       4000,
+	WordAction:      models.WordActionMask,
+	LinksAllowed:    true,
+	DuplicateWindow: 30 * time.Second,
+	FloodLimit:      10,
+	FloodWindow:     10 * time.Second,
+}
+
+// chain runs in order, the content filters come first so the spam heuristics see the final content
+var chain = []MessageFilter{
+	FilterFunc(filterLength),
+	FilterFunc(filterWords),
+	FilterFunc(filterLinks),
+	FilterFunc(filterDuplicates),
+	FilterFunc(filterFlooding),
+}
+
+// Register appends a filter to the chain, it must be called before the server starts
+func Register(filter MessageFilter) {
+	chain = append(chain, filter)
+}
+
+// InitFilters loads the server wide filter policy from the environment
+func InitFilters() {
+	config.LoadEnv()
+
+	defaults.MaxLength = envInt("MAX_MESSAGE_LENGTH", defaults.MaxLength)
+	defaults.BlockedWords = envList("FILTER_BLOCKED_WORDS")
+	defaults.WordAction = config.GetEnv("FILTER_WORD_ACTION", defaults.WordAction)
+	defaults.LinksAllowed = config.GetEnv("FILTER_LINKS_ALLOWED", "true") == "true"
+	defaults.AllowedDomains = envList("FILTER_ALLOWED_DOMAINS")
+	defaults.DeniedDomains = envList("FILTER_DENIED_DOMAINS")
+	defaults.DuplicateWindow = envDuration("FILTER_DUPLICATE_WINDOW", defaults.DuplicateWindow)
+	defaults.FloodLimit = envInt("FILTER_FLOOD_LIMIT", defaults.FloodLimit)
+	defaults.FloodWindow = envDuration("FILTER_FLOOD_WINDOW", defaults.FloodWindow)
+
+	if defaults.WordAction != models.WordActionMask && defaults.WordAction != models.WordActionReject {
+		log.Fatalf("Invalid FILTER_WORD_ACTION %q, expected mask or reject", defaults.WordAction)
+	}
+	log.Println("Message filters loaded with", len(defaults.BlockedWords), "blocked words and a", defaults.MaxLength, "character limit")
+}
+
+// MaxLength is the server wide message length limit, groups may only lower it
+func MaxLength() int {
+	return defaults.MaxLength
+}
+
+// PolicyFor merges the server defaults with the settings of a group
+func PolicyFor(ctx context.Context, groupID int) (*Policy, error) {
+	policy := defaults
+	if groupID == 0 {
+		return &policy, nil
+	}
+
+	settings, err := database.GroupFilterSettings(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.MaxLength != nil && *settings.MaxLength < policy.MaxLength {
+		policy.MaxLength = *settings.MaxLength
+	}
+	if settings.WordAction != "" {
+		policy.WordAction = settings.WordAction
+	}
+	if settings.LinksAllowed != nil {
+		policy.LinksAllowed = *settings.LinksAllowed
+	}
+	policy.BlockedWords = append(append([]string{}, defaults.BlockedWords...), settings.BlockedWords...)
+	policy.AllowedDomains = append(append([]string{}, defaults.AllowedDomains...), settings.AllowedDomains...)
+	policy.DeniedDomains = append(append([]string{}, defaults.DeniedDomains...), settings.DeniedDomains...)
+	return &policy, nil
+}
+
+// Run passes a message through the filter chain, msg.Content holds the filtered content afterwards
+func Run(ctx context.Context, msg *Message) error {
+	policy, err := PolicyFor(ctx, msg.GroupID)
+	if err != nil {
+		return err
+	}
+
+	for _, filter := range chain {
+		if err := filter.Filter(ctx, msg, policy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envList reads a comma separated list, ignoring empty entries
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(config.GetEnv(key, ""), ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func envInt(key string, fallback int) int {
+	value, err := strconv.Atoi(config.GetEnv(key, strconv.Itoa(fallback)))
+	if err != nil || value <= 0 {
+		log.Fatalf("Invalid %s, expected a positive integer", key)
+	}
+	return value
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(config.GetEnv(key, fallback.String()))
+	if err != nil || value <= 0 {
+		log.Fatalf("Invalid %s, expected a duration such as 30s", key)
+	}
+	return value
+}
@@ -0,0 +1,66 @@
+package filters
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/redis/go-redis/v9"
+)
+
+// The spam heuristics keep their state in Redis so every server instance sees it.
+// Redis failures are logged and the message is let through rather than blocking chat.
+
+// filterDuplicates rejects a message identical to the previous one of the same sender in the
+// same conversation within the duplicate window, ignoring case and whitespace
+func filterDuplicates(ctx context.Context, msg *Message, policy *Policy) error {
+	if msg.Edit || msg.Bot || strings.TrimSpace(msg.Content) == "" {
+		return nil
+	}
+
+	normalized := strings.Join(strings.Fields(strings.ToLower(msg.Content)), " ")
+	hash := sha256.Sum256([]byte(normalized))
+	digest := hex.EncodeToString(hash[:])
+
+	key := fmt.Sprintf("filter:last:%d:user:%d", msg.SenderID, msg.ReceiverID)
+	if msg.GroupID != 0 {
+		key = fmt.Sprintf("filter:last:%d:group:%d", msg.SenderID, msg.GroupID)
+	}
+	previous, err := database.RedisClient.SetArgs(ctx, key, digest, redis.SetArgs{Get: true, TTL: policy.DuplicateWindow}).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("Error checking duplicate messages of user %d: %v", msg.SenderID, err)
+		return nil
+	}
+	if previous == digest {
+		return &Rejection{Code: CodeDuplicate, Reason: "You already sent this message"}
+	}
+	return nil
+}
+
+// filterFlooding rejects messages once a sender exceeds the flood limit within the flood window
+func filterFlooding(ctx context.Context, msg *Message, policy *Policy) error {
+	if msg.Edit || msg.Bot {
+		return nil
+	}
+
+	// The window starts with the first counted message, setting it in the same transaction
+	// keeps the counter from living forever when the expiry fails
+	key := fmt.Sprintf("filter:flood:%d", msg.SenderID)
+	pipe := database.RedisClient.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, policy.FloodWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Error counting messages of user %d: %v", msg.SenderID, err)
+		return nil
+	}
+
+	if count.Val() > int64(policy.FloodLimit) {
+		return &Rejection{Code: CodeFlooding, Reason: "You are sending messages too quickly"}
+	}
+	return nil
+}
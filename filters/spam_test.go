@@ -0,0 +1,79 @@
+package filters
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/internal/testenv"
+)
+
+func TestFilterDuplicates(t *testing.T) {
+	server := testenv.Redis(t)
+	policy := &Policy{DuplicateWindow: 30 * time.Second}
+
+	steps := []struct {
+		name     string
+		msg      Message
+		wait     time.Duration
+		wantCode string
+	}{
+		{"first message", Message{SenderID: 1, Content: "hello there"}, 0, ""},
+		{"same message", Message{SenderID: 1, Content: "hello there"}, 0, CodeDuplicate},
+		{"same message, other case and spacing", Message{SenderID: 1, Content: "  HELLO   there "}, 0, CodeDuplicate},
+		{"other sender", Message{SenderID: 2, Content: "hello there"}, 0, ""},
+		{"other direct chat", Message{SenderID: 1, ReceiverID: 3, Content: "hello there"}, 0, ""},
+		{"same group", Message{SenderID: 1, GroupID: 9, Content: "hello there"}, 0, ""},
+		{"same group again", Message{SenderID: 1, GroupID: 9, Content: "hello there"}, 0, CodeDuplicate},
+		{"other group", Message{SenderID: 1, GroupID: 10, Content: "hello there"}, 0, ""},
+		{"edit", Message{SenderID: 1, Content: "hello there", Edit: true}, 0, ""},
+		{"bot", Message{SenderID: 1, Content: "hello there", Bot: true}, 0, ""},
+		{"after the window", Message{SenderID: 1, Content: "hello there"}, 31 * time.Second, ""},
+		{"other message", Message{SenderID: 1, Content: "something else"}, 0, ""},
+		{"previous message again", Message{SenderID: 1, Content: "hello there"}, 0, ""},
+	}
+	for _, step := range steps {
+		server.FastForward(step.wait)
+		if got := rejectionCode(t, filterDuplicates(context.Background(), &step.msg, policy)); got != step.wantCode {
+			t.Errorf("%s: code = %q, want %q", step.name, got, step.wantCode)
+		}
+	}
+}
+
+func TestFilterFlooding(t *testing.T) {
+	server := testenv.Redis(t)
+	policy := &Policy{FloodLimit: 3, FloodWindow: 10 * time.Second}
+
+	send := func(msg Message) string {
+		return rejectionCode(t, filterFlooding(context.Background(), &msg, policy))
+	}
+
+	for i := range 3 {
+		if got := send(Message{SenderID: 1}); got != "" {
+			t.Fatalf("message %d rejected with %q", i+1, got)
+		}
+	}
+	server.FastForward(2 * time.Second)
+	if got := send(Message{SenderID: 1}); got != CodeFlooding {
+		t.Errorf("message over the limit code = %q, want %q", got, CodeFlooding)
+	}
+	if got := send(Message{SenderID: 2}); got != "" {
+		t.Errorf("message of another sender code = %q, want none", got)
+	}
+	if got := send(Message{SenderID: 1, Edit: true}); got != "" {
+		t.Errorf("edit code = %q, want none", got)
+	}
+	if got := send(Message{SenderID: 1, Bot: true}); got != "" {
+		t.Errorf("bot message code = %q, want none", got)
+	}
+
+	// Later messages leave the expiry of the window alone
+	if ttl := server.TTL("filter:flood:1"); ttl != 8*time.Second {
+		t.Errorf("window TTL = %v, want 8s", ttl)
+	}
+
+	server.FastForward(9 * time.Second)
+	if got := send(Message{SenderID: 1}); got != "" {
+		t.Errorf("message after the window code = %q, want none", got)
+	}
+}
@@ -0,0 +1,195 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var invalidUserID = apierror.Invalid("user_id", "Invalid user_id")
+
+// Messages are converted to and from the JSON bodies of the REST routes, whose fields have the
+// names of the proto fields. Fields the messages do not have yet are ignored.
+var (
+	marshalOptions   = protojson.MarshalOptions{UseProtoNames: true}
+	unmarshalOptions = protojson.UnmarshalOptions{DiscardUnknown: true}
+)
+
+// call runs a REST route with in as the JSON body, if any, and decodes the response into out
+func (s *Service) call(ctx context.Context, method string, path string, query url.Values, in proto.Message, out proto.Message) error {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = marshalOptions.Marshal(in)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	data, err := s.roundTrip(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	return decode(data, out)
+}
+
+// decode converts the JSON response of a REST route to a message
+func decode(data []byte, out proto.Message) error {
+	if err := unmarshalOptions.Unmarshal(data, out); err != nil {
+		return status.Errorf(codes.Internal, "decoding %s: %v", out.ProtoReflect().Descriptor().Name(), err)
+	}
+	return nil
+}
+
+// roundTrip runs a REST route in process and returns its JSON response. The caller's address
+// and authorization header are passed on, so rate limits and admin checks apply as they do
+// over HTTP.
+func (s *Service) roundTrip(ctx context.Context, method string, path string, query url.Values, body []byte) ([]byte, error) {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	target := path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	r, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			r.Header.Set("Authorization", values[0])
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	w := &responseRecorder{header: make(http.Header), status: http.StatusOK}
+	s.Handler.ServeHTTP(w, r)
+
+	// The request id links the call to the server logs
+	if id := w.header.Get("X-Request-ID"); id != "" {
+		grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	}
+
+	if w.status >= http.StatusBadRequest {
+		var apiErr apierror.Error
+		if err := json.Unmarshal(w.body.Bytes(), &apiErr); err != nil || apiErr.Code == "" {
+			apiErr = apierror.Error{Code: apierror.CodeForStatus(w.status), Message: http.StatusText(w.status)}
+		}
+		apiErr.Status = w.status
+		return nil, statusOf(&apiErr)
+	}
+	return w.body.Bytes(), nil
+}
+
+// responseRecorder collects the response of a REST route
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+	wrote  bool
+}
+
+func (w *responseRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if !w.wrote {
+		w.status = status
+		w.wrote = true
+	}
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.wrote = true
+	return w.body.Write(data)
+}
+
+// grpcCodes maps the HTTP statuses of API errors to gRPC codes
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusConflict:              codes.AlreadyExists,
+	http.StatusRequestEntityTooLarge: codes.InvalidArgument,
+	http.StatusUnsupportedMediaType:  codes.InvalidArgument,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+}
+
+// statusOf converts an error to a gRPC status. API errors keep their message, their code is
+// sent in the error-code trailer and field errors in error-fields, one "field: message" each.
+func statusOf(err error) error {
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	code, ok := grpcCodes[apiErr.Status]
+	if !ok {
+		code = codes.Internal
+	}
+	return &trailedError{
+		status: status.New(code, apiErr.Message),
+		trailer: func() metadata.MD {
+			md := metadata.Pairs("error-code", apiErr.Code)
+			for _, field := range apiErr.Fields {
+				md.Append("error-fields", fmt.Sprintf("%s: %s", field.Field, field.Message))
+			}
+			return md
+		}(),
+	}
+}
+
+// trailedError is a gRPC status that sets trailer metadata when the method returns
+type trailedError struct {
+	status  *status.Status
+	trailer metadata.MD
+}
+
+func (e *trailedError) Error() string {
+	return e.status.Err().Error()
+}
+
+func (e *trailedError) GRPCStatus() *status.Status {
+	return e.status
+}
+
+// ErrorCode returns the API error code of a failed call, read from its trailer
+func ErrorCode(trailer metadata.MD) string {
+	if values := trailer.Get("error-code"); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// splitFeatures accepts features as separate metadata values or comma separated
+func splitFeatures(values []string) []string {
+	var features []string
+	for _, value := range values {
+		features = append(features, strings.Split(value, ",")...)
+	}
+	return features
+}
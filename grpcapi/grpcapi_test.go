@@ -0,0 +1,373 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/grpcapi/proxychatpb"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+	"github.com/clementus360/proxy-chat/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// dial serves the service over an in-memory connection, unary methods run the routes of handler
+func dial(t *testing.T, handler http.Handler) proxychatpb.ProxyChatClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(apierror.WithRequestID(handler))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return proxychatpb.NewProxyChatClient(conn)
+}
+
+// restRequest is what a stub route received
+type restRequest struct {
+	method        string
+	target        string
+	body          map[string]any
+	authorization string
+}
+
+// stubRoutes answers every route with a canned JSON response and records the requests
+func stubRoutes(responses map[string]string, requests *[]restRequest) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := restRequest{method: r.Method, target: r.URL.RequestURI(), authorization: r.Header.Get("Authorization")}
+		data, _ := io.ReadAll(r.Body)
+		if len(data) > 0 {
+			json.Unmarshal(data, &request.body)
+		}
+		*requests = append(*requests, request)
+
+		response, ok := responses[r.Method+" "+r.URL.Path]
+		if !ok {
+			apierror.Write(w, r, apierror.NotFound("Route not found"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	})
+}
+
+func TestUnaryMethodsRunRESTRoutes(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	responses := map[string]string{
+		"POST /api/users":       `{"id": 7, "username": "bob", "latitude": 1.5, "longitude": 0, "visible": true, "last_active": "2024-05-01T12:00:00Z", "created_at": "2024-05-01T12:00:00Z", "added_later": true}`,
+		"GET /api/users":        `{"users": [{"id": 8, "username": "eve", "image_url": "", "visible": true, "online": true, "last_active": "2024-05-01T12:00:00Z", "created_at": "2024-05-01T12:00:00Z"}], "total_count": 1, "radius_km": 10}`,
+		"PATCH /api/users":      `{"id": 3, "username": "alice", "visible": false, "created_at": "2024-05-01T12:00:00Z"}`,
+		"DELETE /api/users":     `{"message": "User deleted successfully"}`,
+		"POST /api/groups":      `{"id": 4, "name": "hikers", "creator_id": 3, "latitude": 1, "longitude": 2, "created_at": "2024-05-01T12:00:00Z"}`,
+		"GET /api/groups":       `{"groups": [{"id": 4, "name": "hikers", "image_url": "", "creator_id": 3, "unread_count": 2}], "total_count": 1, "radius_km": 5}`,
+		"POST /api/groups/join": `{"message": "Joined group successfully"}`,
+		"POST /api/messages":    `{"id": 11, "content": "hi", "group_id": 4, "sender_id": 3, "receiver_id": 0, "reply_to": null, "attachments": [{"id": 2, "url": "/files/2", "size": 1024, "created_at": "2024-05-01T12:00:00Z"}], "created_at": "2024-05-01T12:00:00Z", "client_msg_id": "c1"}`,
+		"GET /api/messages":     `[{"id": 11, "content": "hi", "group_id": 4, "sender_id": 3, "created_at": "2024-05-01T12:00:00Z"}, {"id": 12, "content": "message deleted", "group_id": 4, "sender_id": 5, "deleted": true, "created_at": "2024-05-01T12:00:00Z"}]`,
+	}
+	var requests []restRequest
+	client := dial(t, stubRoutes(responses, &requests))
+
+	tests := []struct {
+		name       string
+		call       func(ctx context.Context) (proto.Message, error)
+		wantTarget string
+		wantBody   map[string]any
+		want       proto.Message
+	}{
+		{
+			name: "CreateUser",
+			call: func(ctx context.Context) (proto.Message, error) {
+				return client.CreateUser(ctx, &proxychatpb.User{Username: "bob", Latitude: 1.5})
+			},
+			wantTarget: "POST /api/users",
+			wantBody:   map[string]any{"username": "bob", "latitude": 1.5},
+			want:       &proxychatpb.User{Id: 7, Username: "bob", Latitude: 1.5, Visible: true, LastActive: timestamppb.New(at), CreatedAt: timestamppb.New(at)},
+		},
+		{
+			name: "GetNearbyUsers",
+			call: func(ctx context.Context) (proto.Message, error) {
+				return client.GetNearbyUsers(ctx, &proxychatpb.NearbyRequest{UserId: 3, Lat: 1.5, Long: -2, Radius: 10})
+			},
+			wantTarget: "GET /api/users?id=3&lat=1.5&long=-2&radius=10",
+			want: &proxychatpb.NearbyUsers{
+				Users:      []*proxychatpb.NearbyUser{{Id: 8, Username: "eve", Visible: true, Online: true, LastActive: timestamppb.New(at), CreatedAt: timestamppb.New(at)}},
+				TotalCount: 1,
+				RadiusKm:   10,
+			},
+		},
+		{
+			name: "UpdateUser sends the fields that are set",
+			call: func(ctx context.Context) (proto.Message, error) {
+				return client.UpdateUser(ctx, &proxychatpb.UpdateUserRequest{Id: 3, Username: proto.String("alice"), Visible: proto.Bool(false)})
+			},
+			wantTarget: "PATCH /api/users?id=3",
+			wantBody:   map[string]any{"username": "alice", "visible": false},
+			want:       &proxychatpb.User{Id: 3, Username: "alice", CreatedAt: timestamppb.New(at)},
+		},
+		{
+			name: "DeleteUser",
+			call: func(ctx context.Context) (proto.Message, error) {
+				return client.DeleteUser(ctx, &proxychatpb.UserRef{Id: 3})
+			},
+			wantTarget: "DELETE /api/users?id=3",
+			want:       &proxychatpb.StatusMessage{Message: "User deleted successfully"},
+		},
+		{
+			name: "CreateGroup",
+			call: func(ctx context.Context) (proto.Message, error) {
+				return client.CreateGroup(ctx, &proxychatpb.Group{Name: "hikers", CreatorId: 3, Latitude: 1, Longitude: 2})
+			},
+			wantTarget: "POST /api/groups",
+			wantBody:   map[string]any{"name": "hikers", "creator_id": float64(3), "latitude": float64(1), "longitude": float64(2)},
+			want:       &proxychatpb.Group{Id: 4, Name: "hikers", CreatorId: 3, Latitude: 1, Longitude: 2, CreatedAt: timestamppb.New(at)},
+		},
+		{
+			name: "GetNearbyGroups without a user",
+			call: func(ctx context.Context) (proto.Message, error) {
+				return client.GetNearbyGroups(ctx, &proxychatpb.NearbyRequest{Lat: 1, Long: 2})
+			},
+			wantTarget: "GET /api/groups?lat=1&long=2",
+			want:       &proxychatpb.NearbyGroups{Groups: []*proxychatpb.NearbyGroup{{Id: 4, Name: "hikers", CreatorId: 3, UnreadCount: 2}}, TotalCount: 1, RadiusKm: 5},
+		},
+		{
+			name: "JoinGroup sends the ids as strings",
+			call: func(ctx context.Context) (proto.Message, error) {
+				return client.JoinGroup(ctx, &proxychatpb.JoinGroupRequest{UserId: 3, GroupId: 4})
+			},
+			wantTarget: "POST /api/groups/join",
+			wantBody:   map[string]any{"user_id": "3", "group_id": "4"},
+			want:       &proxychatpb.StatusMessage{Message: "Joined group successfully"},
+		},
+		{
+			name: "SendMessage",
+			call: func(ctx context.Context) (proto.Message, error) {
+				return client.SendMessage(ctx, &proxychatpb.Message{Content: "hi", GroupId: 4, SenderId: 3, AttachmentIds: []int32{2}, ClientMsgId: "c1"})
+			},
+			wantTarget: "POST /api/messages",
+			wantBody:   map[string]any{"content": "hi", "group_id": float64(4), "sender_id": float64(3), "attachment_ids": []any{float64(2)}, "client_msg_id": "c1"},
+			want: &proxychatpb.Message{
+				Id: 11, Content: "hi", GroupId: 4, SenderId: 3, ClientMsgId: "c1", CreatedAt: timestamppb.New(at),
+				Attachments: []*proxychatpb.Attachment{{Id: 2, Url: "/files/2", Size: 1024, CreatedAt: timestamppb.New(at)}},
+			},
+		},
+		{
+			name: "GetMessages",
+			call: func(ctx context.Context) (proto.Message, error) {
+				return client.GetMessages(ctx, &proxychatpb.GetMessagesRequest{GroupId: 4})
+			},
+			wantTarget: "GET /api/messages?group_id=4",
+			want: &proxychatpb.MessageList{Messages: []*proxychatpb.Message{
+				{Id: 11, Content: "hi", GroupId: 4, SenderId: 3, CreatedAt: timestamppb.New(at)},
+				{Id: 12, Content: "message deleted", GroupId: 4, SenderId: 5, Deleted: true, CreatedAt: timestamppb.New(at)},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = nil
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+
+			got, err := tt.call(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got, tt.want) {
+				t.Errorf("response = %v, want %v", got, tt.want)
+			}
+
+			if len(requests) != 1 {
+				t.Fatalf("routes called %d times, want once", len(requests))
+			}
+			request := requests[0]
+			if target := request.method + " " + request.target; target != tt.wantTarget {
+				t.Errorf("route = %s, want %s", target, tt.wantTarget)
+			}
+			if !reflect.DeepEqual(request.body, tt.wantBody) {
+				t.Errorf("body = %v, want %v", request.body, tt.wantBody)
+			}
+			if request.authorization != "Bearer secret" {
+				t.Errorf("authorization = %q, want it passed on", request.authorization)
+			}
+		})
+	}
+}
+
+func TestUnaryErrors(t *testing.T) {
+	client := dial(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("id") {
+		case "1":
+			err := apierror.Invalid("username", "is required")
+			err.Message = "username: is required"
+			apierror.Write(w, r, err)
+		case "2":
+			apierror.Write(w, r, apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "Slow down"))
+		case "3":
+			http.Error(w, "upstream failed", http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"message": 5}`))
+		}
+	}))
+
+	tests := []struct {
+		id          int32
+		wantCode    codes.Code
+		wantMessage string
+		wantError   string
+		wantFields  []string
+	}{
+		{1, codes.InvalidArgument, "username: is required", apierror.CodeValidation, []string{"username: is required"}},
+		{2, codes.ResourceExhausted, "Slow down", apierror.CodeRateLimited, nil},
+		{3, codes.Internal, "Bad Gateway", apierror.CodeForStatus(http.StatusBadGateway), nil},
+		{4, codes.Internal, "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.id), func(t *testing.T) {
+			var header, trailer metadata.MD
+			_, err := client.DeleteUser(context.Background(), &proxychatpb.UserRef{Id: tt.id}, grpc.Header(&header), grpc.Trailer(&trailer))
+
+			s := status.Convert(err)
+			if s.Code() != tt.wantCode {
+				t.Fatalf("code = %v (%v), want %v", s.Code(), err, tt.wantCode)
+			}
+			if tt.wantMessage != "" && s.Message() != tt.wantMessage {
+				t.Errorf("message = %q, want %q", s.Message(), tt.wantMessage)
+			}
+			if got := ErrorCode(trailer); got != tt.wantError {
+				t.Errorf("error-code = %q, want %q", got, tt.wantError)
+			}
+			if got := trailer.Get("error-fields"); !reflect.DeepEqual(got, tt.wantFields) {
+				t.Errorf("error-fields = %q, want %q", got, tt.wantFields)
+			}
+			if len(header.Get("x-request-id")) != 1 {
+				t.Errorf("header = %v, want an x-request-id", header)
+			}
+		})
+	}
+}
+
+func TestChatRejectsInvalidMetadata(t *testing.T) {
+	client := dial(t, http.NotFoundHandler())
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		wantField string
+	}{
+		{"missing user", context.Background(), "user_id"},
+		{"invalid user", metadata.AppendToOutgoingContext(context.Background(), MetadataUserID, "me"), "user_id"},
+		{"invalid device", ChatContext(context.Background(), 1, "my phone", nil), "device_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var trailer metadata.MD
+			stream, err := client.Chat(tt.ctx, grpc.Trailer(&trailer))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = stream.Recv()
+			if status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Recv() error = %v, want InvalidArgument", err)
+			}
+			if ErrorCode(trailer) != apierror.CodeValidation || len(trailer.Get("error-fields")) != 1 {
+				t.Errorf("trailer = %v, want a %s error on %s", trailer, apierror.CodeValidation, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestChatServesTheHub(t *testing.T) {
+	testenv.Postgres(t)
+	previous := ratelimit.Default
+	ratelimit.Default = ratelimit.NewMemoryLimiter()
+	t.Cleanup(func() { ratelimit.Default = previous })
+
+	sender := testenv.CreateUser(t)
+	receiver := testenv.CreateUser(t)
+	client := dial(t, http.NotFoundHandler())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := client.Chat(ChatContext(ctx, sender, "grpc-test", []string{"receipts"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	welcome, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if welcome.Type != "welcome" || welcome.Payload.Fields["user_id"].GetNumberValue() != float64(sender) {
+		t.Fatalf("first frame = %v, want the welcome of user %d", welcome, sender)
+	}
+
+	tests := []struct {
+		name     string
+		payload  map[string]any
+		wantType string
+		wantCode string
+	}{
+		{"message", map[string]any{"receiver_id": receiver, "content": "hello over grpc", "client_msg_id": "grpc-1"}, "sent", ""},
+		{"unknown payload field", map[string]any{"receiver_id": receiver, "content": "hi", "colour": "red"}, "error", apierror.CodeProtocol},
+		{"receiver and group", map[string]any{"receiver_id": receiver, "group_id": 1, "content": "hi"}, "error", apierror.CodeValidation},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := structpb.NewStruct(tt.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id := fmt.Sprint("frame-", i)
+			if err := stream.Send(&proxychatpb.Envelope{Version: 2, Type: "message", Id: id, Payload: payload}); err != nil {
+				t.Fatal(err)
+			}
+
+			reply, err := stream.Recv()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reply.Type != tt.wantType || reply.Ref != id {
+				t.Fatalf("reply = %v, want a %s frame answering %s", reply, tt.wantType, id)
+			}
+			switch tt.wantType {
+			case "sent":
+				if reply.Payload.Fields["message_id"].GetNumberValue() == 0 || reply.Payload.Fields["client_msg_id"].GetStringValue() != "grpc-1" {
+					t.Errorf("sent payload = %v", reply.Payload)
+				}
+			case "error":
+				if code := reply.Payload.Fields["code"].GetStringValue(); code != tt.wantCode {
+					t.Errorf("error code = %q, want %q", code, tt.wantCode)
+				}
+			}
+		})
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Errorf("Recv() after CloseSend = %v, want io.EOF", err)
+	}
+}
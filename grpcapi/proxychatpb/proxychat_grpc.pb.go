@@ -0,0 +1,472 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: proxychat/v1/proxychat.proto
+
+package proxychatpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ProxyChat_CreateUser_FullMethodName      = "/proxychat.v1.ProxyChat/CreateUser"
+	ProxyChat_GetNearbyUsers_FullMethodName  = "/proxychat.v1.ProxyChat/GetNearbyUsers"
+	ProxyChat_UpdateUser_FullMethodName      = "/proxychat.v1.ProxyChat/UpdateUser"
+	ProxyChat_DeleteUser_FullMethodName      = "/proxychat.v1.ProxyChat/DeleteUser"
+	ProxyChat_CreateGroup_FullMethodName     = "/proxychat.v1.ProxyChat/CreateGroup"
+	ProxyChat_GetNearbyGroups_FullMethodName = "/proxychat.v1.ProxyChat/GetNearbyGroups"
+	ProxyChat_JoinGroup_FullMethodName       = "/proxychat.v1.ProxyChat/JoinGroup"
+	ProxyChat_SendMessage_FullMethodName     = "/proxychat.v1.ProxyChat/SendMessage"
+	ProxyChat_GetMessages_FullMethodName     = "/proxychat.v1.ProxyChat/GetMessages"
+	ProxyChat_Chat_FullMethodName            = "/proxychat.v1.ProxyChat/Chat"
+)
+
+// ProxyChatClient is the client API for ProxyChat service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ProxyChat exposes the REST API and the realtime hub over gRPC. Unary methods run the REST
+// routes of the same name, fields are named like their JSON bodies and query parameters, and
+// errors carry the API error code in the error-code trailer and field errors in error-fields.
+type ProxyChatClient interface {
+	CreateUser(ctx context.Context, in *User, opts ...grpc.CallOption) (*User, error)
+	GetNearbyUsers(ctx context.Context, in *NearbyRequest, opts ...grpc.CallOption) (*NearbyUsers, error)
+	UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*User, error)
+	DeleteUser(ctx context.Context, in *UserRef, opts ...grpc.CallOption) (*StatusMessage, error)
+	CreateGroup(ctx context.Context, in *Group, opts ...grpc.CallOption) (*Group, error)
+	GetNearbyGroups(ctx context.Context, in *NearbyRequest, opts ...grpc.CallOption) (*NearbyGroups, error)
+	JoinGroup(ctx context.Context, in *JoinGroupRequest, opts ...grpc.CallOption) (*StatusMessage, error)
+	SendMessage(ctx context.Context, in *Message, opts ...grpc.CallOption) (*Message, error)
+	GetMessages(ctx context.Context, in *GetMessagesRequest, opts ...grpc.CallOption) (*MessageList, error)
+	// Chat is a bidirectional stream of envelopes, like an envelope WebSocket. The user-id,
+	// device-id and features metadata take the place of the query parameters of /ws and of the
+	// hello frame, bots add "authorization: Bot <token>". The first frame received is the welcome.
+	Chat(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Envelope, Envelope], error)
+}
+
+type proxyChatClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewProxyChatClient(cc grpc.ClientConnInterface) ProxyChatClient {
+	return &proxyChatClient{cc}
+}
+
+func (c *proxyChatClient) CreateUser(ctx context.Context, in *User, opts ...grpc.CallOption) (*User, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(User)
+	err := c.cc.Invoke(ctx, ProxyChat_CreateUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyChatClient) GetNearbyUsers(ctx context.Context, in *NearbyRequest, opts ...grpc.CallOption) (*NearbyUsers, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(NearbyUsers)
+	err := c.cc.Invoke(ctx, ProxyChat_GetNearbyUsers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyChatClient) UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*User, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(User)
+	err := c.cc.Invoke(ctx, ProxyChat_UpdateUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyChatClient) DeleteUser(ctx context.Context, in *UserRef, opts ...grpc.CallOption) (*StatusMessage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatusMessage)
+	err := c.cc.Invoke(ctx, ProxyChat_DeleteUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyChatClient) CreateGroup(ctx context.Context, in *Group, opts ...grpc.CallOption) (*Group, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Group)
+	err := c.cc.Invoke(ctx, ProxyChat_CreateGroup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyChatClient) GetNearbyGroups(ctx context.Context, in *NearbyRequest, opts ...grpc.CallOption) (*NearbyGroups, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(NearbyGroups)
+	err := c.cc.Invoke(ctx, ProxyChat_GetNearbyGroups_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyChatClient) JoinGroup(ctx context.Context, in *JoinGroupRequest, opts ...grpc.CallOption) (*StatusMessage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatusMessage)
+	err := c.cc.Invoke(ctx, ProxyChat_JoinGroup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyChatClient) SendMessage(ctx context.Context, in *Message, opts ...grpc.CallOption) (*Message, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Message)
+	err := c.cc.Invoke(ctx, ProxyChat_SendMessage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyChatClient) GetMessages(ctx context.Context, in *GetMessagesRequest, opts ...grpc.CallOption) (*MessageList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MessageList)
+	err := c.cc.Invoke(ctx, ProxyChat_GetMessages_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyChatClient) Chat(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Envelope, Envelope], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ProxyChat_ServiceDesc.Streams[0], ProxyChat_Chat_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Envelope, Envelope]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProxyChat_ChatClient = grpc.BidiStreamingClient[Envelope, Envelope]
+
+// ProxyChatServer is the server API for ProxyChat service.
+// All implementations must embed UnimplementedProxyChatServer
+// for forward compatibility.
+//
+// ProxyChat exposes the REST API and the realtime hub over gRPC. Unary methods run the REST
+// routes of the same name, fields are named like their JSON bodies and query parameters, and
+// errors carry the API error code in the error-code trailer and field errors in error-fields.
+type ProxyChatServer interface {
+	CreateUser(context.Context, *User) (*User, error)
+	GetNearbyUsers(context.Context, *NearbyRequest) (*NearbyUsers, error)
+	UpdateUser(context.Context, *UpdateUserRequest) (*User, error)
+	DeleteUser(context.Context, *UserRef) (*StatusMessage, error)
+	CreateGroup(context.Context, *Group) (*Group, error)
+	GetNearbyGroups(context.Context, *NearbyRequest) (*NearbyGroups, error)
+	JoinGroup(context.Context, *JoinGroupRequest) (*StatusMessage, error)
+	SendMessage(context.Context, *Message) (*Message, error)
+	GetMessages(context.Context, *GetMessagesRequest) (*MessageList, error)
+	// Chat is a bidirectional stream of envelopes, like an envelope WebSocket. The user-id,
+	// device-id and features metadata take the place of the query parameters of /ws and of the
+	// hello frame, bots add "authorization: Bot <token>". The first frame received is the welcome.
+	Chat(grpc.BidiStreamingServer[Envelope, Envelope]) error
+	mustEmbedUnimplementedProxyChatServer()
+}
+
+// UnimplementedProxyChatServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedProxyChatServer struct{}
+
+func (UnimplementedProxyChatServer) CreateUser(context.Context, *User) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateUser not implemented")
+}
+func (UnimplementedProxyChatServer) GetNearbyUsers(context.Context, *NearbyRequest) (*NearbyUsers, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNearbyUsers not implemented")
+}
+func (UnimplementedProxyChatServer) UpdateUser(context.Context, *UpdateUserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateUser not implemented")
+}
+func (UnimplementedProxyChatServer) DeleteUser(context.Context, *UserRef) (*StatusMessage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteUser not implemented")
+}
+func (UnimplementedProxyChatServer) CreateGroup(context.Context, *Group) (*Group, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateGroup not implemented")
+}
+func (UnimplementedProxyChatServer) GetNearbyGroups(context.Context, *NearbyRequest) (*NearbyGroups, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetNearbyGroups not implemented")
+}
+func (UnimplementedProxyChatServer) JoinGroup(context.Context, *JoinGroupRequest) (*StatusMessage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method JoinGroup not implemented")
+}
+func (UnimplementedProxyChatServer) SendMessage(context.Context, *Message) (*Message, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendMessage not implemented")
+}
+func (UnimplementedProxyChatServer) GetMessages(context.Context, *GetMessagesRequest) (*MessageList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMessages not implemented")
+}
+func (UnimplementedProxyChatServer) Chat(grpc.BidiStreamingServer[Envelope, Envelope]) error {
+	return status.Errorf(codes.Unimplemented, "method Chat not implemented")
+}
+func (UnimplementedProxyChatServer) mustEmbedUnimplementedProxyChatServer() {}
+func (UnimplementedProxyChatServer) testEmbeddedByValue()                   {}
+
+// UnsafeProxyChatServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ProxyChatServer will
+// result in compilation errors.
+type UnsafeProxyChatServer interface {
+	mustEmbedUnimplementedProxyChatServer()
+}
+
+func RegisterProxyChatServer(s grpc.ServiceRegistrar, srv ProxyChatServer) {
+	// If the following call pancis, it indicates UnimplementedProxyChatServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ProxyChat_ServiceDesc, srv)
+}
+
+func _ProxyChat_CreateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(User)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyChatServer).CreateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyChat_CreateUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyChatServer).CreateUser(ctx, req.(*User))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyChat_GetNearbyUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NearbyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyChatServer).GetNearbyUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyChat_GetNearbyUsers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyChatServer).GetNearbyUsers(ctx, req.(*NearbyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyChat_UpdateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyChatServer).UpdateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyChat_UpdateUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyChatServer).UpdateUser(ctx, req.(*UpdateUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyChat_DeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRef)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyChatServer).DeleteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyChat_DeleteUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyChatServer).DeleteUser(ctx, req.(*UserRef))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyChat_CreateGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Group)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyChatServer).CreateGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyChat_CreateGroup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyChatServer).CreateGroup(ctx, req.(*Group))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyChat_GetNearbyGroups_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NearbyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyChatServer).GetNearbyGroups(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyChat_GetNearbyGroups_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyChatServer).GetNearbyGroups(ctx, req.(*NearbyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyChat_JoinGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JoinGroupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyChatServer).JoinGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyChat_JoinGroup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyChatServer).JoinGroup(ctx, req.(*JoinGroupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyChat_SendMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Message)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyChatServer).SendMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyChat_SendMessage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyChatServer).SendMessage(ctx, req.(*Message))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyChat_GetMessages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMessagesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyChatServer).GetMessages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyChat_GetMessages_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyChatServer).GetMessages(ctx, req.(*GetMessagesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyChat_Chat_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ProxyChatServer).Chat(&grpc.GenericServerStream[Envelope, Envelope]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProxyChat_ChatServer = grpc.BidiStreamingServer[Envelope, Envelope]
+
+// ProxyChat_ServiceDesc is the grpc.ServiceDesc for ProxyChat service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ProxyChat_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proxychat.v1.ProxyChat",
+	HandlerType: (*ProxyChatServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateUser",
+			Handler:    _ProxyChat_CreateUser_Handler,
+		},
+		{
+			MethodName: "GetNearbyUsers",
+			Handler:    _ProxyChat_GetNearbyUsers_Handler,
+		},
+		{
+			MethodName: "UpdateUser",
+			Handler:    _ProxyChat_UpdateUser_Handler,
+		},
+		{
+			MethodName: "DeleteUser",
+			Handler:    _ProxyChat_DeleteUser_Handler,
+		},
+		{
+			MethodName: "CreateGroup",
+			Handler:    _ProxyChat_CreateGroup_Handler,
+		},
+		{
+			MethodName: "GetNearbyGroups",
+			Handler:    _ProxyChat_GetNearbyGroups_Handler,
+		},
+		{
+			MethodName: "JoinGroup",
+			Handler:    _ProxyChat_JoinGroup_Handler,
+		},
+		{
+			MethodName: "SendMessage",
+			Handler:    _ProxyChat_SendMessage_Handler,
+		},
+		{
+			MethodName: "GetMessages",
+			Handler:    _ProxyChat_GetMessages_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Chat",
+			Handler:       _ProxyChat_Chat_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "proxychat/v1/proxychat.proto",
+}
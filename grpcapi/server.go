@@ -0,0 +1,58 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/clementus360/proxy-chat/grpcapi/proxychatpb"
+	"google.golang.org/grpc"
+)
+
+// The service is defined in proto/proxychat/v1/proxychat.proto, generating the stubs needs buf,
+// protoc-gen-go and protoc-gen-go-grpc on the PATH
+//go:generate buf generate
+
+var _ proxychatpb.ProxyChatServer = (*Service)(nil)
+
+// NewServer returns a gRPC server for the service, unary methods run the routes of handler
+func NewServer(handler http.Handler) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryTrailers),
+		grpc.ChainStreamInterceptor(streamTrailers),
+	)
+	proxychatpb.RegisterProxyChatServer(server, &Service{Handler: handler})
+	return server
+}
+
+// Serve listens on addr and serves the service until the listener fails
+func Serve(addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	log.Println("gRPC API listening on", addr)
+	return NewServer(handler).Serve(listener)
+}
+
+// unaryTrailers sends the trailer metadata of API errors
+func unaryTrailers(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	res, err := handler(ctx, req)
+	var trailed *trailedError
+	if errors.As(err, &trailed) {
+		grpc.SetTrailer(ctx, trailed.trailer)
+	}
+	return res, err
+}
+
+func streamTrailers(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	err := handler(srv, stream)
+	var trailed *trailedError
+	if errors.As(err, &trailed) {
+		stream.SetTrailer(trailed.trailer)
+	}
+	return err
+}
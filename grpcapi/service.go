@@ -0,0 +1,213 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/clementus360/proxy-chat/grpcapi/proxychatpb"
+	"github.com/clementus360/proxy-chat/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ServiceName is the full name of the gRPC service
+const ServiceName = "proxychat.v1.ProxyChat"
+
+// Metadata keys of the Chat stream, they match the query parameters of /ws
+const (
+	MetadataUserID   = "user-id"
+	MetadataDeviceID = "device-id"
+	MetadataFeatures = "features"
+)
+
+// Service implements the ProxyChat service. Unary methods run the REST routes in process so they
+// share their validation, rate limits, filters and errors, Chat plugs into the WebSocket hub.
+type Service struct {
+	proxychatpb.UnimplementedProxyChatServer
+
+	// Handler serves the REST routes, usually the server mux
+	Handler http.Handler
+}
+
+func (s *Service) CreateUser(ctx context.Context, in *proxychatpb.User) (*proxychatpb.User, error) {
+	out := new(proxychatpb.User)
+	return out, s.call(ctx, http.MethodPost, "/api/users", nil, in, out)
+}
+
+func (s *Service) GetNearbyUsers(ctx context.Context, in *proxychatpb.NearbyRequest) (*proxychatpb.NearbyUsers, error) {
+	query := nearbyQuery(in)
+	query.Set("id", strconv.Itoa(int(in.UserId)))
+
+	out := new(proxychatpb.NearbyUsers)
+	return out, s.call(ctx, http.MethodGet, "/api/users", query, nil, out)
+}
+
+func (s *Service) UpdateUser(ctx context.Context, in *proxychatpb.UpdateUserRequest) (*proxychatpb.User, error) {
+	// The id goes in the query string, the body holds the fields to change
+	body := proto.Clone(in).(*proxychatpb.UpdateUserRequest)
+	body.Id = 0
+
+	out := new(proxychatpb.User)
+	return out, s.call(ctx, http.MethodPatch, "/api/users", url.Values{"id": {strconv.Itoa(int(in.Id))}}, body, out)
+}
+
+func (s *Service) DeleteUser(ctx context.Context, in *proxychatpb.UserRef) (*proxychatpb.StatusMessage, error) {
+	out := new(proxychatpb.StatusMessage)
+	return out, s.call(ctx, http.MethodDelete, "/api/users", url.Values{"id": {strconv.Itoa(int(in.Id))}}, nil, out)
+}
+
+func (s *Service) CreateGroup(ctx context.Context, in *proxychatpb.Group) (*proxychatpb.Group, error) {
+	out := new(proxychatpb.Group)
+	return out, s.call(ctx, http.MethodPost, "/api/groups", nil, in, out)
+}
+
+func (s *Service) GetNearbyGroups(ctx context.Context, in *proxychatpb.NearbyRequest) (*proxychatpb.NearbyGroups, error) {
+	query := nearbyQuery(in)
+	if in.UserId != 0 {
+		query.Set("user_id", strconv.Itoa(int(in.UserId)))
+	}
+
+	out := new(proxychatpb.NearbyGroups)
+	return out, s.call(ctx, http.MethodGet, "/api/groups", query, nil, out)
+}
+
+func (s *Service) JoinGroup(ctx context.Context, in *proxychatpb.JoinGroupRequest) (*proxychatpb.StatusMessage, error) {
+	// The REST route takes both ids as strings
+	body, err := json.Marshal(map[string]string{"user_id": strconv.Itoa(int(in.UserId)), "group_id": strconv.Itoa(int(in.GroupId))})
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	data, err := s.roundTrip(ctx, http.MethodPost, "/api/groups/join", nil, body)
+	if err != nil {
+		return nil, err
+	}
+
+	out := new(proxychatpb.StatusMessage)
+	return out, decode(data, out)
+}
+
+func (s *Service) SendMessage(ctx context.Context, in *proxychatpb.Message) (*proxychatpb.Message, error) {
+	out := new(proxychatpb.Message)
+	return out, s.call(ctx, http.MethodPost, "/api/messages", nil, in, out)
+}
+
+func (s *Service) GetMessages(ctx context.Context, in *proxychatpb.GetMessagesRequest) (*proxychatpb.MessageList, error) {
+	query := url.Values{}
+	for name, id := range map[string]int32{"user_id": in.UserId, "group_id": in.GroupId, "thread_id": in.ThreadId} {
+		if id != 0 {
+			query.Set(name, strconv.Itoa(int(id)))
+		}
+	}
+	data, err := s.roundTrip(ctx, http.MethodGet, "/api/messages", query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The REST route answers with a bare array
+	var messages []json.RawMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, statusOf(err)
+	}
+	out := &proxychatpb.MessageList{Messages: make([]*proxychatpb.Message, len(messages))}
+	for i, raw := range messages {
+		out.Messages[i] = new(proxychatpb.Message)
+		if err := decode(raw, out.Messages[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Chat exchanges envelopes with the hub like an envelope WebSocket, the user, device, features
+// and the authorization of bots come from the metadata
+func (s *Service) Chat(stream grpc.BidiStreamingServer[proxychatpb.Envelope, proxychatpb.Envelope]) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	userID, err := strconv.Atoi(first(MetadataUserID))
+	if err != nil {
+		return statusOf(invalidUserID)
+	}
+
+	remoteAddr := ""
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		remoteAddr = p.Addr.String()
+	}
+
+	err = websocket.ServeStream(frameStream{stream}, userID, first(MetadataDeviceID), splitFeatures(md.Get(MetadataFeatures)), first("authorization"), remoteAddr, first("user-agent"))
+	if err != nil {
+		return statusOf(err)
+	}
+	return nil
+}
+
+// ChatContext adds the metadata of the Chat stream of a device to ctx. It keeps the metadata set
+// by the caller, such as the authorization of bots.
+func ChatContext(ctx context.Context, userID int, deviceID string, features []string) context.Context {
+	pairs := []string{MetadataUserID, strconv.Itoa(userID)}
+	if deviceID != "" {
+		pairs = append(pairs, MetadataDeviceID, deviceID)
+	}
+	for _, feature := range features {
+		pairs = append(pairs, MetadataFeatures, feature)
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...)
+}
+
+// frameStream adapts the Chat stream to the envelopes of the hub, payloads are the same JSON objects
+type frameStream struct {
+	stream grpc.BidiStreamingServer[proxychatpb.Envelope, proxychatpb.Envelope]
+}
+
+func (s frameStream) Context() context.Context {
+	return s.stream.Context()
+}
+
+func (s frameStream) Send(env *websocket.Envelope) error {
+	out := &proxychatpb.Envelope{Version: int32(env.Version), Type: env.Type, Id: env.ID, Ref: env.Ref}
+	if len(env.Payload) > 0 {
+		out.Payload = new(structpb.Struct)
+		if err := protojson.Unmarshal(env.Payload, out.Payload); err != nil {
+			return err
+		}
+	}
+	return s.stream.Send(out)
+}
+
+func (s frameStream) Recv() (*websocket.Envelope, error) {
+	in, err := s.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	env := &websocket.Envelope{Version: int(in.Version), Type: in.Type, ID: in.Id, Ref: in.Ref}
+	if in.Payload != nil {
+		env.Payload, err = protojson.Marshal(in.Payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+func nearbyQuery(in *proxychatpb.NearbyRequest) url.Values {
+	query := url.Values{}
+	query.Set("lat", strconv.FormatFloat(in.Lat, 'f', -1, 64))
+	query.Set("long", strconv.FormatFloat(in.Long, 'f', -1, 64))
+	if in.Radius != 0 {
+		query.Set("radius", strconv.Itoa(int(in.Radius)))
+	}
+	return query
+}
@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/config"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/validation"
+	"github.com/clementus360/proxy-chat/websocket"
+	"github.com/jackc/pgx/v5"
+)
+
+// Moderation actions accepted by TakeModerationAction
+const (
+	ActionWarn        = "warn"
+	ActionMute        = "mute"
+	ActionUnmute      = "unmute"
+	ActionSuspend     = "suspend"
+	ActionUnsuspend   = "unsuspend"
+	ActionRemoveGroup = "remove_group"
+)
+
+// indefiniteSuspension stands in for suspensions without an end date
+const indefiniteSuspension = 100 * 365 * 24 * time.Hour
+
+// RequireAdmin only lets requests through that carry the ADMIN_TOKEN as a bearer token.
+// The admin API is disabled when no token is configured.
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := config.GetEnv("ADMIN_TOKEN", "")
+		if token == "" {
+			apierror.Write(w, r, apierror.Forbidden("Admin API is disabled"))
+			return
+		}
+
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			apierror.Write(w, r, apierror.Unauthorized("Invalid admin token"))
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// moderatorName identifies the moderator in the audit log
+func moderatorName(r *http.Request) string {
+	if name := strings.TrimSpace(r.Header.Get("X-Moderator")); name != "" {
+		return name
+	}
+	return "admin"
+}
+
+// parsePagination reads limit and offset query parameters
+func parsePagination(r *http.Request, defaultLimit int, maxLimit int) (int, int, error) {
+	limit := defaultLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxLimit {
+			return 0, 0, fmt.Errorf("invalid limit, expected 1 to %d", maxLimit)
+		}
+		limit = parsed
+	}
+
+	offset := 0
+	if value := r.URL.Query().Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("invalid offset")
+		}
+		offset = parsed
+	}
+
+	return limit, offset, nil
+}
+
+func GetReports(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r, 50, 200)
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest(err.Error()))
+		return
+	}
+
+	// Default to the pending queue, oldest reports first
+	status := r.URL.Query().Get("status")
+	statuses := []string{models.ReportStatusOpen, models.ReportStatusTriaged}
+	if status != "" {
+		statuses = strings.Split(status, ",")
+	}
+
+	query := `SELECT id, COALESCE(reporter_id, 0), target_type, target_id, reason, COALESCE(details, ''), status,
+	                 COALESCE(resolution, ''), created_at, updated_at, resolved_at
+	          FROM reports
+	          WHERE status = ANY($1)
+	          ORDER BY created_at
+	          LIMIT $2 OFFSET $3`
+	rows, err := database.DB.Query(r.Context(), query, statuses, limit, offset)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch reports"))
+		log.Println("Error fetching reports:", err)
+		return
+	}
+	defer rows.Close()
+
+	reports := []models.Report{}
+	for rows.Next() {
+		var report models.Report
+		err = rows.Scan(&report.ID, &report.ReporterID, &report.TargetType, &report.TargetID, &report.Reason, &report.Details, &report.Status, &report.Resolution, &report.CreatedAt, &report.UpdatedAt, &report.ResolvedAt)
+		if err != nil {
+			apierror.Write(w, r, apierror.From(err, "Unable to fetch reports"))
+			log.Println("Error fetching reports:", err)
+			return
+		}
+		reports = append(reports, report)
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+func UpdateReport(w http.ResponseWriter, r *http.Request) {
+	// Parse report id from path
+	reportID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid report id"))
+		log.Println("Error parsing report id:", err)
+		return
+	}
+
+	// Parse request body
+	var requestData struct {
+		Status     string `json:"status" validate:"required,oneof=open triaged resolved dismissed"`
+		Resolution string `json:"resolution" validate:"max=2000"`
+	}
+	err = validation.DecodeJSON(r.Body, &requestData)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing report update from request body:", err)
+		return
+	}
+
+	// Every status change is recorded in the audit log under a matching action name
+	actions := map[string]string{
+		models.ReportStatusTriaged:   "triage_report",
+		models.ReportStatusResolved:  "resolve_report",
+		models.ReportStatusDismissed: "dismiss_report",
+		models.ReportStatusOpen:      "reopen_report",
+	}
+	action := actions[requestData.Status]
+
+	tx, err := database.DB.Begin(r.Context())
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to update report"))
+		log.Println("Error starting transaction:", err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var report models.Report
+	query := `UPDATE reports
+	          SET status = $2, resolution = NULLIF($3, ''), updated_at = NOW(),
+	              resolved_at = CASE WHEN $2 IN ('resolved', 'dismissed') THEN NOW() ELSE NULL END
+	          WHERE id = $1
+	          RETURNING id, COALESCE(reporter_id, 0), target_type, target_id, reason, COALESCE(details, ''), status,
+	                    COALESCE(resolution, ''), created_at, updated_at, resolved_at`
+	err = tx.QueryRow(r.Context(), query, reportID, requestData.Status, requestData.Resolution).Scan(&report.ID, &report.ReporterID, &report.TargetType, &report.TargetID, &report.Reason, &report.Details, &report.Status, &report.Resolution, &report.CreatedAt, &report.UpdatedAt, &report.ResolvedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound("Report not found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to update report"))
+		log.Println("Error updating report:", err)
+		return
+	}
+
+	err = database.LogModerationAction(r.Context(), tx, &models.ModerationAction{
+		Moderator:  moderatorName(r),
+		Action:     action,
+		TargetType: report.TargetType,
+		TargetID:   report.TargetID,
+		ReportID:   &report.ID,
+		Reason:     requestData.Resolution,
+	})
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to update report"))
+		log.Println("Error logging moderation action:", err)
+		return
+	}
+
+	if err = tx.Commit(r.Context()); err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to update report"))
+		log.Println("Error committing report update:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+	log.Println("Report", report.ID, "set to", report.Status)
+}
+
+func TakeModerationAction(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var requestData struct {
+		Action   string `json:"action" validate:"required,oneof=warn mute unmute suspend unsuspend remove_group"`
+		UserID   int    `json:"user_id" validate:"required_without=group_id,excluded_with=group_id"`
+		GroupID  int    `json:"group_id"`
+		Duration string `json:"duration"`
+		Reason   string `json:"reason" validate:"max=2000"`
+		ReportID *int   `json:"report_id"`
+	}
+	err := validation.DecodeJSON(r.Body, &requestData)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing moderation action from request body:", err)
+		return
+	}
+
+	action := models.ModerationAction{
+		Moderator:  moderatorName(r),
+		Action:     requestData.Action,
+		TargetType: models.ReportTargetUser,
+		TargetID:   requestData.UserID,
+		ReportID:   requestData.ReportID,
+		Reason:     requestData.Reason,
+	}
+
+	// Work out the statement enforcing the action
+	var query string
+	var args []interface{}
+	switch requestData.Action {
+	case ActionWarn:
+		query = "SELECT 1 FROM users WHERE id = $1"
+		args = []interface{}{requestData.UserID}
+
+	case ActionMute, ActionSuspend:
+		duration := indefiniteSuspension
+		if requestData.Duration != "" {
+			duration, err = validation.ParseDuration(requestData.Duration)
+			if err != nil {
+				apierror.Write(w, r, apierror.Invalid("duration", err.Error()))
+				return
+			}
+		} else if requestData.Action == ActionMute {
+			apierror.Write(w, r, apierror.Invalid("duration", "is required"))
+			return
+		}
+
+		expiresAt := time.Now().Add(duration)
+		action.ExpiresAt = &expiresAt
+		column := "muted_until"
+		if requestData.Action == ActionSuspend {
+			column = "suspended_until"
+		}
+		query = fmt.Sprintf("UPDATE users SET %s = $2 WHERE id = $1 RETURNING 1", column)
+		args = []interface{}{requestData.UserID, expiresAt}
+
+	case ActionUnmute:
+		query = "UPDATE users SET muted_until = NULL WHERE id = $1 RETURNING 1"
+		args = []interface{}{requestData.UserID}
+
+	case ActionUnsuspend:
+		query = "UPDATE users SET suspended_until = NULL WHERE id = $1 RETURNING 1"
+		args = []interface{}{requestData.UserID}
+
+	case ActionRemoveGroup:
+		action.TargetType = models.ReportTargetGroup
+		action.TargetID = requestData.GroupID
+		query = "UPDATE chat_groups SET removed_at = NOW() WHERE id = $1 AND removed_at IS NULL RETURNING 1"
+		args = []interface{}{requestData.GroupID}
+
+	default:
+		apierror.Write(w, r, apierror.Invalid("action", "Invalid action"))
+		return
+	}
+
+	tx, err := database.DB.Begin(r.Context())
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to apply moderation action"))
+		log.Println("Error starting transaction:", err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var found int
+	err = tx.QueryRow(r.Context(), query, args...).Scan(&found)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound("Moderation target not found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to apply moderation action"))
+		log.Println("Error applying moderation action:", err)
+		return
+	}
+
+	if err = database.LogModerationAction(r.Context(), tx, &action); err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to apply moderation action"))
+		log.Println("Error logging moderation action:", err)
+		return
+	}
+
+	if err = tx.Commit(r.Context()); err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to apply moderation action"))
+		log.Println("Error committing moderation action:", err)
+		return
+	}
+
+	enforceModerationAction(r.Context(), action)
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(action)
+	log.Println("Moderation action", action.Action, "applied to", action.TargetType, action.TargetID, "by", action.Moderator)
+}
+
+// enforceModerationAction applies the realtime side of an action: notifying the user,
+// closing the connection of suspended accounts and stopping fan-out to removed groups
+func enforceModerationAction(ctx context.Context, action models.ModerationAction) {
+	if action.Action == ActionRemoveGroup {
+		members, err := websocket.GroupMembers(action.TargetID)
+		if err != nil {
+			log.Println("Error fetching members of removed group:", err)
+		}
+		for _, memberID := range members {
+			database.RedisClient.SRem(ctx, fmt.Sprintf("user_groups:%s", memberID), action.TargetID)
+		}
+		database.RedisClient.Del(ctx, fmt.Sprintf("group:%d", action.TargetID))
+		return
+	}
+
+	websocket.SendToUser(action.TargetID, websocket.WsMessage{
+		Type:      websocket.TypeModeration,
+		Status:    action.Action,
+		Content:   action.Reason,
+		ExpiresAt: action.ExpiresAt,
+	})
+
+	if action.Action == ActionSuspend {
+		websocket.DisconnectUser(action.TargetID, "account suspended")
+	}
+}
+
+func GetModerationLog(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePagination(r, 50, 200)
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest(err.Error()))
+		return
+	}
+
+	query := `SELECT id, moderator, action, target_type, target_id, report_id, COALESCE(reason, ''), expires_at, created_at
+	          FROM moderation_actions
+	          ORDER BY created_at DESC, id DESC
+	          LIMIT $1 OFFSET $2`
+	rows, err := database.DB.Query(r.Context(), query, limit, offset)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch moderation log"))
+		log.Println("Error fetching moderation log:", err)
+		return
+	}
+	defer rows.Close()
+
+	actions := []models.ModerationAction{}
+	for rows.Next() {
+		var action models.ModerationAction
+		err = rows.Scan(&action.ID, &action.Moderator, &action.Action, &action.TargetType, &action.TargetID, &action.ReportID, &action.Reason, &action.ExpiresAt, &action.CreatedAt)
+		if err != nil {
+			apierror.Write(w, r, apierror.From(err, "Unable to fetch moderation log"))
+			log.Println("Error fetching moderation log:", err)
+			return
+		}
+		actions = append(actions, action)
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(actions)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          int
+	}{
+		{"admin API disabled", "", "Bearer ", http.StatusForbidden},
+		{"missing token", "s3cret", "", http.StatusUnauthorized},
+		{"wrong token", "s3cret", "Bearer wrong", http.StatusUnauthorized},
+		{"token without scheme", "s3cret", "s3cret", http.StatusOK},
+		{"valid token", "s3cret", "Bearer s3cret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ADMIN_TOKEN", tt.token)
+
+			r := httptest.NewRequest(http.MethodGet, "/api/admin/reports", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			RequireAdmin(func(w http.ResponseWriter, r *http.Request) {})(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantLimit  int
+		wantOffset int
+		wantErr    bool
+	}{
+		{"", 50, 0, false},
+		{"limit=10&offset=20", 10, 20, false},
+		{"limit=200", 200, 0, false},
+		{"limit=201", 0, 0, true},
+		{"limit=0", 0, 0, true},
+		{"limit=ten", 0, 0, true},
+		{"offset=-1", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/admin/reports?"+tt.query, nil)
+			limit, offset, err := parsePagination(r, 50, 200)
+			if (err != nil) != tt.wantErr || limit != tt.wantLimit || offset != tt.wantOffset {
+				t.Errorf("parsePagination() = %d, %d, %v, want %d, %d, error %t", limit, offset, err, tt.wantLimit, tt.wantOffset, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestModeratorName(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "admin"},
+		{"   ", "admin"},
+		{" alice ", "alice"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/admin/audit", nil)
+		r.Header.Set("X-Moderator", tt.header)
+		if got := moderatorName(r); got != tt.want {
+			t.Errorf("moderatorName(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestRemovedGroupRefusesPosts(t *testing.T) {
+	testenv.Postgres(t)
+	bg := context.Background()
+
+	owner := testenv.CreateUser(t)
+	member := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, owner)
+	if err := database.AddGroupMember(bg, groupID, member, database.RoleMember); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	TakeModerationAction(w, httptest.NewRequest(http.MethodPost, "/api/admin/actions", strings.NewReader(fmt.Sprintf(`{"action": "remove_group", "group_id": %d}`, groupID))))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("remove_group status = %d: %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		name   string
+		userID int
+	}{
+		{"owner", owner},
+		{"member", member},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			membership, err := database.GroupMembership(bg, groupID, tt.userID)
+			if err != nil || membership.Role != "" {
+				t.Errorf("GroupMembership() = %+v, %v, want no membership", membership, err)
+			}
+			if moderator, err := database.IsGroupModerator(bg, groupID, tt.userID); err != nil || moderator {
+				t.Errorf("IsGroupModerator() = %v, %v, want false", moderator, err)
+			}
+
+			w := httptest.NewRecorder()
+			body := fmt.Sprintf(`{"sender_id": %d, "group_id": %d, "content": "still here from %s"}`, tt.userID, groupID, tt.name)
+			SendMessage(w, httptest.NewRequest(http.MethodPost, "/api/messages", strings.NewReader(body)))
+			if w.Code != http.StatusForbidden {
+				t.Errorf("SendMessage status = %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+			}
+
+			// Moderators of the removed group cannot bring fan-out back by adding bots
+			r := httptest.NewRequest(http.MethodPost, "/api/groups/"+strconv.Itoa(groupID)+"/bots", strings.NewReader(fmt.Sprintf(`{"user_id": %d, "bot_id": %d}`, tt.userID, member)))
+			r.SetPathValue("id", strconv.Itoa(groupID))
+			w = httptest.NewRecorder()
+			AddGroupBot(w, r)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("AddGroupBot status = %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+
+	var stored int
+	database.DB.QueryRow(bg, "SELECT COUNT(*) FROM messages WHERE group_id = $1", groupID).Scan(&stored)
+	if stored != 0 {
+		t.Errorf("stored %d messages in the removed group", stored)
+	}
+}
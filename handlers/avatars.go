@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/imaging"
+	"github.com/clementus360/proxy-chat/storage"
+)
+
+// maxAvatarSize is the largest image accepted by UploadAvatar
+const maxAvatarSize = 5 << 20
+
+// Avatar owners, used in blob keys and avatar URLs
+const (
+	avatarKindUsers  = "users"
+	avatarKindGroups = "groups"
+)
+
+// storeAvatar saves every thumbnail size of an avatar and returns the URL serving it.
+// The URL carries a version so clients refetch the image when it changes.
+func storeAvatar(ctx context.Context, kind string, id int, img image.Image) (string, error) {
+	keepAlpha := imaging.HasAlpha(img)
+
+	for _, size := range imaging.ThumbnailSizes {
+		thumb := imaging.Thumbnail(img, size)
+
+		var encoded imaging.Image
+		var err error
+		if keepAlpha {
+			encoded, err = imaging.EncodePNG(thumb)
+		} else {
+			encoded, err = imaging.EncodeJPEG(thumb)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		key := fmt.Sprintf("avatars/%s/%d/%d", kind, id, size)
+		err = storage.Blobs.Put(ctx, key, bytes.NewReader(encoded.Data), int64(len(encoded.Data)), encoded.ContentType)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("/api/avatars/%s/%d?v=%d", kind, id, time.Now().Unix()), nil
+}
+
+// generateAvatar renders an initials avatar for a user or group that did not provide an image
+func generateAvatar(ctx context.Context, kind string, id int, name string) (string, error) {
+	return storeAvatar(ctx, kind, id, imaging.InitialsAvatar(name, slices.Max(imaging.ThumbnailSizes)))
+}
+
+func GetAvatar(w http.ResponseWriter, r *http.Request) {
+	kind := r.PathValue("kind")
+	if kind != avatarKindUsers && kind != avatarKindGroups {
+		apierror.Write(w, r, apierror.NotFound("Avatar not found"))
+		return
+	}
+
+	// Parse owner id from path
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid id"))
+		log.Println("Error parsing avatar owner id:", err)
+		return
+	}
+
+	// Parse thumbnail size from query string
+	size := imaging.DefaultSize
+	if r.URL.Query().Get("size") != "" {
+		size, err = strconv.Atoi(r.URL.Query().Get("size"))
+		if err != nil || !slices.Contains(imaging.ThumbnailSizes, size) {
+			apierror.Write(w, r, apierror.Invalid("size", fmt.Sprintf("Invalid size, expected one of %v", imaging.ThumbnailSizes)))
+			return
+		}
+	}
+
+	blob, err := storage.Blobs.Get(r.Context(), fmt.Sprintf("avatars/%s/%d/%d", kind, id, size))
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Avatar not found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch avatar"))
+		log.Println("Error reading avatar blob:", err)
+		return
+	}
+	defer blob.Close()
+
+	// Thumbnails are PNG or JPEG depending on transparency, sniff which one this is
+	reader := bufio.NewReader(blob)
+	head, _ := reader.Peek(512)
+
+	w.Header().Set("Content-Type", http.DetectContentType(head))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	io.Copy(w, reader)
+}
+
+func UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	kind := r.PathValue("kind")
+	if kind != avatarKindUsers && kind != avatarKindGroups {
+		apierror.Write(w, r, apierror.NotFound("Avatar not found"))
+		return
+	}
+
+	// Parse owner id from path
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid id"))
+		log.Println("Error parsing avatar owner id:", err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarSize+(1<<20))
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			apierror.Write(w, r, apierror.TooLarge("Image too large"))
+			return
+		}
+		apierror.Write(w, r, apierror.Invalid("file", "Missing file"))
+		log.Println("Error reading uploaded avatar:", err)
+		return
+	}
+	defer file.Close()
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	// Users may only change their own avatar, group images may only be changed by group moderators
+	if kind == avatarKindUsers && userID != id {
+		apierror.Write(w, r, apierror.Forbidden("Users can only change their own avatar"))
+		return
+	}
+	if kind == avatarKindGroups {
+		isModerator, err := database.IsGroupModerator(r.Context(), id, userID)
+		if err != nil {
+			apierror.Write(w, r, apierror.From(err, "Unable to update group image"))
+			log.Println("Error checking group role:", err)
+			return
+		}
+		if !isModerator {
+			apierror.Write(w, r, apierror.Forbidden("Only group moderators can change the group image"))
+			return
+		}
+	}
+
+	// Check the owner exists before any thumbnail is stored
+	table := "users"
+	if kind == avatarKindGroups {
+		table = "chat_groups"
+	}
+	var exists bool
+	err = database.DB.QueryRow(r.Context(), "SELECT EXISTS (SELECT 1 FROM "+table+" WHERE id = $1)", id).Scan(&exists)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to store image"))
+		log.Println("Error checking avatar owner:", err)
+		return
+	}
+	if !exists {
+		apierror.Write(w, r, apierror.NotFound("Not found"))
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarSize+1))
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Unable to read image"))
+		log.Println("Error reading uploaded avatar:", err)
+		return
+	}
+	if len(data) > maxAvatarSize {
+		apierror.Write(w, r, apierror.TooLarge("Image too large"))
+		return
+	}
+
+	// Thumbnails are rendered from the decoded pixels, so no metadata survives
+	img, _, err := imaging.Decode(data)
+	if errors.Is(err, imaging.ErrImageTooLarge) {
+		apierror.Write(w, r, apierror.TooLarge(fmt.Sprintf("Images may have at most %d pixels", imaging.MaxPixels)))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.UnsupportedMedia("Unsupported image"))
+		log.Println("Error decoding uploaded avatar:", err)
+		return
+	}
+
+	imageURL, err := storeAvatar(r.Context(), kind, id, img)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to store image"))
+		log.Println("Error storing avatar:", err)
+		return
+	}
+
+	tag, err := database.DB.Exec(r.Context(), "UPDATE "+table+" SET image_url = $1 WHERE id = $2", imageURL, id)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to store image"))
+		log.Println("Error updating image url:", err)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		apierror.Write(w, r, apierror.NotFound("Not found"))
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(fmt.Sprintf(`{"image_url": %q}`, imageURL)))
+	log.Println("Avatar updated for", kind, id)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/internal/testenv"
+	"github.com/clementus360/proxy-chat/storage"
+)
+
+// avatarRequest builds the multipart upload of a small PNG avatar
+func avatarRequest(t *testing.T, kind string, id int, userID string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if userID != "" {
+		form.WriteField("user_id", userID)
+	}
+	file, _ := form.CreateFormFile("file", "avatar.png")
+	if err := png.Encode(file, image.NewRGBA(image.Rect(0, 0, 32, 32))); err != nil {
+		t.Fatal(err)
+	}
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/avatars/"+kind+"/"+strconv.Itoa(id), &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r.SetPathValue("kind", kind)
+	r.SetPathValue("id", strconv.Itoa(id))
+	return r
+}
+
+func TestUploadAvatarRequiresOwner(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     int
+		userID string
+		want   int
+	}{
+		{"missing user id", 7, "", http.StatusBadRequest},
+		{"invalid user id", 7, "seven", http.StatusBadRequest},
+		{"another user", 7, "8", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			UploadAvatar(w, avatarRequest(t, avatarKindUsers, tt.id, tt.userID))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestUploadAvatarStoresNothingForMissingOwner(t *testing.T) {
+	testenv.Postgres(t)
+	root := t.TempDir()
+	previous := storage.Blobs
+	storage.Blobs, _ = storage.NewLocalStore(root)
+	t.Cleanup(func() { storage.Blobs = previous })
+
+	// Ids are never reused, so one past the newest user does not exist
+	missing := testenv.CreateUser(t) + 1000000
+	w := httptest.NewRecorder()
+	UploadAvatar(w, avatarRequest(t, avatarKindUsers, missing, strconv.Itoa(missing)))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusNotFound, w.Body)
+	}
+	if _, err := os.Stat(filepath.Join(root, "avatars", avatarKindUsers, strconv.Itoa(missing))); !os.IsNotExist(err) {
+		t.Errorf("thumbnails were stored for a missing user: %v", err)
+	}
+
+	owner := testenv.CreateUser(t)
+	w = httptest.NewRecorder()
+	UploadAvatar(w, avatarRequest(t, avatarKindUsers, owner, strconv.Itoa(owner)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if _, err := os.Stat(filepath.Join(root, "avatars", avatarKindUsers, strconv.Itoa(owner), "256")); err != nil {
+		t.Errorf("thumbnail of the owner was not stored: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/validation"
+)
+
+func BlockUser(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var requestData struct {
+		UserID    int `json:"user_id" validate:"required"`
+		BlockedID int `json:"blocked_id" validate:"required"`
+	}
+	err := validation.DecodeJSON(r.Body, &requestData)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing block from request body:", err)
+		return
+	}
+
+	if requestData.UserID == requestData.BlockedID {
+		apierror.Write(w, r, apierror.Invalid("blocked_id", "Users cannot block themselves"))
+		return
+	}
+
+	err = database.BlockUser(r.Context(), requestData.UserID, requestData.BlockedID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to block user"))
+		log.Println("Error blocking user:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(`{"message": "User blocked successfully"}`))
+	log.Println("User", requestData.UserID, "blocked user", requestData.BlockedID)
+}
+
+func UnblockUser(w http.ResponseWriter, r *http.Request) {
+	// Parse user ids from query string
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	blockedID, err := strconv.Atoi(r.URL.Query().Get("blocked_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("blocked_id", "Invalid blocked user id"))
+		log.Println("Error parsing blocked user id:", err)
+		return
+	}
+
+	removed, err := database.UnblockUser(r.Context(), userID, blockedID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to unblock user"))
+		log.Println("Error unblocking user:", err)
+		return
+	}
+	if !removed {
+		apierror.Write(w, r, apierror.NotFound("User is not blocked"))
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "User unblocked successfully"}`))
+	log.Println("User", userID, "unblocked user", blockedID)
+}
+
+func GetBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	// Parse user id from query string
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	query := `SELECT u.id, u.username, COALESCE(u.image_url, ''), u.visible, u.online, u.last_active, u.created_at
+	          FROM user_blocks b
+	          JOIN users u ON u.id = b.blocked_id
+	          WHERE b.blocker_id = $1
+	          ORDER BY b.created_at DESC`
+	rows, err := database.DB.Query(r.Context(), query, userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch blocked users"))
+		log.Println("Error fetching blocked users:", err)
+		return
+	}
+	defer rows.Close()
+
+	users := []UserResponse{}
+	for rows.Next() {
+		var user UserResponse
+		err = rows.Scan(&user.ID, &user.Username, &user.Image_url, &user.Visible, &user.Online, &user.LastActive, &user.CreatedAt)
+		if err != nil {
+			apierror.Write(w, r, apierror.From(err, "Unable to fetch blocked users"))
+			log.Println("Error fetching blocked users:", err)
+			return
+		}
+		users = append(users, user)
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+	log.Println("Blocked users fetched for user:", userID)
+}
@@ -0,0 +1,477 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/bots"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/ratelimit"
+	"github.com/clementus360/proxy-chat/validation"
+	"github.com/clementus360/proxy-chat/webhooks"
+)
+
+// Most bots a user may own
+const maxBotsPerOwner = 10
+
+// BotCredentials is a bot with its token, returned when the bot is created and when its token
+// is replaced
+type BotCredentials struct {
+	models.Bot
+	Token string `json:"token"`
+}
+
+type botContextKey struct{}
+
+// RequireBot only lets requests through that carry a bot token as "Authorization: Bot <token>",
+// then limits them per bot with rule. Handlers read the bot with requestBot.
+func RequireBot(rule ratelimit.Rule, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bot, err := bots.Authenticate(r.Context(), r.Header.Get("Authorization"))
+		if errors.Is(err, bots.ErrNoToken) || errors.Is(err, database.ErrBotNotFound) {
+			// Failed attempts are limited per address so tokens cannot be guessed
+			if ratelimit.Admit(w, r, ratelimit.Allow(r.Context(), "bot_auth:ip:"+ratelimit.ClientIP(r), ratelimit.RuleWrite)) {
+				apierror.Write(w, r, apierror.Unauthorized("Invalid bot token"))
+			}
+			return
+		}
+		if err != nil {
+			apierror.Write(w, r, apierror.From(err, "Unable to authenticate bot"))
+			log.Println("Error authenticating bot:", err)
+			return
+		}
+
+		if !ratelimit.Admit(w, r, ratelimit.Allow(r.Context(), rule.Name+":bot:"+strconv.Itoa(bot.ID), rule)) {
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), botContextKey{}, bot)))
+	}
+}
+
+// requestBot returns the bot authenticated by RequireBot
+func requestBot(r *http.Request) models.Bot {
+	return r.Context().Value(botContextKey{}).(models.Bot)
+}
+
+// ownedBot loads the bot named by the id path value and checks that userID owns it.
+// It returns false when the request was answered.
+func ownedBot(w http.ResponseWriter, r *http.Request, userID int) (models.Bot, bool) {
+	botID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid bot id"))
+		log.Println("Error parsing bot id:", err)
+		return models.Bot{}, false
+	}
+
+	bot, err := database.GetBot(r.Context(), botID)
+	if errors.Is(err, database.ErrBotNotFound) || (err == nil && bot.OwnerID != userID) {
+		apierror.Write(w, r, apierror.NotFound("Bot not found"))
+		return bot, false
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch bot"))
+		log.Println("Error fetching bot:", err)
+		return bot, false
+	}
+	return bot, true
+}
+
+func CreateBot(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var bot models.Bot
+	err := validation.DecodeJSON(r.Body, &bot)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing bot from request body:", err)
+		return
+	}
+	bot.Commands = []models.BotCommand{}
+
+	if !checkRestrictions(w, r, bot.OwnerID, false) {
+		return
+	}
+
+	// Bots are owned by people
+	ownerIsBot, err := database.IsBot(r.Context(), bot.OwnerID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to create bot"))
+		log.Println("Error checking bot owner:", err)
+		return
+	}
+	if ownerIsBot {
+		apierror.Write(w, r, apierror.Forbidden("Bots cannot own bots"))
+		return
+	}
+
+	owned, err := database.BotsByOwner(r.Context(), bot.OwnerID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to create bot"))
+		log.Println("Error fetching bots of owner:", err)
+		return
+	}
+	if len(owned) >= maxBotsPerOwner {
+		apierror.Write(w, r, apierror.Conflict(fmt.Sprintf("Users can own at most %d bots", maxBotsPerOwner)))
+		return
+	}
+
+	token, err := bots.NewToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Unable to create bot"))
+		log.Println("Error generating bot token:", err)
+		return
+	}
+
+	err = database.CreateBot(r.Context(), &bot, bots.HashToken(token))
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to create bot"))
+		log.Println("Error creating bot:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(BotCredentials{Bot: bot, Token: token})
+	log.Println("Bot created:", bot.ID, bot.Username, "owned by user", bot.OwnerID)
+}
+
+func GetBots(w http.ResponseWriter, r *http.Request) {
+	// Parse owner id from query string
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	owned, err := database.BotsByOwner(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch bots"))
+		log.Println("Error fetching bots:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(owned)
+}
+
+func DeleteBot(w http.ResponseWriter, r *http.Request) {
+	// Parse owner id from query string
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	bot, ok := ownedBot(w, r, userID)
+	if !ok {
+		return
+	}
+
+	err = database.DeleteBot(r.Context(), bot.ID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to delete bot"))
+		log.Println("Error deleting bot:", err)
+		return
+	}
+
+	log.Println("Bot deleted:", bot.ID)
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"message": "Bot deleted successfully"}`))
+}
+
+func ResetBotToken(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var requestData struct {
+		UserID int `json:"user_id" validate:"required"`
+	}
+	err := validation.DecodeJSON(r.Body, &requestData)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing request body:", err)
+		return
+	}
+
+	bot, ok := ownedBot(w, r, requestData.UserID)
+	if !ok {
+		return
+	}
+
+	token, err := bots.NewToken()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Unable to reset bot token"))
+		log.Println("Error generating bot token:", err)
+		return
+	}
+
+	err = database.SetBotToken(r.Context(), bot.ID, bots.HashToken(token))
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to reset bot token"))
+		log.Println("Error saving bot token:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BotCredentials{Bot: bot, Token: token})
+	log.Println("Token reset for bot", bot.ID)
+}
+
+func AddGroupBot(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var requestData struct {
+		UserID int `json:"user_id" validate:"required"`
+		BotID  int `json:"bot_id" validate:"required"`
+	}
+	err := validation.DecodeJSON(r.Body, &requestData)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing request body:", err)
+		return
+	}
+
+	// Only group moderators may add bots, bots have no location to join groups nearby
+	groupID, ok := groupModerator(w, r, requestData.UserID)
+	if !ok {
+		return
+	}
+
+	_, err = database.GetBot(r.Context(), requestData.BotID)
+	if errors.Is(err, database.ErrBotNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Bot not found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to add bot"))
+		log.Println("Error fetching bot:", err)
+		return
+	}
+
+	member, err := database.IsGroupMember(r.Context(), groupID, requestData.BotID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to add bot"))
+		log.Println("Error checking group membership:", err)
+		return
+	}
+	if member {
+		apierror.Write(w, r, apierror.Conflict("Bot is already a member of the group"))
+		return
+	}
+
+	err = database.AddGroupMember(r.Context(), groupID, requestData.BotID, database.RoleMember)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to add bot"))
+		log.Println("Error adding bot to group:", err)
+		return
+	}
+
+	webhooks.Emit(r.Context(), models.WebhookMemberJoined, groupID, webhooks.Member{GroupID: groupID, UserID: requestData.BotID, Role: database.RoleMember})
+
+	log.Println("Bot", requestData.BotID, "added to group", groupID, "by user", requestData.UserID)
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(`{"message": "Bot added to group successfully"}`))
+}
+
+func RemoveGroupBot(w http.ResponseWriter, r *http.Request) {
+	// Parse moderator id from query string
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	groupID, ok := groupModerator(w, r, userID)
+	if !ok {
+		return
+	}
+
+	botID, err := strconv.Atoi(r.PathValue("bot_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("bot_id", "Invalid bot id"))
+		log.Println("Error parsing bot id:", err)
+		return
+	}
+
+	// Only bots can be removed here, members leave on their own
+	isBot, err := database.IsBot(r.Context(), botID)
+	if err == nil && isBot {
+		isBot, err = database.IsGroupMember(r.Context(), groupID, botID)
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to remove bot"))
+		log.Println("Error checking group membership:", err)
+		return
+	}
+	if !isBot {
+		apierror.Write(w, r, apierror.NotFound("Bot is not a member of the group"))
+		return
+	}
+
+	err = database.RemoveGroupMember(r.Context(), groupID, botID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to remove bot"))
+		log.Println("Error removing bot from group:", err)
+		return
+	}
+
+	webhooks.Emit(r.Context(), models.WebhookMemberLeft, groupID, webhooks.Member{GroupID: groupID, UserID: botID, Role: database.RoleMember})
+
+	log.Println("Bot", botID, "removed from group", groupID, "by user", userID)
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"message": "Bot removed from group successfully"}`))
+}
+
+func GetBotMe(w http.ResponseWriter, r *http.Request) {
+	bot, err := database.GetBot(r.Context(), requestBot(r).ID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch bot"))
+		log.Println("Error fetching bot:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bot)
+}
+
+func SetBotCommands(w http.ResponseWriter, r *http.Request) {
+	bot := requestBot(r)
+
+	// Parse request body
+	var requestData struct {
+		Commands []models.BotCommand `json:"commands" validate:"max=50"`
+	}
+	err := validation.DecodeJSON(r.Body, &requestData)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing bot commands from request body:", err)
+		return
+	}
+
+	seen := map[string]bool{}
+	for i := range requestData.Commands {
+		if err := validation.Struct(&requestData.Commands[i]); err != nil {
+			apierror.Write(w, r, err)
+			return
+		}
+		if seen[requestData.Commands[i].Name] {
+			apierror.Write(w, r, apierror.Invalid("commands", "Duplicate command /"+requestData.Commands[i].Name))
+			return
+		}
+		seen[requestData.Commands[i].Name] = true
+	}
+
+	err = database.SetBotCommands(r.Context(), bot.ID, requestData.Commands)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to save bot commands"))
+		log.Println("Error saving bot commands:", err)
+		return
+	}
+
+	commands, err := database.BotCommands(r.Context(), bot.ID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch bot commands"))
+		log.Println("Error fetching bot commands:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commands)
+	log.Println("Commands updated for bot", bot.ID)
+}
+
+func SendBotMessage(w http.ResponseWriter, r *http.Request) {
+	// Parse request body. The sender is the bot, it is set before decoding so sender_id may be
+	// left out and after so it cannot be changed.
+	var message models.Message
+	message.SenderID = requestBot(r).ID
+	err := validation.DecodeJSON(r.Body, &message)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing message from request body:", err)
+		return
+	}
+	message.SenderID = requestBot(r).ID
+
+	sendMessage(w, r, &message, true)
+}
+
+func SetBotWebhook(w http.ResponseWriter, r *http.Request) {
+	bot := requestBot(r)
+
+	// Parse request body
+	var hook models.Webhook
+	err := validation.DecodeJSON(r.Body, &hook)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing webhook from request body:", err)
+		return
+	}
+	hook.GroupID, hook.BotID, hook.CreatedBy = nil, &bot.ID, &bot.OwnerID
+
+	if !checkWebhook(w, r, &hook, webhooks.BotEvents) {
+		return
+	}
+
+	// A bot has one webhook, which is replaced
+	existing, err := database.BotWebhook(r.Context(), bot.ID)
+	if err == nil {
+		err = database.DeleteWebhook(r.Context(), existing.ID)
+	}
+	if err != nil && !errors.Is(err, database.ErrWebhookNotFound) {
+		apierror.Write(w, r, apierror.From(err, "Unable to replace webhook"))
+		log.Println("Error replacing bot webhook:", err)
+		return
+	}
+
+	createWebhook(w, r, &hook)
+}
+
+func DeleteBotWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, err := database.BotWebhook(r.Context(), requestBot(r).ID)
+	if errors.Is(err, database.ErrWebhookNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Webhook not found"))
+		return
+	}
+	if err == nil {
+		err = database.DeleteWebhook(r.Context(), hook.ID)
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to delete webhook"))
+		log.Println("Error deleting bot webhook:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"message": "Webhook deleted successfully"}`))
+}
+
+func GetBotWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	hook, err := database.BotWebhook(r.Context(), requestBot(r).ID)
+	if errors.Is(err, database.ErrWebhookNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Webhook not found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch webhook"))
+		log.Println("Error fetching bot webhook:", err)
+		return
+	}
+	writeWebhookDeliveries(w, r, hook.ID)
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/filters"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/validation"
+)
+
+// Longest blocked word or domain accepted in group filter settings
+const maxFilterEntryLen = 100
+
+// filterMessage runs the message filters and replies with an error when the message is refused.
+// It returns false when the request was answered.
+func filterMessage(w http.ResponseWriter, r *http.Request, msg *filters.Message) bool {
+	err := filters.Run(r.Context(), msg)
+	if err == nil {
+		return true
+	}
+
+	var rejection *filters.Rejection
+	if errors.As(err, &rejection) {
+		status := http.StatusUnprocessableEntity
+		if rejection.Code == filters.CodeFlooding {
+			status = http.StatusTooManyRequests
+		}
+		apierror.Write(w, r, apierror.New(status, rejection.Code, rejection.Reason))
+		return false
+	}
+
+	apierror.Write(w, r, apierror.From(err, "Unable to check message content"))
+	log.Println("Error filtering message:", err)
+	return false
+}
+
+// normalizeFilterList lowercases and trims entries, dropping empty ones and duplicates
+func normalizeFilterList(values []string) ([]string, error) {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" || seen[value] {
+			continue
+		}
+		if len(value) > maxFilterEntryLen {
+			return nil, fmt.Errorf("entries are limited to %d characters", maxFilterEntryLen)
+		}
+		seen[value] = true
+		normalized = append(normalized, value)
+	}
+	return normalized, nil
+}
+
+func GetGroupFilters(w http.ResponseWriter, r *http.Request) {
+	// Parse group id from path
+	groupID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid group id"))
+		log.Println("Error parsing group id:", err)
+		return
+	}
+
+	settings, err := database.GroupFilterSettings(r.Context(), groupID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch group filters"))
+		log.Println("Error fetching group filters:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func UpdateGroupFilters(w http.ResponseWriter, r *http.Request) {
+	// Parse group id from path
+	groupID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid group id"))
+		log.Println("Error parsing group id:", err)
+		return
+	}
+
+	// Parse request body
+	var requestData struct {
+		UserID int `json:"user_id" validate:"required"`
+		models.GroupFilterSettings
+	}
+	err = validation.DecodeJSON(r.Body, &requestData)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing group filters from request body:", err)
+		return
+	}
+	settings := requestData.GroupFilterSettings
+	settings.GroupID = groupID
+
+	// Only group moderators may change the filters
+	isModerator, err := database.IsGroupModerator(r.Context(), groupID, requestData.UserID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to update group filters"))
+		log.Println("Error checking group role:", err)
+		return
+	}
+	if !isModerator {
+		apierror.Write(w, r, apierror.Forbidden("Only group moderators can change filters"))
+		return
+	}
+
+	// Groups can only lower the server wide limit, which is configured at runtime
+	if settings.MaxLength != nil && *settings.MaxLength > filters.MaxLength() {
+		apierror.Write(w, r, apierror.Invalid("max_length", fmt.Sprintf("must be at most %d", filters.MaxLength())))
+		return
+	}
+
+	settings.BlockedWords, err = normalizeFilterList(settings.BlockedWords)
+	if err == nil {
+		settings.AllowedDomains, err = normalizeFilterList(settings.AllowedDomains)
+	}
+	if err == nil {
+		settings.DeniedDomains, err = normalizeFilterList(settings.DeniedDomains)
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Invalid filter list: "+err.Error()))
+		return
+	}
+
+	err = database.SaveGroupFilterSettings(r.Context(), &settings)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to update group filters"))
+		log.Println("Error saving group filters:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+	log.Println("Filters updated for group", groupID, "by user", requestData.UserID)
+}
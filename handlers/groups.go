@@ -2,21 +2,26 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
-	"strings"
 
+	"github.com/clementus360/proxy-chat/apierror"
 	"github.com/clementus360/proxy-chat/database"
 	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/validation"
+	"github.com/clementus360/proxy-chat/webhooks"
 )
 
 type GroupResponse struct {
-	ID         int    `json:"id"`
-	Name       string `json:"name"`
-	Image_url  string `json:"image_url"`
-	Creator_id int    `json:"creator_id"`
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Image_url   string `json:"image_url"`
+	Creator_id  int    `json:"creator_id"`
+	UnreadCount int    `json:"unread_count,omitempty"`
 }
 
 type GetGroupsResponse struct {
@@ -29,19 +34,15 @@ func CreateGroup(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body
 	var group models.Group
-	err := json.NewDecoder(r.Body).Decode(&group)
+	err := validation.DecodeJSON(r.Body, &group)
 	if err != nil {
-		http.Error(w, "Unable to parse request body", http.StatusBadRequest)
+		apierror.Write(w, r, err)
 		log.Println("Error parsing group from request body:", err)
 		return
 	}
 
-	// Create initials from group name with random background color
-	if group.Image_url == "" {
-		groupName := strings.ReplaceAll(group.Name, " ", "")
-		backgroundColor := fmt.Sprintf("%06x", (int(group.CreatorID)*12345+100000)&0xB0B0B0)
-		textColor := "ffffff"
-		group.Image_url = fmt.Sprintf("https://ui-avatars.com/api/?name=%s&background=%s&color=%s&size=256", groupName, backgroundColor, textColor)
+	if !checkRestrictions(w, r, group.CreatorID, true) {
+		return
 	}
 
 	// Ensure location is valid and create a point from latitude and longitude
@@ -51,11 +52,31 @@ func CreateGroup(w http.ResponseWriter, r *http.Request) {
 	query := "INSERT INTO chat_groups (name, creator_id, latitude, longitude, image_url, location) VALUES ($1, $2, $3, $4, $5, ST_GeographyFromText($6)) RETURNING id, created_at, image_url"
 	err = database.DB.QueryRow(r.Context(), query, group.Name, group.CreatorID, group.Latitude, group.Longitude, group.Image_url, location).Scan(&group.ID, &group.CreatedAt, &group.Image_url)
 	if err != nil {
-		http.Error(w, "Unable to create group", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.From(err, "Unable to create group"))
 		log.Println("Error creating group:", err)
 		return
 	}
 
+	// Render an initials image locally when no image was provided
+	if group.Image_url == "" {
+		group.Image_url, err = generateAvatar(r.Context(), avatarKindGroups, group.ID, group.Name)
+		if err != nil {
+			log.Println("Error generating group image:", err)
+		} else {
+			_, err = database.DB.Exec(r.Context(), "UPDATE chat_groups SET image_url = $1 WHERE id = $2", group.Image_url, group.ID)
+			if err != nil {
+				log.Println("Error saving group image url:", err)
+			}
+		}
+	}
+
+	// The creator owns the group
+	err = database.AddGroupMember(r.Context(), group.ID, group.CreatorID, database.RoleOwner)
+	if err != nil {
+		log.Println("Error adding group creator as owner:", err)
+	}
+	webhooks.Emit(r.Context(), models.WebhookGroupCreated, 0, group)
+
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(group)
@@ -64,32 +85,14 @@ func CreateGroup(w http.ResponseWriter, r *http.Request) {
 
 func GetGroups(w http.ResponseWriter, r *http.Request) {
 
-	// default search radius is 5km
-	radius := 5
-	if r.URL.Query().Get("radius") != "" {
-		parsedRadius, err := strconv.Atoi(r.URL.Query().Get("radius"))
-		if err != nil || radius <= 0 {
-			http.Error(w, "Invalid radius", http.StatusBadRequest)
-			log.Println("Error parsing radius:", err)
-			return
-		}
-		radius = parsedRadius
-	}
-
-	// Parse latitude and longitude from query string
-	lat, err := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
-	if err != nil {
-		http.Error(w, "Invalid latitude", http.StatusBadRequest)
-		log.Println("Error parsing latitude:", err)
-		return
-	}
-
-	long, err := strconv.ParseFloat(r.URL.Query().Get("long"), 64)
+	// Parse location and search radius from query string, the default radius is 5km
+	search := NearbyQuery{Radius: 5}
+	err := validation.DecodeQuery(r.URL.Query(), &search)
 	if err != nil {
-		http.Error(w, "Invalid longitude", http.StatusBadRequest)
-		log.Println("Error parsing longitude:", err)
+		apierror.Write(w, r, err)
 		return
 	}
+	lat, long, radius := *search.Lat, *search.Long, search.Radius
 
 	fmt.Println("Latitude:", lat, "Longitude:", long)
 
@@ -97,10 +100,10 @@ func GetGroups(w http.ResponseWriter, r *http.Request) {
 	location := fmt.Sprintf("POINT(%f %f)", long, lat)
 
 	// fetch groups within the search radius
-	query := `SELECT id, name, image_url FROM chat_groups WHERE ST_DWithin(location, ST_GeographyFromText($1), $2 * 1000)`
+	query := `SELECT id, name, image_url FROM chat_groups WHERE ST_DWithin(location, ST_GeographyFromText($1), $2 * 1000) AND removed_at IS NULL`
 	rows, err := database.DB.Query(r.Context(), query, location, radius)
 	if err != nil {
-		http.Error(w, "Unable to fetch groups", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch groups"))
 		log.Println("Error fetching groups:", err)
 		return
 	}
@@ -112,12 +115,42 @@ func GetGroups(w http.ResponseWriter, r *http.Request) {
 		var group GroupResponse
 		err = rows.Scan(&group.ID, &group.Name, &group.Image_url)
 		if err != nil {
-			http.Error(w, "Unable to fetch groups", http.StatusInternalServerError)
+			apierror.Write(w, r, apierror.From(err, "Unable to fetch groups"))
 			log.Println("Error fetching groups:", err)
 			return
 		}
 		groups = append(groups, group)
 	}
+	rows.Close()
+
+	// include unread counts for the groups the caller joined
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		userIDInt, err := strconv.Atoi(userID)
+		if err != nil {
+			apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+			log.Println("Error parsing user id:", err)
+			return
+		}
+
+		joined, err := database.RedisClient.SMembers(r.Context(), fmt.Sprintf("user_groups:%d", userIDInt)).Result()
+		if err != nil {
+			apierror.Write(w, r, apierror.From(err, "Unable to fetch groups"))
+			log.Println("Error fetching user groups:", err)
+			return
+		}
+
+		for i := range groups {
+			if !slices.Contains(joined, strconv.Itoa(groups[i].ID)) {
+				continue
+			}
+			groups[i].UnreadCount, err = database.GroupUnreadCount(r.Context(), groups[i].ID, userIDInt)
+			if err != nil {
+				apierror.Write(w, r, apierror.From(err, "Unable to fetch groups"))
+				log.Println("Error fetching unread count:", err)
+				return
+			}
+		}
+	}
 
 	// send response
 	response := GetGroupsResponse{
@@ -134,50 +167,103 @@ func GetGroups(w http.ResponseWriter, r *http.Request) {
 func JoinGroup(w http.ResponseWriter, r *http.Request) {
 
 	var requestData struct {
-		UserID  string `json:"user_id"`
-		GroupID string `json:"group_id"`
+		UserID  string `json:"user_id" validate:"required,numeric"`
+		GroupID string `json:"group_id" validate:"required,numeric"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestData)
+	err := validation.DecodeJSON(r.Body, &requestData)
 	if err != nil {
-		http.Error(w, "Unable to parse request body", http.StatusBadRequest)
+		apierror.Write(w, r, err)
 		log.Println("Error parsing request body:", err)
 		return
 	}
 
-	if requestData.UserID == "" || requestData.GroupID == "" {
-		http.Error(w, "Missing user_id or group_id", http.StatusBadRequest)
-		log.Println("Missing user_id or group_id")
+	// Both ids were validated as numbers
+	userID, _ := strconv.Atoi(requestData.UserID)
+	groupID, _ := strconv.Atoi(requestData.GroupID)
+
+	if !checkRestrictions(w, r, userID, false) {
 		return
 	}
 
-	// add user to group in Redis
-	groupKey := fmt.Sprintf("group:%s", requestData.GroupID)
+	// Removed groups cannot be joined
+	var available bool
+	err = database.DB.QueryRow(r.Context(), "SELECT EXISTS (SELECT 1 FROM chat_groups WHERE id = $1 AND removed_at IS NULL)", groupID).Scan(&available)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to join group"))
+		log.Println("Error checking group:", err)
+		return
+	}
+	if !available {
+		apierror.Write(w, r, apierror.NotFound("Group not found"))
+		return
+	}
 
-	// Check if the user is already a member of the group
-	isMember, err := database.RedisClient.SIsMember(r.Context(), groupKey, requestData.UserID).Result()
+	// Check if the user is already a member of the group, Postgres holds the memberships
+	isMember, err := database.IsGroupMember(r.Context(), groupID, userID)
 	if err != nil {
-		http.Error(w, "Unable to check group membership", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.From(err, "Unable to check group membership"))
 		log.Println("Error checking group membership:", err)
 		return
 	}
 	if isMember {
-		http.Error(w, "User is already a member of the group", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.Conflict("User is already a member of the group"))
 		log.Println("User", requestData.UserID, "is already a member of group", requestData.GroupID)
 		return
 	}
 
-	// Add user to group in Redis
-	err = database.RedisClient.SAdd(r.Context(), groupKey, requestData.UserID).Err()
+	// Add user to group in Postgres and Redis
+	err = database.AddGroupMember(r.Context(), groupID, userID, database.RoleMember)
 	if err != nil {
-		http.Error(w, "Unable to join group", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.From(err, "Unable to join group"))
 		log.Println("Error joining group:", err)
 		return
 	}
 
+	webhooks.Emit(r.Context(), models.WebhookMemberJoined, groupID, webhooks.Member{GroupID: groupID, UserID: userID, Role: database.RoleMember})
+
 	log.Println("User", requestData.UserID, "joined group", requestData.GroupID)
 	// send response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`Joined group successfully`))
+	w.Write([]byte(`{"message": "Joined group successfully"}`))
+}
+
+func LeaveGroup(w http.ResponseWriter, r *http.Request) {
+
+	var requestData struct {
+		UserID  int `json:"user_id" validate:"required"`
+		GroupID int `json:"group_id" validate:"required"`
+	}
+
+	err := validation.DecodeJSON(r.Body, &requestData)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing request body:", err)
+		return
+	}
+
+	// Remove user from group in Postgres and Redis, groups keep their owner
+	role, err := database.LeaveGroup(r.Context(), requestData.GroupID, requestData.UserID)
+	if errors.Is(err, database.ErrNotGroupMember) {
+		apierror.Write(w, r, apierror.NotFound("User is not a member of the group"))
+		return
+	}
+	if errors.Is(err, database.ErrGroupOwner) {
+		apierror.Write(w, r, apierror.Forbidden("The group owner cannot leave the group"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to leave group"))
+		log.Println("Error leaving group:", err)
+		return
+	}
+
+	webhooks.Emit(r.Context(), models.WebhookMemberLeft, requestData.GroupID, webhooks.Member{GroupID: requestData.GroupID, UserID: requestData.UserID, Role: role})
+
+	log.Println("User", requestData.UserID, "left group", requestData.GroupID)
+	// send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Left group successfully"}`))
 }
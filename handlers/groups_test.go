@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+)
+
+func TestJoinGroup(t *testing.T) {
+	testenv.Postgres(t)
+	ctx := context.Background()
+
+	owner := testenv.CreateUser(t)
+	member := testenv.CreateUser(t)
+	stale := testenv.CreateUser(t)
+	joiner := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, owner)
+	removedID := testenv.CreateGroup(t, owner)
+	if err := database.AddGroupMember(ctx, groupID, member, database.RoleMember); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.DB.Exec(ctx, "UPDATE chat_groups SET removed_at = NOW() WHERE id = $1", removedID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The Redis fan-out set disagrees with Postgres: it lost the member and kept a user who left
+	groupKey := fmt.Sprintf("group:%d", groupID)
+	database.RedisClient.SRem(ctx, groupKey, member)
+	database.RedisClient.SAdd(ctx, groupKey, stale)
+
+	body := func(userID, groupID int) string {
+		return fmt.Sprintf(`{"user_id": "%d", "group_id": "%d"}`, userID, groupID)
+	}
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"join", body(joiner, groupID), http.StatusOK},
+		{"joined twice", body(joiner, groupID), http.StatusConflict},
+		{"member missing from redis", body(member, groupID), http.StatusConflict},
+		{"stale redis entry", body(stale, groupID), http.StatusOK},
+		{"removed group", body(joiner, removedID), http.StatusNotFound},
+		{"not a number", `{"user_id": "me", "group_id": "1"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			JoinGroup(w, httptest.NewRequest(http.MethodPost, "/api/groups/join", strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+
+	for _, userID := range []int{joiner, stale} {
+		if member, err := database.IsGroupMember(ctx, groupID, userID); err != nil || !member {
+			t.Errorf("IsGroupMember(%d) = %v, %v, want true", userID, member, err)
+		}
+	}
+}
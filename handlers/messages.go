@@ -1,35 +1,139 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"maps"
 	"net/http"
+	"slices"
 	"strconv"
+	"time"
 
+	"github.com/clementus360/proxy-chat/apierror"
 	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/filters"
 	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/validation"
+	"github.com/clementus360/proxy-chat/websocket"
+	"github.com/jackc/pgx/v5"
 )
 
 func SendMessage(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body
 	var message models.Message
-	err := json.NewDecoder(r.Body).Decode(&message)
+	err := validation.DecodeJSON(r.Body, &message)
 	if err != nil {
-		http.Error(w, "Unable to parse request body", http.StatusBadRequest)
+		apierror.Write(w, r, err)
 		log.Println("Error parsing message from request body:", err)
 		return
 	}
 
-	// insert message into database
-	query := "INSERT INTO messages (group_id, receiver_id, sender_id, content) VALUES ($1, $2, $3, $4) RETURNING id, created_at"
-	err = database.DB.QueryRow(r.Context(), query, message.GroupID, message.ReceiverID, message.SenderID, message.Content).Scan(&message.ID, &message.CreatedAt)
+	// Bots authenticate with their token on the bot API
+	isBot, err := database.IsBot(r.Context(), message.SenderID)
 	if err != nil {
-		http.Error(w, "Unable to send message", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.From(err, "Unable to send message"))
+		log.Println("Error checking sender:", err)
+		return
+	}
+	if isBot {
+		apierror.Write(w, r, apierror.Forbidden("Bots send messages through the bot API"))
+		return
+	}
+
+	sendMessage(w, r, &message, false)
+}
+
+// sendMessage checks, stores and delivers a message and answers with the stored message.
+// Messages of bots skip the spam heuristics, bots have their own rate limits.
+func sendMessage(w http.ResponseWriter, r *http.Request, message *models.Message, bot bool) {
+	// A retried send gets the message stored the first time, before filters reject it as a duplicate
+	if message.ClientMsgID != "" {
+		stored, err := database.MessageByClientID(r.Context(), message.SenderID, message.ClientMsgID)
+		if err == nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(stored)
+			log.Println("Message already sent:", stored.ID)
+			return
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			apierror.Write(w, r, apierror.From(err, "Unable to send message"))
+			log.Println("Error looking up client message id:", err)
+			return
+		}
+	}
+
+	if !checkRestrictions(w, r, message.SenderID, true) {
+		return
+	}
+
+	// Only members may post to a group, unless a moderator muted them there
+	if message.GroupID != 0 {
+		membership, err := database.GroupMembership(r.Context(), message.GroupID, message.SenderID)
+		if err != nil {
+			apierror.Write(w, r, apierror.From(err, "Unable to send message"))
+			log.Println("Error checking group membership:", err)
+			return
+		}
+		if membership.Role == "" {
+			apierror.Write(w, r, apierror.Forbidden("You are not a member of this group"))
+			return
+		}
+		if membership.Muted() {
+			apierror.Write(w, r, apierror.New(http.StatusForbidden, apierror.CodeMuted, fmt.Sprintf("You are muted in this group until %s", membership.MutedUntil.Format(time.RFC3339))))
+			return
+		}
+	}
+
+	// Run the content filters, they may mask parts of the message
+	filtered := filters.Message{SenderID: message.SenderID, GroupID: message.GroupID, ReceiverID: message.ReceiverID, Content: message.Content, Bot: bot}
+	if !filterMessage(w, r, &filtered) {
+		return
+	}
+	message.Content = filtered.Content
+
+	// Refuse direct messages between users who blocked each other
+	if message.ReceiverID != 0 {
+		blocked, err := database.IsBlocked(r.Context(), message.SenderID, message.ReceiverID)
+		if err != nil {
+			apierror.Write(w, r, apierror.From(err, "Unable to send message"))
+			log.Println("Error checking blocks:", err)
+			return
+		}
+		if blocked {
+			apierror.Write(w, r, apierror.New(http.StatusForbidden, apierror.CodeBlocked, "Unable to message this user"))
+			return
+		}
+	}
+
+	// insert message into database, a concurrent retry may have stored it already and delivers it
+	err := database.InsertMessage(r.Context(), message)
+	duplicate := errors.Is(err, database.ErrDuplicateMessage)
+	if duplicate {
+		err = nil
+	}
+	if errors.Is(err, database.ErrInvalidReply) {
+		apierror.Write(w, r, apierror.Invalid("reply_to_id", "Invalid reply_to_id or thread_root_id"))
+		return
+	}
+	if errors.Is(err, database.ErrInvalidAttachment) {
+		apierror.Write(w, r, apierror.Invalid("attachment_ids", "Invalid attachment_ids"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to send message"))
 		log.Println("Error sending message:", err)
 		return
 	}
 
+	// Push the message to the recipients and to every device of the sender
+	if !duplicate {
+		websocket.DeliverMessage(*message)
+	}
+
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(message)
@@ -37,24 +141,103 @@ func SendMessage(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetMessages(w http.ResponseWriter, r *http.Request) {
-	// Parse group id from query string
+	// Parse group id and thread id from query string
 	groupId := r.URL.Query().Get("group_id")
+	threadId := r.URL.Query().Get("thread_id")
 	var messages []models.Message
 
-	// If group_id is provided, fetch group messages
-	if groupId != "" {
+	// If thread_id is provided, fetch the thread root followed by its replies
+	if threadId != "" {
+		threadIdInt, err := strconv.Atoi(threadId)
+		if err != nil {
+			apierror.Write(w, r, apierror.Invalid("thread_id", "Invalid thread id"))
+			log.Println("Error parsing thread id:", err)
+			return
+		}
+
+		// Threads are only shown to the participants of the direct chat or the members of the group,
+		// group messages from users the viewer blocked are hidden
+		userId, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+		if err != nil {
+			apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+			log.Println("Error parsing user id:", err)
+			return
+		}
+
+		query := `SELECT id, sender_id, COALESCE(receiver_id, 0), COALESCE(group_id, 0), content, COALESCE(reply_to_id, 0), COALESCE(thread_root_id, 0), edited_at, deleted_at, created_at
+		          FROM messages
+		          WHERE (id = $1 OR thread_root_id = $1)
+		            AND (group_id IS NULL OR sender_id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = $2))
+		          ORDER BY created_at, id`
+		rows, err := database.DB.Query(r.Context(), query, threadIdInt, userId)
+		if err != nil {
+			apierror.Write(w, r, apierror.From(err, "Unable to fetch thread messages"))
+			log.Println("Error fetching thread messages:", err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var message models.Message
+			var deletedAt *time.Time
+			err = rows.Scan(&message.ID, &message.SenderID, &message.ReceiverID, &message.GroupID, &message.Content, &message.ReplyToID, &message.ThreadRootID, &message.EditedAt, &deletedAt, &message.CreatedAt)
+			if err != nil {
+				apierror.Write(w, r, apierror.From(err, "Unable to fetch thread messages"))
+				log.Println("Error fetching thread messages:", err)
+				return
+			}
+			applyTombstone(&message, deletedAt)
+			messages = append(messages, message)
+		}
+
+		root := slices.IndexFunc(messages, func(message models.Message) bool { return message.ID == threadIdInt })
+		if root == -1 {
+			apierror.Write(w, r, apierror.NotFound("Thread not found"))
+			return
+		}
+		if groupID := messages[root].GroupID; groupID != 0 {
+			member, err := database.IsGroupMember(r.Context(), groupID, userId)
+			if err != nil {
+				apierror.Write(w, r, apierror.From(err, "Unable to fetch thread messages"))
+				log.Println("Error checking group membership:", err)
+				return
+			}
+			if !member {
+				apierror.Write(w, r, apierror.NotFound("Thread not found"))
+				return
+			}
+		} else if userId != messages[root].SenderID && userId != messages[root].ReceiverID {
+			apierror.Write(w, r, apierror.NotFound("Thread not found"))
+			return
+		}
+	} else if groupId != "" {
+		// If group_id is provided, fetch group messages
 		groupIdInt, err := strconv.Atoi(groupId)
 		if err != nil {
-			http.Error(w, "Invalid group id", http.StatusBadRequest)
+			apierror.Write(w, r, apierror.Invalid("group_id", "Invalid group id"))
 			log.Println("Error parsing group id:", err)
 			return
 		}
 
+		// Messages from users the viewer blocked are hidden when user_id is provided
+		viewerId := 0
+		if userId := r.URL.Query().Get("user_id"); userId != "" {
+			viewerId, err = strconv.Atoi(userId)
+			if err != nil {
+				apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+				log.Println("Error parsing user id:", err)
+				return
+			}
+		}
+
 		// Fetch group messages
-		query := "SELECT id, group_id, sender_id, content, created_at FROM messages WHERE group_id = $1"
-		rows, err := database.DB.Query(r.Context(), query, groupIdInt)
+		query := `SELECT id, group_id, sender_id, content, COALESCE(reply_to_id, 0), COALESCE(thread_root_id, 0), edited_at, deleted_at, created_at
+		          FROM messages
+		          WHERE group_id = $1
+		            AND sender_id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = $2)`
+		rows, err := database.DB.Query(r.Context(), query, groupIdInt, viewerId)
 		if err != nil {
-			http.Error(w, "Unable to fetch group messages", http.StatusInternalServerError)
+			apierror.Write(w, r, apierror.From(err, "Unable to fetch group messages"))
 			log.Println("Error fetching group messages:", err)
 			return
 		}
@@ -62,12 +245,14 @@ func GetMessages(w http.ResponseWriter, r *http.Request) {
 
 		for rows.Next() {
 			var message models.Message
-			err = rows.Scan(&message.ID, &message.GroupID, &message.SenderID, &message.Content, &message.CreatedAt)
+			var deletedAt *time.Time
+			err = rows.Scan(&message.ID, &message.GroupID, &message.SenderID, &message.Content, &message.ReplyToID, &message.ThreadRootID, &message.EditedAt, &deletedAt, &message.CreatedAt)
 			if err != nil {
-				http.Error(w, "Unable to fetch group messages", http.StatusInternalServerError)
+				apierror.Write(w, r, apierror.From(err, "Unable to fetch group messages"))
 				log.Println("Error fetching group messages:", err)
 				return
 			}
+			applyTombstone(&message, deletedAt)
 			messages = append(messages, message)
 		}
 	} else {
@@ -75,25 +260,26 @@ func GetMessages(w http.ResponseWriter, r *http.Request) {
 		// Example: Get messages for a user (both sent and received)
 		userId := r.URL.Query().Get("user_id")
 		if userId == "" {
-			http.Error(w, "Missing user_id for one-on-one messages", http.StatusBadRequest)
+			apierror.Write(w, r, apierror.Invalid("user_id", "Missing user_id for one-on-one messages"))
 			return
 		}
 
 		userIdInt, err := strconv.Atoi(userId)
 		if err != nil {
-			http.Error(w, "Invalid user id", http.StatusBadRequest)
+			apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
 			log.Println("Error parsing user id:", err)
 			return
 		}
 
 		// Fetch one-on-one messages (sent or received)
-		query := `SELECT id, sender_id, receiver_id, group_id, content, created_at 
-		          FROM messages 
-		          WHERE (sender_id = $1 AND receiver_id IS NOT NULL) 
-		             OR (receiver_id = $1 AND sender_id IS NOT NULL)`
+		query := `SELECT m.id, m.sender_id, m.receiver_id, COALESCE(m.group_id, 0), m.content, COALESCE(m.reply_to_id, 0), COALESCE(m.thread_root_id, 0), r.delivered_at, r.read_at, m.edited_at, m.deleted_at, m.created_at 
+		          FROM messages m
+		          LEFT JOIN message_receipts r ON r.message_id = m.id AND r.user_id = m.receiver_id
+		          WHERE (m.sender_id = $1 AND m.receiver_id IS NOT NULL) 
+		             OR (m.receiver_id = $1 AND m.sender_id IS NOT NULL)`
 		rows, err := database.DB.Query(r.Context(), query, userIdInt)
 		if err != nil {
-			http.Error(w, "Unable to fetch one-on-one messages", http.StatusInternalServerError)
+			apierror.Write(w, r, apierror.From(err, "Unable to fetch one-on-one messages"))
 			log.Println("Error fetching one-on-one messages:", err)
 			return
 		}
@@ -101,18 +287,356 @@ func GetMessages(w http.ResponseWriter, r *http.Request) {
 
 		for rows.Next() {
 			var message models.Message
-			err = rows.Scan(&message.ID, &message.SenderID, &message.ReceiverID, &message.GroupID, &message.Content, &message.CreatedAt)
+			var deletedAt *time.Time
+			err = rows.Scan(&message.ID, &message.SenderID, &message.ReceiverID, &message.GroupID, &message.Content, &message.ReplyToID, &message.ThreadRootID, &message.DeliveredAt, &message.ReadAt, &message.EditedAt, &deletedAt, &message.CreatedAt)
 			if err != nil {
-				http.Error(w, "Unable to fetch one-on-one messages", http.StatusInternalServerError)
+				apierror.Write(w, r, apierror.From(err, "Unable to fetch one-on-one messages"))
 				log.Println("Error fetching one-on-one messages:", err)
 				return
 			}
+			applyTombstone(&message, deletedAt)
 			messages = append(messages, message)
 		}
 	}
 
+	// Include aggregated reaction counts
+	err := attachReactions(r.Context(), messages)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch reactions"))
+		log.Println("Error fetching reactions:", err)
+		return
+	}
+
+	// Include quoted replies and thread reply counts
+	err = attachThreadInfo(r.Context(), messages)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch replies"))
+		log.Println("Error fetching replies:", err)
+		return
+	}
+
+	// Include attachments
+	err = attachAttachments(r.Context(), messages)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch attachments"))
+		log.Println("Error fetching attachments:", err)
+		return
+	}
+
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(messages)
 	log.Println("Messages fetched:", messages)
 }
+
+// attachThreadInfo fills in the quoted message previews and, for thread roots, the reply counts
+func attachThreadInfo(ctx context.Context, messages []models.Message) error {
+	var replyToIDs, rootIDs []int
+	for _, message := range messages {
+		if message.ReplyToID != 0 {
+			replyToIDs = append(replyToIDs, message.ReplyToID)
+		}
+		if message.ThreadRootID == 0 {
+			rootIDs = append(rootIDs, message.ID)
+		}
+	}
+
+	previews, err := database.ReplyPreviews(ctx, replyToIDs)
+	if err != nil {
+		return err
+	}
+
+	counts, err := database.ThreadReplyCounts(ctx, rootIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		messages[i].ReplyTo = previews[messages[i].ReplyToID]
+		messages[i].ThreadReplyCount = counts[messages[i].ID]
+	}
+	return nil
+}
+
+// attachAttachments fills in the files attached to messages that were not deleted
+func attachAttachments(ctx context.Context, messages []models.Message) error {
+	var messageIDs []int
+	for _, message := range messages {
+		if !message.Deleted {
+			messageIDs = append(messageIDs, message.ID)
+		}
+	}
+
+	attachments, err := database.MessageAttachments(ctx, messageIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		messages[i].Attachments = attachments[messages[i].ID]
+	}
+	return nil
+}
+
+// applyTombstone hides the content of soft-deleted messages
+func applyTombstone(message *models.Message, deletedAt *time.Time) {
+	if deletedAt != nil {
+		message.Deleted = true
+		message.Content = models.DeletedMessageContent
+		message.EditedAt = nil
+	}
+}
+
+func EditMessage(w http.ResponseWriter, r *http.Request) {
+	// Parse message id from path
+	messageID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid message id"))
+		log.Println("Error parsing message id:", err)
+		return
+	}
+
+	// Parse request body
+	var requestData struct {
+		UserID  int    `json:"user_id" validate:"required"`
+		Content string `json:"content" validate:"required,max=4000"`
+	}
+	err = validation.DecodeJSON(r.Body, &requestData)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing message edit from request body:", err)
+		return
+	}
+
+	if !checkRestrictions(w, r, requestData.UserID, true) {
+		return
+	}
+
+	tx, err := database.DB.Begin(r.Context())
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to edit message"))
+		log.Println("Error starting transaction:", err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	// Lock the message so concurrent edits keep a consistent history
+	var message models.Message
+	var previousContent string
+	var deletedAt *time.Time
+	query := "SELECT id, sender_id, COALESCE(receiver_id, 0), COALESCE(group_id, 0), content, deleted_at, created_at FROM messages WHERE id = $1 FOR UPDATE"
+	err = tx.QueryRow(r.Context(), query, messageID).Scan(&message.ID, &message.SenderID, &message.ReceiverID, &message.GroupID, &previousContent, &deletedAt, &message.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound("Message not found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to edit message"))
+		log.Println("Error fetching message:", err)
+		return
+	}
+
+	if message.SenderID != requestData.UserID {
+		apierror.Write(w, r, apierror.Forbidden("Only the sender can edit a message"))
+		return
+	}
+	if deletedAt != nil {
+		apierror.Write(w, r, apierror.Conflict("Message was deleted"))
+		return
+	}
+
+	// Edits go through the content filters of the conversation too
+	filtered := filters.Message{SenderID: message.SenderID, GroupID: message.GroupID, ReceiverID: message.ReceiverID, Content: requestData.Content, Edit: true}
+	if !filterMessage(w, r, &filtered) {
+		return
+	}
+
+	// Keep the previous content in the edit history
+	_, err = tx.Exec(r.Context(), "INSERT INTO message_edits (message_id, content) VALUES ($1, $2)", messageID, previousContent)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to edit message"))
+		log.Println("Error storing edit history:", err)
+		return
+	}
+
+	err = tx.QueryRow(r.Context(), "UPDATE messages SET content = $2, edited_at = NOW() WHERE id = $1 RETURNING content, edited_at", messageID, filtered.Content).Scan(&message.Content, &message.EditedAt)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to edit message"))
+		log.Println("Error editing message:", err)
+		return
+	}
+
+	if err = tx.Commit(r.Context()); err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to edit message"))
+		log.Println("Error committing message edit:", err)
+		return
+	}
+
+	// Let every participant update the message in place
+	websocket.BroadcastEvent(websocket.WsMessage{
+		Type:       websocket.TypeMessageEdited,
+		MessageID:  message.ID,
+		GroupID:    message.GroupID,
+		SenderID:   message.SenderID,
+		ReceiverID: message.ReceiverID,
+		Content:    message.Content,
+		EditedAt:   message.EditedAt,
+		CreatedAt:  message.CreatedAt,
+	})
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message)
+	log.Println("Message edited:", message.ID)
+}
+
+func DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	// Parse message id from path
+	messageID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid message id"))
+		log.Println("Error parsing message id:", err)
+		return
+	}
+
+	// Parse user id from query string
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	var message models.Message
+	var deletedAt *time.Time
+	query := "SELECT id, sender_id, COALESCE(receiver_id, 0), COALESCE(group_id, 0), deleted_at, created_at FROM messages WHERE id = $1"
+	err = database.DB.QueryRow(r.Context(), query, messageID).Scan(&message.ID, &message.SenderID, &message.ReceiverID, &message.GroupID, &deletedAt, &message.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound("Message not found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to delete message"))
+		log.Println("Error fetching message:", err)
+		return
+	}
+
+	// The sender may delete their own message, group moderators may delete any group message
+	if message.SenderID != userID {
+		isModerator := false
+		if message.GroupID != 0 {
+			isModerator, err = database.IsGroupModerator(r.Context(), message.GroupID, userID)
+			if err != nil {
+				apierror.Write(w, r, apierror.From(err, "Unable to delete message"))
+				log.Println("Error checking group role:", err)
+				return
+			}
+		}
+		if !isModerator {
+			apierror.Write(w, r, apierror.Forbidden("Not allowed to delete this message"))
+			return
+		}
+	}
+
+	if deletedAt == nil {
+		// Leave a tombstone and drop the content along with its edit history
+		_, err = database.DB.Exec(r.Context(), "UPDATE messages SET content = '', deleted_at = NOW() WHERE id = $1", messageID)
+		if err != nil {
+			apierror.Write(w, r, apierror.From(err, "Unable to delete message"))
+			log.Println("Error deleting message:", err)
+			return
+		}
+
+		_, err = database.DB.Exec(r.Context(), "DELETE FROM message_edits WHERE message_id = $1", messageID)
+		if err != nil {
+			log.Println("Error deleting edit history:", err)
+		}
+
+		websocket.BroadcastEvent(websocket.WsMessage{
+			Type:       websocket.TypeMessageDeleted,
+			MessageID:  message.ID,
+			GroupID:    message.GroupID,
+			SenderID:   message.SenderID,
+			ReceiverID: message.ReceiverID,
+			Content:    models.DeletedMessageContent,
+			CreatedAt:  message.CreatedAt,
+		})
+	}
+
+	// Send response
+	message.Deleted = true
+	message.Content = models.DeletedMessageContent
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(message)
+	log.Println("Message deleted:", messageID)
+}
+
+// Response structs for GetUnreadCounts API
+type DirectUnread struct {
+	UserID int `json:"user_id"`
+	Count  int `json:"count"`
+}
+
+type GroupUnread struct {
+	GroupID int `json:"group_id"`
+	Count   int `json:"count"`
+}
+
+type UnreadCountsResponse struct {
+	Direct []DirectUnread `json:"direct"`
+	Groups []GroupUnread  `json:"groups"`
+	Total  int            `json:"total"`
+}
+
+func GetUnreadCounts(w http.ResponseWriter, r *http.Request) {
+	// Parse user id from query string
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	response := UnreadCountsResponse{Direct: []DirectUnread{}, Groups: []GroupUnread{}}
+
+	// Unread direct messages grouped by sender
+	direct, err := database.DirectUnreadCounts(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch unread counts"))
+		log.Println("Error fetching unread direct messages:", err)
+		return
+	}
+	for _, senderID := range slices.Sorted(maps.Keys(direct)) {
+		response.Direct = append(response.Direct, DirectUnread{UserID: senderID, Count: direct[senderID]})
+		response.Total += direct[senderID]
+	}
+
+	// Unread group messages for every group the user joined
+	groupIDs, err := database.RedisClient.SMembers(r.Context(), fmt.Sprintf("user_groups:%d", userID)).Result()
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch unread counts"))
+		log.Println("Error fetching user groups:", err)
+		return
+	}
+
+	for _, groupID := range groupIDs {
+		groupIDInt, err := strconv.Atoi(groupID)
+		if err != nil {
+			continue
+		}
+
+		count, err := database.GroupUnreadCount(r.Context(), groupIDInt, userID)
+		if err != nil {
+			apierror.Write(w, r, apierror.From(err, "Unable to fetch unread counts"))
+			log.Println("Error fetching unread group messages:", err)
+			return
+		}
+		response.Groups = append(response.Groups, GroupUnread{GroupID: groupIDInt, Count: count})
+		response.Total += count
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+	log.Println("Unread counts fetched for user:", userID)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+	"github.com/clementus360/proxy-chat/models"
+)
+
+func TestSendMessageIsIdempotent(t *testing.T) {
+	testenv.Postgres(t)
+
+	sender := testenv.CreateUser(t)
+	receiver := testenv.CreateUser(t)
+
+	send := func(body string) (int, models.Message) {
+		w := httptest.NewRecorder()
+		SendMessage(w, httptest.NewRequest(http.MethodPost, "/api/messages", strings.NewReader(body)))
+		var message models.Message
+		json.NewDecoder(w.Body).Decode(&message)
+		return w.Code, message
+	}
+
+	body := fmt.Sprintf(`{"sender_id": %d, "receiver_id": %d, "content": "hello", "client_msg_id": "send-1"}`, sender, receiver)
+	code, first := send(body)
+	if code != http.StatusOK || first.ID == 0 || first.ClientMsgID != "send-1" {
+		t.Fatalf("first send = %d %+v", code, first)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		wantID bool
+	}{
+		{"retry", body, true},
+		{"retry with other content", fmt.Sprintf(`{"sender_id": %d, "receiver_id": %d, "content": "changed", "client_msg_id": "send-1"}`, sender, receiver), true},
+		{"other client id", fmt.Sprintf(`{"sender_id": %d, "receiver_id": %d, "content": "hello there", "client_msg_id": "send-2"}`, sender, receiver), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, message := send(tt.body)
+			if code != http.StatusOK {
+				t.Fatalf("status = %d", code)
+			}
+			if got := message.ID == first.ID; got != tt.wantID {
+				t.Errorf("message id = %d, first id = %d", message.ID, first.ID)
+			}
+			if tt.wantID && (message.Content != first.Content || !message.CreatedAt.Equal(first.CreatedAt)) {
+				t.Errorf("retry = %+v, want the stored message %+v", message, first)
+			}
+		})
+	}
+
+	var count int
+	database.DB.QueryRow(context.Background(), "SELECT COUNT(*) FROM messages WHERE sender_id = $1", sender).Scan(&count)
+	if count != 2 {
+		t.Errorf("stored %d messages, want 2", count)
+	}
+}
+
+func TestGetThread(t *testing.T) {
+	testenv.Postgres(t)
+	ctx := context.Background()
+
+	sender := testenv.CreateUser(t)
+	receiver := testenv.CreateUser(t)
+	outsider := testenv.CreateUser(t)
+	blocked := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, sender)
+	for _, memberID := range []int{receiver, blocked} {
+		if err := database.AddGroupMember(ctx, groupID, memberID, database.RoleMember); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.BlockUser(ctx, receiver, blocked); err != nil {
+		t.Fatal(err)
+	}
+
+	insert := func(message models.Message) models.Message {
+		t.Helper()
+		if err := database.InsertMessage(ctx, &message); err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+	root := insert(models.Message{SenderID: sender, ReceiverID: receiver, Content: "root"})
+	first := insert(models.Message{SenderID: receiver, ReceiverID: sender, Content: "first", ThreadRootID: root.ID})
+	second := insert(models.Message{SenderID: sender, ReceiverID: receiver, Content: "second", ReplyToID: first.ID})
+	insert(models.Message{SenderID: sender, ReceiverID: receiver, Content: "outside the thread"})
+	groupRoot := insert(models.Message{SenderID: sender, GroupID: groupID, Content: "group root"})
+	groupReply := insert(models.Message{SenderID: sender, GroupID: groupID, Content: "group reply", ThreadRootID: groupRoot.ID})
+	insert(models.Message{SenderID: blocked, GroupID: groupID, Content: "reply from a blocked member", ThreadRootID: groupRoot.ID})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantIDs    []int
+	}{
+		{"root", fmt.Sprintf("thread_id=%d&user_id=%d", root.ID, sender), http.StatusOK, []int{root.ID, first.ID, second.ID}},
+		{"receiver of the root", fmt.Sprintf("thread_id=%d&user_id=%d", root.ID, receiver), http.StatusOK, []int{root.ID, first.ID, second.ID}},
+		{"outsider of a direct chat", fmt.Sprintf("thread_id=%d&user_id=%d", root.ID, outsider), http.StatusNotFound, nil},
+		{"group member who blocked a replier", fmt.Sprintf("thread_id=%d&user_id=%d", groupRoot.ID, receiver), http.StatusOK, []int{groupRoot.ID, groupReply.ID}},
+		{"outsider of a group", fmt.Sprintf("thread_id=%d&user_id=%d", groupRoot.ID, outsider), http.StatusNotFound, nil},
+		{"missing user id", fmt.Sprintf("thread_id=%d", root.ID), http.StatusBadRequest, nil},
+		{"unknown thread", fmt.Sprintf("thread_id=0&user_id=%d", sender), http.StatusNotFound, nil},
+		{"invalid thread id", fmt.Sprintf("thread_id=root&user_id=%d", sender), http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			GetMessages(w, httptest.NewRequest(http.MethodGet, "/api/messages?"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantIDs == nil {
+				return
+			}
+
+			var messages []models.Message
+			if err := json.NewDecoder(w.Body).Decode(&messages); err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, message := range messages {
+				ids = append(ids, message.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Fatalf("messages = %v, want %v", ids, tt.wantIDs)
+			}
+			if ids[0] != root.ID {
+				return // The group thread only checks which replies are shown
+			}
+			if messages[0].ThreadReplyCount != 2 {
+				t.Errorf("root reply count = %d, want 2", messages[0].ThreadReplyCount)
+			}
+			if reply := messages[2]; reply.ThreadRootID != root.ID || reply.ReplyTo == nil || reply.ReplyTo.ID != first.ID || reply.ReplyTo.Content != "first" {
+				t.Errorf("quoting reply = %+v, want it in the thread with a preview of the first reply", reply)
+			}
+		})
+	}
+}
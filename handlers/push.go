@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/validation"
+)
+
+// Most devices a user may register for push notifications
+const maxPushTokens = 10
+
+func RegisterPushToken(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var token models.PushToken
+	err := validation.DecodeJSON(r.Body, &token)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing push token from request body:", err)
+		return
+	}
+
+	// Devices registering again replace their token, new devices must fit in the limit
+	tokens, err := database.PushTokens(r.Context(), token.UserID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to register push token"))
+		log.Println("Error fetching push tokens:", err)
+		return
+	}
+	registered := false
+	for _, existing := range tokens {
+		registered = registered || existing.DeviceID == token.DeviceID
+	}
+	if !registered && len(tokens) >= maxPushTokens {
+		apierror.Write(w, r, apierror.Conflict(fmt.Sprintf("Users can register at most %d devices for push notifications", maxPushTokens)))
+		return
+	}
+
+	err = database.SavePushToken(r.Context(), &token)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to register push token"))
+		log.Println("Error saving push token:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(token)
+	log.Printf("User %d registered a %s push token for device %s", token.UserID, token.Platform, token.DeviceID)
+}
+
+func GetPushTokens(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	tokens, err := database.PushTokens(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch push tokens"))
+		log.Println("Error fetching push tokens:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func DeletePushToken(w http.ResponseWriter, r *http.Request) {
+	// Parse user id from query string and device id from path
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+	deviceID := r.PathValue("device_id")
+
+	err = database.DeletePushToken(r.Context(), userID, deviceID)
+	if errors.Is(err, database.ErrPushTokenNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Push token not found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to delete push token"))
+		log.Println("Error deleting push token:", err)
+		return
+	}
+
+	log.Println("User", userID, "deleted the push token of device", deviceID)
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"message": "Push token deleted successfully"}`))
+}
+
+func GetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	settings, err := database.GetNotificationSettings(r.Context(), userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch notification settings"))
+		log.Println("Error fetching notification settings:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func UpdateNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var settings models.NotificationSettings
+	err := validation.DecodeJSON(r.Body, &settings)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing notification settings from request body:", err)
+		return
+	}
+
+	if settings.TimeZone == "" {
+		settings.TimeZone = "UTC"
+	}
+	if _, err = time.LoadLocation(settings.TimeZone); err != nil {
+		apierror.Write(w, r, apierror.Invalid("time_zone", "must be an IANA time zone such as Europe/Paris"))
+		return
+	}
+
+	err = database.SaveNotificationSettings(r.Context(), settings)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to save notification settings"))
+		log.Println("Error saving notification settings:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func GetGroupNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid group id"))
+		log.Println("Error parsing group id:", err)
+		return
+	}
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	settings, err := database.GetGroupNotificationSettings(r.Context(), groupID, userID)
+	if errors.Is(err, database.ErrNotGroupMember) {
+		apierror.Write(w, r, apierror.NotFound("User is not a member of the group"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch notification settings"))
+		log.Println("Error fetching group notification settings:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+func UpdateGroupNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid group id"))
+		log.Println("Error parsing group id:", err)
+		return
+	}
+
+	// Parse request body, muted groups stay muted for duration or until they are unmuted
+	var requestData struct {
+		UserID   int    `json:"user_id" validate:"required"`
+		Muted    bool   `json:"muted"`
+		Duration string `json:"duration,omitempty"`
+	}
+	err = validation.DecodeJSON(r.Body, &requestData)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing notification settings from request body:", err)
+		return
+	}
+
+	var until *time.Time
+	if requestData.Muted && requestData.Duration != "" {
+		duration, err := validation.ParseDuration(requestData.Duration)
+		if err != nil {
+			apierror.Write(w, r, apierror.Invalid("duration", err.Error()))
+			return
+		}
+		mutedUntil := time.Now().Add(duration)
+		until = &mutedUntil
+	}
+
+	err = database.MuteGroupNotifications(r.Context(), groupID, requestData.UserID, requestData.Muted, until)
+	if errors.Is(err, database.ErrNotGroupMember) {
+		apierror.Write(w, r, apierror.NotFound("User is not a member of the group"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to save notification settings"))
+		log.Println("Error saving group notification settings:", err)
+		return
+	}
+
+	log.Printf("User %d set the notifications of group %d muted to %t", requestData.UserID, groupID, requestData.Muted)
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.GroupNotificationSettings{GroupID: groupID, UserID: requestData.UserID, Muted: requestData.Muted, MutedUntil: until})
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/validation"
+	"github.com/clementus360/proxy-chat/websocket"
+	"github.com/jackc/pgx/v5"
+)
+
+func AddReaction(w http.ResponseWriter, r *http.Request) {
+	// Parse message id from path
+	messageID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid message id"))
+		log.Println("Error parsing message id:", err)
+		return
+	}
+
+	// Parse request body
+	var requestData struct {
+		UserID int `json:"user_id" validate:"required"`
+		// A single emoji, the bound keeps long joined sequences within the column
+		Emoji string `json:"emoji" validate:"required,max=16,emoji"`
+	}
+	err = validation.DecodeJSON(r.Body, &requestData)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing reaction from request body:", err)
+		return
+	}
+
+	if !checkRestrictions(w, r, requestData.UserID, true) {
+		return
+	}
+
+	message, status := reactionTarget(r.Context(), messageID, requestData.UserID)
+	if status != http.StatusOK {
+		apierror.Write(w, r, apierror.New(status, apierror.CodeForStatus(status), http.StatusText(status)))
+		return
+	}
+
+	query := `INSERT INTO message_reactions (message_id, user_id, emoji) VALUES ($1, $2, $3)
+	          ON CONFLICT (message_id, user_id, emoji) DO NOTHING`
+	tag, err := database.DB.Exec(r.Context(), query, messageID, requestData.UserID, requestData.Emoji)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to add reaction"))
+		log.Println("Error adding reaction:", err)
+		return
+	}
+
+	// Only announce reactions that were not there already
+	if tag.RowsAffected() > 0 {
+		broadcastReaction(websocket.TypeReactionAdded, message, requestData.UserID, requestData.Emoji)
+	}
+
+	sendReactions(w, r, messageID)
+	log.Println("Reaction added to message", messageID, "by user", requestData.UserID)
+}
+
+func RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	// Parse message id from path
+	messageID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid message id"))
+		log.Println("Error parsing message id:", err)
+		return
+	}
+
+	// Parse user id and emoji from query string
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	emoji := r.URL.Query().Get("emoji")
+	if emoji == "" {
+		apierror.Write(w, r, apierror.Invalid("emoji", "Missing emoji"))
+		return
+	}
+
+	message, status := reactionTarget(r.Context(), messageID, userID)
+	if status != http.StatusOK {
+		apierror.Write(w, r, apierror.New(status, apierror.CodeForStatus(status), http.StatusText(status)))
+		return
+	}
+
+	query := "DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3"
+	tag, err := database.DB.Exec(r.Context(), query, messageID, userID, emoji)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to remove reaction"))
+		log.Println("Error removing reaction:", err)
+		return
+	}
+
+	if tag.RowsAffected() > 0 {
+		broadcastReaction(websocket.TypeReactionRemoved, message, userID, emoji)
+	}
+
+	sendReactions(w, r, messageID)
+	log.Println("Reaction removed from message", messageID, "by user", userID)
+}
+
+// reactionTarget loads a message and checks that the user takes part in its conversation.
+// It returns http.StatusOK when the user may react to the message.
+func reactionTarget(ctx context.Context, messageID int, userID int) (models.Message, int) {
+	var message models.Message
+	var deletedAt *time.Time
+	query := "SELECT id, sender_id, COALESCE(receiver_id, 0), COALESCE(group_id, 0), deleted_at FROM messages WHERE id = $1"
+	err := database.DB.QueryRow(ctx, query, messageID).Scan(&message.ID, &message.SenderID, &message.ReceiverID, &message.GroupID, &deletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return message, http.StatusNotFound
+	}
+	if err != nil {
+		log.Println("Error fetching message:", err)
+		return message, http.StatusInternalServerError
+	}
+
+	if deletedAt != nil {
+		return message, http.StatusGone
+	}
+
+	if message.GroupID != 0 {
+		role, err := database.GroupRole(ctx, message.GroupID, userID)
+		if err != nil {
+			log.Println("Error checking group membership:", err)
+			return message, http.StatusInternalServerError
+		}
+		if role == "" {
+			return message, http.StatusForbidden
+		}
+	} else if userID != message.SenderID && userID != message.ReceiverID {
+		return message, http.StatusForbidden
+	}
+
+	return message, http.StatusOK
+}
+
+// broadcastReaction sends a reaction frame to the DM peer or the group members
+func broadcastReaction(eventType string, message models.Message, userID int, emoji string) {
+	frame := websocket.WsMessage{
+		Type:      eventType,
+		MessageID: message.ID,
+		GroupID:   message.GroupID,
+		SenderID:  userID,
+		Emoji:     emoji,
+		CreatedAt: time.Now(),
+	}
+
+	// For direct messages the reacting user is one participant and the frame goes to the other
+	if message.GroupID == 0 {
+		frame.ReceiverID = message.ReceiverID
+		if userID == message.ReceiverID {
+			frame.ReceiverID = message.SenderID
+		}
+	}
+
+	websocket.BroadcastEvent(frame)
+}
+
+// sendReactions replies with the aggregated reactions of a message
+func sendReactions(w http.ResponseWriter, r *http.Request, messageID int) {
+	reactions, err := fetchReactions(r.Context(), []int{messageID})
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch reactions"))
+		log.Println("Error fetching reactions:", err)
+		return
+	}
+
+	response := reactions[messageID]
+	if response == nil {
+		response = []models.ReactionCount{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// fetchReactions aggregates reaction counts per emoji for a set of messages,
+// emojis are listed in the order they were first used
+func fetchReactions(ctx context.Context, messageIDs []int) (map[int][]models.ReactionCount, error) {
+	reactions := make(map[int][]models.ReactionCount)
+	if len(messageIDs) == 0 {
+		return reactions, nil
+	}
+
+	query := `SELECT message_id, emoji, COUNT(*)
+	          FROM message_reactions
+	          WHERE message_id = ANY($1)
+	          GROUP BY message_id, emoji
+	          ORDER BY message_id, MIN(created_at)`
+	rows, err := database.DB.Query(ctx, query, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		var reaction models.ReactionCount
+		if err := rows.Scan(&messageID, &reaction.Emoji, &reaction.Count); err != nil {
+			return nil, err
+		}
+		reactions[messageID] = append(reactions[messageID], reaction)
+	}
+
+	return reactions, rows.Err()
+}
+
+// attachReactions fills in the reaction counts of fetched messages
+func attachReactions(ctx context.Context, messages []models.Message) error {
+	messageIDs := make([]int, 0, len(messages))
+	for _, message := range messages {
+		if !message.Deleted {
+			messageIDs = append(messageIDs, message.ID)
+		}
+	}
+
+	reactions, err := fetchReactions(ctx, messageIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		messages[i].Reactions = reactions[messages[i].ID]
+	}
+	return nil
+}
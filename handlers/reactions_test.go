@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+	"github.com/clementus360/proxy-chat/models"
+)
+
+// insertMessage stores a message and returns its id, receiverID or groupID is zero
+func insertMessage(t *testing.T, senderID int, receiverID int, groupID int, content string) int {
+	t.Helper()
+
+	var id int
+	query := "INSERT INTO messages (sender_id, receiver_id, group_id, content) VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), $4) RETURNING id"
+	if err := database.DB.QueryRow(context.Background(), query, senderID, receiverID, groupID, content).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestReactions(t *testing.T) {
+	testenv.Postgres(t)
+	bg := context.Background()
+
+	sender := testenv.CreateUser(t)
+	receiver := testenv.CreateUser(t)
+	outsider := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, sender)
+	if err := database.AddGroupMember(bg, groupID, receiver, database.RoleMember); err != nil {
+		t.Fatal(err)
+	}
+
+	direct := insertMessage(t, sender, receiver, 0, "direct")
+	group := insertMessage(t, receiver, 0, groupID, "group")
+	deleted := insertMessage(t, sender, receiver, 0, "deleted")
+	if _, err := database.DB.Exec(bg, "UPDATE messages SET deleted_at = NOW() WHERE id = $1", deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(messageID string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/messages/"+messageID+"/reactions", strings.NewReader(body))
+		r.SetPathValue("id", messageID)
+		AddReaction(w, r)
+		return w
+	}
+	remove := func(messageID string, query url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodDelete, "/api/messages/"+messageID+"/reactions?"+query.Encode(), nil)
+		r.SetPathValue("id", messageID)
+		RemoveReaction(w, r)
+		return w
+	}
+	reaction := func(userID int, emoji string) string {
+		return fmt.Sprintf(`{"user_id": %d, "emoji": %q}`, userID, emoji)
+	}
+	removal := func(userID int, emoji string) url.Values {
+		return url.Values{"user_id": {strconv.Itoa(userID)}, "emoji": {emoji}}
+	}
+
+	// The steps run in order and build on the reactions added before them
+	tests := []struct {
+		name       string
+		do         func() *httptest.ResponseRecorder
+		wantStatus int
+		want       []models.ReactionCount
+	}{
+		{"receiver reacts", func() *httptest.ResponseRecorder { return add(strconv.Itoa(direct), reaction(receiver, "👍")) }, http.StatusOK, []models.ReactionCount{{Emoji: "👍", Count: 1}}},
+		{"same reaction again", func() *httptest.ResponseRecorder { return add(strconv.Itoa(direct), reaction(receiver, "👍")) }, http.StatusOK, []models.ReactionCount{{Emoji: "👍", Count: 1}}},
+		{"sender reacts", func() *httptest.ResponseRecorder { return add(strconv.Itoa(direct), reaction(sender, "👍")) }, http.StatusOK, []models.ReactionCount{{Emoji: "👍", Count: 2}}},
+		{"other emoji", func() *httptest.ResponseRecorder { return add(strconv.Itoa(direct), reaction(sender, "🎉")) }, http.StatusOK, []models.ReactionCount{{Emoji: "👍", Count: 2}, {Emoji: "🎉", Count: 1}}},
+		{"group member reacts", func() *httptest.ResponseRecorder { return add(strconv.Itoa(group), reaction(sender, "🔥")) }, http.StatusOK, []models.ReactionCount{{Emoji: "🔥", Count: 1}}},
+		{"outsider reacts to a direct message", func() *httptest.ResponseRecorder { return add(strconv.Itoa(direct), reaction(outsider, "👍")) }, http.StatusForbidden, nil},
+		{"outsider reacts in a group", func() *httptest.ResponseRecorder { return add(strconv.Itoa(group), reaction(outsider, "👍")) }, http.StatusForbidden, nil},
+		{"deleted message", func() *httptest.ResponseRecorder { return add(strconv.Itoa(deleted), reaction(receiver, "👍")) }, http.StatusGone, nil},
+		{"unknown message", func() *httptest.ResponseRecorder { return add("0", reaction(receiver, "👍")) }, http.StatusNotFound, nil},
+		{"invalid message id", func() *httptest.ResponseRecorder { return add("first", reaction(receiver, "👍")) }, http.StatusBadRequest, nil},
+		{"missing emoji", func() *httptest.ResponseRecorder { return add(strconv.Itoa(direct), reaction(receiver, "")) }, http.StatusBadRequest, nil},
+		{"text instead of an emoji", func() *httptest.ResponseRecorder { return add(strconv.Itoa(direct), reaction(receiver, "lol")) }, http.StatusBadRequest, nil},
+		{"two emoji", func() *httptest.ResponseRecorder { return add(strconv.Itoa(direct), reaction(receiver, "👍👍")) }, http.StatusBadRequest, nil},
+		{"remove a reaction", func() *httptest.ResponseRecorder { return remove(strconv.Itoa(direct), removal(receiver, "👍")) }, http.StatusOK, []models.ReactionCount{{Emoji: "👍", Count: 1}, {Emoji: "🎉", Count: 1}}},
+		{"remove it again", func() *httptest.ResponseRecorder { return remove(strconv.Itoa(direct), removal(receiver, "👍")) }, http.StatusOK, []models.ReactionCount{{Emoji: "👍", Count: 1}, {Emoji: "🎉", Count: 1}}},
+		{"remove the last reaction", func() *httptest.ResponseRecorder { return remove(strconv.Itoa(group), removal(sender, "🔥")) }, http.StatusOK, []models.ReactionCount{}},
+		{"remove without emoji", func() *httptest.ResponseRecorder { return remove(strconv.Itoa(direct), removal(sender, "")) }, http.StatusBadRequest, nil},
+		{"outsider removes", func() *httptest.ResponseRecorder { return remove(strconv.Itoa(direct), removal(outsider, "🎉")) }, http.StatusForbidden, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tt.do()
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.want == nil {
+				return
+			}
+			var got []models.ReactionCount
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("reactions = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Fetched messages carry their reaction counts, deleted ones none
+	messages := []models.Message{{ID: direct}, {ID: group}, {ID: deleted, Deleted: true}}
+	if err := attachReactions(bg, messages); err != nil {
+		t.Fatal(err)
+	}
+	if len(messages[0].Reactions) != 2 || messages[1].Reactions != nil || messages[2].Reactions != nil {
+		t.Errorf("attached reactions = %+v", messages)
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/validation"
+	"github.com/clementus360/proxy-chat/webhooks"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// checkRestrictions replies with an error and returns false when a user's sanctions forbid the request.
+// Suspended users cannot do anything, muted users cannot post when posting is true.
+func checkRestrictions(w http.ResponseWriter, r *http.Request, userID int, posting bool) bool {
+	restrictions, err := database.UserRestrictions(r.Context(), userID)
+	if errors.Is(err, database.ErrUserNotFound) {
+		apierror.Write(w, r, apierror.NotFound("User not found"))
+		return false
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to check account status"))
+		log.Println("Error fetching user restrictions:", err)
+		return false
+	}
+
+	if restrictions.Suspended() {
+		apierror.Write(w, r, apierror.New(http.StatusForbidden, apierror.CodeSuspended, "Account suspended"))
+		return false
+	}
+	if posting && restrictions.Muted() {
+		apierror.Write(w, r, apierror.New(http.StatusForbidden, apierror.CodeMuted, fmt.Sprintf("You are muted until %s", restrictions.MutedUntil.Format(time.RFC3339))))
+		return false
+	}
+	return true
+}
+
+func CreateReport(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var report models.Report
+	err := validation.DecodeJSON(r.Body, &report)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing report from request body:", err)
+		return
+	}
+
+	report.Details = strings.TrimSpace(report.Details)
+
+	if !checkRestrictions(w, r, report.ReporterID, false) {
+		return
+	}
+
+	// Make sure the reported target exists
+	var targetQuery string
+	switch report.TargetType {
+	case models.ReportTargetMessage:
+		targetQuery = "SELECT EXISTS (SELECT 1 FROM messages WHERE id = $1)"
+	case models.ReportTargetUser:
+		targetQuery = "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)"
+	case models.ReportTargetGroup:
+		targetQuery = "SELECT EXISTS (SELECT 1 FROM chat_groups WHERE id = $1)"
+	default:
+		apierror.Write(w, r, apierror.Invalid("target_type", "Invalid target_type"))
+		return
+	}
+
+	var exists bool
+	err = database.DB.QueryRow(r.Context(), targetQuery, report.TargetID).Scan(&exists)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to create report"))
+		log.Println("Error checking report target:", err)
+		return
+	}
+	if !exists {
+		apierror.Write(w, r, apierror.NotFound("Reported "+report.TargetType+" not found"))
+		return
+	}
+
+	// insert report into database
+	query := `INSERT INTO reports (reporter_id, target_type, target_id, reason, details)
+	          VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+	          RETURNING id, status, created_at, updated_at`
+	err = database.DB.QueryRow(r.Context(), query, report.ReporterID, report.TargetType, report.TargetID, report.Reason, report.Details).Scan(&report.ID, &report.Status, &report.CreatedAt, &report.UpdatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		apierror.Write(w, r, apierror.Conflict("You already reported this "+report.TargetType))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to create report"))
+		log.Println("Error creating report:", err)
+		return
+	}
+
+	webhooks.Emit(r.Context(), models.WebhookReportFiled, 0, report)
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+	log.Println("Report created:", report.ID, report.TargetType, report.TargetID)
+}
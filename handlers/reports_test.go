@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+)
+
+func TestCreateReport(t *testing.T) {
+	testenv.Postgres(t)
+
+	reporter := testenv.CreateUser(t)
+	suspended := testenv.CreateUser(t)
+	target := testenv.CreateUser(t)
+	if _, err := database.DB.Exec(context.Background(), "UPDATE users SET suspended_until = NOW() + INTERVAL '1 day' WHERE id = $1", suspended); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"user report", fmt.Sprintf(`{"reporter_id": %d, "target_type": "user", "target_id": %d, "reason": "spam"}`, reporter, target), http.StatusCreated},
+		{"reported twice", fmt.Sprintf(`{"reporter_id": %d, "target_type": "user", "target_id": %d, "reason": "hate"}`, reporter, target), http.StatusConflict},
+		{"missing target", fmt.Sprintf(`{"reporter_id": %d, "target_type": "message", "target_id": 2147483647, "reason": "spam"}`, reporter), http.StatusNotFound},
+		{"unknown target type", fmt.Sprintf(`{"reporter_id": %d, "target_type": "planet", "target_id": 1, "reason": "spam"}`, reporter), http.StatusBadRequest},
+		{"unknown reason", fmt.Sprintf(`{"reporter_id": %d, "target_type": "user", "target_id": %d, "reason": "dislike"}`, reporter, target), http.StatusBadRequest},
+		{"suspended reporter", fmt.Sprintf(`{"reporter_id": %d, "target_type": "user", "target_id": %d, "reason": "spam"}`, suspended, target), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			CreateReport(w, httptest.NewRequest(http.MethodPost, "/api/reports", strings.NewReader(tt.body)))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/models"
+)
+
+// Search pagination defaults and bounds
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// Matches are delimited with private use characters so the snippet can be HTML escaped
+// before they are turned into <mark> tags
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+// searchHeadlineOptions marks matches and keeps snippets short
+const searchHeadlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxFragments=2, MaxWords=20, MinWords=5, FragmentDelimiter=\" … \""
+
+// highlightSnippet escapes a headline returned by Postgres and wraps the matches in <mark> tags
+func highlightSnippet(headline string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(html.EscapeString(headline))
+}
+
+type SearchResult struct {
+	Message models.Message `json:"message"`
+	Snippet string         `json:"snippet"`
+	Rank    float32        `json:"rank"`
+}
+
+type SearchMessagesResponse struct {
+	Results    []SearchResult `json:"results"`
+	TotalCount int            `json:"total_count"`
+	Limit      int            `json:"limit"`
+	Offset     int            `json:"offset"`
+}
+
+// parseSearchTime accepts either a full RFC 3339 timestamp or a plain date
+func parseSearchTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+func SearchMessages(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	// Parse user id from query string, results are limited to what this user can read
+	userID, err := strconv.Atoi(params.Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	searchQuery := strings.TrimSpace(params.Get("q"))
+	if searchQuery == "" {
+		apierror.Write(w, r, apierror.Invalid("q", "Missing search query"))
+		return
+	}
+
+	// Only groups the user belongs to and the user's own direct messages are searched,
+	// group messages from users they blocked are left out
+	conditions := []string{
+		"m.content_tsv @@ query",
+		"m.deleted_at IS NULL",
+		`(m.group_id IN (SELECT group_id FROM group_memberships WHERE user_id = $1)
+		  OR (m.receiver_id IS NOT NULL AND (m.sender_id = $1 OR m.receiver_id = $1)))`,
+		"(m.group_id IS NULL OR m.sender_id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = $1))",
+	}
+	args := []interface{}{userID, searchQuery}
+
+	addFilter := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if groupID := params.Get("group_id"); groupID != "" {
+		groupIDInt, err := strconv.Atoi(groupID)
+		if err != nil {
+			apierror.Write(w, r, apierror.Invalid("group_id", "Invalid group id"))
+			log.Println("Error parsing group id:", err)
+			return
+		}
+		addFilter("m.group_id = $%d", groupIDInt)
+	}
+
+	if senderID := params.Get("sender_id"); senderID != "" {
+		senderIDInt, err := strconv.Atoi(senderID)
+		if err != nil {
+			apierror.Write(w, r, apierror.Invalid("sender_id", "Invalid sender id"))
+			log.Println("Error parsing sender id:", err)
+			return
+		}
+		addFilter("m.sender_id = $%d", senderIDInt)
+	}
+
+	if from := params.Get("from"); from != "" {
+		fromTime, err := parseSearchTime(from)
+		if err != nil {
+			apierror.Write(w, r, apierror.Invalid("from", "Invalid from date"))
+			log.Println("Error parsing from date:", err)
+			return
+		}
+		addFilter("m.created_at >= $%d", fromTime)
+	}
+
+	if to := params.Get("to"); to != "" {
+		toTime, err := parseSearchTime(to)
+		if err != nil {
+			apierror.Write(w, r, apierror.Invalid("to", "Invalid to date"))
+			log.Println("Error parsing to date:", err)
+			return
+		}
+		// A plain date includes the whole day
+		if len(to) == len(time.DateOnly) {
+			toTime = toTime.AddDate(0, 0, 1)
+		}
+		addFilter("m.created_at < $%d", toTime)
+	}
+
+	// Parse pagination
+	limit := defaultSearchLimit
+	if params.Get("limit") != "" {
+		limit, err = strconv.Atoi(params.Get("limit"))
+		if err != nil || limit <= 0 || limit > maxSearchLimit {
+			apierror.Write(w, r, apierror.Invalid("limit", fmt.Sprintf("Invalid limit, expected 1 to %d", maxSearchLimit)))
+			return
+		}
+	}
+
+	offset := 0
+	if params.Get("offset") != "" {
+		offset, err = strconv.Atoi(params.Get("offset"))
+		if err != nil || offset < 0 {
+			apierror.Write(w, r, apierror.Invalid("offset", "Invalid offset"))
+			return
+		}
+	}
+
+	args = append(args, searchHeadlineOptions, limit, offset)
+	query := fmt.Sprintf(`
+		SELECT m.id, m.sender_id, COALESCE(m.receiver_id, 0), COALESCE(m.group_id, 0), m.content,
+		       COALESCE(m.reply_to_id, 0), COALESCE(m.thread_root_id, 0), m.edited_at, m.created_at,
+		       ts_headline('simple', m.content, query, $%d),
+		       ts_rank(m.content_tsv, query),
+		       COUNT(*) OVER ()
+		FROM messages m, websearch_to_tsquery('simple', $2) query
+		WHERE %s
+		ORDER BY ts_rank(m.content_tsv, query) DESC, m.created_at DESC
+		LIMIT $%d OFFSET $%d`,
+		len(args)-2, strings.Join(conditions, " AND "), len(args)-1, len(args))
+
+	rows, err := database.DB.Query(r.Context(), query, args...)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to search messages"))
+		log.Println("Error searching messages:", err)
+		return
+	}
+	defer rows.Close()
+
+	response := SearchMessagesResponse{Results: []SearchResult{}, Limit: limit, Offset: offset}
+	for rows.Next() {
+		var result SearchResult
+		message := &result.Message
+		err = rows.Scan(&message.ID, &message.SenderID, &message.ReceiverID, &message.GroupID, &message.Content,
+			&message.ReplyToID, &message.ThreadRootID, &message.EditedAt, &message.CreatedAt,
+			&result.Snippet, &result.Rank, &response.TotalCount)
+		if err != nil {
+			apierror.Write(w, r, apierror.From(err, "Unable to search messages"))
+			log.Println("Error scanning search results:", err)
+			return
+		}
+		result.Snippet = highlightSnippet(result.Snippet)
+		response.Results = append(response.Results, result)
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+	log.Println("Messages searched by user", userID, "with", response.TotalCount, "results")
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+)
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		headline string
+		want     string
+	}{
+		{"no match", "no match"},
+		{"a " + highlightStart + "match" + highlightStop + " here", "a <mark>match</mark> here"},
+		{highlightStart + "<b>" + highlightStop + " & co", "<mark>&lt;b&gt;</mark> &amp; co"},
+		{"<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+	}
+	for _, tt := range tests {
+		if got := highlightSnippet(tt.headline); got != tt.want {
+			t.Errorf("highlightSnippet(%q) = %q, want %q", tt.headline, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"2024-03-01", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), false},
+		{"2024-03-01T10:30:00Z", time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC), false},
+		{"2024-03-01T10:30:00+02:00", time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC), false},
+		{"01/03/2024", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSearchTime(tt.value)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("parseSearchTime(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestSearchMessagesValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		field string
+	}{
+		{"missing user id", "q=hello", "user_id"},
+		{"missing query", "user_id=1&q=%20", "q"},
+		{"invalid group id", "user_id=1&q=hello&group_id=x", "group_id"},
+		{"invalid sender id", "user_id=1&q=hello&sender_id=x", "sender_id"},
+		{"invalid from", "user_id=1&q=hello&from=yesterday", "from"},
+		{"invalid to", "user_id=1&q=hello&to=tomorrow", "to"},
+		{"limit too large", "user_id=1&q=hello&limit=1000", "limit"},
+		{"negative offset", "user_id=1&q=hello&offset=-1", "offset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			SearchMessages(w, httptest.NewRequest(http.MethodGet, "/api/search/messages?"+tt.query, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(w.Body.String(), `"field":"`+tt.field+`"`) {
+				t.Errorf("body = %s, want an error on %s", w.Body, tt.field)
+			}
+		})
+	}
+}
+
+func TestSearchMessagesScope(t *testing.T) {
+	testenv.Postgres(t)
+	ctx := context.Background()
+
+	member := testenv.CreateUser(t)
+	outsider := testenv.CreateUser(t)
+	blocked := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, member)
+	if err := database.AddGroupMember(ctx, groupID, blocked, database.RoleMember); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.BlockUser(ctx, member, blocked); err != nil {
+		t.Fatal(err)
+	}
+
+	// A word no other test writes
+	word := strings.TrimPrefix(testenv.Name("w"), "w_")
+	post := func(senderID, receiverID, groupID int, deleted bool) int {
+		var id int
+		query := `INSERT INTO messages (sender_id, receiver_id, group_id, content, deleted_at)
+		          VALUES ($1, NULLIF($2, 0), NULLIF($3, 0), $4, CASE WHEN $5 THEN NOW() END) RETURNING id`
+		if err := database.DB.QueryRow(ctx, query, senderID, receiverID, groupID, "about "+word+" today", deleted).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	inGroup := post(member, 0, groupID, false)
+	post(member, 0, groupID, true)
+	direct := post(outsider, member, 0, false)
+	fromBlocked := post(blocked, 0, groupID, false)
+
+	tests := []struct {
+		name   string
+		userID int
+		extra  string
+		want   []int
+	}{
+		{"group member and recipient", member, "", []int{inGroup, direct}},
+		{"only the group", member, "&group_id=" + strconv.Itoa(groupID), []int{inGroup}},
+		{"only the sender", member, "&sender_id=" + strconv.Itoa(outsider), []int{direct}},
+		{"outside the group", outsider, "", []int{direct}},
+		{"blocked group member", blocked, "", []int{inGroup, fromBlocked}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/api/search/messages?user_id=" + strconv.Itoa(tt.userID) + "&q=" + url.QueryEscape(word) + tt.extra
+			w := httptest.NewRecorder()
+			SearchMessages(w, httptest.NewRequest(http.MethodGet, target, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+
+			var response SearchMessagesResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			got := map[int]bool{}
+			for _, result := range response.Results {
+				got[result.Message.ID] = true
+				if !strings.Contains(result.Snippet, "<mark>"+word+"</mark>") {
+					t.Errorf("snippet %q does not highlight the match", result.Snippet)
+				}
+			}
+			if len(got) != len(tt.want) || response.TotalCount != len(tt.want) {
+				t.Errorf("results = %v (total %d), want %v", got, response.TotalCount, tt.want)
+			}
+			for _, id := range tt.want {
+				if !got[id] {
+					t.Errorf("message %d is missing from the results", id)
+				}
+			}
+		})
+	}
+}
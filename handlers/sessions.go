@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/websocket"
+)
+
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	// Parse user id from query string
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	sessions, err := websocket.Sessions(userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch sessions"))
+		log.Println("Error fetching sessions:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+	log.Println("Sessions fetched for user:", userID)
+}
+
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	// Parse user id from query string and device id from path
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+	deviceID := r.PathValue("device_id")
+
+	revoked, err := websocket.RevokeSession(userID, deviceID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to revoke session"))
+		log.Println("Error revoking session:", err)
+		return
+	}
+	if !revoked {
+		apierror.Write(w, r, apierror.NotFound("Session not found"))
+		return
+	}
+
+	// A revoked device gets no more push notifications
+	err = database.DeletePushToken(r.Context(), userID, deviceID)
+	if err != nil && !errors.Is(err, database.ErrPushTokenNotFound) {
+		log.Println("Error deleting push token:", err)
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Session revoked successfully"}`))
+	log.Println("User", userID, "revoked the session of device", deviceID)
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/imaging"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// maxUploadSize is the largest file accepted by UploadFile
+const maxUploadSize = 10 << 20
+
+// allowedUploadTypes lists the accepted MIME types, detected from the file contents
+// rather than trusting the type sent by the client
+var allowedUploadTypes = map[string]bool{
+	"image/jpeg":                true,
+	"image/png":                 true,
+	"image/gif":                 true,
+	"image/webp":                true,
+	"application/pdf":           true,
+	"application/zip":           true,
+	"text/plain; charset=utf-8": true,
+	"audio/mpeg":                true,
+	"audio/wave":                true,
+	"video/mp4":                 true,
+	"video/webm":                true,
+}
+
+func UploadFile(w http.ResponseWriter, r *http.Request) {
+	// Reject oversized bodies before reading them, leaving room for the multipart envelope
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+(1<<20))
+	err := r.ParseMultipartForm(1 << 20)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			apierror.Write(w, r, apierror.TooLarge("File too large"))
+			return
+		}
+		apierror.Write(w, r, apierror.BadRequest("Unable to parse upload"))
+		log.Println("Error parsing multipart form:", err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	// Parse uploader id from form
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	if !checkRestrictions(w, r, userID, true) {
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("file", "Missing file"))
+		log.Println("Error reading uploaded file:", err)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxUploadSize {
+		apierror.Write(w, r, apierror.TooLarge("File too large"))
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadSize+1))
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("Unable to read file"))
+		log.Println("Error reading uploaded file:", err)
+		return
+	}
+	if len(data) > maxUploadSize {
+		apierror.Write(w, r, apierror.TooLarge("File too large"))
+		return
+	}
+
+	// Detect the content type from the first bytes of the file
+	contentType := http.DetectContentType(data)
+	if !allowedUploadTypes[contentType] {
+		apierror.Write(w, r, apierror.UnsupportedMedia("Unsupported file type"))
+		log.Println("Rejected upload of type", contentType)
+		return
+	}
+
+	attachment := models.Attachment{
+		Filename:    filepath.Base(header.Filename),
+		ContentType: contentType,
+	}
+
+	// Images are re-encoded to strip EXIF metadata such as GPS coordinates
+	if strings.HasPrefix(contentType, "image/") {
+		sanitized, err := imaging.Sanitize(data)
+		if errors.Is(err, imaging.ErrImageTooLarge) {
+			apierror.Write(w, r, apierror.TooLarge(fmt.Sprintf("Images may have at most %d pixels and %d frames", imaging.MaxPixels, imaging.MaxGIFFrames)))
+			return
+		}
+		if err != nil {
+			apierror.Write(w, r, apierror.UnsupportedMedia("Unable to process image"))
+			log.Println("Error re-encoding uploaded image:", err)
+			return
+		}
+		data = sanitized.Data
+		attachment.ContentType = sanitized.ContentType
+		attachment.Width = sanitized.Width
+		attachment.Height = sanitized.Height
+	}
+	attachment.Size = int64(len(data))
+
+	// Hash the contents, blobs are stored by hash so identical files share storage
+	hash := sha256.Sum256(data)
+	attachment.SHA256 = hex.EncodeToString(hash[:])
+	storageKey := fmt.Sprintf("attachments/%s/%s", attachment.SHA256[:2], attachment.SHA256)
+
+	err = storage.Blobs.Put(r.Context(), storageKey, bytes.NewReader(data), attachment.Size, attachment.ContentType)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to store file"))
+		log.Println("Error storing uploaded file:", err)
+		return
+	}
+
+	// insert attachment into database
+	query := `INSERT INTO attachments (uploader_id, storage_key, filename, content_type, size_bytes, width, height, sha256)
+	          VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, 0), $8)
+	          RETURNING id, created_at`
+	err = database.DB.QueryRow(r.Context(), query, userID, storageKey, attachment.Filename, attachment.ContentType, attachment.Size, attachment.Width, attachment.Height, attachment.SHA256).Scan(&attachment.ID, &attachment.CreatedAt)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to store file"))
+		log.Println("Error creating attachment:", err)
+		return
+	}
+	attachment.URL = database.AttachmentURL(attachment.ID)
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+	log.Println("File uploaded:", attachment.ID, attachment.ContentType, attachment.Size)
+}
+
+func GetUpload(w http.ResponseWriter, r *http.Request) {
+	// Parse attachment id from path
+	attachmentID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid attachment id"))
+		log.Println("Error parsing attachment id:", err)
+		return
+	}
+
+	// Parse user id from query string
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	var storageKey, filename, contentType string
+	var uploaderID, senderID, receiverID, groupID int
+	var attached, deleted bool
+	query := `SELECT a.storage_key, a.filename, a.content_type, COALESCE(a.uploader_id, 0), m.id IS NOT NULL,
+	                 COALESCE(m.sender_id, 0), COALESCE(m.receiver_id, 0), COALESCE(m.group_id, 0), m.deleted_at IS NOT NULL
+	          FROM attachments a
+	          LEFT JOIN messages m ON m.id = a.message_id
+	          WHERE a.id = $1`
+	err = database.DB.QueryRow(r.Context(), query, attachmentID).Scan(&storageKey, &filename, &contentType, &uploaderID, &attached, &senderID, &receiverID, &groupID, &deleted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		apierror.Write(w, r, apierror.NotFound("Attachment not found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch attachment"))
+		log.Println("Error fetching attachment:", err)
+		return
+	}
+
+	// Attachments are served to the uploader and to the conversation of their message,
+	// attachments of deleted messages to nobody. Others are told it does not exist.
+	allowed := !deleted && userID == uploaderID
+	if attached && !deleted && !allowed {
+		if groupID != 0 {
+			allowed, err = database.IsGroupMember(r.Context(), groupID, userID)
+			if err != nil {
+				apierror.Write(w, r, apierror.From(err, "Unable to fetch attachment"))
+				log.Println("Error checking group membership:", err)
+				return
+			}
+		} else {
+			allowed = userID == senderID || userID == receiverID
+		}
+	}
+	if !allowed {
+		apierror.Write(w, r, apierror.NotFound("Attachment not found"))
+		return
+	}
+
+	blob, err := storage.Blobs.Get(r.Context(), storageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		apierror.Write(w, r, apierror.NotFound("Attachment not found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch attachment"))
+		log.Println("Error reading attachment blob:", err)
+		return
+	}
+	defer blob.Close()
+
+	// Only images are displayed inline, everything else is downloaded
+	disposition := "attachment"
+	if strings.HasPrefix(contentType, "image/") {
+		disposition = "inline"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	io.Copy(w, blob)
+}
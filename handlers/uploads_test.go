@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+	"github.com/clementus360/proxy-chat/storage"
+)
+
+func TestGetUploadAccess(t *testing.T) {
+	testenv.Postgres(t)
+	bg := context.Background()
+	previous := storage.Blobs
+	storage.Blobs, _ = storage.NewLocalStore(t.TempDir())
+	t.Cleanup(func() { storage.Blobs = previous })
+
+	sender := testenv.CreateUser(t)
+	receiver := testenv.CreateUser(t)
+	member := testenv.CreateUser(t)
+	outsider := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, sender)
+	if err := database.AddGroupMember(bg, groupID, member, database.RoleMember); err != nil {
+		t.Fatal(err)
+	}
+
+	direct := insertMessage(t, sender, receiver, 0, "direct")
+	group := insertMessage(t, sender, 0, groupID, "group")
+	deleted := insertMessage(t, sender, receiver, 0, "deleted")
+	if _, err := database.DB.Exec(bg, "UPDATE messages SET deleted_at = NOW() WHERE id = $1", deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	// attach stores a blob uploaded by the sender, messageID is zero for an upload not sent yet
+	attach := func(messageID int) string {
+		t.Helper()
+		key := testenv.Name("attachment")
+		if err := storage.Blobs.Put(bg, key, strings.NewReader("file"), 4, "text/plain"); err != nil {
+			t.Fatal(err)
+		}
+		var id int
+		query := `INSERT INTO attachments (uploader_id, message_id, storage_key, filename, content_type, size_bytes, sha256)
+		          VALUES ($1, NULLIF($2, 0), $3, 'notes.txt', 'text/plain', 4, $4) RETURNING id`
+		if err := database.DB.QueryRow(bg, query, sender, messageID, key, strings.Repeat("0", 64)).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return strconv.Itoa(id)
+	}
+	pending := attach(0)
+	inDirect := attach(direct)
+	inGroup := attach(group)
+	inDeleted := attach(deleted)
+
+	tests := []struct {
+		name         string
+		attachmentID string
+		userID       string
+		want         int
+	}{
+		{"uploader before sending", pending, strconv.Itoa(sender), http.StatusOK},
+		{"someone else before sending", pending, strconv.Itoa(receiver), http.StatusNotFound},
+		{"direct message receiver", inDirect, strconv.Itoa(receiver), http.StatusOK},
+		{"outsider of a direct message", inDirect, strconv.Itoa(outsider), http.StatusNotFound},
+		{"group member", inGroup, strconv.Itoa(member), http.StatusOK},
+		{"outsider of a group", inGroup, strconv.Itoa(outsider), http.StatusNotFound},
+		{"deleted message", inDeleted, strconv.Itoa(receiver), http.StatusNotFound},
+		{"uploader of a deleted message", inDeleted, strconv.Itoa(sender), http.StatusNotFound},
+		{"missing user id", inDirect, "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/uploads/"+tt.attachmentID+"?user_id="+tt.userID, nil)
+			r.SetPathValue("id", tt.attachmentID)
+			w := httptest.NewRecorder()
+			GetUpload(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want == http.StatusOK && w.Body.String() != "file" {
+				t.Errorf("body = %q, want the stored file", w.Body)
+			}
+		})
+	}
+}
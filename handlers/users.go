@@ -9,8 +9,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/clementus360/proxy-chat/apierror"
 	"github.com/clementus360/proxy-chat/database"
 	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/validation"
 )
 
 // Define a response struct that excludes latitude & longitude
@@ -24,6 +26,22 @@ type UserResponse struct {
 	CreatedAt  time.Time `json:"created_at"`
 }
 
+// NearbyQuery holds the query parameters of the location searches
+type NearbyQuery struct {
+	Lat    *float64 `query:"lat" json:"lat" validate:"required,lat"`
+	Long   *float64 `query:"long" json:"long" validate:"required,lng"`
+	Radius int      `query:"radius" json:"radius" validate:"min=1,max=50"`
+}
+
+// UpdateUserRequest lists the fields a user can change, nil fields are left as they are
+type UpdateUserRequest struct {
+	Username  *string  `json:"username" validate:"username"`
+	ImageURL  *string  `json:"image_url" validate:"url,max=255"`
+	Latitude  *float64 `json:"latitude" validate:"required_with=longitude,lat"`
+	Longitude *float64 `json:"longitude" validate:"required_with=latitude,lng"`
+	Visible   *bool    `json:"visible"`
+}
+
 // Response struct for GetUsers API
 type GetUsersResponse struct {
 	Users      []UserResponse `json:"users"`
@@ -35,21 +53,13 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body
 	var user models.User
-	err := json.NewDecoder(r.Body).Decode(&user)
+	err := validation.DecodeJSON(r.Body, &user)
 	if err != nil {
-		http.Error(w, "Unable to parse request body", http.StatusBadRequest)
+		apierror.Write(w, r, err)
 		log.Println("Error parsing user from request body:", err)
 		return
 	}
 
-	// Create initials from username
-	if user.Image_url == "" {
-		userName := strings.ReplaceAll(user.Username, " ", "")
-		backgroundColor := fmt.Sprintf("%06x", (int(user.ID)*12345+100000)&0xB0B0B0)
-		textColor := "ffffff"
-		user.Image_url = fmt.Sprintf("https://ui-avatars.com/api/?name=%s&background=%s&color=%s&size=256", userName, backgroundColor, textColor)
-	}
-
 	// Ensure location is valid and create a point from latitude and longitude
 	location := fmt.Sprintf("POINT(%f %f)", user.Longitude, user.Latitude)
 
@@ -57,11 +67,24 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 	query := "INSERT INTO users (username, latitude, longitude, image_url, location) VALUES ($1, $2, $3, $4, ST_GeographyFromText($5)) RETURNING id, created_at"
 	err = database.DB.QueryRow(r.Context(), query, user.Username, user.Latitude, user.Longitude, user.Image_url, location).Scan(&user.ID, &user.CreatedAt)
 	if err != nil {
-		http.Error(w, "Unable to create user", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.From(err, "Unable to create user"))
 		log.Println("Error creating user:", err)
 		return
 	}
 
+	// Render an initials avatar locally when no image was provided
+	if user.Image_url == "" {
+		user.Image_url, err = generateAvatar(r.Context(), avatarKindUsers, user.ID, user.Username)
+		if err != nil {
+			log.Println("Error generating avatar:", err)
+		} else {
+			_, err = database.DB.Exec(r.Context(), "UPDATE users SET image_url = $1 WHERE id = $2", user.Image_url, user.ID)
+			if err != nil {
+				log.Println("Error saving avatar url:", err)
+			}
+		}
+	}
+
 	// Send response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
@@ -73,37 +96,19 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 	// Parse user id from URL
 	userID, err := strconv.Atoi(r.URL.Query().Get("id"))
 	if err != nil {
-		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid user id"))
 		log.Println("Error parsing user id:", err)
 		return
 	}
 
-	// Default search radius is 5km
-	radius := 5
-	if r.URL.Query().Get("radius") != "" {
-		parsedRadius, err := strconv.Atoi(r.URL.Query().Get("radius"))
-		if err != nil || parsedRadius <= 0 {
-			http.Error(w, "Invalid radius", http.StatusBadRequest)
-			log.Println("Error parsing radius:", err)
-			return
-		}
-		radius = parsedRadius
-	}
-
-	// Parse latitude and longitude from URL
-	lat, err := strconv.ParseFloat(r.URL.Query().Get("lat"), 64)
+	// Parse location and search radius from query string, the default radius is 5km
+	search := NearbyQuery{Radius: 5}
+	err = validation.DecodeQuery(r.URL.Query(), &search)
 	if err != nil {
-		http.Error(w, "Invalid latitude", http.StatusBadRequest)
-		log.Println("Error parsing latitude:", err)
-		return
-	}
-
-	long, err := strconv.ParseFloat(r.URL.Query().Get("long"), 64)
-	if err != nil {
-		http.Error(w, "Invalid longitude", http.StatusBadRequest)
-		log.Println("Error parsing longitude:", err)
+		apierror.Write(w, r, err)
 		return
 	}
+	lat, long, radius := *search.Lat, *search.Long, search.Radius
 
 	// Ensure location is valid and create a point from latitude and longitude
 	location := fmt.Sprintf("POINT(%f %f)", long, lat)
@@ -113,11 +118,13 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 		FROM users 
 		WHERE ST_DWithin(
 		location, ST_GeographyFromText($1), $2 * 1000
-		) AND visible = TRUE AND id != $3 AND online = TRUE;`
+		) AND visible = TRUE AND id != $3 AND online = TRUE
+		AND id NOT IN (SELECT blocked_id FROM user_blocks WHERE blocker_id = $3)
+		AND id NOT IN (SELECT blocker_id FROM user_blocks WHERE blocked_id = $3);`
 
 	rows, err := database.DB.Query(r.Context(), query, location, radius, userID)
 	if err != nil {
-		http.Error(w, "Unable to fetch users", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch users"))
 		log.Println("Error fetching users:", err)
 		return
 	}
@@ -129,7 +136,7 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 		var user UserResponse
 		err = rows.Scan(&user.ID, &user.Username, &user.Image_url, &user.Visible, &user.Online, &user.LastActive, &user.CreatedAt)
 		if err != nil {
-			http.Error(w, "Unable to fetch users", http.StatusInternalServerError)
+			apierror.Write(w, r, apierror.From(err, "Unable to fetch users"))
 			log.Println("Error fetching users:", err)
 			return
 		}
@@ -150,11 +157,11 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 }
 
 func UpdateUser(w http.ResponseWriter, r *http.Request) {
-	// Parse request body
-	var updates map[string]interface{}
-	err := json.NewDecoder(r.Body).Decode(&updates)
+	// Parse request body, only the fields present are updated
+	var updates UpdateUserRequest
+	err := validation.DecodeJSON(r.Body, &updates)
 	if err != nil {
-		http.Error(w, "Unable to parse request body", http.StatusBadRequest)
+		apierror.Write(w, r, err)
 		log.Println("Error parsing user updates from request body:", err)
 		return
 	}
@@ -162,7 +169,7 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	// Parse user id from URL
 	userID, err := strconv.Atoi(r.URL.Query().Get("id"))
 	if err != nil {
-		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid user id"))
 		log.Println("Error parsing user id:", err)
 		return
 	}
@@ -173,51 +180,37 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	argIndex := 1
 
 	// handle updatable fields
-	if username, exists := updates["username"]; exists {
+	if updates.Username != nil {
 		queryParts = append(queryParts, fmt.Sprintf("username = $%d", argIndex))
-		queryParams = append(queryParams, username)
+		queryParams = append(queryParams, *updates.Username)
 		argIndex++
 	}
 
-	if imageURL, exists := updates["image_url"]; exists {
+	if updates.ImageURL != nil {
 		queryParts = append(queryParts, fmt.Sprintf("image_url = $%d", argIndex))
-		queryParams = append(queryParams, imageURL)
-		argIndex++
-	}
-
-	if latitude, exists := updates["latitude"]; exists {
-		queryParts = append(queryParts, fmt.Sprintf("latitude = $%d", argIndex))
-		queryParams = append(queryParams, latitude)
+		queryParams = append(queryParams, *updates.ImageURL)
 		argIndex++
 	}
 
-	if longitude, exists := updates["longitude"]; exists {
-		queryParts = append(queryParts, fmt.Sprintf("longitude = $%d", argIndex))
-		queryParams = append(queryParams, longitude)
-		argIndex++
-	}
-
-	if visible, exists := updates["visible"]; exists {
+	if updates.Visible != nil {
 		queryParts = append(queryParts, fmt.Sprintf("visible = $%d", argIndex))
-		queryParams = append(queryParams, visible)
+		queryParams = append(queryParams, *updates.Visible)
 		argIndex++
 	}
 
-	// Ensure location is valid and create a point from latitude and longitude
-	if lat, exists := updates["latitude"].(float64); exists {
-		if lng, exists := updates["longitude"].(float64); exists {
-			location := fmt.Sprintf("POINT(%f %f)", lng, lat)
-			queryParts = append(queryParts, fmt.Sprintf("location = ST_GeographyFromText($%d)", argIndex))
-			queryParams = append(queryParams, location)
-			argIndex++
-		}
+	// Latitude and longitude are validated to come together, update the point with them
+	if updates.Latitude != nil {
+		location := fmt.Sprintf("POINT(%f %f)", *updates.Longitude, *updates.Latitude)
+		queryParts = append(queryParts, fmt.Sprintf("latitude = $%d, longitude = $%d, location = ST_GeographyFromText($%d)", argIndex, argIndex+1, argIndex+2))
+		queryParams = append(queryParams, *updates.Latitude, *updates.Longitude, location)
+		argIndex += 3
 
-		log.Println("Location updated:", updates["latitude"], updates["longitude"])
+		log.Println("Location updated:", *updates.Latitude, *updates.Longitude)
 	}
 
 	// if no updatable fields are provided
 	if len(queryParts) == 0 {
-		http.Error(w, "No fields to update", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.BadRequest("No fields to update"))
 		log.Println("No fields to update")
 		return
 	}
@@ -231,7 +224,7 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	var user models.User
 	err = database.DB.QueryRow(r.Context(), query, queryParams...).Scan(&user.ID, &user.Username, &user.Image_url, &user.Longitude, &user.Latitude, &user.Visible, &user.LastActive, &user.CreatedAt)
 	if err != nil {
-		http.Error(w, "Unable to update user", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.From(err, "Unable to update user"))
 		log.Println("Error updating user:", err)
 		return
 	}
@@ -248,7 +241,7 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	// Parse user id from URL
 	userID, err := strconv.Atoi(r.URL.Query().Get("id"))
 	if err != nil {
-		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid user id"))
 		log.Println("Error parsing user id:", err)
 		return
 	}
@@ -257,7 +250,7 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	query := "DELETE FROM users WHERE id = $1"
 	_, err = database.DB.Exec(r.Context(), query, userID)
 	if err != nil {
-		http.Error(w, "Unable to delete user", http.StatusInternalServerError)
+		apierror.Write(w, r, apierror.From(err, "Unable to delete user"))
 		log.Println("Error deleting user:", err)
 		return
 	}
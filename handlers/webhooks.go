@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/validation"
+	"github.com/clementus360/proxy-chat/webhooks"
+)
+
+// Most webhooks a group may register
+const maxGroupWebhooks = 5
+
+// checkWebhook validates the url and the events of a new webhook against the events allowed
+// for its scope, removing duplicate events. It returns false when the request was answered.
+func checkWebhook(w http.ResponseWriter, r *http.Request, hook *models.Webhook, allowed []string) bool {
+	// Paths on this server are valid urls elsewhere, not here
+	if strings.HasPrefix(hook.URL, "/") {
+		apierror.Write(w, r, apierror.Invalid("url", "must be an absolute http or https URL"))
+		return false
+	}
+
+	events := []string{}
+	for _, event := range hook.Events {
+		if !slices.Contains(allowed, event) {
+			apierror.Write(w, r, apierror.Invalid("events", fmt.Sprintf("must be one of %s", strings.Join(allowed, ", "))))
+			return false
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	hook.Events = events
+	return true
+}
+
+// createWebhook stores a webhook with a new secret and returns it, with the secret
+func createWebhook(w http.ResponseWriter, r *http.Request, hook *models.Webhook) {
+	var err error
+	hook.Secret, err = webhooks.NewSecret()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal("Unable to create webhook"))
+		log.Println("Error generating webhook secret:", err)
+		return
+	}
+
+	err = database.CreateWebhook(r.Context(), hook)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to create webhook"))
+		log.Println("Error creating webhook:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+	log.Println("Webhook created:", hook.ID, hook.URL, hook.Events)
+}
+
+// writeWebhookDeliveries answers with the delivery log of a webhook
+func writeWebhookDeliveries(w http.ResponseWriter, r *http.Request, webhookID int) {
+	limit, offset, err := parsePagination(r, 50, 200)
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest(err.Error()))
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && status != models.DeliveryPending && status != models.DeliveryDelivered && status != models.DeliveryDead {
+		apierror.Write(w, r, apierror.Invalid("status", "must be one of pending, delivered, dead"))
+		return
+	}
+
+	deliveries, err := database.WebhookDeliveries(r.Context(), webhookID, status, limit, offset)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch webhook deliveries"))
+		log.Println("Error fetching webhook deliveries:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// serverWebhook loads the server wide webhook named by the id path value.
+// It returns false when the request was answered.
+func serverWebhook(w http.ResponseWriter, r *http.Request) (models.Webhook, bool) {
+	webhookID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid webhook id"))
+		log.Println("Error parsing webhook id:", err)
+		return models.Webhook{}, false
+	}
+
+	hook, err := database.GetWebhook(r.Context(), webhookID)
+	if errors.Is(err, database.ErrWebhookNotFound) || (err == nil && (hook.GroupID != nil || hook.BotID != nil)) {
+		apierror.Write(w, r, apierror.NotFound("Webhook not found"))
+		return hook, false
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch webhook"))
+		log.Println("Error fetching webhook:", err)
+		return hook, false
+	}
+	return hook, true
+}
+
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var hook models.Webhook
+	err := validation.DecodeJSON(r.Body, &hook)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing webhook from request body:", err)
+		return
+	}
+	hook.GroupID, hook.BotID, hook.CreatedBy = nil, nil, nil
+
+	if !checkWebhook(w, r, &hook, webhooks.Events) {
+		return
+	}
+	createWebhook(w, r, &hook)
+}
+
+func GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := database.Webhooks(r.Context(), nil)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch webhooks"))
+		log.Println("Error fetching webhooks:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := serverWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := database.DeleteWebhook(r.Context(), hook.ID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to delete webhook"))
+		log.Println("Error deleting webhook:", err)
+		return
+	}
+
+	log.Println("Webhook deleted:", hook.ID)
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"message": "Webhook deleted successfully"}`))
+}
+
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	hook, ok := serverWebhook(w, r)
+	if !ok {
+		return
+	}
+	writeWebhookDeliveries(w, r, hook.ID)
+}
+
+// groupModerator parses the group id path value and checks that userID moderates the group.
+// It returns false when the request was answered.
+func groupModerator(w http.ResponseWriter, r *http.Request, userID int) (int, bool) {
+	groupID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("id", "Invalid group id"))
+		log.Println("Error parsing group id:", err)
+		return 0, false
+	}
+
+	// Only group moderators may manage webhooks and bots, they receive the group's messages
+	isModerator, err := database.IsGroupModerator(r.Context(), groupID, userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to check group role"))
+		log.Println("Error checking group role:", err)
+		return 0, false
+	}
+	if !isModerator {
+		apierror.Write(w, r, apierror.Forbidden("Only group moderators can manage webhooks and bots"))
+		return 0, false
+	}
+	return groupID, true
+}
+
+// groupWebhook checks that the user_id query parameter moderates the group and loads the group
+// webhook named by the webhook_id path value. It returns false when the request was answered.
+func groupWebhook(w http.ResponseWriter, r *http.Request) (models.Webhook, bool) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return models.Webhook{}, false
+	}
+
+	groupID, ok := groupModerator(w, r, userID)
+	if !ok {
+		return models.Webhook{}, false
+	}
+
+	webhookID, err := strconv.Atoi(r.PathValue("webhook_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("webhook_id", "Invalid webhook id"))
+		log.Println("Error parsing webhook id:", err)
+		return models.Webhook{}, false
+	}
+
+	hook, err := database.GetWebhook(r.Context(), webhookID)
+	if errors.Is(err, database.ErrWebhookNotFound) || (err == nil && (hook.GroupID == nil || *hook.GroupID != groupID)) {
+		apierror.Write(w, r, apierror.NotFound("Webhook not found"))
+		return hook, false
+	}
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch webhook"))
+		log.Println("Error fetching webhook:", err)
+		return hook, false
+	}
+	return hook, true
+}
+
+func CreateGroupWebhook(w http.ResponseWriter, r *http.Request) {
+	// Parse request body
+	var requestData struct {
+		UserID int `json:"user_id" validate:"required"`
+		models.Webhook
+	}
+	err := validation.DecodeJSON(r.Body, &requestData)
+	if err != nil {
+		apierror.Write(w, r, err)
+		log.Println("Error parsing webhook from request body:", err)
+		return
+	}
+	hook := requestData.Webhook
+
+	groupID, ok := groupModerator(w, r, requestData.UserID)
+	if !ok {
+		return
+	}
+	hook.GroupID, hook.BotID, hook.CreatedBy = &groupID, nil, &requestData.UserID
+
+	if !checkWebhook(w, r, &hook, webhooks.GroupEvents) {
+		return
+	}
+
+	existing, err := database.Webhooks(r.Context(), &groupID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to create webhook"))
+		log.Println("Error fetching group webhooks:", err)
+		return
+	}
+	if len(existing) >= maxGroupWebhooks {
+		apierror.Write(w, r, apierror.Conflict(fmt.Sprintf("Groups can register at most %d webhooks", maxGroupWebhooks)))
+		return
+	}
+
+	createWebhook(w, r, &hook)
+}
+
+func GetGroupWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user id"))
+		log.Println("Error parsing user id:", err)
+		return
+	}
+
+	groupID, ok := groupModerator(w, r, userID)
+	if !ok {
+		return
+	}
+
+	hooks, err := database.Webhooks(r.Context(), &groupID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to fetch webhooks"))
+		log.Println("Error fetching webhooks:", err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+func DeleteGroupWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := groupWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := database.DeleteWebhook(r.Context(), hook.ID)
+	if err != nil {
+		apierror.Write(w, r, apierror.From(err, "Unable to delete webhook"))
+		log.Println("Error deleting webhook:", err)
+		return
+	}
+
+	log.Println("Webhook", hook.ID, "deleted from group", *hook.GroupID)
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"message": "Webhook deleted successfully"}`))
+}
+
+func GetGroupWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	hook, ok := groupWebhook(w, r)
+	if !ok {
+		return
+	}
+	writeWebhookDeliveries(w, r, hook.ID)
+}
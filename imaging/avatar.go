@@ -0,0 +1,113 @@
+package imaging
+
+import (
+	"hash/fnv"
+	"image"
+	"image/color"
+	"strings"
+	"unicode"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Initials returns up to two uppercase letters taken from the first words of a name.
+// Characters the bundled bitmap font cannot draw are skipped, "?" is used if nothing is left.
+func Initials(name string) string {
+	var initials []rune
+	for _, word := range strings.Fields(name) {
+		for _, r := range word {
+			r = unicode.ToUpper(r)
+			if r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				initials = append(initials, r)
+				break
+			}
+		}
+		if len(initials) == 2 {
+			break
+		}
+	}
+
+	if len(initials) == 0 {
+		return "?"
+	}
+	return string(initials)
+}
+
+// AvatarColor derives a stable background color from a name. Hue varies with the name
+// while saturation and lightness are fixed so white initials always stay readable.
+func AvatarColor(name string) color.RGBA {
+	hash := fnv.New32a()
+	hash.Write([]byte(strings.ToLower(strings.TrimSpace(name))))
+	hue := float64(hash.Sum32()%360) / 360
+
+	return hslToRGB(hue, 0.55, 0.45)
+}
+
+// InitialsAvatar renders the initials of a name in white on its avatar color
+func InitialsAvatar(name string, size int) image.Image {
+	avatar := image.NewRGBA(image.Rect(0, 0, size, size))
+	xdraw.Draw(avatar, avatar.Bounds(), image.NewUniform(AvatarColor(name)), image.Point{}, xdraw.Src)
+
+	// Draw the initials with the bitmap font at its native size, then scale them up
+	initials := Initials(name)
+	face := basicfont.Face7x13
+	textWidth := font.MeasureString(face, initials).Ceil()
+	textHeight := face.Metrics().Height.Ceil()
+
+	text := image.NewRGBA(image.Rect(0, 0, textWidth, textHeight))
+	drawer := font.Drawer{
+		Dst:  text,
+		Src:  image.NewUniform(white),
+		Face: face,
+		Dot:  fixed.P(0, face.Metrics().Ascent.Ceil()),
+	}
+	drawer.DrawString(initials)
+
+	// The initials take about half of the avatar width
+	scale := float64(size) / 2 / float64(textWidth)
+	if maxScale := float64(size) / 2 / float64(textHeight); scale > maxScale {
+		scale = maxScale
+	}
+	scaledWidth := int(float64(textWidth) * scale)
+	scaledHeight := int(float64(textHeight) * scale)
+	target := image.Rect(0, 0, scaledWidth, scaledHeight).Add(image.Pt((size-scaledWidth)/2, (size-scaledHeight)/2))
+
+	xdraw.ApproxBiLinear.Scale(avatar, target, text, text.Bounds(), xdraw.Over, nil)
+	return avatar
+}
+
+func hslToRGB(h, s, l float64) color.RGBA {
+	var q float64
+	if l < 0.5 {
+		q = l * (1 + s)
+	} else {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+
+	channel := func(t float64) uint8 {
+		if t < 0 {
+			t++
+		}
+		if t > 1 {
+			t--
+		}
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 1.0/2:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return uint8(v*255 + 0.5)
+	}
+
+	return color.RGBA{R: channel(h + 1.0/3), G: channel(h), B: channel(h - 1.0/3), A: 0xff}
+}
@@ -0,0 +1,54 @@
+package imaging
+
+import "errors"
+
+var errMalformedGIF = errors.New("malformed GIF")
+
+// gifFrames counts the frames of a GIF by walking its blocks, without decompressing them
+func gifFrames(data []byte) (int, error) {
+	// Header and logical screen descriptor
+	if len(data) < 13 {
+		return 0, errMalformedGIF
+	}
+	pos := 13 + colorTableSize(data[10])
+
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // Extension: label, then sub-blocks
+			pos += 2
+		case 0x2c: // Image descriptor, local color table, LZW code size, then sub-blocks
+			if pos+10 > len(data) {
+				return 0, errMalformedGIF
+			}
+			pos += 10 + colorTableSize(data[pos+9]) + 1
+			frames++
+		case 0x3b: // Trailer
+			return frames, nil
+		default:
+			return 0, errMalformedGIF
+		}
+
+		// Sub-blocks run until an empty one
+		for {
+			if pos >= len(data) {
+				return 0, errMalformedGIF
+			}
+			size := int(data[pos])
+			pos += 1 + size
+			if size == 0 {
+				break
+			}
+		}
+	}
+	return 0, errMalformedGIF
+}
+
+// colorTableSize returns the length of the color table announced by the packed field of a
+// screen or image descriptor
+func colorTableSize(packed byte) int {
+	if packed&0x80 == 0 {
+		return 0
+	}
+	return 3 << (packed&0x07 + 1)
+}
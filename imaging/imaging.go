@@ -0,0 +1,200 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// ThumbnailSizes are the square sizes, in pixels, generated for avatars and group images
+var ThumbnailSizes = []int{64, 128, 256}
+
+// DefaultSize is served when a client does not ask for a specific thumbnail size
+const DefaultSize = 256
+
+// jpegQuality is used whenever an image is re-encoded as JPEG
+const jpegQuality = 85
+
+// Images are checked against these limits from their headers before they are decoded, a small
+// file may declare dimensions that take gigabytes of memory once decoded
+const (
+	// MaxPixels bounds the width times the height of an image
+	MaxPixels = 40_000_000
+	// MaxGIFFrames bounds the frames of an animated GIF
+	MaxGIFFrames = 500
+	// maxAnimationPixels bounds the pixels of all frames of an animated GIF together
+	maxAnimationPixels = 100_000_000
+)
+
+var (
+	// ErrUnsupportedImage is returned for image formats that cannot be decoded
+	ErrUnsupportedImage = errors.New("unsupported image format")
+	// ErrImageTooLarge is returned for images over MaxPixels or MaxGIFFrames
+	ErrImageTooLarge = errors.New("image too large")
+)
+
+// Image is an encoded image along with its content type and dimensions
+type Image struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Check reads the format and dimensions of an image from its header and rejects images over
+// the size limits, without decoding their pixels
+func Check(data []byte) (string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if config, err = webp.DecodeConfig(bytes.NewReader(data)); err != nil {
+			return "", ErrUnsupportedImage
+		}
+		format = "webp"
+	}
+
+	pixels := int64(config.Width) * int64(config.Height)
+	if pixels > MaxPixels {
+		return "", ErrImageTooLarge
+	}
+
+	// Frames are bounded by the logical screen of the GIF, the decoder rejects larger ones
+	if format == "gif" {
+		frames, err := gifFrames(data)
+		if err != nil {
+			return "", ErrUnsupportedImage
+		}
+		if frames > MaxGIFFrames || int64(frames)*pixels > maxAnimationPixels {
+			return "", ErrImageTooLarge
+		}
+	}
+	return format, nil
+}
+
+// Decode reads a JPEG, PNG, GIF or WebP image and applies the EXIF orientation of JPEGs,
+// so the returned image looks the way the camera meant it to once metadata is dropped
+func Decode(data []byte) (image.Image, string, error) {
+	format, err := Check(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var img image.Image
+	if format == "webp" {
+		img, err = webp.Decode(bytes.NewReader(data))
+	} else {
+		img, _, err = image.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if format == "jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	return img, format, nil
+}
+
+// Sanitize re-encodes an uploaded image from its pixels only, which strips EXIF data such as
+// GPS coordinates, camera details and embedded thumbnails. Animated GIFs keep their frames,
+// WebP images are converted to PNG since the standard library cannot encode WebP.
+func Sanitize(data []byte) (Image, error) {
+	format, err := Check(data)
+	if err != nil {
+		return Image{}, err
+	}
+
+	if format == "gif" {
+		animation, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return Image{}, err
+		}
+
+		var buf bytes.Buffer
+		err = gif.EncodeAll(&buf, &gif.GIF{
+			Image:     animation.Image,
+			Delay:     animation.Delay,
+			LoopCount: animation.LoopCount,
+			Disposal:  animation.Disposal,
+			Config:    animation.Config,
+		})
+		if err != nil {
+			return Image{}, err
+		}
+		return Image{Data: buf.Bytes(), ContentType: "image/gif", Width: animation.Config.Width, Height: animation.Config.Height}, nil
+	}
+
+	img, format, err := Decode(data)
+	if err != nil {
+		return Image{}, err
+	}
+
+	if format == "jpeg" {
+		return EncodeJPEG(img)
+	}
+	return EncodePNG(img)
+}
+
+func EncodeJPEG(img image.Image) (Image, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return Image{}, err
+	}
+	bounds := img.Bounds()
+	return Image{Data: buf.Bytes(), ContentType: "image/jpeg", Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+func EncodePNG(img image.Image) (Image, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return Image{}, err
+	}
+	bounds := img.Bounds()
+	return Image{Data: buf.Bytes(), ContentType: "image/png", Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+// Thumbnail crops the center square of an image and scales it to size x size pixels
+func Thumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+
+	thumb := image.NewRGBA(image.Rect(0, 0, size, size))
+	xdraw.CatmullRom.Scale(thumb, thumb.Bounds(), img, crop, xdraw.Src, nil)
+	return thumb
+}
+
+// toRGBA copies any image into an RGBA image anchored at the origin
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	xdraw.Draw(rgba, rgba.Bounds(), img, bounds.Min, xdraw.Src)
+	return rgba
+}
+
+// HasAlpha reports whether an image uses transparency, such images are kept as PNG
+func HasAlpha(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var white = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
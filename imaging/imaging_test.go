@@ -0,0 +1,132 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+// pngData encodes a small PNG, then patches its header to declare width x height pixels
+func pngData(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// Signature, then the IHDR chunk: length, type, width, height, ..., CRC of type and data
+	ihdr := data[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:4], width)
+	binary.BigEndian.PutUint32(ihdr[4:8], height)
+	binary.BigEndian.PutUint32(data[8+8+13:], crc32.ChecksumIEEE(data[8+4:8+8+13]))
+	return data
+}
+
+// gifData encodes an animation of 1x1 frames, then patches its logical screen to width x height
+func gifData(t *testing.T, frames int, width, height uint16) []byte {
+	t.Helper()
+
+	animation := &gif.GIF{}
+	for i := range frames {
+		frame := image.NewPaletted(image.Rect(0, 0, 1, 1), palette.Plan9)
+		frame.Set(0, 0, color.Gray{Y: uint8(i)})
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, 10)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint16(data[6:8], width)
+	binary.LittleEndian.PutUint16(data[8:10], height)
+	return data
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		wantFormat string
+		wantErr    error
+	}{
+		{"small png", pngData(t, 2, 2), "png", nil},
+		{"png at the pixel limit", pngData(t, 8000, 5000), "png", nil},
+		{"png over the pixel limit", pngData(t, 8000, 5001), "", ErrImageTooLarge},
+		{"png declaring billions of pixels", pngData(t, 100000, 100000), "", ErrImageTooLarge},
+		{"animated gif", gifData(t, 20, 1, 1), "gif", nil},
+		{"gif at the frame limit", gifData(t, MaxGIFFrames, 1, 1), "gif", nil},
+		{"gif over the frame limit", gifData(t, MaxGIFFrames+1, 1, 1), "", ErrImageTooLarge},
+		{"gif over the pixel limit", gifData(t, 1, 8000, 8000), "", ErrImageTooLarge},
+		{"gif over the animation pixel limit", gifData(t, 100, 1200, 1000), "", ErrImageTooLarge},
+		{"truncated gif", gifData(t, 3, 1, 1)[:40], "", ErrUnsupportedImage},
+		{"not an image", []byte("hello, world"), "", ErrUnsupportedImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := Check(tt.data)
+			if !errors.Is(err, tt.wantErr) || format != tt.wantFormat {
+				t.Errorf("Check() = %q, %v, want %q, %v", format, err, tt.wantFormat, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsOversizedImages(t *testing.T) {
+	bombs := map[string][]byte{
+		"png": pngData(t, 50000, 50000),
+		"gif": gifData(t, MaxGIFFrames+1, 1, 1),
+	}
+	for name, data := range bombs {
+		if _, _, err := Decode(data); !errors.Is(err, ErrImageTooLarge) {
+			t.Errorf("Decode(%s) error = %v, want ErrImageTooLarge", name, err)
+		}
+		if _, err := Sanitize(data); !errors.Is(err, ErrImageTooLarge) {
+			t.Errorf("Sanitize(%s) error = %v, want ErrImageTooLarge", name, err)
+		}
+	}
+}
+
+func TestGIFFrames(t *testing.T) {
+	tests := []struct {
+		name       string
+		frames     int
+		withLocals bool
+	}{
+		{"single frame", 1, false},
+		{"animation", 12, false},
+		{"local color tables", 5, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			animation := &gif.GIF{LoopCount: 0}
+			for i := range tt.frames {
+				colors := color.Palette{color.Black, color.White}
+				if tt.withLocals && i%2 == 1 {
+					colors = palette.WebSafe
+				}
+				animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, 4, 4), colors))
+				animation.Delay = append(animation.Delay, 5)
+			}
+
+			var buf bytes.Buffer
+			if err := gif.EncodeAll(&buf, animation); err != nil {
+				t.Fatal(err)
+			}
+			frames, err := gifFrames(buf.Bytes())
+			if err != nil || frames != tt.frames {
+				t.Errorf("gifFrames() = %d, %v, want %d", frames, err, tt.frames)
+			}
+		})
+	}
+}
@@ -1,16 +1,34 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/config"
 	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/filters"
+	"github.com/clementus360/proxy-chat/grpcapi"
 	"github.com/clementus360/proxy-chat/handlers"
+	"github.com/clementus360/proxy-chat/openapi"
+	"github.com/clementus360/proxy-chat/push"
+	"github.com/clementus360/proxy-chat/ratelimit"
+	"github.com/clementus360/proxy-chat/storage"
+	"github.com/clementus360/proxy-chat/webhooks"
 	"github.com/clementus360/proxy-chat/websocket"
 
 	"github.com/rs/cors"
 )
 
+// routes records every registered pattern so it can be checked against the OpenAPI document
+var routes []string
+
+func handle(pattern string, handler http.HandlerFunc) {
+	routes = append(routes, pattern)
+	http.HandleFunc(pattern, handler)
+}
+
 func main() {
 	// Initialize PostgreSQL & Redis
 	database.InitPostgres()
@@ -19,28 +37,129 @@ func main() {
 	// Run database migrations
 	database.RunMigrations()
 
-	// Set up http routes
-	http.HandleFunc("POST /api/users", handlers.CreateUser)   // POST /users
-	http.HandleFunc("GET /api/users", handlers.GetUsers)      // GET /users/:lat/:long
-	http.HandleFunc("PATCH /api/users", handlers.UpdateUser)  // PATCH /users
-	http.HandleFunc("DELETE /api/users", handlers.DeleteUser) // DELETE /users
+	// Initialize blob storage for uploads
+	storage.InitBlobStore()
 
-	http.HandleFunc("POST /api/groups", handlers.CreateGroup)    // POST /groups
-	http.HandleFunc("GET /api/groups", handlers.GetGroups)       // GET /groups/:lat/:long
-	http.HandleFunc("POST /api/groups/join", handlers.JoinGroup) // GET /group/:group_id
+	// Load the message filter policy
+	filters.InitFilters()
 
-	http.HandleFunc("POST /api/messages", handlers.SendMessage) // POST /messages
-	http.HandleFunc("GET /api/messages", handlers.GetMessages)  // GET /messages/:group_id
+	// Select the rate limiter backend
+	ratelimit.InitRateLimiter()
 
-	http.HandleFunc("GET /ws", websocket.HandleWebSocket)
+	// Configure the push platforms
+	push.InitNotifiers()
 
-	// Set up CORS
-	c := cors.AllowAll()
-	handler := c.Handler(http.DefaultServeMux)
+	// Deliver queued webhook events in the background
+	go webhooks.Start(context.Background())
+
+	// Push batched notifications to offline users in the background
+	go push.Start(context.Background())
+
+	// Set up http routes
+	registerRoutes()
+
+	// Set up CORS, exposing the headers clients need to read error details
+	c := cors.New(cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{http.MethodHead, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{"X-Request-ID", "Retry-After", "X-RateLimit-Remaining"},
+	})
+	handler := c.Handler(apierror.WithRequestID(http.DefaultServeMux))
+
+	// Serve the gRPC API on its own port, its methods run the routes above
+	go func() {
+		log.Fatal(grpcapi.Serve(config.GetEnv("GRPC_ADDR", ":9090"), apierror.WithRequestID(http.DefaultServeMux)))
+	}()
 
 	log.Println("Proximity chat backend is running...")
 	log.Println("Listening on port 8080")
 	log.Fatal(http.ListenAndServe(":8080", handler))
 }
 
+// registerRoutes sets up the http routes, each limited per client IP and per user.
+// main_test.go checks them against the OpenAPI document.
+func registerRoutes() {
+	handle("POST /api/users", ratelimit.Middleware(ratelimit.RuleWrite, handlers.CreateUser))   // POST /users
+	handle("GET /api/users", ratelimit.Middleware(ratelimit.RuleNearby, handlers.GetUsers))      // GET /users?id=&lat=&long=&radius=
+	handle("PATCH /api/users", ratelimit.Middleware(ratelimit.RuleWrite, handlers.UpdateUser))  // PATCH /users?id=
+	handle("DELETE /api/users", ratelimit.Middleware(ratelimit.RuleWrite, handlers.DeleteUser)) // DELETE /users?id=
+
+	handle("GET /api/users/sessions", ratelimit.Middleware(ratelimit.RuleAPI, handlers.GetSessions))                    // GET /users/sessions?user_id=
+	handle("DELETE /api/users/sessions/{device_id}", ratelimit.Middleware(ratelimit.RuleWrite, handlers.RevokeSession)) // DELETE /users/sessions/:device_id?user_id=
+
+	handle("POST /api/users/push-tokens", ratelimit.Middleware(ratelimit.RuleWrite, handlers.RegisterPushToken))                // POST /users/push-tokens
+	handle("GET /api/users/push-tokens", ratelimit.Middleware(ratelimit.RuleAPI, handlers.GetPushTokens))                       // GET /users/push-tokens?user_id=
+	handle("DELETE /api/users/push-tokens/{device_id}", ratelimit.Middleware(ratelimit.RuleWrite, handlers.DeletePushToken))    // DELETE /users/push-tokens/:device_id?user_id=
+	handle("GET /api/users/notifications", ratelimit.Middleware(ratelimit.RuleAPI, handlers.GetNotificationSettings))           // GET /users/notifications?user_id=
+	handle("PUT /api/users/notifications", ratelimit.Middleware(ratelimit.RuleWrite, handlers.UpdateNotificationSettings))      // PUT /users/notifications
+
+	handle("POST /api/users/blocks", ratelimit.Middleware(ratelimit.RuleWrite, handlers.BlockUser))        // POST /users/blocks
+	handle("GET /api/users/blocks", ratelimit.Middleware(ratelimit.RuleAPI, handlers.GetBlockedUsers))   // GET /users/blocks?user_id=
+	handle("DELETE /api/users/blocks", ratelimit.Middleware(ratelimit.RuleWrite, handlers.UnblockUser))    // DELETE /users/blocks?user_id=&blocked_id=
+
+	handle("POST /api/groups", ratelimit.Middleware(ratelimit.RuleWrite, handlers.CreateGroup))    // POST /groups
+	handle("GET /api/groups", ratelimit.Middleware(ratelimit.RuleNearby, handlers.GetGroups))       // GET /groups?lat=&long=&radius=&user_id=
+	handle("POST /api/groups/join", ratelimit.Middleware(ratelimit.RuleWrite, handlers.JoinGroup)) // POST /groups/join
+	handle("POST /api/groups/leave", ratelimit.Middleware(ratelimit.RuleWrite, handlers.LeaveGroup)) // POST /groups/leave
+	handle("GET /api/groups/{id}/filters", ratelimit.Middleware(ratelimit.RuleAPI, handlers.GetGroupFilters))    // GET /groups/:id/filters
+	handle("PUT /api/groups/{id}/filters", ratelimit.Middleware(ratelimit.RuleWrite, handlers.UpdateGroupFilters)) // PUT /groups/:id/filters
 
+	handle("GET /api/groups/{id}/notifications", ratelimit.Middleware(ratelimit.RuleAPI, handlers.GetGroupNotificationSettings))      // GET /groups/:id/notifications?user_id=
+	handle("PUT /api/groups/{id}/notifications", ratelimit.Middleware(ratelimit.RuleWrite, handlers.UpdateGroupNotificationSettings)) // PUT /groups/:id/notifications
+
+	handle("POST /api/groups/{id}/webhooks", ratelimit.Middleware(ratelimit.RuleWrite, handlers.CreateGroupWebhook))                               // POST /groups/:id/webhooks
+	handle("GET /api/groups/{id}/webhooks", ratelimit.Middleware(ratelimit.RuleAPI, handlers.GetGroupWebhooks))                                    // GET /groups/:id/webhooks?user_id=
+	handle("DELETE /api/groups/{id}/webhooks/{webhook_id}", ratelimit.Middleware(ratelimit.RuleWrite, handlers.DeleteGroupWebhook))                // DELETE /groups/:id/webhooks/:webhook_id?user_id=
+	handle("GET /api/groups/{id}/webhooks/{webhook_id}/deliveries", ratelimit.Middleware(ratelimit.RuleAPI, handlers.GetGroupWebhookDeliveries)) // GET /groups/:id/webhooks/:webhook_id/deliveries?user_id=&status=&limit=&offset=
+	handle("POST /api/groups/{id}/bots", ratelimit.Middleware(ratelimit.RuleWrite, handlers.AddGroupBot))                 // POST /groups/:id/bots
+	handle("DELETE /api/groups/{id}/bots/{bot_id}", ratelimit.Middleware(ratelimit.RuleWrite, handlers.RemoveGroupBot)) // DELETE /groups/:id/bots/:bot_id?user_id=
+
+	handle("POST /api/messages", ratelimit.Middleware(ratelimit.RuleWrite, handlers.SendMessage)) // POST /messages
+	handle("GET /api/messages", ratelimit.Middleware(ratelimit.RuleAPI, handlers.GetMessages))  // GET /messages?thread_id=&user_id= | ?group_id=&user_id= | ?user_id=
+	handle("GET /api/messages/unread", ratelimit.Middleware(ratelimit.RuleAPI, handlers.GetUnreadCounts)) // GET /messages/unread?user_id=
+	handle("GET /api/messages/search", ratelimit.Middleware(ratelimit.RuleAPI, handlers.SearchMessages))  // GET /messages/search?user_id=&q=&group_id=&sender_id=&from=&to=&limit=&offset=
+	handle("PATCH /api/messages/{id}", ratelimit.Middleware(ratelimit.RuleWrite, handlers.EditMessage))      // PATCH /messages/:id
+	handle("DELETE /api/messages/{id}", ratelimit.Middleware(ratelimit.RuleWrite, handlers.DeleteMessage))   // DELETE /messages/:id?user_id=
+
+	handle("POST /api/messages/{id}/reactions", ratelimit.Middleware(ratelimit.RuleWrite, handlers.AddReaction))      // POST /messages/:id/reactions
+	handle("DELETE /api/messages/{id}/reactions", ratelimit.Middleware(ratelimit.RuleWrite, handlers.RemoveReaction)) // DELETE /messages/:id/reactions?user_id=&emoji=
+
+	handle("POST /api/uploads", ratelimit.Middleware(ratelimit.RuleUpload, handlers.UploadFile))   // POST /uploads (multipart: file, user_id)
+	handle("GET /api/uploads/{id}", ratelimit.Middleware(ratelimit.RuleMedia, handlers.GetUpload)) // GET /uploads/:id?user_id=
+
+	handle("GET /api/avatars/{kind}/{id}", ratelimit.Middleware(ratelimit.RuleMedia, handlers.GetAvatar))     // GET /avatars/(users|groups)/:id?size=
+	handle("POST /api/avatars/{kind}/{id}", ratelimit.Middleware(ratelimit.RuleUpload, handlers.UploadAvatar)) // POST /avatars/(users|groups)/:id (multipart: file, user_id)
+
+	handle("POST /api/reports", ratelimit.Middleware(ratelimit.RuleWrite, handlers.CreateReport)) // POST /reports
+
+	handle("POST /api/bots", ratelimit.Middleware(ratelimit.RuleWrite, handlers.CreateBot))                 // POST /bots
+	handle("GET /api/bots", ratelimit.Middleware(ratelimit.RuleAPI, handlers.GetBots))                      // GET /bots?user_id=
+	handle("DELETE /api/bots/{id}", ratelimit.Middleware(ratelimit.RuleWrite, handlers.DeleteBot))          // DELETE /bots/:id?user_id=
+	handle("POST /api/bots/{id}/token", ratelimit.Middleware(ratelimit.RuleWrite, handlers.ResetBotToken)) // POST /bots/:id/token
+
+	// Bot API endpoints require a bot token, "Authorization: Bot <token>", and are limited per bot
+	handle("GET /api/bot/me", handlers.RequireBot(ratelimit.RuleBot, handlers.GetBotMe))                                   // GET /bot/me
+	handle("PUT /api/bot/commands", handlers.RequireBot(ratelimit.RuleBot, handlers.SetBotCommands))                       // PUT /bot/commands
+	handle("POST /api/bot/messages", handlers.RequireBot(ratelimit.RuleBotMessage, handlers.SendBotMessage))               // POST /bot/messages
+	handle("PUT /api/bot/webhook", handlers.RequireBot(ratelimit.RuleBot, handlers.SetBotWebhook))                         // PUT /bot/webhook
+	handle("DELETE /api/bot/webhook", handlers.RequireBot(ratelimit.RuleBot, handlers.DeleteBotWebhook))                   // DELETE /bot/webhook
+	handle("GET /api/bot/webhook/deliveries", handlers.RequireBot(ratelimit.RuleBot, handlers.GetBotWebhookDeliveries)) // GET /bot/webhook/deliveries?status=&limit=&offset=
+
+	// Moderation endpoints require the ADMIN_TOKEN bearer token
+	handle("GET /api/admin/reports", handlers.RequireAdmin(handlers.GetReports))           // GET /admin/reports?status=&limit=&offset=
+	handle("PATCH /api/admin/reports/{id}", handlers.RequireAdmin(handlers.UpdateReport))  // PATCH /admin/reports/:id
+	handle("POST /api/admin/actions", handlers.RequireAdmin(handlers.TakeModerationAction)) // POST /admin/actions
+	handle("GET /api/admin/audit", handlers.RequireAdmin(handlers.GetModerationLog))       // GET /admin/audit?limit=&offset=
+
+	handle("POST /api/admin/webhooks", handlers.RequireAdmin(handlers.CreateWebhook))                        // POST /admin/webhooks
+	handle("GET /api/admin/webhooks", handlers.RequireAdmin(handlers.GetWebhooks))                           // GET /admin/webhooks
+	handle("DELETE /api/admin/webhooks/{id}", handlers.RequireAdmin(handlers.DeleteWebhook))                 // DELETE /admin/webhooks/:id
+	handle("GET /api/admin/webhooks/{id}/deliveries", handlers.RequireAdmin(handlers.GetWebhookDeliveries)) // GET /admin/webhooks/:id/deliveries?status=&limit=&offset=
+
+	handle("GET /ws", ratelimit.Middleware(ratelimit.RuleConnect, websocket.HandleWebSocket)) // GET /ws?user_id=&device_id= (bots send their token)
+	handle("GET /api/events", ratelimit.Middleware(ratelimit.RuleEvents, websocket.HandleEvents))     // GET /events?user_id=&device_id=&features=&last_event_id=
+	handle("GET /api/events/poll", ratelimit.Middleware(ratelimit.RuleEvents, websocket.PollEvents)) // GET /events/poll?user_id=&device_id=&features=&cursor=
+
+	handle("GET /api/openapi.json", ratelimit.Middleware(ratelimit.RuleAPI, openapi.ServeSpec)) // GET /openapi.json
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/openapi"
+)
+
+// TestRoutesMatchOpenAPI keeps openapi.json in sync with the routes, run go generate ./openapi
+// after changing either
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	registerRoutes()
+
+	problems, err := openapi.CheckRoutes(routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("OpenAPI document out of sync:\n%s", strings.Join(problems, "\n"))
+	}
+}
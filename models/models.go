@@ -2,12 +2,15 @@ package models
 
 import "time"
 
+// DeletedMessageContent replaces the content of soft-deleted messages
+const DeletedMessageContent = "message deleted"
+
 type User struct {
 	ID         int       `json:"id"`
-	Username   string    `json:"username"`
-	Image_url  string    `json:"image_url"`
-	Latitude   float64   `json:"latitude"`
-	Longitude  float64   `json:"longitude"`
+	Username   string    `json:"username" validate:"required,username"`
+	Image_url  string    `json:"image_url" validate:"omitempty,url,max=255"`
+	Latitude   float64   `json:"latitude" validate:"lat"`
+	Longitude  float64   `json:"longitude" validate:"lng"`
 	Visible    bool      `json:"visible"`
 	Online     bool      `json:"online"`
 	LastActive time.Time `json:"last_active"`
@@ -16,19 +19,227 @@ type User struct {
 
 type Group struct {
 	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Image_url string    `json:"image_url"`
-	CreatorID int       `json:"creator_id"`
-	Latitude  float64   `json:"latitude"`
-	Longitude float64   `json:"longitude"`
+	Name      string    `json:"name" validate:"required,max=100"`
+	Image_url string    `json:"image_url" validate:"omitempty,url,max=255"`
+	CreatorID int       `json:"creator_id" validate:"required"`
+	Latitude  float64   `json:"latitude" validate:"lat"`
+	Longitude float64   `json:"longitude" validate:"lng"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// NearbyMember is a group member listed by the /who command
+type NearbyMember struct {
+	UserID     int     `json:"user_id"`
+	Name       string  `json:"name"`
+	Role       string  `json:"role"`
+	DistanceKm float64 `json:"distance_km"`
+}
+
 type Message struct {
-	ID         int       `json:"id"`
-	Content    string    `json:"content"`
-	GroupID    int       `json:"group_id"`
-	SenderID   int       `json:"sender_id"`
-	ReceiverID int       `json:"receiver_id"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID               int             `json:"id"`
+	Content          string          `json:"content" validate:"max=4000,required_without=attachment_ids"`
+	GroupID          int             `json:"group_id" validate:"required_without=receiver_id,excluded_with=receiver_id"`
+	SenderID         int             `json:"sender_id" validate:"required"`
+	ReceiverID       int             `json:"receiver_id"`
+	DeliveredAt      *time.Time      `json:"delivered_at,omitempty"`
+	ReadAt           *time.Time      `json:"read_at,omitempty"`
+	EditedAt         *time.Time      `json:"edited_at,omitempty"`
+	Deleted          bool            `json:"deleted,omitempty"`
+	Reactions        []ReactionCount `json:"reactions,omitempty"`
+	ReplyToID        int             `json:"reply_to_id,omitempty"`
+	ReplyTo          *ReplyPreview   `json:"reply_to,omitempty"`
+	ThreadRootID     int             `json:"thread_root_id,omitempty"`
+	ThreadReplyCount int             `json:"thread_reply_count,omitempty"`
+	AttachmentIDs    []int           `json:"attachment_ids,omitempty" validate:"max=10"`
+	Attachments      []Attachment    `json:"attachments,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+
+	// ClientMsgID is chosen by the client so retried sends return the stored message
+	ClientMsgID string `json:"client_msg_id,omitempty" validate:"max=64"`
+}
+
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+}
+
+// ReplyPreview is the quoted part of the message being replied to
+type ReplyPreview struct {
+	ID       int    `json:"id"`
+	SenderID int    `json:"sender_id"`
+	Content  string `json:"content"`
+	Deleted  bool   `json:"deleted,omitempty"`
+}
+
+type Attachment struct {
+	ID          int       `json:"id"`
+	URL         string    `json:"url"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Width       int       `json:"width,omitempty"`
+	Height      int       `json:"height,omitempty"`
+	SHA256      string    `json:"sha256"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Report targets and statuses
+const (
+	ReportTargetMessage = "message"
+	ReportTargetUser    = "user"
+	ReportTargetGroup   = "group"
+
+	ReportStatusOpen      = "open"
+	ReportStatusTriaged   = "triaged"
+	ReportStatusResolved  = "resolved"
+	ReportStatusDismissed = "dismissed"
+)
+
+type Report struct {
+	ID         int        `json:"id"`
+	ReporterID int        `json:"reporter_id" validate:"required"`
+	TargetType string     `json:"target_type" validate:"required,oneof=message user group"`
+	TargetID   int        `json:"target_id" validate:"required"`
+	Reason     string     `json:"reason" validate:"required,oneof=spam harassment hate violence sexual_content impersonation other"`
+	Details    string     `json:"details,omitempty" validate:"max=2000"`
+	Status     string     `json:"status"`
+	Resolution string     `json:"resolution,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// ModerationAction is an entry of the moderation audit log
+type ModerationAction struct {
+	ID         int        `json:"id"`
+	Moderator  string     `json:"moderator"`
+	Action     string     `json:"action"`
+	TargetType string     `json:"target_type"`
+	TargetID   int        `json:"target_id"`
+	ReportID   *int       `json:"report_id,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Actions applied to blocked words
+const (
+	WordActionMask   = "mask"
+	WordActionReject = "reject"
+)
+
+// GroupFilterSettings override the server wide message filters for one group.
+// Nil fields keep the server default, word and domain lists add to the server lists.
+type GroupFilterSettings struct {
+	GroupID        int       `json:"group_id"`
+	MaxLength      *int      `json:"max_length,omitempty" validate:"min=1"`
+	BlockedWords   []string  `json:"blocked_words" validate:"max=500"`
+	WordAction     string    `json:"word_action,omitempty" validate:"omitempty,oneof=mask reject"`
+	LinksAllowed   *bool     `json:"links_allowed,omitempty"`
+	AllowedDomains []string  `json:"allowed_domains" validate:"max=200"`
+	DeniedDomains  []string  `json:"denied_domains" validate:"max=200"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Webhook events
+const (
+	WebhookMessageCreated = "message.created"
+	WebhookMemberJoined   = "member.joined"
+	WebhookMemberLeft     = "member.left"
+	WebhookGroupCreated   = "group.created"
+	WebhookReportFiled    = "report.filed"
+
+	// WebhookCommandInvoked is only sent to the bot that registered the command
+	WebhookCommandInvoked = "command.invoked"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Webhook receives the events it subscribed to. Group webhooks only see the events of their
+// group, bot webhooks the events of the groups their bot joined and its commands, server
+// webhooks (without a group or bot) see every event.
+type Webhook struct {
+	ID        int       `json:"id"`
+	GroupID   *int      `json:"group_id,omitempty"`
+	BotID     *int      `json:"bot_id,omitempty"`
+	URL       string    `json:"url" validate:"required,url,max=2000"`
+	Events    []string  `json:"events" validate:"required,max=5"`
+	CreatedBy *int      `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Secret signs the payloads, it is only returned when the webhook is created
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookDelivery is an entry of the delivery log of a webhook
+type WebhookDelivery struct {
+	ID             int        `json:"id"`
+	WebhookID      int        `json:"webhook_id"`
+	Event          string     `json:"event"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// Bot is an automated account. Bots post as a user without a location, so they never appear in
+// nearby searches, and they authenticate with a token instead of a user id.
+type Bot struct {
+	ID          int          `json:"id"`
+	Username    string       `json:"username" validate:"required,username"`
+	Description string       `json:"description,omitempty" validate:"max=500"`
+	OwnerID     int          `json:"owner_id" validate:"required"`
+	Commands    []BotCommand `json:"commands"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// BotCommand is a slash command handled by a bot, group messages invoking it are sent to the bot
+type BotCommand struct {
+	Name        string `json:"name" validate:"required,command"`
+	Description string `json:"description,omitempty" validate:"max=200"`
+	Usage       string `json:"usage,omitempty" validate:"max=200"`
+}
+
+// Push notification platforms
+const (
+	PlatformFCM  = "fcm"
+	PlatformAPNs = "apns"
+)
+
+// PushToken is the token a device registered with its push platform, notifications about
+// messages that reach none of the user's connected devices are sent to it
+type PushToken struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id" validate:"required"`
+	DeviceID  string    `json:"device_id" validate:"required,max=64"`
+	Platform  string    `json:"platform" validate:"required,oneof=fcm apns"`
+	Token     string    `json:"token" validate:"required,max=4096"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NotificationSettings are the push preferences of a user. No notification is sent between the
+// start and the end of the quiet hours, which are read in the user's time zone and may span midnight.
+type NotificationSettings struct {
+	UserID          int    `json:"user_id" validate:"required"`
+	QuietHoursStart string `json:"quiet_hours_start,omitempty" validate:"required_with=quiet_hours_end,omitempty,clock"`
+	QuietHoursEnd   string `json:"quiet_hours_end,omitempty" validate:"required_with=quiet_hours_start,omitempty,clock"`
+	TimeZone        string `json:"time_zone" validate:"max=64"`
+}
+
+// GroupNotificationSettings tell whether a member gets push notifications for a group,
+// muted groups stay muted until MutedUntil, or until they are unmuted when it is not set
+type GroupNotificationSettings struct {
+	GroupID    int        `json:"group_id"`
+	UserID     int        `json:"user_id"`
+	Muted      bool       `json:"muted"`
+	MutedUntil *time.Time `json:"muted_until,omitempty"`
 }
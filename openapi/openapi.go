@@ -0,0 +1,68 @@
+// Package openapi serves the OpenAPI document describing the REST routes and WebSocket frames.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+//go:generate go run ../cmd/genclient -spec openapi.json -out ../client/client.go
+
+//go:embed openapi.json
+var document []byte
+
+// Document returns the raw OpenAPI document
+func Document() []byte {
+	return document
+}
+
+// ServeSpec serves the OpenAPI document
+func ServeSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(document)
+}
+
+// Operations lists the operations of the document as ServeMux patterns, such as "GET /api/users"
+func Operations() ([]string, error) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(document, &spec); err != nil {
+		return nil, fmt.Errorf("parsing openapi.json: %w", err)
+	}
+
+	var operations []string
+	for path, item := range spec.Paths {
+		for method := range item {
+			operations = append(operations, strings.ToUpper(method)+" "+path)
+		}
+	}
+	slices.Sort(operations)
+	return operations, nil
+}
+
+// CheckRoutes compares the registered route patterns with the document and describes every
+// route that is missing from either side
+func CheckRoutes(patterns []string) ([]string, error) {
+	operations, err := Operations()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, pattern := range patterns {
+		if !slices.Contains(operations, pattern) {
+			problems = append(problems, fmt.Sprintf("route %q is not documented in openapi.json", pattern))
+		}
+	}
+	for _, operation := range operations {
+		if !slices.Contains(patterns, operation) {
+			problems = append(problems, fmt.Sprintf("operation %q in openapi.json has no route", operation))
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,58 @@
+package openapi
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestOperations(t *testing.T) {
+	operations, err := Operations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.IsSorted(operations) {
+		t.Error("operations are not sorted")
+	}
+	for _, want := range []string{"POST /api/users", "GET /api/avatars/{kind}/{id}", "GET /ws", "GET /api/openapi.json"} {
+		if !slices.Contains(operations, want) {
+			t.Errorf("operation %q is missing", want)
+		}
+	}
+}
+
+func TestCheckRoutes(t *testing.T) {
+	operations, err := Operations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{"in sync", operations, nil},
+		{
+			"undocumented route",
+			append(slices.Clone(operations), "GET /api/secret"),
+			[]string{`route "GET /api/secret" is not documented in openapi.json`},
+		},
+		{
+			"operation without route",
+			slices.DeleteFunc(slices.Clone(operations), func(op string) bool { return op == "GET /ws" }),
+			[]string{`operation "GET /ws" in openapi.json has no route`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CheckRoutes(tt.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckRoutes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
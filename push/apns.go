@@ -0,0 +1,149 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apnsTokenLifetime is how long a provider token is reused. Apple rejects tokens older than an
+// hour and refreshing them more often than every 20 minutes.
+const apnsTokenLifetime = 40 * time.Minute
+
+// APNsNotifier sends notifications through the Apple Push Notification service with token based
+// authentication, signing its own provider tokens with the .p8 key of the team
+type APNsNotifier struct {
+	Endpoint string
+	KeyID    string
+	TeamID   string
+	// Topic is the bundle id of the app
+	Topic string
+	key   crypto.Signer
+
+	// Client defaults to http.DefaultClient, which speaks HTTP/2 to TLS endpoints as APNs requires
+	Client *http.Client
+
+	mu          sync.Mutex
+	bearer      string
+	generatedAt time.Time
+}
+
+// NewAPNsNotifier reads the .p8 signing key of a team
+func NewAPNsNotifier(endpoint string, key []byte, keyID string, teamID string, topic string) (*APNsNotifier, error) {
+	if keyID == "" || teamID == "" || topic == "" {
+		return nil, errors.New("APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC are required")
+	}
+
+	signer, err := parsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APNs key: %w", err)
+	}
+	if _, ok := signer.(*ecdsa.PrivateKey); !ok {
+		return nil, errors.New("invalid APNs key: not an ECDSA key")
+	}
+	return &APNsNotifier{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		KeyID:    keyID,
+		TeamID:   teamID,
+		Topic:    topic,
+		key:      signer,
+	}, nil
+}
+
+func (a *APNsNotifier) client() *http.Client {
+	if a.Client != nil {
+		return a.Client
+	}
+	return http.DefaultClient
+}
+
+func (a *APNsNotifier) Send(ctx context.Context, token string, n Notification) error {
+	bearer, err := a.token()
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]any{}
+	for key, value := range n.Data {
+		payload[key] = value
+	}
+	payload["aps"] = map[string]any{
+		"alert":     map[string]string{"title": n.Title, "body": n.Body},
+		"sound":     "default",
+		"thread-id": n.CollapseKey,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.Endpoint+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "bearer "+bearer)
+	req.Header.Set("apns-topic", a.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	if n.CollapseKey != "" {
+		req.Header.Set("apns-collapse-id", n.CollapseKey)
+	}
+
+	resp, err := a.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return nil
+	}
+
+	var failure struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&failure)
+
+	if resp.StatusCode == http.StatusGone || failure.Reason == "BadDeviceToken" || failure.Reason == "DeviceTokenNotForTopic" {
+		return ErrInvalidToken
+	}
+	if failure.Reason == "ExpiredProviderToken" {
+		// Sign a new token on the next attempt
+		a.mu.Lock()
+		a.bearer = ""
+		a.mu.Unlock()
+	}
+	return fmt.Errorf("APNs send: %s: %s", resp.Status, failure.Reason)
+}
+
+// token returns the cached provider token, signing a new one once it gets old
+func (a *APNsNotifier) token() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.bearer != "" && time.Since(a.generatedAt) < apnsTokenLifetime {
+		return a.bearer, nil
+	}
+
+	now := time.Now()
+	bearer, err := signJWT(a.key, map[string]string{"kid": a.KeyID}, map[string]any{
+		"iss": a.TeamID,
+		"iat": now.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	a.bearer, a.generatedAt = bearer, now
+	return bearer, nil
+}
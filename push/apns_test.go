@@ -0,0 +1,130 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pkcs8PEM encodes a private key the way FCM service accounts and APNs .p8 files hold it
+func pkcs8PEM(t *testing.T, key any) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestAPNsNotifierSend(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		status      int
+		reason      string
+		wantErr     error
+		wantFailure bool
+		wantResign  bool
+	}{
+		{name: "delivered", status: http.StatusOK},
+		{name: "app uninstalled", status: http.StatusGone, reason: "Unregistered", wantErr: ErrInvalidToken},
+		{name: "bad device token", status: http.StatusBadRequest, reason: "BadDeviceToken", wantErr: ErrInvalidToken},
+		{name: "token of another app", status: http.StatusBadRequest, reason: "DeviceTokenNotForTopic", wantErr: ErrInvalidToken},
+		{name: "expired provider token", status: http.StatusForbidden, reason: "ExpiredProviderToken", wantFailure: true, wantResign: true},
+		{name: "server error", status: http.StatusInternalServerError, reason: "InternalServerError", wantFailure: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			var payload map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				json.NewDecoder(r.Body).Decode(&payload)
+				w.WriteHeader(tt.status)
+				if tt.reason != "" {
+					json.NewEncoder(w).Encode(map[string]string{"reason": tt.reason})
+				}
+			}))
+			defer server.Close()
+
+			notifier, err := NewAPNsNotifier(server.URL+"/", pkcs8PEM(t, key), "KEY123", "TEAM456", "com.example.proxychat")
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := Notification{Title: "alice", Body: "hi", CollapseKey: "user:2", Data: map[string]string{"message_id": "5"}}
+			err = notifier.Send(context.Background(), "device token", n)
+
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Send() = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantFailure:
+				if err == nil || errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("Send() = %v, want a failure keeping the token", err)
+				}
+			case err != nil:
+				t.Fatalf("Send() = %v", err)
+			}
+			if resigned := notifier.bearer == ""; resigned != tt.wantResign {
+				t.Errorf("provider token cleared = %v, want %v", resigned, tt.wantResign)
+			}
+
+			if got.URL.EscapedPath() != "/3/device/device%20token" {
+				t.Errorf("path = %q, want the escaped device token", got.URL.EscapedPath())
+			}
+			if got.Header.Get("apns-topic") != "com.example.proxychat" || got.Header.Get("apns-collapse-id") != "user:2" || got.Header.Get("apns-push-type") != "alert" {
+				t.Errorf("headers = %v", got.Header)
+			}
+			if bearer := got.Header.Get("Authorization"); !strings.HasPrefix(bearer, "bearer ") || strings.Count(bearer, ".") != 2 {
+				t.Errorf("Authorization = %q, want a signed provider token", bearer)
+			}
+			aps, _ := payload["aps"].(map[string]any)
+			alert, _ := aps["alert"].(map[string]any)
+			if alert["title"] != "alice" || alert["body"] != "hi" || aps["thread-id"] != "user:2" || payload["message_id"] != "5" {
+				t.Errorf("payload = %v", payload)
+			}
+		})
+	}
+}
+
+func TestNewAPNsNotifier(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := pkcs8PEM(t, ecKey)
+
+	tests := []struct {
+		name    string
+		key     []byte
+		keyID   string
+		wantErr bool
+	}{
+		{name: "valid", key: valid, keyID: "KEY123"},
+		{name: "missing key id", key: valid, wantErr: true},
+		{name: "not a PEM key", key: []byte("secret"), keyID: "KEY123", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAPNsNotifier("https://api.push.apple.com", tt.key, tt.keyID, "TEAM456", "com.example.proxychat")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAPNsNotifier() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
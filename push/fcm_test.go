@@ -0,0 +1,127 @@
+package push
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFCMNotifierSend(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		status      int
+		failure     string
+		wantErr     error
+		wantFailure bool
+		wantSignIns int
+	}{
+		{name: "delivered", status: http.StatusOK, wantSignIns: 1},
+		{name: "unknown token", status: http.StatusNotFound, failure: `{"error": {"status": "NOT_FOUND", "message": "Requested entity was not found."}}`, wantErr: ErrInvalidToken, wantSignIns: 1},
+		{name: "unregistered token", status: http.StatusBadRequest, failure: `{"error": {"status": "INVALID_ARGUMENT", "details": [{"errorCode": "UNREGISTERED"}]}}`, wantErr: ErrInvalidToken, wantSignIns: 1},
+		{name: "expired access token", status: http.StatusUnauthorized, failure: `{"error": {"status": "UNAUTHENTICATED"}}`, wantFailure: true, wantSignIns: 2},
+		{name: "server error", status: http.StatusInternalServerError, failure: `{"error": {"status": "INTERNAL"}}`, wantFailure: true, wantSignIns: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signIns := 0
+			var sent struct {
+				Message struct {
+					Token        string            `json:"token"`
+					Notification map[string]string `json:"notification"`
+					Data         map[string]string `json:"data"`
+					Android      struct {
+						CollapseKey string `json:"collapse_key"`
+					} `json:"android"`
+				} `json:"message"`
+			}
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+				signIns++
+				if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || r.FormValue("assertion") == "" {
+					http.Error(w, "invalid_grant", http.StatusBadRequest)
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]any{"access_token": "access-token", "expires_in": 3600})
+			})
+			mux.HandleFunc("POST /v1/projects/proxy-chat/messages:send", func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer access-token" {
+					http.Error(w, "unauthorized", http.StatusUnauthorized)
+					return
+				}
+				json.NewDecoder(r.Body).Decode(&sent)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.failure))
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			credentials, err := json.Marshal(map[string]string{
+				"project_id":   "proxy-chat",
+				"client_email": "push@proxy-chat.iam.gserviceaccount.com",
+				"private_key":  string(pkcs8PEM(t, key)),
+				"token_uri":    server.URL + "/token",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			notifier, err := NewFCMNotifier(server.URL, credentials)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The second notification reuses the access token, unless FCM refused it
+			n := Notification{Title: "alice", Body: "hi", CollapseKey: "user:2", Data: map[string]string{"message_id": "5"}}
+			for range 2 {
+				err = notifier.Send(context.Background(), "device-token", n)
+				switch {
+				case tt.wantErr != nil:
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("Send() = %v, want %v", err, tt.wantErr)
+					}
+				case tt.wantFailure:
+					if err == nil || errors.Is(err, ErrInvalidToken) {
+						t.Fatalf("Send() = %v, want a failure keeping the token", err)
+					}
+				case err != nil:
+					t.Fatalf("Send() = %v", err)
+				}
+			}
+			if signIns != tt.wantSignIns {
+				t.Errorf("sign-ins = %d, want %d", signIns, tt.wantSignIns)
+			}
+
+			m := sent.Message
+			if m.Token != "device-token" || m.Notification["title"] != "alice" || m.Notification["body"] != "hi" || m.Data["message_id"] != "5" || m.Android.CollapseKey != "user:2" {
+				t.Errorf("message = %+v", m)
+			}
+		})
+	}
+}
+
+func TestNewFCMNotifier(t *testing.T) {
+	tests := []struct {
+		name        string
+		credentials string
+	}{
+		{name: "not JSON", credentials: "project_id=proxy-chat"},
+		{name: "missing token uri", credentials: `{"project_id": "proxy-chat", "client_email": "push@proxy-chat.iam.gserviceaccount.com", "private_key": ""}`},
+		{name: "invalid key", credentials: `{"project_id": "proxy-chat", "client_email": "push@proxy-chat.iam.gserviceaccount.com", "private_key": "secret", "token_uri": "https://oauth2.googleapis.com/token"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewFCMNotifier("https://fcm.googleapis.com", []byte(tt.credentials)); err == nil {
+				t.Error("NewFCMNotifier() succeeded, want an error")
+			}
+		})
+	}
+}
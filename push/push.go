@@ -0,0 +1,78 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+
+	"github.com/clementus360/proxy-chat/config"
+	"github.com/clementus360/proxy-chat/models"
+
+	// Quiet hours are kept in the time zone of each user, which must load without a system zoneinfo
+	_ "time/tzdata"
+)
+
+// ErrInvalidToken is returned when the push platform no longer accepts a token, because the app
+// was uninstalled or the token expired. The token is removed.
+var ErrInvalidToken = errors.New("push token is no longer valid")
+
+// Notification is what a device shows for one conversation
+type Notification struct {
+	Title string
+	Body  string
+	// CollapseKey makes a notification replace the previous one of the same conversation
+	CollapseKey string
+	// Data is handed to the app when the notification is opened
+	Data map[string]string
+}
+
+// Notifier sends notifications through a push platform
+type Notifier interface {
+	Send(ctx context.Context, token string, n Notification) error
+}
+
+// Notifiers holds the notifier of each configured platform, tokens of other platforms are skipped
+var Notifiers = map[string]Notifier{}
+
+// InitNotifiers configures the push platforms from the environment. A platform without
+// credentials is left out, its devices get no notifications.
+func InitNotifiers() {
+	config.LoadEnv()
+
+	if file := config.GetEnv("FCM_CREDENTIALS_FILE", ""); file != "" {
+		credentials, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatalf("Unable to read FCM credentials: %v", err)
+		}
+		notifier, err := NewFCMNotifier(config.GetEnv("FCM_ENDPOINT", "https://fcm.googleapis.com"), credentials)
+		if err != nil {
+			log.Fatalf("Unable to configure FCM: %v", err)
+		}
+		Notifiers[models.PlatformFCM] = notifier
+		log.Println("Sending push notifications through FCM project", notifier.ProjectID)
+	} else {
+		log.Println("FCM_CREDENTIALS_FILE is not set, FCM devices get no push notifications")
+	}
+
+	if file := config.GetEnv("APNS_KEY_FILE", ""); file != "" {
+		key, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatalf("Unable to read APNs key: %v", err)
+		}
+		notifier, err := NewAPNsNotifier(
+			config.GetEnv("APNS_ENDPOINT", "https://api.push.apple.com"),
+			key,
+			config.GetEnv("APNS_KEY_ID", ""),
+			config.GetEnv("APNS_TEAM_ID", ""),
+			config.GetEnv("APNS_TOPIC", ""),
+		)
+		if err != nil {
+			log.Fatalf("Unable to configure APNs: %v", err)
+		}
+		Notifiers[models.PlatformAPNs] = notifier
+		log.Println("Sending push notifications through APNs for", notifier.Topic)
+	} else {
+		log.Println("APNS_KEY_FILE is not set, APNs devices get no push notifications")
+	}
+}
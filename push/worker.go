@@ -0,0 +1,345 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// Messages for a user who is offline are not pushed one by one. The first one opens a batch that
+// is sent batchWindow later, with one notification per conversation that replaces the previous
+// notification of the conversation on the device.
+const (
+	// batchWindow is how long messages are gathered before the first of them is pushed
+	batchWindow = 10 * time.Second
+	// pollInterval is how often the worker looks for batches that are due
+	pollInterval = 2 * time.Second
+	// batchSize bounds the users whose notifications are sent at once
+	batchSize = 50
+	// pendingRetention drops the messages of a batch no worker picked up
+	pendingRetention = time.Hour
+	// sendTimeout bounds the notifications of one user
+	sendTimeout = 15 * time.Second
+	// previewLength is the most characters of a message shown in a notification
+	previewLength = 100
+)
+
+// dueKey is the Redis sorted set of users with a batch, scored by when it is due
+const dueKey = "push:due"
+
+func pendingKey(userID int) string {
+	return fmt.Sprintf("push:pending:%d", userID)
+}
+
+// Message is what a notification needs to know about a chat message
+type Message struct {
+	ID          int    `json:"id"`
+	GroupID     int    `json:"group_id,omitempty"`
+	SenderID    int    `json:"sender_id"`
+	SenderName  string `json:"sender_name"`
+	Content     string `json:"content"`
+	Attachments int    `json:"attachments,omitempty"`
+}
+
+// conversation names the chat of a message as seen by its recipient, it is the collapse key
+// of its notifications
+func (m Message) conversation() string {
+	if m.GroupID != 0 {
+		return fmt.Sprintf("group:%d", m.GroupID)
+	}
+	return fmt.Sprintf("user:%d", m.SenderID)
+}
+
+// Enqueue adds a message to the batch of a user who is not connected. Users without push
+// tokens are skipped.
+func Enqueue(ctx context.Context, userID int, msg Message) error {
+	hasTokens, err := database.HasPushTokens(ctx, userID)
+	if err != nil || !hasTokens {
+		return err
+	}
+
+	last, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	key := pendingKey(userID)
+	conversation := msg.conversation()
+	pipe := database.RedisClient.TxPipeline()
+	pipe.HIncrBy(ctx, key, conversation+":count", 1)
+	pipe.HSet(ctx, key, conversation+":last", last)
+	pipe.Expire(ctx, key, pendingRetention)
+	// The batch stays due when the first message was queued
+	pipe.ZAddNX(ctx, dueKey, redis.Z{Score: float64(time.Now().Add(batchWindow).UnixMilli()), Member: userID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Start runs the notification worker until ctx is done. Several servers may run it against the
+// same Redis, each batch is claimed by one of them.
+func Start(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going while full batches come back
+		for sendDue(ctx) == batchSize {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendDue sends the batches that are due and returns how many users were looked at
+func sendDue(ctx context.Context) int {
+	users, err := database.RedisClient.ZRangeArgs(ctx, redis.ZRangeArgs{
+		Key:     dueKey,
+		Start:   "-inf",
+		Stop:    strconv.FormatInt(time.Now().UnixMilli(), 10),
+		ByScore: true,
+		Count:   batchSize,
+	}).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Println("Error fetching due push notifications:", err)
+		}
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	for _, member := range users {
+		// Whoever removes the entry owns the batch
+		claimed, err := database.RedisClient.ZRem(ctx, dueKey, member).Result()
+		if err != nil {
+			log.Println("Error claiming push notifications:", err)
+			continue
+		}
+		userID, err := strconv.Atoi(member)
+		if claimed == 0 || err != nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			notify(ctx, userID)
+		}()
+	}
+	wg.Wait()
+	return len(users)
+}
+
+// conversationBatch is what was gathered for one conversation
+type conversationBatch struct {
+	key   string
+	count int
+	last  Message
+}
+
+// notify sends the batch of a user to each of their devices
+func notify(ctx context.Context, userID int) {
+	batches, err := takeBatch(ctx, userID)
+	if err != nil {
+		log.Println("Error loading push notifications:", err)
+		return
+	}
+	if len(batches) == 0 {
+		return
+	}
+
+	// Users who came back since the messages were queued already got them
+	online, err := database.IsOnline(ctx, userID)
+	if err != nil || online {
+		if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+			log.Println("Error checking user presence:", err)
+		}
+		return
+	}
+
+	// Messages held back by quiet hours or mutes are not pushed later, they wait in the
+	// delivery streams like for users without push tokens
+	settings, err := database.GetNotificationSettings(ctx, userID)
+	if err != nil {
+		log.Println("Error fetching notification settings:", err)
+		return
+	}
+	if inQuietHours(settings, time.Now()) {
+		return
+	}
+
+	muted, err := database.PushMutedGroups(ctx, userID)
+	if err != nil {
+		log.Println("Error fetching muted groups:", err)
+		return
+	}
+
+	notifications := []Notification{}
+	for _, batch := range batches {
+		if batch.last.GroupID != 0 && slices.Contains(muted, batch.last.GroupID) {
+			continue
+		}
+		notifications = append(notifications, notification(ctx, batch))
+	}
+	if len(notifications) == 0 {
+		return
+	}
+
+	tokens, err := database.PushTokens(ctx, userID)
+	if err != nil {
+		log.Println("Error fetching push tokens:", err)
+		return
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	for _, token := range tokens {
+		notifier, ok := Notifiers[token.Platform]
+		if !ok {
+			continue
+		}
+		for _, n := range notifications {
+			err = notifier.Send(sendCtx, token.Token, n)
+			if errors.Is(err, ErrInvalidToken) {
+				log.Printf("Discarding the %s push token of device %s of user %d", token.Platform, token.DeviceID, userID)
+				if err = database.DiscardPushToken(ctx, userID, token.Token); err != nil {
+					log.Println("Error discarding push token:", err)
+				}
+				break
+			}
+			if err != nil {
+				log.Printf("Error sending push notification to device %s of user %d: %v", token.DeviceID, userID, err)
+			}
+		}
+	}
+}
+
+// takeBatch reads and removes the messages gathered for a user, by conversation
+func takeBatch(ctx context.Context, userID int) ([]conversationBatch, error) {
+	key := pendingKey(userID)
+	pipe := database.RedisClient.TxPipeline()
+	fields := pipe.HGetAll(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	byKey := map[string]*conversationBatch{}
+	for field, value := range fields.Val() {
+		conversation, kind := splitField(field)
+		batch, ok := byKey[conversation]
+		if !ok {
+			batch = &conversationBatch{key: conversation}
+			byKey[conversation] = batch
+		}
+
+		switch kind {
+		case "count":
+			batch.count, _ = strconv.Atoi(value)
+		case "last":
+			if err := json.Unmarshal([]byte(value), &batch.last); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	batches := []conversationBatch{}
+	for _, batch := range byKey {
+		if batch.last.ID != 0 {
+			batches = append(batches, *batch)
+		}
+	}
+	// Most recent conversation last, so it shows on top
+	slices.SortFunc(batches, func(a, b conversationBatch) int {
+		return a.last.ID - b.last.ID
+	})
+	return batches, nil
+}
+
+// splitField splits a pending field such as "group:4:count" into its conversation and its kind
+func splitField(field string) (string, string) {
+	i := strings.LastIndex(field, ":")
+	if i < 0 {
+		return field, ""
+	}
+	return field[:i], field[i+1:]
+}
+
+// notification describes the messages of one conversation. Group notifications are titled
+// with the group, direct ones with the sender.
+func notification(ctx context.Context, batch conversationBatch) Notification {
+	msg := batch.last
+	title, body := msg.SenderName, preview(msg)
+	data := map[string]string{
+		"conversation": batch.key,
+		"message_id":   strconv.Itoa(msg.ID),
+		"sender_id":    strconv.Itoa(msg.SenderID),
+		"count":        strconv.Itoa(batch.count),
+	}
+
+	if msg.GroupID != 0 {
+		name, err := database.GroupName(ctx, msg.GroupID)
+		if err != nil {
+			log.Println("Error fetching group name:", err)
+			name = "Group"
+		}
+		title, body = name, msg.SenderName+": "+body
+		data["group_id"] = strconv.Itoa(msg.GroupID)
+	}
+	if batch.count > 1 {
+		title = fmt.Sprintf("%s (%d new messages)", title, batch.count)
+	}
+
+	return Notification{Title: title, Body: body, CollapseKey: batch.key, Data: data}
+}
+
+// preview shortens the content of a message for a notification
+func preview(msg Message) string {
+	content := strings.TrimSpace(msg.Content)
+	if content == "" {
+		if msg.Attachments == 1 {
+			return "Sent an attachment"
+		}
+		return fmt.Sprintf("Sent %d attachments", msg.Attachments)
+	}
+	if utf8.RuneCountInString(content) <= previewLength {
+		return content
+	}
+	runes := []rune(content)
+	return strings.TrimSpace(string(runes[:previewLength])) + "…"
+}
+
+// inQuietHours reports whether now falls within the quiet hours of a user, in their time zone.
+// Quiet hours may span midnight, such as 22:00 to 07:00.
+func inQuietHours(settings models.NotificationSettings, now time.Time) bool {
+	start, end := settings.QuietHoursStart, settings.QuietHoursEnd
+	if start == "" || end == "" || start == end {
+		return false
+	}
+
+	location, err := time.LoadLocation(settings.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	clock := now.In(location).Format("15:04")
+
+	if start < end {
+		return clock >= start && clock < end
+	}
+	return clock >= start || clock < end
+}
@@ -0,0 +1,171 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+	"github.com/clementus360/proxy-chat/models"
+)
+
+func TestInQuietHours(t *testing.T) {
+	// 23:30 in UTC, 01:30 in Paris during summer time
+	now := time.Date(2024, 7, 1, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		settings models.NotificationSettings
+		want     bool
+	}{
+		{"no quiet hours", models.NotificationSettings{}, false},
+		{"start only", models.NotificationSettings{QuietHoursStart: "22:00"}, false},
+		{"same start and end", models.NotificationSettings{QuietHoursStart: "22:00", QuietHoursEnd: "22:00"}, false},
+		{"within the day", models.NotificationSettings{QuietHoursStart: "23:00", QuietHoursEnd: "23:45"}, true},
+		{"after the day", models.NotificationSettings{QuietHoursStart: "09:00", QuietHoursEnd: "17:00"}, false},
+		{"end is excluded", models.NotificationSettings{QuietHoursStart: "22:00", QuietHoursEnd: "23:30"}, false},
+		{"spanning midnight", models.NotificationSettings{QuietHoursStart: "22:00", QuietHoursEnd: "07:00"}, true},
+		{"in the time zone of the user", models.NotificationSettings{QuietHoursStart: "01:00", QuietHoursEnd: "02:00", TimeZone: "Europe/Paris"}, true},
+		{"unknown time zone reads as UTC", models.NotificationSettings{QuietHoursStart: "23:00", QuietHoursEnd: "23:45", TimeZone: "Mars/Olympus"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inQuietHours(tt.settings, now); got != tt.want {
+				t.Errorf("inQuietHours() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreview(t *testing.T) {
+	long := strings.Repeat("é", previewLength+10)
+
+	tests := []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{"short", Message{Content: "  hello  "}, "hello"},
+		{"one attachment", Message{Attachments: 1}, "Sent an attachment"},
+		{"several attachments", Message{Content: " ", Attachments: 3}, "Sent 3 attachments"},
+		{"exactly the limit", Message{Content: long[:previewLength*2]}, long[:previewLength*2]},
+		{"shortened by characters", Message{Content: long}, long[:previewLength*2] + "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := preview(tt.msg); got != tt.want {
+				t.Errorf("preview() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitField(t *testing.T) {
+	tests := []struct {
+		field            string
+		wantConversation string
+		wantKind         string
+	}{
+		{"group:4:count", "group:4", "count"},
+		{"user:12:last", "user:12", "last"},
+		{"plain", "plain", ""},
+	}
+	for _, tt := range tests {
+		conversation, kind := splitField(tt.field)
+		if conversation != tt.wantConversation || kind != tt.wantKind {
+			t.Errorf("splitField(%q) = %q, %q, want %q, %q", tt.field, conversation, kind, tt.wantConversation, tt.wantKind)
+		}
+	}
+}
+
+func TestTakeBatch(t *testing.T) {
+	server := testenv.Redis(t)
+	ctx := context.Background()
+
+	last := func(msg Message) string {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	server.HSet(pendingKey(7),
+		"group:4:count", "3",
+		"group:4:last", last(Message{ID: 30, GroupID: 4, SenderID: 2, SenderName: "alice", Content: "third"}),
+		"user:5:count", "1",
+		"user:5:last", last(Message{ID: 12, SenderID: 5, SenderName: "bob", Content: "hi"}),
+		// A count without its message is left out
+		"user:6:count", "2",
+	)
+
+	batches, err := takeBatch(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("batches = %+v, want two", batches)
+	}
+	if batches[0].key != "user:5" || batches[0].count != 1 || batches[0].last.Content != "hi" {
+		t.Errorf("batches[0] = %+v, want the direct messages of user 5 first", batches[0])
+	}
+	if batches[1].key != "group:4" || batches[1].count != 3 || batches[1].last.ID != 30 {
+		t.Errorf("batches[1] = %+v, want the messages of group 4 last", batches[1])
+	}
+
+	// The batch is taken once
+	if server.Exists(pendingKey(7)) {
+		t.Error("pending messages were kept")
+	}
+	batches, err = takeBatch(ctx, 7)
+	if err != nil || len(batches) != 0 {
+		t.Errorf("takeBatch() again = %+v, %v, want nothing", batches, err)
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	server := testenv.Postgres(t)
+	ctx := context.Background()
+
+	withToken := testenv.CreateUser(t)
+	withoutToken := testenv.CreateUser(t)
+	token := &models.PushToken{UserID: withToken, DeviceID: "phone", Platform: models.PlatformFCM, Token: testenv.Name("token")}
+	if err := database.SavePushToken(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []Message{
+		{ID: 1, GroupID: 4, SenderID: 2, Content: "first"},
+		{ID: 2, GroupID: 4, SenderID: 3, Content: "second"},
+		{ID: 3, SenderID: 2, Content: "direct"},
+	}
+	for _, userID := range []int{withToken, withoutToken} {
+		for _, msg := range messages {
+			if err := Enqueue(ctx, userID, msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if server.Exists(pendingKey(withoutToken)) {
+		t.Error("messages were queued for a user without push tokens")
+	}
+	score, err := server.ZScore(dueKey, strconv.Itoa(withToken))
+	if err != nil {
+		t.Fatalf("the user with a push token is not due: %v", err)
+	}
+	if due := time.UnixMilli(int64(score)); time.Until(due) <= 0 || time.Until(due) > batchWindow {
+		t.Errorf("batch due at %v, want within %v", due, batchWindow)
+	}
+
+	batches, err := takeBatch(ctx, withToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 2 || batches[0].key != "group:4" || batches[0].count != 2 || batches[0].last.Content != "second" || batches[1].key != "user:2" || batches[1].count != 1 {
+		t.Errorf("batches = %+v, want group 4 with two messages then user 2 with one", batches)
+	}
+}
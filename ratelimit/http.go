@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/config"
+)
+
+// ClientIP returns the address of the client. X-Forwarded-For is only trusted when
+// TRUST_PROXY is set, otherwise any client could pick its own rate limit key.
+func ClientIP(r *http.Request) string {
+	if config.GetEnv("TRUST_PROXY", "false") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RetryAfterSeconds rounds a wait up to whole seconds, as used by the Retry-After header
+func RetryAfterSeconds(wait time.Duration) int {
+	return max(1, int(math.Ceil(wait.Seconds())))
+}
+
+// Middleware limits a route per client IP, and per user when the request names one
+// in its user_id or id query parameter
+func Middleware(rule Rule, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result := Allow(r.Context(), rule.Name+":ip:"+ClientIP(r), rule)
+
+		userID := r.URL.Query().Get("user_id")
+		if userID == "" {
+			userID = r.URL.Query().Get("id")
+		}
+		if _, err := strconv.Atoi(userID); result.Allowed && err == nil {
+			result = Allow(r.Context(), rule.Name+":user:"+userID, rule)
+		}
+
+		if !Admit(w, r, result) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Admit sets the rate limit headers of a response and answers refused requests.
+// It returns false when the request was answered.
+func Admit(w http.ResponseWriter, r *http.Request, result Result) bool {
+	if !result.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(RetryAfterSeconds(result.RetryAfter)))
+		apierror.Write(w, r, apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "Too many requests"))
+		return false
+	}
+
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	return true
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/clementus360/proxy-chat/config"
+	"github.com/clementus360/proxy-chat/database"
+)
+
+// Rule describes a token bucket: it holds up to Burst tokens and refills at Rate tokens per second.
+// Every request takes one token, requests are refused while the bucket is empty.
+type Rule struct {
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Limiter takes tokens from the bucket identified by key
+type Limiter interface {
+	Allow(ctx context.Context, key string, rule Rule) (Result, error)
+}
+
+// Limits applied to the REST API and the WebSocket
+var (
+	// RuleAPI covers ordinary reads
+	RuleAPI = Rule{Name: "api", Rate: 10, Burst: 40}
+	// RuleNearby covers the location lookups, which are expensive and can be used to triangulate users
+	RuleNearby = Rule{Name: "nearby", Rate: 0.5, Burst: 10}
+	// RuleMedia covers attachment and avatar downloads, clients load many of them at once
+	RuleMedia = Rule{Name: "media", Rate: 50, Burst: 200}
+	// RuleWrite covers requests that create or change data
+	RuleWrite = Rule{Name: "write", Rate: 2, Burst: 20}
+	// RuleUpload covers file uploads
+	RuleUpload = Rule{Name: "upload", Rate: 0.2, Burst: 5}
+	// RuleConnect covers WebSocket handshakes
+	RuleConnect = Rule{Name: "ws_connect", Rate: 0.2, Burst: 5}
+	// RuleEvents covers event streams and long polls, busy polling clients reconnect after every batch
+	RuleEvents = Rule{Name: "events", Rate: 1, Burst: 10}
+
+	// Bots are limited per bot instead of per address, they usually share the address of their host
+	RuleBot        = Rule{Name: "bot", Rate: 5, Burst: 50}
+	RuleBotMessage = Rule{Name: "bot_message", Rate: 1, Burst: 20}
+
+	// WebSocket frames, limited per connected user
+	RuleChatFrame     = Rule{Name: "ws_message", Rate: 2, Burst: 20}
+	RuleTypingFrame   = Rule{Name: "ws_typing", Rate: 1, Burst: 5}
+	RulePresenceFrame = Rule{Name: "ws_presence", Rate: 0.2, Burst: 5}
+	RuleReadFrame     = Rule{Name: "ws_read", Rate: 5, Burst: 30}
+)
+
+// Default is the limiter used by the middleware and the WebSocket
+var Default Limiter
+
+// InitRateLimiter selects the limiter backend from the environment.
+// The Redis limiter shares buckets between server instances, the memory limiter suits a single instance.
+func InitRateLimiter() {
+	config.LoadEnv()
+
+	switch backend := config.GetEnv("RATE_LIMIT_STORE", "redis"); backend {
+	case "redis":
+		Default = NewRedisLimiter(database.RedisClient)
+	case "memory":
+		Default = NewMemoryLimiter()
+	default:
+		log.Fatalf("Unknown rate limit backend %q", backend)
+	}
+	log.Println("Rate limiting with the", config.GetEnv("RATE_LIMIT_STORE", "redis"), "backend")
+}
+
+// Allow takes a token from the Default limiter. Limiter failures are logged and the request
+// is let through, an unavailable Redis should not take the whole API down.
+func Allow(ctx context.Context, key string, rule Rule) Result {
+	result, err := Default.Allow(ctx, key, rule)
+	if err != nil {
+		log.Printf("Error checking rate limit %s: %v", key, err)
+		return Result{Allowed: true}
+	}
+	return result
+}
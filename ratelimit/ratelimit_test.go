@@ -0,0 +1,195 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+)
+
+// takeTokens takes n tokens from a bucket and returns which requests were allowed
+func takeTokens(t *testing.T, limiter Limiter, key string, rule Rule, n int) []bool {
+	t.Helper()
+
+	allowed := make([]bool, n)
+	for i := range n {
+		result, err := limiter.Allow(context.Background(), key, rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		allowed[i] = result.Allowed
+	}
+	return allowed
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	limiter := NewMemoryLimiter()
+	rule := Rule{Name: "test", Rate: 10, Burst: 3}
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		key  string
+		wait time.Duration
+		n    int
+		want []bool
+	}{
+		{"burst", "a", 0, 4, []bool{true, true, true, false}},
+		{"separate bucket", "b", 0, 1, []bool{true}},
+		{"refilled one token", "a", 150 * time.Millisecond, 2, []bool{true, false}},
+		{"refilled up to the burst", "a", 500 * time.Millisecond, 4, []bool{true, true, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			time.Sleep(tt.wait)
+			got := takeTokens(t, limiter, tt.key, rule, tt.n)
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("allowed = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	result, _ := limiter.Allow(ctx, "a", rule)
+	if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > time.Second/10 {
+		t.Errorf("refused result = %+v, want a retry within one token", result)
+	}
+}
+
+func TestRedisLimiter(t *testing.T) {
+	server := testenv.Redis(t)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	server.SetTime(now)
+
+	limiter := NewRedisLimiter(database.RedisClient)
+	rule := Rule{Name: "test", Rate: 0.5, Burst: 2}
+
+	tests := []struct {
+		name string
+		key  string
+		wait time.Duration
+		n    int
+		want []bool
+	}{
+		{"burst", "a", 0, 3, []bool{true, true, false}},
+		{"separate bucket", "b", 0, 1, []bool{true}},
+		{"not refilled yet", "a", time.Second, 1, []bool{false}},
+		{"refilled one token", "a", time.Second, 2, []bool{true, false}},
+		{"refilled up to the burst", "a", time.Minute, 3, []bool{true, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.wait)
+			server.SetTime(now)
+
+			got := takeTokens(t, limiter, tt.key, rule, tt.n)
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("allowed = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	result, err := limiter.Allow(context.Background(), "a", rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed || result.RetryAfter != 2*time.Second || result.Remaining != 0 {
+		t.Errorf("refused result = %+v, want a retry in 2s", result)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	previous := Default
+	Default = NewMemoryLimiter()
+	t.Cleanup(func() { Default = previous })
+	t.Setenv("TRUST_PROXY", "false")
+
+	rule := Rule{Name: "middleware", Rate: 0.001, Burst: 2}
+	handler := Middleware(rule, func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name          string
+		remoteAddr    string
+		query         string
+		want          int
+		wantRemaining string
+	}{
+		{"first request", "10.0.0.1:1234", "?user_id=1", http.StatusOK, "1"},
+		{"same user from another address", "10.0.0.2:1234", "?user_id=1", http.StatusOK, "0"},
+		{"user over the limit", "10.0.0.3:1234", "?user_id=1", http.StatusTooManyRequests, ""},
+		{"address of the user, other user", "10.0.0.1:1234", "?id=2", http.StatusOK, "1"},
+		{"address over the limit", "10.0.0.1:1234", "", http.StatusTooManyRequests, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/users"+tt.query, nil)
+			r.RemoteAddr = tt.remoteAddr
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if got := w.Header().Get("X-RateLimit-Remaining"); got != tt.wantRemaining {
+				t.Errorf("X-RateLimit-Remaining = %q, want %q", got, tt.wantRemaining)
+			}
+			if tt.want == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+				t.Error("Retry-After is missing")
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"remote address", "false", "192.0.2.1:5000", "", "192.0.2.1"},
+		{"untrusted forwarded header", "false", "192.0.2.1:5000", "198.51.100.7", "192.0.2.1"},
+		{"trusted forwarded header", "true", "192.0.2.1:5000", "198.51.100.7, 192.0.2.1", "198.51.100.7"},
+		{"trusted proxy without header", "true", "192.0.2.1:5000", "", "192.0.2.1"},
+		{"address without port", "false", "192.0.2.1", "", "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUST_PROXY", tt.trustProxy)
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want int
+	}{
+		{0, 1},
+		{100 * time.Millisecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{10 * time.Second, 10},
+	}
+	for _, tt := range tests {
+		if got := RetryAfterSeconds(tt.wait); got != tt.want {
+			t.Errorf("RetryAfterSeconds(%v) = %d, want %d", tt.wait, got, tt.want)
+		}
+	}
+}
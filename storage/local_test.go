@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestLocalStoreRejectsEscapingKeys(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{"attachments/ab/abcdef", false},
+		{"avatars/users/1.png", false},
+		{"a/../b", false},
+		{"", true},
+		{".", true},
+		{"..", true},
+		{"../outside", true},
+		{"a/../../outside", true},
+		{"/etc/passwd", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			err := store.Put(ctx, tt.key, strings.NewReader("x"), 1, "text/plain")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Put(%q) error = %v, want error %t", tt.key, err, tt.wantErr)
+			}
+			_, err = store.Get(ctx, tt.key)
+			if tt.wantErr && (err == nil || errors.Is(err, ErrNotFound)) {
+				t.Errorf("Get(%q) error = %v, want an invalid key error", tt.key, err)
+			}
+			err = store.Delete(ctx, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Delete(%q) error = %v, want error %t", tt.key, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocalStorePutIsAtomic(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	const key = "attachments/ab/abcdef"
+
+	if err = store.Put(ctx, key, strings.NewReader("original"), 8, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body io.Reader
+		size int64
+	}{
+		{"body fails midway", io.MultiReader(strings.NewReader("part"), iotest.ErrReader(errors.New("connection reset"))), 100},
+		{"body shorter than size", strings.NewReader("short"), 100},
+		{"body longer than size", strings.NewReader("much longer body"), 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.Put(ctx, key, tt.body, tt.size, "text/plain"); err == nil {
+				t.Fatal("Put succeeded, want an error")
+			}
+
+			if got := readBlob(t, store, key); got != "original" {
+				t.Errorf("blob = %q after a failed Put, want the original", got)
+			}
+			leftovers, _ := filepath.Glob(filepath.Join(root, "attachments", "ab", ".upload-*"))
+			if len(leftovers) > 0 {
+				t.Errorf("temporary files left behind: %v", leftovers)
+			}
+		})
+	}
+
+	if err = store.Put(ctx, key, strings.NewReader("replaced"), -1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readBlob(t, store, key); got != "replaced" {
+		t.Errorf("blob = %q, want the replacement", got)
+	}
+}
+
+func TestLocalStoreNotFound(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err = store.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing blob error = %v, want ErrNotFound", err)
+	}
+	if err = store.Delete(ctx, "missing"); err != nil {
+		t.Errorf("Delete of a missing blob error = %v, want nil", err)
+	}
+
+	if err = store.Put(ctx, "present", strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Delete(ctx, "present"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(store.Root, "present")); !os.IsNotExist(err) {
+		t.Errorf("deleted blob still exists: %v", err)
+	}
+	if _, err = store.Get(ctx, "present"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a deleted blob error = %v, want ErrNotFound", err)
+	}
+}
+
+func readBlob(t *testing.T, store BlobStore, key string) string {
+	t.Helper()
+
+	blob, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Close()
+
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
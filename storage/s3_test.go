@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a stand-in for an S3 bucket that checks the signature of every request the way S3
+// does and keeps objects in memory
+type fakeS3 struct {
+	t         *testing.T
+	accessKey string
+	secretKey string
+	region    string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+var authorizationPattern = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=([^/]+)/(\d{8})/([^/]+)/s3/aws4_request, SignedHeaders=([^,]+), Signature=([0-9a-f]{64})$`)
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f.verify(r); err != nil {
+		f.t.Errorf("%s %s: %v", r.Method, r.URL.EscapedPath(), err)
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	path := r.URL.EscapedPath()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if int64(len(data)) != r.ContentLength {
+			http.Error(w, "IncompleteBody", http.StatusBadRequest)
+			return
+		}
+		f.objects[path] = data
+		f.types[path] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := f.objects[path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		if _, ok := f.objects[path]; !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		delete(f.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// verify recomputes the Signature Version 4 of a request from what reached the server
+func (f *fakeS3) verify(r *http.Request) error {
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return fmt.Errorf("invalid X-Amz-Date %q", amzDate)
+	}
+	if since := time.Since(signedAt); since < -time.Minute || since > 15*time.Minute {
+		return fmt.Errorf("X-Amz-Date %s is not current", amzDate)
+	}
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != "UNSIGNED-PAYLOAD" {
+		return fmt.Errorf("X-Amz-Content-Sha256 = %q, want UNSIGNED-PAYLOAD", got)
+	}
+
+	match := authorizationPattern.FindStringSubmatch(r.Header.Get("Authorization"))
+	if match == nil {
+		return fmt.Errorf("malformed Authorization %q", r.Header.Get("Authorization"))
+	}
+	accessKey, date, region, signedHeaders, signature := match[1], match[2], match[3], match[4], match[5]
+	if accessKey != f.accessKey || region != f.region || date != amzDate[:8] {
+		return fmt.Errorf("credential %s/%s/%s does not match", accessKey, date, region)
+	}
+	if signedHeaders != "host;x-amz-content-sha256;x-amz-date" {
+		return fmt.Errorf("SignedHeaders = %q", signedHeaders)
+	}
+
+	canonicalRequest := r.Method + "\n" +
+		r.URL.EscapedPath() + "\n" +
+		r.URL.RawQuery + "\n" +
+		"host:" + r.Host + "\n" +
+		"x-amz-content-sha256:UNSIGNED-PAYLOAD\n" +
+		"x-amz-date:" + amzDate + "\n\n" +
+		signedHeaders + "\n" +
+		"UNSIGNED-PAYLOAD"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + f.secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	if want := hex.EncodeToString(hmacSHA256(key, stringToSign)); signature != want {
+		return fmt.Errorf("Signature = %s, want %s", signature, want)
+	}
+	return nil
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3Store) {
+	fake := &fakeS3{
+		t:         t,
+		accessKey: "AKIDEXAMPLE",
+		secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		region:    "eu-west-1",
+		objects:   map[string][]byte{},
+		types:     map[string]string{},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return fake, &S3Store{
+		Endpoint:  server.URL,
+		Bucket:    "proxy-chat",
+		Region:    fake.region,
+		AccessKey: fake.accessKey,
+		SecretKey: fake.secretKey,
+		Client:    server.Client(),
+	}
+}
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	fake, store := newFakeS3(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		key  string
+		path string
+	}{
+		{"attachments/ab/abcdef", "/proxy-chat/attachments/ab/abcdef"},
+		{"avatars/users/1.png", "/proxy-chat/avatars/users/1.png"},
+		{"uploads/a file+name=é.txt", "/proxy-chat/uploads/a%20file%2Bname%3D%C3%A9.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			body := "contents of " + tt.key
+			if err := store.Put(ctx, tt.key, strings.NewReader(body), int64(len(body)), "text/plain"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+
+			fake.mu.Lock()
+			stored, ok := fake.objects[tt.path]
+			contentType := fake.types[tt.path]
+			fake.mu.Unlock()
+			if !ok || string(stored) != body {
+				t.Fatalf("object at %s = %q, want %q", tt.path, stored, body)
+			}
+			if contentType != "text/plain" {
+				t.Errorf("Content-Type = %q, want text/plain", contentType)
+			}
+
+			blob, err := store.Get(ctx, tt.key)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			data, err := io.ReadAll(blob)
+			blob.Close()
+			if err != nil || string(data) != body {
+				t.Errorf("Get = %q, %v, want %q", data, err, body)
+			}
+
+			if err = store.Delete(ctx, tt.key); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err = store.Get(ctx, tt.key); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get after Delete error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	_, store := newFakeS3(t)
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing object error = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "missing"); err != nil {
+		t.Errorf("Delete of a missing object error = %v, want nil", err)
+	}
+
+	// Requests the bucket refuses are errors, not missing blobs
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+	}))
+	defer server.Close()
+	store.Endpoint = server.URL
+
+	_, err := store.Get(ctx, "denied")
+	if err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("Get of a denied object error = %v, want the S3 error", err)
+	}
+	if err = store.Put(ctx, "denied", strings.NewReader("x"), 1, "text/plain"); err == nil {
+		t.Error("Put of a denied object succeeded, want an error")
+	}
+}
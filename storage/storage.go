@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/clementus360/proxy-chat/config"
+)
+
+// ErrNotFound is returned when a blob does not exist in the store
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps uploaded files. Keys are slash separated paths such as "attachments/ab/abcdef".
+type BlobStore interface {
+	// Put stores size bytes read from body under key, replacing any existing blob
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get opens a blob for reading, the caller closes it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes a blob, deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+var Blobs BlobStore
+
+// InitBlobStore selects the blob store backend from the environment
+func InitBlobStore() {
+	config.LoadEnv()
+
+	switch backend := config.GetEnv("BLOB_STORE", "local"); backend {
+	case "local":
+		dir := config.GetEnv("BLOB_DIR", "./data/blobs")
+		store, err := NewLocalStore(dir)
+		if err != nil {
+			log.Fatalf("Unable to open local blob store: %v", err)
+		}
+		Blobs = store
+		log.Println("Storing blobs in", dir)
+
+	case "s3":
+		Blobs = &S3Store{
+			Endpoint:  config.GetEnv("S3_ENDPOINT", "https://s3.amazonaws.com"),
+			Bucket:    config.GetEnv("S3_BUCKET", "proxy-chat"),
+			Region:    config.GetEnv("S3_REGION", "us-east-1"),
+			AccessKey: config.GetEnv("S3_ACCESS_KEY", ""),
+			SecretKey: config.GetEnv("S3_SECRET_KEY", ""),
+		}
+		log.Println("Storing blobs in S3 bucket", config.GetEnv("S3_BUCKET", "proxy-chat"))
+
+	default:
+		log.Fatalf("Unknown blob store backend %q", backend)
+	}
+}
@@ -0,0 +1,103 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"strconv"
+
+	"github.com/clementus360/proxy-chat/apierror"
+)
+
+// DecodeJSON reads a JSON body into dst and validates it.
+// Type mismatches are reported against the offending field.
+func DecodeJSON(body io.Reader, dst interface{}) error {
+	err := json.NewDecoder(body).Decode(dst)
+
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		return fieldsError([]apierror.FieldError{{Field: typeErr.Field, Message: fmt.Sprintf("must be a %s", jsonKind(typeErr.Type))}})
+	case errors.Is(err, io.EOF):
+		return apierror.BadRequest("Missing request body")
+	case err != nil:
+		return apierror.BadRequest("Unable to parse request body")
+	}
+
+	return Struct(dst)
+}
+
+// DecodeQuery fills the fields of dst tagged with `query:"name"` from query parameters and validates it.
+// Parameters that are absent keep the value already in dst, so defaults can be set beforehand.
+func DecodeQuery(values url.Values, dst interface{}) error {
+	value := reflect.ValueOf(dst).Elem()
+	structType := value.Type()
+
+	var fields []apierror.FieldError
+	for i := 0; i < structType.NumField(); i++ {
+		name := structType.Field(i).Tag.Get("query")
+		if name == "" || !values.Has(name) {
+			continue
+		}
+
+		if err := setQueryValue(value.Field(i), values.Get(name)); err != nil {
+			fields = append(fields, apierror.FieldError{Field: name, Message: err.Error()})
+		}
+	}
+	if len(fields) > 0 {
+		return fieldsError(fields)
+	}
+
+	return Struct(dst)
+}
+
+func setQueryValue(field reflect.Value, raw string) error {
+	if field.Kind() == reflect.Pointer {
+		field.Set(reflect.New(field.Type().Elem()))
+		field = field.Elem()
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		field.SetBool(b)
+	default:
+		panic(fmt.Sprintf("validation: query parameters cannot fill %s", field.Kind()))
+	}
+	return nil
+}
+
+// jsonKind names a Go type the way a client sending JSON thinks of it
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return "number"
+}
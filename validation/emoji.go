@@ -0,0 +1,121 @@
+package validation
+
+import "unicode"
+
+const (
+	zeroWidthJoiner    = '\u200D'
+	variationSelector  = '\uFE0F'
+	combiningKeycap    = '\u20E3'
+	blackFlag          = '\U0001F3F4'
+	cancelTag          = '\U000E007F'
+	regionalIndicatorA = '\U0001F1E6'
+	regionalIndicatorZ = '\U0001F1FF'
+)
+
+// pictographs covers the code points emoji are drawn from, the Extended_Pictographic
+// property of Unicode the standard library has no table for
+var pictographs = &unicode.RangeTable{
+	LatinOffset: 1,
+	R16: []unicode.Range16{
+		{Lo: 0x00A9, Hi: 0x00AE, Stride: 5},
+		{Lo: 0x203C, Hi: 0x2049, Stride: 13},
+		{Lo: 0x2122, Hi: 0x2139, Stride: 23},
+		{Lo: 0x2194, Hi: 0x2199, Stride: 1},
+		{Lo: 0x21A9, Hi: 0x21AA, Stride: 1},
+		{Lo: 0x231A, Hi: 0x231B, Stride: 1},
+		{Lo: 0x2328, Hi: 0x2328, Stride: 1},
+		{Lo: 0x23CF, Hi: 0x23CF, Stride: 1},
+		{Lo: 0x23E9, Hi: 0x23F3, Stride: 1},
+		{Lo: 0x23F8, Hi: 0x23FA, Stride: 1},
+		{Lo: 0x24C2, Hi: 0x24C2, Stride: 1},
+		{Lo: 0x25AA, Hi: 0x25AB, Stride: 1},
+		{Lo: 0x25B6, Hi: 0x25C0, Stride: 10},
+		{Lo: 0x25FB, Hi: 0x25FE, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27BF, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2B05, Hi: 0x2B07, Stride: 1},
+		{Lo: 0x2B1B, Hi: 0x2B1C, Stride: 1},
+		{Lo: 0x2B50, Hi: 0x2B55, Stride: 5},
+		{Lo: 0x3030, Hi: 0x303D, Stride: 13},
+		{Lo: 0x3297, Hi: 0x3299, Stride: 2},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1F000, Hi: 0x1F1E5, Stride: 1},
+		{Lo: 0x1F200, Hi: 0x1F3FA, Stride: 1},
+		{Lo: 0x1F400, Hi: 0x1FAFF, Stride: 1},
+	},
+}
+
+func isModifier(r rune) bool {
+	return r >= '\U0001F3FB' && r <= '\U0001F3FF'
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= regionalIndicatorA && r <= regionalIndicatorZ
+}
+
+func isTag(r rune) bool {
+	return r >= '\U000E0020' && r <= '\U000E007E'
+}
+
+// isEmoji reports whether s is exactly one emoji as a user would pick it: a pictograph with
+// an optional presentation selector or skin tone, several of them joined by zero width
+// joiners, a flag, a subdivision flag or a keycap
+func isEmoji(s string) bool {
+	runes := []rune(s)
+	if len(runes) == 0 {
+		return false
+	}
+
+	// Country flags are a pair of regional indicators
+	if isRegionalIndicator(runes[0]) {
+		return len(runes) == 2 && isRegionalIndicator(runes[1])
+	}
+
+	// Keycaps are a digit, # or * followed by the keycap mark
+	if (runes[0] >= '0' && runes[0] <= '9') || runes[0] == '#' || runes[0] == '*' {
+		rest := runes[1:]
+		if len(rest) > 0 && rest[0] == variationSelector {
+			rest = rest[1:]
+		}
+		return len(rest) == 1 && rest[0] == combiningKeycap
+	}
+
+	// Subdivision flags such as the flag of Scotland are a black flag, tag letters and a cancel tag
+	if runes[0] == blackFlag && len(runes) > 2 && isTag(runes[1]) {
+		for i, r := range runes[1:] {
+			if r == cancelTag {
+				return i+2 == len(runes)
+			}
+			if !isTag(r) {
+				return false
+			}
+		}
+		return false
+	}
+
+	// Everything else is a chain of pictographs joined by zero width joiners
+	for i := 0; i < len(runes); {
+		if !unicode.Is(pictographs, runes[i]) {
+			return false
+		}
+		i++
+		if i < len(runes) && runes[i] == variationSelector {
+			i++
+		}
+		if i < len(runes) && isModifier(runes[i]) {
+			i++
+		}
+		if i == len(runes) {
+			return true
+		}
+		if runes[i] != zeroWidthJoiner {
+			return false
+		}
+		i++
+		if i == len(runes) {
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// rule checks a value against its parameter and describes the problem, or returns an empty string
+type rule func(value reflect.Value, param string) string
+
+var rules = map[string]rule{
+	"min":      checkMin,
+	"max":      checkMax,
+	"oneof":    checkOneOf,
+	"lat":      checkLatitude,
+	"lng":      checkLongitude,
+	"username": checkUsername,
+	"url":      checkURL,
+	"numeric":  checkNumeric,
+	"command":  checkCommand,
+	"clock":    checkClock,
+	"emoji":    checkEmoji,
+}
+
+// UsernamePattern matches usernames, and the nicknames members take in a group
+var UsernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,30}$`)
+
+// CommandPattern matches slash command names, without the slash
+var CommandPattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+var clockPattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// size is what min and max compare: the number itself, or the length of strings and slices
+func size(value reflect.Value) (float64, string) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Slice, reflect.Map:
+		return float64(value.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), ""
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), ""
+	}
+	panic(fmt.Sprintf("validation: min and max do not apply to %s", value.Kind()))
+}
+
+func bound(param string) float64 {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validation: invalid bound %q", param))
+	}
+	return limit
+}
+
+func checkMin(value reflect.Value, param string) string {
+	if n, unit := size(value); n < bound(param) {
+		return fmt.Sprintf("must be at least %s%s", param, unit)
+	}
+	return ""
+}
+
+func checkMax(value reflect.Value, param string) string {
+	if n, unit := size(value); n > bound(param) {
+		return fmt.Sprintf("must be at most %s%s", param, unit)
+	}
+	return ""
+}
+
+func checkOneOf(value reflect.Value, param string) string {
+	options := strings.Fields(param)
+	if !slices.Contains(options, fmt.Sprint(value.Interface())) {
+		return fmt.Sprintf("must be one of %s", strings.Join(options, ", "))
+	}
+	return ""
+}
+
+func checkLatitude(value reflect.Value, param string) string {
+	// Written so NaN fails the range too
+	if lat := value.Float(); !(lat >= -90 && lat <= 90) {
+		return "must be a latitude between -90 and 90"
+	}
+	return ""
+}
+
+func checkLongitude(value reflect.Value, param string) string {
+	if lng := value.Float(); !(lng >= -180 && lng <= 180) {
+		return "must be a longitude between -180 and 180"
+	}
+	return ""
+}
+
+func checkUsername(value reflect.Value, param string) string {
+	if !UsernamePattern.MatchString(value.String()) {
+		return "must be 3 to 30 letters, digits, dots, dashes or underscores"
+	}
+	return ""
+}
+
+func checkCommand(value reflect.Value, param string) string {
+	if !CommandPattern.MatchString(value.String()) {
+		return "must be 1 to 32 lowercase letters, digits or underscores"
+	}
+	return ""
+}
+
+func checkClock(value reflect.Value, param string) string {
+	if !clockPattern.MatchString(value.String()) {
+		return "must be a time of day such as 22:30"
+	}
+	return ""
+}
+
+func checkEmoji(value reflect.Value, param string) string {
+	if !isEmoji(value.String()) {
+		return "must be a single emoji"
+	}
+	return ""
+}
+
+// checkURL accepts absolute http(s) URLs, and paths such as the avatar URLs generated by this server
+func checkURL(value reflect.Value, param string) string {
+	raw := value.String()
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "must be a valid URL"
+	}
+
+	if strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//") {
+		return ""
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "must be an http or https URL"
+	}
+	return ""
+}
+
+func checkNumeric(value reflect.Value, param string) string {
+	if n, err := strconv.Atoi(value.String()); err != nil || n <= 0 {
+		return "must be a positive integer"
+	}
+	return ""
+}
+
+// ParseDuration accepts Go durations such as "10m" or "12h" and whole days such as "7d",
+// durations must be positive
+func ParseDuration(value string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return duration, nil
+}
@@ -0,0 +1,166 @@
+package validation
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/clementus360/proxy-chat/apierror"
+)
+
+// Struct checks the `validate` tags of a struct and returns an *apierror.Error listing every
+// invalid field, or nil. Rules are separated by commas, for instance `validate:"required,max=100"`.
+// Fields are named after their json tag, embedded structs are checked as part of the parent.
+//
+// Rules:
+//
+//	required             the field must not be the zero value
+//	omitempty            skip the remaining rules when the field is the zero value
+//	min=N, max=N         bounds on numbers, on the length of strings in characters and on slices
+//	oneof=a b c          the value must be one of the space separated options
+//	required_with=f      required when the field named f is set
+//	required_without=f   required when the field named f is not set
+//	excluded_with=f      must not be set together with the field named f
+//	lat, lng             a latitude in [-90, 90] or a longitude in [-180, 180]
+//	username             3 to 30 letters, digits, dots, dashes or underscores
+//	url                  an absolute http(s) URL or a path on this server
+//	numeric              a string holding a positive integer
+//	command              a slash command name: 1 to 32 lowercase letters, digits or underscores
+//	clock                a time of day from 00:00 to 23:59
+//	emoji                exactly one emoji, with its skin tone, joiners, flag or keycap parts
+//
+// Pointer fields are only checked when they are not nil.
+func Struct(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validation: expected a struct, got %s", value.Kind()))
+	}
+
+	var fields []apierror.FieldError
+	checkStruct(value, &fields)
+	if len(fields) == 0 {
+		return nil
+	}
+	return fieldsError(fields)
+}
+
+// fieldsError wraps field errors in a validation error
+func fieldsError(fields []apierror.FieldError) *apierror.Error {
+	message := fields[0].Field + ": " + fields[0].Message
+	if len(fields) > 1 {
+		message = fmt.Sprintf("%s (and %d more)", message, len(fields)-1)
+	}
+
+	err := apierror.New(http.StatusBadRequest, apierror.CodeValidation, message)
+	err.Fields = fields
+	return err
+}
+
+func checkStruct(value reflect.Value, fields *[]apierror.FieldError) {
+	structType := value.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		// Fields of embedded structs are promoted even when the struct type is unexported
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			checkStruct(value.Field(i), fields)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("validate")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		if message := checkField(value, value.Field(i), tag); message != "" {
+			*fields = append(*fields, apierror.FieldError{Field: fieldName(field), Message: message})
+		}
+	}
+}
+
+// checkField applies the rules of one field and returns the first failure
+func checkField(parent reflect.Value, value reflect.Value, tag string) string {
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+
+		switch name {
+		case "omitempty":
+			if isZero(value) {
+				return ""
+			}
+			continue
+		case "required":
+			if isZero(value) {
+				return "is required"
+			}
+			continue
+		case "required_with", "required_without", "excluded_with":
+			other, ok := lookupField(parent, param)
+			if !ok {
+				panic(fmt.Sprintf("validation: unknown field %q in %s", param, name))
+			}
+			if message := checkRelation(name, param, isZero(value), isZero(other)); message != "" {
+				return message
+			}
+			continue
+		}
+
+		// The remaining rules check the value itself, nil pointers have no value to check
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				return ""
+			}
+			value = value.Elem()
+		}
+
+		check, ok := rules[name]
+		if !ok {
+			panic(fmt.Sprintf("validation: unknown rule %q", name))
+		}
+		if message := check(value, param); message != "" {
+			return message
+		}
+	}
+	return ""
+}
+
+func checkRelation(rule string, other string, empty bool, otherEmpty bool) string {
+	switch {
+	case rule == "required_with" && empty && !otherEmpty:
+		return fmt.Sprintf("is required with %s", other)
+	case rule == "required_without" && empty && otherEmpty:
+		return fmt.Sprintf("is required without %s", other)
+	case rule == "excluded_with" && !empty && !otherEmpty:
+		return fmt.Sprintf("cannot be set together with %s", other)
+	}
+	return ""
+}
+
+func isZero(value reflect.Value) bool {
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Map {
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+// fieldName is the json name of a struct field
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// lookupField finds a sibling field by its json name
+func lookupField(parent reflect.Value, name string) (reflect.Value, bool) {
+	structType := parent.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		if fieldName(structType.Field(i)) == name {
+			return parent.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,237 @@
+package validation
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+)
+
+type base struct {
+	UserID int `json:"user_id" validate:"required"`
+}
+
+type payload struct {
+	base
+	Name      string   `json:"name" validate:"required,min=3,max=5"`
+	Kind      string   `json:"kind,omitempty" validate:"omitempty,oneof=a b"`
+	Latitude  float64  `json:"latitude" validate:"lat"`
+	Longitude float64  `json:"longitude" validate:"lng"`
+	Username  *string  `json:"username,omitempty" validate:"username"`
+	ImageURL  string   `json:"image_url,omitempty" validate:"omitempty,url"`
+	GroupID   string   `json:"group_id,omitempty" validate:"omitempty,numeric"`
+	Tags      []string `json:"tags,omitempty" validate:"max=2"`
+	Command   string   `json:"command,omitempty" validate:"omitempty,command"`
+	Start     string   `json:"start,omitempty" validate:"omitempty,clock"`
+	Emoji     string   `json:"emoji,omitempty" validate:"omitempty,emoji"`
+	End       string   `json:"end,omitempty" validate:"required_with=start"`
+	Receiver  int      `json:"receiver_id,omitempty" validate:"required_without=group,excluded_with=group"`
+	Group     int      `json:"group,omitempty"`
+}
+
+func valid() payload {
+	return payload{base: base{UserID: 1}, Name: "abc", Receiver: 2}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// fieldMessages returns the field errors of a validation error by field
+func fieldMessages(t *testing.T, err error) map[string]string {
+	t.Helper()
+
+	messages := map[string]string{}
+	if err == nil {
+		return messages
+	}
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != apierror.CodeValidation || apiErr.Status != 400 {
+		t.Fatalf("error = %v, want a validation error", err)
+	}
+	for _, field := range apiErr.Fields {
+		messages[field.Field] = field.Message
+	}
+	return messages
+}
+
+func TestStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(p *payload)
+		want   map[string]string
+	}{
+		{"valid", func(p *payload) {}, map[string]string{}},
+		{"embedded required", func(p *payload) { p.UserID = 0 }, map[string]string{"user_id": "is required"}},
+		{"required", func(p *payload) { p.Name = "" }, map[string]string{"name": "is required"}},
+		{"too short", func(p *payload) { p.Name = "ab" }, map[string]string{"name": "must be at least 3 characters"}},
+		{"too long", func(p *payload) { p.Name = "abcdef" }, map[string]string{"name": "must be at most 5 characters"}},
+		{"length in characters", func(p *payload) { p.Name = "héllo" }, map[string]string{}},
+		{"oneof", func(p *payload) { p.Kind = "c" }, map[string]string{"kind": "must be one of a, b"}},
+		{"omitempty", func(p *payload) { p.Kind = "" }, map[string]string{}},
+		{"latitude", func(p *payload) { p.Latitude = 90.5 }, map[string]string{"latitude": "must be a latitude between -90 and 90"}},
+		{"longitude", func(p *payload) { p.Longitude = -181 }, map[string]string{"longitude": "must be a longitude between -180 and 180"}},
+		{"latitude NaN", func(p *payload) { p.Latitude = math.NaN() }, map[string]string{"latitude": "must be a latitude between -90 and 90"}},
+		{"latitude infinity", func(p *payload) { p.Latitude = math.Inf(1) }, map[string]string{"latitude": "must be a latitude between -90 and 90"}},
+		{"longitude NaN", func(p *payload) { p.Longitude = math.NaN() }, map[string]string{"longitude": "must be a longitude between -180 and 180"}},
+		{"longitude infinity", func(p *payload) { p.Longitude = math.Inf(-1) }, map[string]string{"longitude": "must be a longitude between -180 and 180"}},
+		{"nil pointer", func(p *payload) { p.Username = nil }, map[string]string{}},
+		{"pointer", func(p *payload) { p.Username = ptr("a b") }, map[string]string{"username": "must be 3 to 30 letters, digits, dots, dashes or underscores"}},
+		{"valid pointer", func(p *payload) { p.Username = ptr("bob.smith") }, map[string]string{}},
+		{"absolute url", func(p *payload) { p.ImageURL = "https://example.com/a.png" }, map[string]string{}},
+		{"server path", func(p *payload) { p.ImageURL = "/api/avatars/users/1" }, map[string]string{}},
+		{"protocol relative url", func(p *payload) { p.ImageURL = "//evil.com/a.png" }, map[string]string{"image_url": "must be an http or https URL"}},
+		{"javascript url", func(p *payload) { p.ImageURL = "javascript:alert(1)" }, map[string]string{"image_url": "must be an http or https URL"}},
+		{"numeric", func(p *payload) { p.GroupID = "-4" }, map[string]string{"group_id": "must be a positive integer"}},
+		{"slice length", func(p *payload) { p.Tags = []string{"a", "b", "c"} }, map[string]string{"tags": "must be at most 2 items"}},
+		{"command", func(p *payload) { p.Command = "Roll" }, map[string]string{"command": "must be 1 to 32 lowercase letters, digits or underscores"}},
+		{"clock", func(p *payload) { p.Start, p.End = "24:00", "07:00" }, map[string]string{"start": "must be a time of day such as 22:30"}},
+		{"required with", func(p *payload) { p.Start = "22:00" }, map[string]string{"end": "is required with start"}},
+		{"emoji", func(p *payload) { p.Emoji = "ok" }, map[string]string{"emoji": "must be a single emoji"}},
+		{"required without", func(p *payload) { p.Receiver = 0 }, map[string]string{"receiver_id": "is required without group"}},
+		{"excluded with", func(p *payload) { p.Group = 3 }, map[string]string{"receiver_id": "cannot be set together with group"}},
+		{"every invalid field", func(p *payload) { p.UserID, p.Name, p.Kind = 0, "", "c" }, map[string]string{"user_id": "is required", "name": "is required", "kind": "must be one of a, b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.change(&p)
+			if got := fieldMessages(t, Struct(&p)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Struct() fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantCode   string
+		wantFields map[string]string
+	}{
+		{"valid", `{"user_id": 1, "name": "abc", "receiver_id": 2}`, "", map[string]string{}},
+		{"type mismatch", `{"user_id": "one", "name": "abc", "receiver_id": 2}`, apierror.CodeValidation, map[string]string{"user_id": "must be a number"}},
+		{"string expected", `{"user_id": 1, "name": 5, "receiver_id": 2}`, apierror.CodeValidation, map[string]string{"name": "must be a string"}},
+		{"invalid fields", `{"user_id": 1, "name": "a"}`, apierror.CodeValidation, map[string]string{"name": "must be at least 3 characters", "receiver_id": "is required without group"}},
+		{"empty body", ``, apierror.CodeBadRequest, nil},
+		{"malformed body", `{"user_id": `, apierror.CodeBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p payload
+			err := DecodeJSON(strings.NewReader(tt.body), &p)
+
+			var apiErr *apierror.Error
+			code := ""
+			if errors.As(err, &apiErr) {
+				code = apiErr.Code
+			}
+			if code != tt.wantCode {
+				t.Fatalf("DecodeJSON() error = %v, want code %q", err, tt.wantCode)
+			}
+			if tt.wantFields != nil {
+				if got := fieldMessages(t, err); !reflect.DeepEqual(got, tt.wantFields) {
+					t.Errorf("fields = %v, want %v", got, tt.wantFields)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeQuery(t *testing.T) {
+	type query struct {
+		Limit   int      `query:"limit" json:"limit" validate:"min=1,max=100"`
+		Radius  float64  `query:"radius" json:"radius"`
+		Visible *bool    `query:"visible" json:"visible"`
+		Name    string   `query:"name" json:"name"`
+		Ignored string   `json:"ignored"`
+		Missing *float64 `query:"missing" json:"missing"`
+	}
+
+	tests := []struct {
+		name       string
+		raw        string
+		want       query
+		wantFields map[string]string
+	}{
+		{"defaults kept", "", query{Limit: 20}, map[string]string{}},
+		{"parsed", "limit=5&radius=1.5&visible=true&name=x&ignored=y", query{Limit: 5, Radius: 1.5, Visible: ptr(true), Name: "x"}, map[string]string{}},
+		{"type errors", "limit=many&radius=far&visible=maybe", query{Limit: 20}, map[string]string{"limit": "must be an integer", "radius": "must be a number", "visible": "must be true or false"}},
+		{"rules checked", "limit=500", query{Limit: 500}, map[string]string{"limit": "must be at most 100"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.raw)
+			q := query{Limit: 20}
+			err := DecodeQuery(values, &q)
+			if got := fieldMessages(t, err); !reflect.DeepEqual(got, tt.wantFields) {
+				t.Errorf("fields = %v, want %v", got, tt.wantFields)
+			}
+			if len(tt.wantFields) == 0 && !reflect.DeepEqual(q, tt.want) {
+				t.Errorf("DecodeQuery() = %+v, want %+v", q, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"10m", 10 * time.Minute, false},
+		{"12h", 12 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"0d", 0, true},
+		{"-1h", 0, true},
+		{"d", 0, true},
+		{"1.5d", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v, error %t", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestIsEmoji(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{"pictograph", "\U0001F44D", true},
+		{"presentation selector", "\u2764\uFE0F", true},
+		{"skin tone", "\U0001F44D\U0001F3FD", true},
+		{"joined family", "\U0001F468\u200D\U0001F469\u200D\U0001F467", true},
+		{"joined with a skin tone", "\U0001F9D1\U0001F3FD\u200D\U0001F4BB", true},
+		{"country flag", "\U0001F1F7\U0001F1FC", true},
+		{"subdivision flag", "\U0001F3F4\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F", true},
+		{"keycap", "1\uFE0F\u20E3", true},
+		{"empty", "", false},
+		{"letters", "ok", false},
+		{"digit without keycap", "1", false},
+		{"two emoji", "\U0001F44D\U0001F44D", false},
+		{"emoji and text", "\U0001F44Dx", false},
+		{"lone skin tone", "\U0001F3FD", false},
+		{"trailing joiner", "\U0001F468\u200D", false},
+		{"three regional indicators", "\U0001F1F7\U0001F1FC\U0001F1FC", false},
+		{"unterminated subdivision flag", "\U0001F3F4\U000E0067\U000E0062", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isEmoji(tt.value); got != tt.want {
+				t.Errorf("isEmoji(%+q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/models"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-ProxyChat-Event"
+	HeaderDelivery  = "X-ProxyChat-Delivery"
+	HeaderTimestamp = "X-ProxyChat-Timestamp"
+	HeaderSignature = "X-ProxyChat-Signature"
+)
+
+// GroupEvents are the events group webhooks may subscribe to
+var GroupEvents = []string{models.WebhookMessageCreated, models.WebhookMemberJoined, models.WebhookMemberLeft}
+
+// Events lists the events of server webhooks
+var Events = append(slices.Clone(GroupEvents), models.WebhookGroupCreated, models.WebhookReportFiled)
+
+// BotEvents are the events bot webhooks may subscribe to
+var BotEvents = append(slices.Clone(GroupEvents), models.WebhookCommandInvoked)
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	Event     string      `json:"event"`
+	GroupID   int         `json:"group_id,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Member is the data of member.joined and member.left events
+type Member struct {
+	GroupID int    `json:"group_id"`
+	UserID  int    `json:"user_id"`
+	Role    string `json:"role,omitempty"`
+}
+
+// DirectMessage is the data of message.created events for direct messages. Only server webhooks
+// get them, with the metadata of the message but not its content, which stays between the two users.
+type DirectMessage struct {
+	ID         int       `json:"id"`
+	SenderID   int       `json:"sender_id"`
+	ReceiverID int       `json:"receiver_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Emit queues an event for the webhooks subscribed to it, groupID is zero for events outside of
+// a group. Failures are logged, they never fail the request that caused the event.
+func Emit(ctx context.Context, event string, groupID int, data interface{}) {
+	emit(ctx, event, groupID, data, func(ctx context.Context, payload []byte) (int64, error) {
+		return database.EnqueueWebhookDeliveries(ctx, event, groupID, payload)
+	})
+}
+
+// EmitToBot queues an event for the webhook of one bot only
+func EmitToBot(ctx context.Context, botID int, event string, groupID int, data interface{}) {
+	emit(ctx, event, groupID, data, func(ctx context.Context, payload []byte) (int64, error) {
+		return database.EnqueueBotWebhookDelivery(ctx, event, botID, payload)
+	})
+}
+
+func emit(ctx context.Context, event string, groupID int, data interface{}, enqueue func(ctx context.Context, payload []byte) (int64, error)) {
+	payload, err := json.Marshal(Payload{Event: event, GroupID: groupID, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		log.Println("Error encoding webhook payload:", err)
+		return
+	}
+
+	// The event happened even if the client went away
+	queued, err := enqueue(context.WithoutCancel(ctx), payload)
+	if err != nil {
+		log.Println("Error queueing webhook deliveries:", err)
+		return
+	}
+	if queued > 0 {
+		wake()
+	}
+}
+
+// NewSecret generates a signing secret
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// Sign computes the signature header of a payload: "sha256=" followed by the hex HMAC-SHA256
+// of the timestamp header, a dot and the body, keyed with the webhook secret. Receivers
+// recompute it and should reject old timestamps to prevent replays.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of a payload
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
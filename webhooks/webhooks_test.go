@@ -0,0 +1,138 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"event":"message.created"}`)
+	signature := Sign("whsec_secret", "1700000000", body)
+	if !strings.HasPrefix(signature, "sha256=") || len(signature) != len("sha256=")+64 {
+		t.Fatalf("Sign() = %q, want sha256= and 64 hex digits", signature)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		signature string
+		want      bool
+	}{
+		{"valid", "whsec_secret", "1700000000", string(body), signature, true},
+		{"other secret", "whsec_other", "1700000000", string(body), signature, false},
+		{"replayed with a new timestamp", "whsec_secret", "1700000001", string(body), signature, false},
+		{"altered body", "whsec_secret", "1700000000", `{"event":"report.filed"}`, signature, false},
+		{"hex digest only", "whsec_secret", "1700000000", string(body), strings.TrimPrefix(signature, "sha256="), false},
+		{"empty", "whsec_secret", "1700000000", string(body), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.timestamp, []byte(tt.body), tt.signature); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{9, 128 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		address      string
+		allowPrivate string
+		wantErr      bool
+	}{
+		{"93.184.216.34:443", "", false},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", "", false},
+		{"127.0.0.1:80", "", true},
+		{"[::1]:80", "", true},
+		{"10.1.2.3:443", "", true},
+		{"192.168.0.10:443", "", true},
+		{"[fd00::1]:443", "", true},
+		{"169.254.169.254:80", "", true},
+		{"0.0.0.0:80", "", true},
+		{"224.0.0.1:80", "", true},
+		{"127.0.0.1:80", "true", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			t.Setenv("WEBHOOK_ALLOW_PRIVATE", tt.allowPrivate)
+			if err := checkAddress("tcp", tt.address, nil); (err != nil) != tt.wantErr {
+				t.Errorf("checkAddress(%s) = %v, want error %v", tt.address, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+
+	var received *http.Request
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusNoContent)
+		case "/redirect":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		default:
+			http.Error(w, "down", http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantErr    bool
+	}{
+		{"/ok", http.StatusNoContent, false},
+		{"/down", http.StatusServiceUnavailable, true},
+		{"/redirect", http.StatusFound, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			delivery := database.PendingDelivery{ID: 42, URL: receiver.URL + tt.path, Secret: "whsec_secret", Event: "member.joined", Payload: []byte(`{"event":"member.joined"}`)}
+			status, err := send(context.Background(), delivery)
+			if status != tt.wantStatus || (err != nil) != tt.wantErr {
+				t.Errorf("send() = %d, %v, want %d and error %v", status, err, tt.wantStatus, tt.wantErr)
+			}
+
+			if received.URL.Path != tt.path {
+				t.Fatalf("receiver got %s, want %s", received.URL.Path, tt.path)
+			}
+			if received.Header.Get(HeaderEvent) != "member.joined" || received.Header.Get(HeaderDelivery) != "42" {
+				t.Errorf("headers = %v", received.Header)
+			}
+			if !Verify("whsec_secret", received.Header.Get(HeaderTimestamp), delivery.Payload, received.Header.Get(HeaderSignature)) {
+				t.Errorf("signature %q does not verify", received.Header.Get(HeaderSignature))
+			}
+		})
+	}
+}
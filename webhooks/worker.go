@@ -0,0 +1,190 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/clementus360/proxy-chat/config"
+	"github.com/clementus360/proxy-chat/database"
+)
+
+const (
+	// pollInterval is how often the worker looks for due deliveries when it is not woken up
+	pollInterval = 5 * time.Second
+	// batchSize bounds the deliveries claimed, and sent concurrently, at once
+	batchSize = 20
+	// deliveryTimeout bounds one attempt, receivers should answer before doing slow work
+	deliveryTimeout = 10 * time.Second
+	// claimLease keeps a claimed delivery from being claimed again while it is being sent
+	claimLease = time.Minute
+
+	// Failed attempts are retried after baseBackoff, doubling up to maxBackoff, and the delivery
+	// moves to the dead letters after maxAttempts attempts, about four hours after the event
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+	maxAttempts = 10
+)
+
+// wakeup lets Emit start a delivery round without waiting for the next poll
+var wakeup = make(chan struct{}, 1)
+
+func wake() {
+	select {
+	case wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// client sends the deliveries directly, without proxies. Redirects are not followed and, unless
+// WEBHOOK_ALLOW_PRIVATE is set, private and loopback addresses cannot be reached, so webhooks
+// cannot probe the internal network.
+var client = &http.Client{
+	Timeout: deliveryTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: deliveryTimeout,
+			Control: checkAddress,
+		}).DialContext,
+		TLSHandshakeTimeout: deliveryTimeout,
+		MaxIdleConnsPerHost: 4,
+	},
+}
+
+// errPrivateAddress is returned when dialing an address webhooks may not reach
+var errPrivateAddress = errors.New("webhook address is not public")
+
+func checkAddress(network string, address string, conn syscall.RawConn) error {
+	if config.GetEnv("WEBHOOK_ALLOW_PRIVATE", "false") == "true" {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// Start runs the delivery worker until ctx is done. Several servers may run it against the same
+// database, each delivery is claimed by one of them.
+func Start(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep going while full batches come back
+		for deliverBatch(ctx) == batchSize {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wakeup:
+		}
+	}
+}
+
+// deliverBatch sends the due deliveries of one batch and returns how many were claimed
+func deliverBatch(ctx context.Context) int {
+	deliveries, err := database.ClaimWebhookDeliveries(ctx, batchSize, claimLease)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Println("Error claiming webhook deliveries:", err)
+		}
+		return 0
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deliver(ctx, delivery)
+		}()
+	}
+	wg.Wait()
+	return len(deliveries)
+}
+
+// deliver makes one attempt and records its outcome
+func deliver(ctx context.Context, delivery database.PendingDelivery) {
+	statusCode, err := send(ctx, delivery)
+	if err == nil {
+		err = database.CompleteWebhookDelivery(ctx, delivery.ID, statusCode)
+		if err != nil {
+			log.Println("Error completing webhook delivery:", err)
+		}
+		return
+	}
+
+	if delivery.Attempts >= maxAttempts {
+		log.Println("Webhook delivery", delivery.ID, "failed for good:", err)
+		err = database.KillWebhookDelivery(ctx, delivery.ID, statusCode, err.Error())
+		if err != nil {
+			log.Println("Error moving webhook delivery to dead letters:", err)
+		}
+		return
+	}
+
+	err = database.RetryWebhookDelivery(ctx, delivery.ID, statusCode, err.Error(), backoff(delivery.Attempts))
+	if err != nil {
+		log.Println("Error scheduling webhook delivery retry:", err)
+	}
+}
+
+// send posts the payload and returns the response status, any status but 2xx is a failure
+func send(ctx context.Context, delivery database.PendingDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ProxyChat-Webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff is the delay before the attempt following attempt number attempts
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
@@ -0,0 +1,134 @@
+package websocket
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+)
+
+// connect registers a device for each user and returns them by user id
+func connect(t *testing.T, userIDs ...int) map[int]*Client {
+	t.Helper()
+
+	devices := map[int]*Client{}
+	for _, userID := range userIDs {
+		c := newClient(strconv.Itoa(userID), defaultDevice, &recordingTransport{}, legacySession, "", "")
+		registerClient(c)
+		t.Cleanup(func() { unregisterClient(c) })
+		devices[userID] = c
+	}
+	return devices
+}
+
+// queued drains the frames queued for a device
+func queued(c *Client) []WsMessage {
+	var frames []WsMessage
+	for {
+		select {
+		case item := <-c.outbox:
+			frames = append(frames, item.frame)
+		default:
+			return frames
+		}
+	}
+}
+
+func TestTypingBetweenBlockedUsers(t *testing.T) {
+	server := testenv.Redis(t)
+
+	// User 1 blocked user 2, the block lists are served from the cache
+	server.SAdd("blocks:1", "-", "2")
+	for _, userID := range []string{"2", "3", "4"} {
+		server.SAdd("blocks:"+userID, "-")
+	}
+	server.SAdd("group:9", "1", "2", "3")
+	devices := connect(t, 1, 2, 3, 4)
+
+	// Forget the typing frames of earlier runs, they would be throttled
+	t.Cleanup(func() {
+		typingMu.Lock()
+		clear(typingSent)
+		typingMu.Unlock()
+	})
+
+	tests := []struct {
+		name     string
+		senderID int
+		frame    WsMessage
+		want     []int
+	}{
+		{"direct message", 1, WsMessage{Type: TypeTypingStart, ReceiverID: 3}, []int{3}},
+		{"to a blocked user", 1, WsMessage{Type: TypeTypingStart, ReceiverID: 2}, nil},
+		{"to the blocker", 2, WsMessage{Type: TypeTypingStart, ReceiverID: 1}, nil},
+		{"group", 3, WsMessage{Type: TypeTypingStart, GroupID: 9}, []int{1, 2}},
+		{"group, blocked sender", 2, WsMessage{Type: TypeTypingStart, GroupID: 9}, []int{3}},
+		{"group, blocker sender", 1, WsMessage{Type: TypeTypingStart, GroupID: 9}, []int{2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handleTyping(strconv.Itoa(tt.senderID), tt.frame)
+
+			for userID, c := range devices {
+				frames := queued(c)
+				want := slices.Contains(tt.want, userID)
+				if got := len(frames) == 1 && frames[0].SenderID == tt.senderID; got != want || len(frames) > 1 {
+					t.Errorf("user %d got %v, want a typing frame %t", userID, frames, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPresenceAudienceLeavesOutBlockedUsers(t *testing.T) {
+	testenv.Postgres(t)
+	bg := context.Background()
+
+	user := testenv.CreateUser(t)
+	blocked := testenv.CreateUser(t)
+	blocker := testenv.CreateUser(t)
+	friend := testenv.CreateUser(t)
+	partner := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, user)
+	for _, memberID := range []int{blocked, blocker, friend} {
+		if err := database.AddGroupMember(bg, groupID, memberID, database.RoleMember); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := database.DB.Exec(bg, "INSERT INTO messages (sender_id, receiver_id, content) VALUES ($1, $2, 'hi')", partner, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.BlockUser(bg, user, blocked); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.BlockUser(bg, blocker, user); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		userID int
+		want   []int
+	}{
+		{"user", user, []int{friend, partner}},
+		{"blocked user", blocked, []int{blocker, friend}},
+		{"friend", friend, []int{user, blocked, blocker}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want []string
+			for _, id := range tt.want {
+				want = append(want, strconv.Itoa(id))
+			}
+			got := presenceAudience(strconv.Itoa(tt.userID))
+			slices.Sort(got)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("presenceAudience() = %v, want %v", got, want)
+			}
+		})
+	}
+}
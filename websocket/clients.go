@@ -0,0 +1,352 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/gorilla/websocket"
+)
+
+// defaultDevice is the device of clients that connect without a device_id
+const defaultDevice = "default"
+
+// validDeviceID limits device ids so they are safe to use in Redis keys and logs
+var validDeviceID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+const (
+	// outboxSize is the number of frames queued for a device before it is disconnected as too slow
+	outboxSize = 256
+
+	// writeTimeout bounds the time spent writing a single frame
+	writeTimeout = 10 * time.Second
+)
+
+// outbound is a frame queued for a device. Frames from the user's delivery stream carry their
+// stream id, skipped frames only move the device cursor, for instance on the device that sent them.
+type outbound struct {
+	frame    WsMessage
+	streamID string
+	skip     bool
+}
+
+// transport carries the frames of a device: a WebSocket, an event stream or a long poll
+type transport interface {
+	name() string
+
+	// write sends an encoded frame, streamID is set for frames of the delivery stream
+	write(v interface{}, streamID string) error
+	close(code int, reason string)
+}
+
+// wsTransport writes frames to a WebSocket connection
+type wsTransport struct {
+	conn *websocket.Conn
+}
+
+func (t wsTransport) name() string {
+	return "websocket"
+}
+
+func (t wsTransport) write(v interface{}, streamID string) error {
+	t.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return t.conn.WriteJSON(v)
+}
+
+func (t wsTransport) close(code int, reason string) {
+	if code == websocket.CloseAbnormalClosure {
+		t.conn.Close()
+		return
+	}
+	closeWithReason(t.conn, code, reason)
+}
+
+// Client is one connected device of a user. Frames are queued in its outbox and written by
+// its own goroutine, so a slow connection never holds up the others.
+type Client struct {
+	userID      string
+	deviceID    string
+	transport   transport
+	session     *session
+	remoteAddr  string
+	userAgent   string
+	connectedAt time.Time
+
+	outbox    chan outbound
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// lastStreamID is the last stream entry written, it is only used by the writer
+	lastStreamID string
+
+	// acknowledged devices keep their saved cursor until the client acknowledges what it
+	// received, long polls do it with the cursor of their next poll
+	acknowledged bool
+}
+
+// DeviceSession describes a connected device, as listed by the sessions API
+type DeviceSession struct {
+	DeviceID    string    `json:"device_id"`
+	Transport   string    `json:"transport"`
+	Protocol    int       `json:"protocol"`
+	Features    []string  `json:"features"`
+	RemoteAddr  string    `json:"remote_addr"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+var (
+	clientsMu sync.RWMutex
+
+	// clients maps user ids to their connected devices, keyed by device id
+	clients = make(map[string]map[string]*Client)
+)
+
+func newClient(userID string, deviceID string, t transport, s *session, remoteAddr string, userAgent string) *Client {
+	return &Client{
+		userID:      userID,
+		deviceID:    deviceID,
+		transport:   t,
+		session:     s,
+		remoteAddr:  remoteAddr,
+		userAgent:   userAgent,
+		connectedAt: time.Now(),
+		outbox:      make(chan outbound, outboxSize),
+		done:        make(chan struct{}),
+	}
+}
+
+func devicesKey(userID string) string {
+	return fmt.Sprintf("devices:%s", userID)
+}
+
+// registerClient adds a device to the registry and reports whether it is the first device of
+// the user. A device reconnecting under the same id replaces its previous connection.
+func registerClient(c *Client) bool {
+	clientsMu.Lock()
+	devices, exists := clients[c.userID]
+	if !exists {
+		devices = make(map[string]*Client)
+		clients[c.userID] = devices
+	}
+	previous := devices[c.deviceID]
+	devices[c.deviceID] = c
+	first := len(devices) == 1
+	clientsMu.Unlock()
+
+	if previous != nil {
+		log.Printf("Device %s of user %s reconnected, closing its previous connection", c.deviceID, c.userID)
+		previous.close(websocket.ClosePolicyViolation, "replaced by a new connection")
+	}
+
+	record, err := json.Marshal(c.describe())
+	if err == nil {
+		err = database.RedisClient.HSet(ctx, devicesKey(c.userID), c.deviceID, record).Err()
+	}
+	if err != nil {
+		log.Printf("Error storing session of device %s of user %s: %v", c.deviceID, c.userID, err)
+	}
+	return first
+}
+
+// unregisterClient removes a device from the registry and reports whether it was the last
+// device of the user. Connections that were already replaced leave the registry untouched.
+func unregisterClient(c *Client) bool {
+	clientsMu.Lock()
+	devices := clients[c.userID]
+	current := devices[c.deviceID] == c
+	if current {
+		delete(devices, c.deviceID)
+		if len(devices) == 0 {
+			delete(clients, c.userID)
+		}
+	}
+	last := len(devices) == 0
+	clientsMu.Unlock()
+
+	if current {
+		if err := database.RedisClient.HDel(ctx, devicesKey(c.userID), c.deviceID).Err(); err != nil {
+			log.Printf("Error removing session of device %s of user %s: %v", c.deviceID, c.userID, err)
+		}
+	}
+	return current && last
+}
+
+// userClients returns the connected devices of a user
+func userClients(userID string) []*Client {
+	clientsMu.RLock()
+	defer clientsMu.RUnlock()
+
+	devices := make([]*Client, 0, len(clients[userID]))
+	for _, c := range clients[userID] {
+		devices = append(devices, c)
+	}
+	return devices
+}
+
+func (c *Client) describe() DeviceSession {
+	return DeviceSession{
+		DeviceID:    c.deviceID,
+		Transport:   c.transport.name(),
+		Protocol:    c.session.version,
+		Features:    c.session.featureList(),
+		RemoteAddr:  c.remoteAddr,
+		UserAgent:   c.userAgent,
+		ConnectedAt: c.connectedAt,
+	}
+}
+
+// send queues an ephemeral frame, it is lost if the device disconnects before it is written
+func (c *Client) send(frame WsMessage) bool {
+	return c.enqueue(outbound{frame: frame})
+}
+
+// enqueue adds a frame to the outbox. Devices that stop reading are disconnected
+// rather than slowing down the senders.
+func (c *Client) enqueue(item outbound) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.outbox <- item:
+		return true
+	default:
+		log.Printf("Disconnecting device %s of user %s: outbox full", c.deviceID, c.userID)
+		c.close(websocket.ClosePolicyViolation, "too many pending frames")
+		return false
+	}
+}
+
+// writeLoop first replays the frames the device missed after the cursor, then writes queued
+// frames until the connection closes. Queued frames that were part of the replay are skipped.
+func (c *Client) writeLoop(cursor string) {
+	replayedUpTo := ""
+	backlog, err := readStream(c.userID, cursor)
+	if err != nil {
+		log.Printf("Error reading the delivery stream of user %s: %v", c.userID, err)
+	}
+	for _, item := range backlog {
+		if !c.write(item) {
+			return
+		}
+		replayedUpTo = item.streamID
+	}
+
+	for {
+		select {
+		case item := <-c.outbox:
+			if item.streamID != "" && !streamIDAfter(item.streamID, replayedUpTo) {
+				continue
+			}
+			if !c.write(item) {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// write sends a frame in the protocol of the device and moves its cursor past stream frames
+func (c *Client) write(item outbound) bool {
+	if !item.skip && c.session.accepts(item.frame.Type) {
+		v, err := c.session.encode(item.frame)
+		if err != nil {
+			log.Printf("Error encoding %s frame: %v", item.frame.Type, err)
+			return true
+		}
+
+		if err := c.transport.write(v, item.streamID); err != nil {
+			log.Printf("Error writing %s frame to device %s of user %s: %v", item.frame.Type, c.deviceID, c.userID, err)
+			c.close(websocket.CloseAbnormalClosure, "")
+			return false
+		}
+
+		// Direct messages are delivered once they were written to a device of the recipient
+		if item.frame.Type == TypeMessage && fmt.Sprint(item.frame.ReceiverID) == c.userID {
+			markDelivered(item.frame)
+		}
+	}
+
+	if item.streamID != "" {
+		if !c.acknowledged {
+			saveCursor(c.userID, c.deviceID, item.streamID)
+		}
+		c.lastStreamID = item.streamID
+	}
+	return true
+}
+
+// close closes the transport and stops the writer, the handler of the device then runs the usual cleanup
+func (c *Client) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.transport.close(code, reason)
+		close(c.done)
+	})
+}
+
+// sendLive writes an ephemeral frame to every connected device of a user, nothing is kept
+// for devices that are offline. It reports whether a device was connected.
+func sendLive(userID string, frame WsMessage) bool {
+	sent := false
+	for _, c := range userClients(userID) {
+		if c.send(frame) {
+			sent = true
+		}
+	}
+	return sent
+}
+
+// Sessions lists the connected devices of a user, oldest first
+func Sessions(userID int) ([]DeviceSession, error) {
+	records, err := database.RedisClient.HGetAll(ctx, devicesKey(fmt.Sprint(userID))).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []DeviceSession{}
+	for deviceID, record := range records {
+		var s DeviceSession
+		if err := json.Unmarshal([]byte(record), &s); err != nil {
+			log.Printf("Error decoding session of device %s of user %d: %v", deviceID, userID, err)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ConnectedAt.Before(sessions[j].ConnectedAt)
+	})
+	return sessions, nil
+}
+
+// RevokeSession disconnects a device and forgets its delivery cursor, so it starts over if it
+// connects again. It reports whether the device had a session.
+func RevokeSession(userID int, deviceID string) (bool, error) {
+	id := fmt.Sprint(userID)
+
+	found := false
+	for _, c := range userClients(id) {
+		if c.deviceID == deviceID {
+			c.close(websocket.ClosePolicyViolation, "session revoked")
+			found = true
+		}
+	}
+
+	removed, err := database.RedisClient.HDel(ctx, devicesKey(id), deviceID).Result()
+	if err != nil {
+		return found, err
+	}
+	if err := database.RedisClient.HDel(ctx, cursorsKey(id), deviceID).Err(); err != nil {
+		return found, err
+	}
+	return found || removed > 0, nil
+}
@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+)
+
+// recordingTransport keeps the frames written to a device
+type recordingTransport struct {
+	mu     sync.Mutex
+	frames []interface{}
+	err    error
+}
+
+func (t *recordingTransport) name() string {
+	return "test"
+}
+
+func (t *recordingTransport) write(v interface{}, streamID string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return t.err
+	}
+	t.frames = append(t.frames, v)
+	return nil
+}
+
+func (t *recordingTransport) close(code int, reason string) {}
+
+func TestWriteMarksDirectMessagesDelivered(t *testing.T) {
+	testenv.Postgres(t)
+
+	tests := []struct {
+		name          string
+		skip          bool
+		err           error
+		wantDelivered bool
+	}{
+		{"written", false, nil, true},
+		{"write failed", false, errors.New("connection reset"), false},
+		{"skipped", true, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			senderID := testenv.CreateUser(t)
+			receiverID := testenv.CreateUser(t)
+
+			var messageID int
+			query := "INSERT INTO messages (sender_id, receiver_id, content) VALUES ($1, $2, 'hello') RETURNING id"
+			if err := database.DB.QueryRow(ctx, query, senderID, receiverID).Scan(&messageID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := database.DB.Exec(ctx, "INSERT INTO message_receipts (message_id, user_id) VALUES ($1, $2)", messageID, receiverID); err != nil {
+				t.Fatal(err)
+			}
+
+			c := newClient(fmt.Sprint(receiverID), defaultDevice, &recordingTransport{err: tt.err}, legacySession, "", "")
+			c.write(outbound{frame: WsMessage{ID: messageID, Type: TypeMessage, SenderID: senderID, ReceiverID: receiverID}, skip: tt.skip})
+
+			var delivered bool
+			query = "SELECT delivered_at IS NOT NULL FROM message_receipts WHERE message_id = $1 AND user_id = $2"
+			if err := database.DB.QueryRow(context.Background(), query, messageID, receiverID).Scan(&delivered); err != nil {
+				t.Fatal(err)
+			}
+			if delivered != tt.wantDelivered {
+				t.Errorf("delivered = %t, want %t", delivered, tt.wantDelivered)
+			}
+		})
+	}
+}
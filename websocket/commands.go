@@ -0,0 +1,428 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/bots"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/validation"
+	"github.com/clementus360/proxy-chat/webhooks"
+)
+
+// Limits of the built-in commands
+const (
+	maxGroupMute   = 30 * 24 * time.Hour
+	maxTopicLength = 200
+	whoRadius      = 5
+	whoLimit       = 50
+)
+
+// Actions of the moderation frames sent by /mute and /unmute
+const (
+	ActionGroupMute   = "group_mute"
+	ActionGroupUnmute = "group_unmute"
+)
+
+// Command is a slash command of the group chat
+type Command struct {
+	// Usage shows the arguments, such as "@user <duration>"
+	Usage       string
+	Description string
+
+	// Role is the lowest group role allowed to run the command
+	Role string
+
+	// Run carries the command out. Errors of type *apierror.Error are sent to the invoker,
+	// other errors are logged and reported as internal errors.
+	Run func(inv *Invocation) error
+}
+
+// Invocation is a command being run by a member of a group
+type Invocation struct {
+	bots.Command
+	GroupID    int
+	UserID     int
+	Membership database.Membership
+
+	client *Client
+	frame  WsMessage
+}
+
+// commands maps the name of each command to its definition
+var commands = map[string]Command{}
+
+// The built-in commands are registered at startup, as /help and the usage errors read the registry
+func init() {
+	RegisterCommand("help", Command{Description: "List the commands you can use", Role: database.RoleMember, Run: runHelp})
+	RegisterCommand("me", Command{Usage: "<action>", Description: "Post an action, such as /me waves", Role: database.RoleMember, Run: runMe})
+	RegisterCommand("nick", Command{Usage: "[nickname]", Description: "Set your nickname in this group, or clear it", Role: database.RoleMember, Run: runNick})
+	RegisterCommand("topic", Command{Usage: "[topic]", Description: "Show the topic of this group, moderators set it", Role: database.RoleMember, Run: runTopic})
+	RegisterCommand("who", Command{Description: "List the members of this group near you", Role: database.RoleMember, Run: runWho})
+	RegisterCommand("leave", Command{Description: "Leave this group", Role: database.RoleMember, Run: runLeave})
+	RegisterCommand("mute", Command{Usage: "@user <duration> [reason]", Description: "Stop a member from posting, for a duration such as 10m or 1d", Role: database.RoleModerator, Run: runMute})
+	RegisterCommand("unmute", Command{Usage: "@user", Description: "Let a muted member post again", Role: database.RoleModerator, Run: runUnmute})
+}
+
+// RegisterCommand adds a command or replaces a built-in one, it must be called before the server starts
+func RegisterCommand(name string, command Command) {
+	if !validation.CommandPattern.MatchString(name) {
+		panic(fmt.Sprintf("websocket: invalid command name %q", name))
+	}
+	commands[name] = command
+}
+
+// roleRanks orders the group roles, a command allowed to a role is allowed to the higher ones
+var roleRanks = map[string]int{database.RoleMember: 1, database.RoleModerator: 2, database.RoleOwner: 3}
+
+// outranks reports whether a role is at least another one
+func outranks(role string, other string) bool {
+	return roleRanks[role] >= roleRanks[other]
+}
+
+// runCommand runs the command a group chat frame starts with. It reports false when the frame
+// should be posted as a message instead: when it addresses a bot, as in /weather@forecast_bot,
+// or when a bot of the group registered a command that is not built in.
+func (c *Client) runCommand(msg WsMessage, parsed bots.Command) bool {
+	if parsed.Bot != "" {
+		return false
+	}
+
+	command, ok := commands[parsed.Name]
+	if !ok {
+		botIDs, err := database.CommandBots(ctx, msg.GroupID, parsed.Name, "")
+		if err != nil {
+			log.Printf("Error finding bots for command /%s in group %d: %v", parsed.Name, msg.GroupID, err)
+			rejectMessage(c, msg, apierror.CodeInternal, "Unable to run command")
+			return true
+		}
+		if len(botIDs) > 0 {
+			return false
+		}
+		rejectMessage(c, msg, apierror.CodeNotFound, fmt.Sprintf("Unknown command /%s, send /help for the list", parsed.Name))
+		return true
+	}
+
+	// Envelope sessions only get the replies and notices of commands with the commands feature
+	if !c.session.accepts(TypeCommandResult) {
+		rejectMessage(c, msg, apierror.CodeProtocol, fmt.Sprintf("Negotiate the %s feature to use /%s", FeatureCommands, parsed.Name))
+		return true
+	}
+
+	membership, err := database.GroupMembership(ctx, msg.GroupID, msg.SenderID)
+	if err != nil {
+		log.Printf("Error checking membership of user %d in group %d: %v", msg.SenderID, msg.GroupID, err)
+		rejectMessage(c, msg, apierror.CodeInternal, "Unable to run command")
+		return true
+	}
+	if membership.Role == "" {
+		rejectMessage(c, msg, apierror.CodeForbidden, "You are not a member of this group")
+		return true
+	}
+	if !outranks(membership.Role, command.Role) {
+		rejectMessage(c, msg, apierror.CodeForbidden, fmt.Sprintf("Only group %ss can use /%s", command.Role, parsed.Name))
+		return true
+	}
+
+	inv := &Invocation{Command: parsed, GroupID: msg.GroupID, UserID: msg.SenderID, Membership: membership, client: c, frame: msg}
+	err = command.Run(inv)
+	var refused *apierror.Error
+	if errors.As(err, &refused) {
+		rejectMessage(c, msg, refused.Code, refused.Message)
+	} else if err != nil {
+		log.Printf("Error running /%s for user %d in group %d: %v", parsed.Name, msg.SenderID, msg.GroupID, err)
+		rejectMessage(c, msg, apierror.CodeInternal, "Unable to run command")
+	}
+	return true
+}
+
+// Reply answers the invoker on the connection the command came from, nobody else sees it
+func (inv *Invocation) Reply(content string, members []models.NearbyMember) {
+	inv.client.send(WsMessage{
+		Type:        TypeCommandResult,
+		Command:     inv.Name,
+		GroupID:     inv.GroupID,
+		Content:     content,
+		Members:     members,
+		ClientMsgID: inv.frame.ClientMsgID,
+		Ref:         inv.frame.Ref,
+		CreatedAt:   time.Now(),
+	})
+}
+
+// Announce tells every member of the group, and every device of the invoker, what the command changed
+func (inv *Invocation) Announce(content string) {
+	BroadcastEvent(WsMessage{
+		Type:      TypeGroupNotice,
+		Command:   inv.Name,
+		GroupID:   inv.GroupID,
+		SenderID:  inv.UserID,
+		Content:   content,
+		CreatedAt: time.Now(),
+	})
+}
+
+// Post sends a chat message to the group on behalf of the invoker, like any other message.
+// The command already went through the membership checks, restrictions and filters, the message is not screened again.
+func (inv *Invocation) Post(content string) {
+	msg := inv.frame
+	msg.Content = content
+	inv.client.publishMessage(msg)
+}
+
+// usage is the error of a command called with the wrong arguments
+func (inv *Invocation) usage() error {
+	return apierror.BadRequest(fmt.Sprintf("Usage: /%s %s", inv.Name, commands[inv.Name].Usage))
+}
+
+// displayName is the name the invoker goes by in the group
+func (inv *Invocation) displayName() (string, error) {
+	return database.DisplayName(ctx, inv.UserID, inv.GroupID)
+}
+
+// names returns the names the invoker and another member go by in the group
+func (inv *Invocation) names(userID int) (string, string, error) {
+	name, err := inv.displayName()
+	if err != nil {
+		return "", "", err
+	}
+	other, err := database.DisplayName(ctx, userID, inv.GroupID)
+	return name, other, err
+}
+
+// target finds the member named by an argument such as @alice
+func (inv *Invocation) target(arg string) (int, database.Membership, error) {
+	userID, membership, err := database.FindGroupMember(ctx, inv.GroupID, strings.TrimPrefix(arg, "@"))
+	if errors.Is(err, database.ErrNotGroupMember) {
+		return 0, membership, apierror.NotFound(fmt.Sprintf("No member named %s in this group", arg))
+	}
+	if err != nil {
+		return 0, membership, err
+	}
+
+	if userID == inv.UserID {
+		return 0, membership, apierror.BadRequest(fmt.Sprintf("You cannot use /%s on yourself", inv.Name))
+	}
+
+	// Moderators answer to the owner only, who answers to no one
+	if membership.Role == database.RoleOwner {
+		return 0, membership, apierror.Forbidden(fmt.Sprintf("You cannot use /%s on the group owner", inv.Name))
+	}
+	if membership.Role == database.RoleModerator && inv.Membership.Role != database.RoleOwner {
+		return 0, membership, apierror.Forbidden(fmt.Sprintf("Only the group owner can use /%s on a moderator", inv.Name))
+	}
+	return userID, membership, nil
+}
+
+func runHelp(inv *Invocation) error {
+	names := []string{}
+	for name, command := range commands {
+		if outranks(inv.Membership.Role, command.Role) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	lines := []string{"Commands:"}
+	for _, name := range names {
+		command := commands[name]
+		line := "/" + name
+		if command.Usage != "" {
+			line += " " + command.Usage
+		}
+		lines = append(lines, line+": "+command.Description)
+	}
+	inv.Reply(strings.Join(lines, "\n"), nil)
+	return nil
+}
+
+func runMe(inv *Invocation) error {
+	if inv.Text == "" {
+		return inv.usage()
+	}
+
+	name, err := inv.displayName()
+	if err != nil {
+		return err
+	}
+	inv.Post(fmt.Sprintf("* %s %s", name, inv.Text))
+	return nil
+}
+
+func runNick(inv *Invocation) error {
+	if len(inv.Args) > 1 {
+		return inv.usage()
+	}
+	nickname := inv.Text
+	if nickname != "" && !validation.UsernamePattern.MatchString(nickname) {
+		return apierror.BadRequest("Nicknames must be 3 to 30 letters, digits, dots, dashes or underscores")
+	}
+
+	previous, err := inv.displayName()
+	if err != nil {
+		return err
+	}
+
+	err = database.SetGroupNickname(ctx, inv.GroupID, inv.UserID, nickname)
+	if errors.Is(err, database.ErrNicknameTaken) {
+		return apierror.Conflict(fmt.Sprintf("%s is already used by another member", nickname))
+	}
+	if err != nil {
+		return err
+	}
+
+	current, err := inv.displayName()
+	if err != nil {
+		return err
+	}
+	if current != previous {
+		inv.Announce(fmt.Sprintf("%s is now known as %s", previous, current))
+	}
+	inv.Reply(fmt.Sprintf("You are now known as %s in this group", current), nil)
+	return nil
+}
+
+func runTopic(inv *Invocation) error {
+	if inv.Text == "" {
+		topic, err := database.GroupTopic(ctx, inv.GroupID)
+		if err != nil {
+			return err
+		}
+		if topic == "" {
+			inv.Reply("This group has no topic", nil)
+		} else {
+			inv.Reply("Topic: "+topic, nil)
+		}
+		return nil
+	}
+
+	if !outranks(inv.Membership.Role, database.RoleModerator) {
+		return apierror.Forbidden("Only group moderators can set the topic")
+	}
+	if utf8.RuneCountInString(inv.Text) > maxTopicLength {
+		return apierror.BadRequest(fmt.Sprintf("Topics are at most %d characters", maxTopicLength))
+	}
+
+	err := database.SetGroupTopic(ctx, inv.GroupID, inv.Text)
+	if err != nil {
+		return err
+	}
+
+	name, err := inv.displayName()
+	if err != nil {
+		return err
+	}
+	inv.Announce(fmt.Sprintf("%s set the topic to: %s", name, inv.Text))
+	return nil
+}
+
+func runWho(inv *Invocation) error {
+	members, err := database.NearbyGroupMembers(ctx, inv.GroupID, inv.UserID, whoRadius, whoLimit)
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		inv.Reply(fmt.Sprintf("No members online within %d km of you", whoRadius), members)
+		return nil
+	}
+
+	names := make([]string, len(members))
+	for i, member := range members {
+		names[i] = fmt.Sprintf("%s (%.1f km)", member.Name, member.DistanceKm)
+	}
+	inv.Reply(fmt.Sprintf("Members online within %d km: %s", whoRadius, strings.Join(names, ", ")), members)
+	return nil
+}
+
+func runLeave(inv *Invocation) error {
+	name, err := inv.displayName()
+	if err != nil {
+		return err
+	}
+
+	role, err := database.LeaveGroup(ctx, inv.GroupID, inv.UserID)
+	if errors.Is(err, database.ErrGroupOwner) {
+		return apierror.Forbidden("The group owner cannot leave the group")
+	}
+	if err != nil {
+		return err
+	}
+
+	webhooks.Emit(ctx, models.WebhookMemberLeft, inv.GroupID, webhooks.Member{GroupID: inv.GroupID, UserID: inv.UserID, Role: role})
+	log.Printf("User %d left group %d", inv.UserID, inv.GroupID)
+
+	// The member left the fan-out set, they get a reply instead of the notice
+	inv.Reply("You left the group", nil)
+	inv.Announce(fmt.Sprintf("%s left the group", name))
+	return nil
+}
+
+func runMute(inv *Invocation) error {
+	if len(inv.Args) < 2 {
+		return inv.usage()
+	}
+	duration, err := validation.ParseDuration(inv.Args[1])
+	if err != nil {
+		return apierror.BadRequest("Durations look like 10m, 12h or 7d")
+	}
+	if duration > maxGroupMute {
+		return apierror.BadRequest("Members can be muted for at most 30 days")
+	}
+
+	targetID, _, err := inv.target(inv.Args[0])
+	if err != nil {
+		return err
+	}
+
+	until := time.Now().Add(duration)
+	if err = database.MuteGroupMember(ctx, inv.GroupID, targetID, &until); err != nil {
+		return err
+	}
+
+	// The reason is whatever follows the duration
+	reason := strings.Join(inv.Args[2:], " ")
+	SendToUser(targetID, WsMessage{Type: TypeModeration, Status: ActionGroupMute, Content: reason, ExpiresAt: &until, GroupID: inv.GroupID})
+	log.Printf("User %d muted user %d in group %d until %s", inv.UserID, targetID, inv.GroupID, until.Format(time.RFC3339))
+
+	name, targetName, err := inv.names(targetID)
+	if err != nil {
+		return err
+	}
+	inv.Announce(fmt.Sprintf("%s muted %s for %s", name, targetName, inv.Args[1]))
+	return nil
+}
+
+func runUnmute(inv *Invocation) error {
+	if len(inv.Args) != 1 {
+		return inv.usage()
+	}
+
+	targetID, membership, err := inv.target(inv.Args[0])
+	if err != nil {
+		return err
+	}
+	if !membership.Muted() {
+		return apierror.Conflict(fmt.Sprintf("%s is not muted", inv.Args[0]))
+	}
+
+	if err = database.MuteGroupMember(ctx, inv.GroupID, targetID, nil); err != nil {
+		return err
+	}
+
+	SendToUser(targetID, WsMessage{Type: TypeModeration, Status: ActionGroupUnmute, GroupID: inv.GroupID})
+	log.Printf("User %d unmuted user %d in group %d", inv.UserID, targetID, inv.GroupID)
+
+	name, targetName, err := inv.names(targetID)
+	if err != nil {
+		return err
+	}
+	inv.Announce(fmt.Sprintf("%s unmuted %s", name, targetName))
+	return nil
+}
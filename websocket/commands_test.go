@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/bots"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+	"github.com/clementus360/proxy-chat/ratelimit"
+)
+
+func TestOutranks(t *testing.T) {
+	tests := []struct {
+		role  string
+		other string
+		want  bool
+	}{
+		{database.RoleMember, database.RoleMember, true},
+		{database.RoleMember, database.RoleModerator, false},
+		{database.RoleModerator, database.RoleMember, true},
+		{database.RoleModerator, database.RoleOwner, false},
+		{database.RoleOwner, database.RoleModerator, true},
+		{"", database.RoleMember, false},
+	}
+
+	for _, tt := range tests {
+		if got := outranks(tt.role, tt.other); got != tt.want {
+			t.Errorf("outranks(%q, %q) = %v, want %v", tt.role, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestRunCommandNeedsTheCommandsFeature(t *testing.T) {
+	tests := []struct {
+		name        string
+		features    []string
+		content     string
+		wantHandled bool
+		wantCode    string
+	}{
+		{name: "built-in command", features: []string{FeatureTyping}, content: "/help", wantHandled: true, wantCode: apierror.CodeProtocol},
+		{name: "command addressed to a bot", features: []string{FeatureTyping}, content: "/help@helper_bot", wantHandled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &session{version: ProtocolEnvelope, features: negotiateFeatures(tt.features)}
+			c := newClient("1", defaultDevice, &recordingTransport{}, s, "", "")
+			parsed, _ := bots.ParseCommand(tt.content)
+
+			if handled := c.runCommand(WsMessage{Type: TypeMessage, GroupID: 3, SenderID: 1, Content: tt.content, Ref: "9"}, parsed); handled != tt.wantHandled {
+				t.Fatalf("runCommand() = %v, want %v", handled, tt.wantHandled)
+			}
+
+			frames := queued(c)
+			if tt.wantCode == "" {
+				if len(frames) != 0 {
+					t.Errorf("queued frames = %+v, want none", frames)
+				}
+				return
+			}
+			if len(frames) != 1 || frames[0].Type != TypeError || frames[0].Code != tt.wantCode || frames[0].Ref != "9" {
+				t.Errorf("queued frames = %+v, want one %s error", frames, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCommandsAreScreened(t *testing.T) {
+	testenv.Postgres(t)
+	previous := ratelimit.Default
+	ratelimit.Default = ratelimit.NewMemoryLimiter()
+	t.Cleanup(func() { ratelimit.Default = previous })
+
+	owner := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, owner)
+	muted := testenv.CreateUser(t)
+	if err := database.AddGroupMember(context.Background(), groupID, muted, database.RoleMember); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.DB.Exec(context.Background(), "UPDATE users SET muted_until = $2 WHERE id = $1", muted, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		userID   int
+		content  string
+		wantType string
+		wantCode string
+	}{
+		{name: "command", userID: owner, content: "/help", wantType: TypeCommandResult},
+		{name: "repeated command", userID: owner, content: "/help", wantType: TypeError, wantCode: apierror.CodeDuplicate},
+		{name: "muted user", userID: muted, content: "/topic", wantType: TypeError, wantCode: apierror.CodeMuted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient(strconv.Itoa(tt.userID), defaultDevice, &recordingTransport{}, legacySession, "", "")
+			limiter := frameLimiter{userID: c.userID, windowStart: time.Now()}
+			c.handleFrame(&limiter, WsMessage{Type: TypeMessage, GroupID: groupID, Content: tt.content}, "", nil)
+
+			frames := queued(c)
+			if len(frames) != 1 || frames[0].Type != tt.wantType || frames[0].Code != tt.wantCode {
+				t.Errorf("queued frames = %+v, want one %s frame %q", frames, tt.wantType, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/gorilla/websocket"
+)
+
+// Clients behind proxies that break WebSockets fall back to an event stream or to long polls.
+// Both are devices like WebSocket connections: they share the delivery streams and cursors and
+// get the same version 2 envelopes, while messages go through POST /api/messages and read
+// receipts are not available. The features to enable are listed in the features parameter.
+const (
+	// heartbeatInterval keeps idle event streams open through proxies
+	heartbeatInterval = 25 * time.Second
+
+	// reconnectDelay is the retry delay suggested to EventSource clients
+	reconnectDelay = 3 * time.Second
+
+	// pollTimeout bounds the wait for frames of a long poll
+	pollTimeout = 25 * time.Second
+
+	// pollBatchWindow collects the frames that arrive together in one poll response
+	pollBatchWindow = 100 * time.Millisecond
+)
+
+// validCursor matches the stream ids used as cursors
+var validCursor = regexp.MustCompile(`^[0-9]+-[0-9]+$`)
+
+// PollResponse holds the frames returned by a long poll, the next poll passes the cursor
+type PollResponse struct {
+	Frames []Envelope `json:"frames"`
+	Cursor string     `json:"cursor"`
+}
+
+// sseTransport writes frames as Server-Sent Events, stream frames carry their stream id as the
+// event id so EventSource resumes from it with Last-Event-ID
+type sseTransport struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	closed  bool
+}
+
+func (t *sseTransport) name() string {
+	return "sse"
+}
+
+func (t *sseTransport) write(v interface{}, streamID string) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	if streamID != "" {
+		fmt.Fprintf(t.w, "id: %s\n", streamID)
+	}
+	if _, err := fmt.Fprintf(t.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+// writeLine sends a line that is not a frame, such as the retry delay or a heartbeat comment
+func (t *sseTransport) writeLine(line string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil
+	}
+	if _, err := fmt.Fprintf(t.w, "%s\n\n", line); err != nil {
+		return err
+	}
+	t.flusher.Flush()
+	return nil
+}
+
+// close tells the client why the stream ends, nothing is written once the handler may have returned
+func (t *sseTransport) close(code int, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	t.closed = true
+
+	if reason != "" {
+		fmt.Fprintf(t.w, "event: close\ndata: %s\n\n", reason)
+		t.flusher.Flush()
+	}
+}
+
+// pollTransport collects the frames of a long poll
+type pollTransport struct {
+	mu     sync.Mutex
+	frames []Envelope
+	ready  chan struct{}
+}
+
+func (t *pollTransport) name() string {
+	return "poll"
+}
+
+func (t *pollTransport) write(v interface{}, streamID string) error {
+	env, ok := v.(Envelope)
+	if !ok {
+		return fmt.Errorf("unexpected %T frame", v)
+	}
+
+	t.mu.Lock()
+	t.frames = append(t.frames, env)
+	t.mu.Unlock()
+
+	select {
+	case t.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (t *pollTransport) close(code int, reason string) {}
+
+// eventSession builds the session of event stream and long poll clients from the features parameter
+func eventSession(r *http.Request) *session {
+	return &session{
+		version:  ProtocolEnvelope,
+		features: negotiateFeatures(strings.Split(r.URL.Query().Get("features"), ",")),
+	}
+}
+
+// HandleEvents streams the frames of a device as Server-Sent Events. The stream opens with a
+// welcome frame, then replays what the device missed after Last-Event-ID, or after its saved
+// cursor, before sending new frames.
+func HandleEvents(w http.ResponseWriter, r *http.Request) {
+	userID, userIDInt, deviceID, _, ok := authorizeDevice(w, r)
+	if !ok {
+		return
+	}
+
+	// EventSource polyfills that cannot set headers send the id in the query string
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("last_event_id")
+	}
+	if cursor != "" && !validCursor.MatchString(cursor) {
+		apierror.Write(w, r, apierror.Invalid("last_event_id", "Invalid event id"))
+		return
+	}
+	if cursor == "" {
+		cursor = loadCursor(userID, deviceID)
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierror.Write(w, r, apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "Streaming unsupported"))
+		log.Println("Error opening event stream: response writer cannot flush")
+		return
+	}
+
+	// Proxies must neither cache nor buffer the stream
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	session := eventSession(r)
+	stream := &sseTransport{w: w, flusher: flusher}
+	stream.writeLine(fmt.Sprintf("retry: %d", reconnectDelay.Milliseconds()))
+	welcome, err := session.welcome(userIDInt, "")
+	if err != nil {
+		log.Printf("Error building welcome frame for user %s: %v", userID, err)
+		return
+	}
+	if err := stream.write(welcome, ""); err != nil {
+		log.Printf("Error opening event stream of user %s: %v", userID, err)
+		return
+	}
+
+	client := newClient(userID, deviceID, stream, session, r.RemoteAddr, r.UserAgent())
+	connectDevice(client)
+	defer disconnectDevice(client)
+
+	// The writer runs on the handler goroutine, it returns once the client goes away or is closed
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := stream.writeLine(": ping"); err != nil {
+					client.close(websocket.CloseAbnormalClosure, "")
+					return
+				}
+			case <-r.Context().Done():
+				client.close(websocket.CloseGoingAway, "")
+				return
+			case <-client.done:
+				return
+			}
+		}
+	}()
+	client.writeLoop(cursor)
+}
+
+// PollEvents returns the frames of a device after the cursor parameter, or after its saved
+// cursor. It waits for frames when there are none yet. Polls do not change the presence of the user.
+// The cursor parameter acknowledges the frames up to it and only then becomes the saved cursor,
+// so the frames of a response that never reached the client are returned again.
+func PollEvents(w http.ResponseWriter, r *http.Request) {
+	userID, _, deviceID, _, ok := authorizeDevice(w, r)
+	if !ok {
+		return
+	}
+
+	cursor := r.URL.Query().Get("cursor")
+	if cursor != "" && !validCursor.MatchString(cursor) {
+		apierror.Write(w, r, apierror.Invalid("cursor", "Invalid cursor"))
+		return
+	}
+	if cursor == "" {
+		cursor = loadCursor(userID, deviceID)
+	} else {
+		saveCursor(userID, deviceID, cursor)
+	}
+
+	poll := &pollTransport{ready: make(chan struct{}, 1)}
+	client := newClient(userID, deviceID, poll, eventSession(r), r.RemoteAddr, r.UserAgent())
+	client.acknowledged = true
+	registerClient(client)
+
+	finished := make(chan struct{})
+	go func() {
+		client.writeLoop(cursor)
+		close(finished)
+	}()
+
+	timeout := time.NewTimer(pollTimeout)
+	defer timeout.Stop()
+	select {
+	case <-poll.ready:
+		// Give frames sent together, such as a replay, the chance to arrive
+		select {
+		case <-time.After(pollBatchWindow):
+		case <-r.Context().Done():
+		}
+	case <-timeout.C:
+	case <-r.Context().Done():
+	case <-client.done:
+	}
+
+	unregisterClient(client)
+	client.close(websocket.CloseNormalClosure, "")
+	<-finished
+
+	response := PollResponse{Frames: poll.frames, Cursor: cursor}
+	if response.Frames == nil {
+		response.Frames = []Envelope{}
+	}
+	if client.lastStreamID != "" {
+		response.Cursor = client.lastStreamID
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,106 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/internal/testenv"
+)
+
+func TestWriteSavesCursorUnlessAcknowledged(t *testing.T) {
+	testenv.Redis(t)
+
+	tests := []struct {
+		name         string
+		acknowledged bool
+		wantCursor   string
+	}{
+		{"websocket device", false, "5-0"},
+		{"long poll", true, "1-0"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := strconv.Itoa(50 + i)
+			saveCursor(userID, "phone", "1-0")
+			c := newClient(userID, "phone", &recordingTransport{}, legacySession, "", "")
+			c.acknowledged = tt.acknowledged
+
+			if !c.write(outbound{frame: WsMessage{Type: TypeMessage, GroupID: 3}, streamID: "5-0"}) {
+				t.Fatal("write() = false")
+			}
+			if cursor := loadCursor(userID, "phone"); cursor != tt.wantCursor {
+				t.Errorf("saved cursor = %q, want %q", cursor, tt.wantCursor)
+			}
+			if c.lastStreamID != "5-0" {
+				t.Errorf("lastStreamID = %q, want 5-0", c.lastStreamID)
+			}
+		})
+	}
+}
+
+func TestPollEventsAcknowledgesCursor(t *testing.T) {
+	testenv.Postgres(t)
+
+	userID := testenv.CreateUser(t)
+	id := strconv.Itoa(userID)
+	var ids []string
+	for _, content := range []string{"first", "second"} {
+		streamID, err := appendToStream(id, WsMessage{Type: TypeMessage, GroupID: 3, Content: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, streamID)
+	}
+
+	poll := func(cursor string) PollResponse {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+
+		url := fmt.Sprintf("/api/events/poll?user_id=%d&device_id=laptop", userID)
+		if cursor != "" {
+			url += "&cursor=" + cursor
+		}
+		w := httptest.NewRecorder()
+		PollEvents(w, httptest.NewRequest(http.MethodGet, url, nil).WithContext(ctx))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var response PollResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	tests := []struct {
+		name       string
+		cursor     string
+		wantFrames int
+		wantCursor string
+		wantSaved  string
+	}{
+		{"first poll", "", 2, ids[1], ""},
+		{"response was lost", "", 2, ids[1], ""},
+		{"acknowledged first frame", ids[0], 1, ids[1], ids[0]},
+		{"acknowledged everything", ids[1], 0, ids[1], ids[1]},
+		{"saved cursor", "", 0, ids[1], ids[1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := poll(tt.cursor)
+			if len(response.Frames) != tt.wantFrames || response.Cursor != tt.wantCursor {
+				t.Errorf("poll = %d frames, cursor %q, want %d frames, cursor %q", len(response.Frames), response.Cursor, tt.wantFrames, tt.wantCursor)
+			}
+			if saved := loadCursor(id, "laptop"); saved != tt.wantSaved {
+				t.Errorf("saved cursor = %q, want %q", saved, tt.wantSaved)
+			}
+		})
+	}
+}
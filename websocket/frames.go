@@ -0,0 +1,232 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/clementus360/proxy-chat/models"
+)
+
+// Payloads of version 2 frames. Client frames are decoded into the payloads of hello, message,
+// typing_start, typing_stop, presence and read frames, the others are only sent by the server.
+
+// HelloPayload opens an envelope session
+type HelloPayload struct {
+	Versions []int    `json:"versions" validate:"required"`
+	Features []string `json:"features" validate:"max=20"`
+
+	// Client names the client and its version, for logs
+	Client string `json:"client,omitempty" validate:"max=100"`
+}
+
+// WelcomePayload answers a hello with what was negotiated
+type WelcomePayload struct {
+	Version    int       `json:"version"`
+	Features   []string  `json:"features"`
+	UserID     int       `json:"user_id"`
+	ServerTime time.Time `json:"server_time"`
+}
+
+// SendPayload is a chat message sent by a client, to a single user or a single group
+type SendPayload struct {
+	ReceiverID    int    `json:"receiver_id,omitempty" validate:"required_without=group_id,excluded_with=group_id"`
+	GroupID       int    `json:"group_id,omitempty"`
+	Content       string `json:"content" validate:"max=4000,required_without=attachment_ids"`
+	ReplyToID     int    `json:"reply_to_id,omitempty"`
+	AttachmentIDs []int  `json:"attachment_ids,omitempty" validate:"max=10"`
+
+	// ThreadRootID posts into a thread without quoting a message, as the REST API allows
+	ThreadRootID *int `json:"thread_root_id,omitempty"`
+
+	// ClientMsgID deduplicates retries, the sent acknowledgement echoes it
+	ClientMsgID string `json:"client_msg_id,omitempty" validate:"max=64"`
+}
+
+// SentPayload acknowledges a stored chat message, the envelope ref is the id of the message frame
+type SentPayload struct {
+	MessageID   int       `json:"message_id"`
+	ClientMsgID string    `json:"client_msg_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// MessagePayload is a chat message delivered by the server
+type MessagePayload struct {
+	ID           int                  `json:"id"`
+	SenderID     int                  `json:"sender_id"`
+	SenderName   string               `json:"sender_name"`
+	ReceiverID   int                  `json:"receiver_id,omitempty"`
+	GroupID      int                  `json:"group_id,omitempty"`
+	Content      string               `json:"content"`
+	ReplyToID    int                  `json:"reply_to_id,omitempty"`
+	ReplyTo      *models.ReplyPreview `json:"reply_to,omitempty"`
+	ThreadRootID int                  `json:"thread_root_id,omitempty"`
+	Attachments  []models.Attachment  `json:"attachments,omitempty"`
+	CreatedAt    time.Time            `json:"created_at"`
+}
+
+// MessageUpdatePayload announces an edited or deleted message
+type MessageUpdatePayload struct {
+	MessageID  int        `json:"message_id"`
+	SenderID   int        `json:"sender_id"`
+	ReceiverID int        `json:"receiver_id,omitempty"`
+	GroupID    int        `json:"group_id,omitempty"`
+	Content    string     `json:"content"`
+	EditedAt   *time.Time `json:"edited_at,omitempty"`
+}
+
+// TypingPayload targets a typing indicator, the server fills in the typing user
+type TypingPayload struct {
+	ReceiverID int `json:"receiver_id,omitempty" validate:"required_without=group_id,excluded_with=group_id"`
+	GroupID    int `json:"group_id,omitempty"`
+	UserID     int `json:"user_id,omitempty"`
+}
+
+// PresencePayload is the status a client sets, or the status of a contact sent by the server
+type PresencePayload struct {
+	UserID   int        `json:"user_id,omitempty"`
+	Status   string     `json:"status" validate:"required,oneof=online away"`
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// ReceiptPayload marks messages as read up to MessageID, or tells a sender that UserID
+// received or read their message
+type ReceiptPayload struct {
+	MessageID int        `json:"message_id" validate:"required"`
+	UserID    int        `json:"user_id,omitempty"`
+	GroupID   int        `json:"group_id,omitempty"`
+	At        *time.Time `json:"at,omitempty"`
+}
+
+// ReactionPayload announces a reaction added to or removed from a message
+type ReactionPayload struct {
+	MessageID int    `json:"message_id"`
+	UserID    int    `json:"user_id"`
+	GroupID   int    `json:"group_id,omitempty"`
+	Emoji     string `json:"emoji"`
+}
+
+// ModerationPayload tells a user about a sanction, GroupID is set for sanctions
+// taken by the moderators of a group
+type ModerationPayload struct {
+	Action    string     `json:"action"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	GroupID   int        `json:"group_id,omitempty"`
+}
+
+// ErrorPayload explains why a frame was rejected
+type ErrorPayload struct {
+	Code        string `json:"code"`
+	Message     string `json:"message"`
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+}
+
+// CommandResultPayload answers a slash command, the envelope ref is the id of the message frame
+type CommandResultPayload struct {
+	Command     string                `json:"command"`
+	GroupID     int                   `json:"group_id"`
+	Content     string                `json:"content"`
+	Members     []models.NearbyMember `json:"members,omitempty"`
+	ClientMsgID string                `json:"client_msg_id,omitempty"`
+}
+
+// GroupNoticePayload tells the members of a group that UserID ran a command changing it
+type GroupNoticePayload struct {
+	Command   string    `json:"command"`
+	GroupID   int       `json:"group_id"`
+	UserID    int       `json:"user_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// payloadOf converts a frame to the payload of its type
+func payloadOf(frame WsMessage) interface{} {
+	switch frame.Type {
+	case TypeMessage:
+		return MessagePayload{
+			ID:           frame.ID,
+			SenderID:     frame.SenderID,
+			SenderName:   frame.SenderName,
+			ReceiverID:   frame.ReceiverID,
+			GroupID:      frame.GroupID,
+			Content:      frame.Content,
+			ReplyToID:    frame.ReplyToID,
+			ReplyTo:      frame.ReplyTo,
+			ThreadRootID: frame.ThreadRootID,
+			Attachments:  frame.Attachments,
+			CreatedAt:    frame.CreatedAt,
+		}
+	case TypeMessageEdited, TypeMessageDeleted:
+		return MessageUpdatePayload{
+			MessageID:  frame.MessageID,
+			SenderID:   frame.SenderID,
+			ReceiverID: frame.ReceiverID,
+			GroupID:    frame.GroupID,
+			Content:    frame.Content,
+			EditedAt:   frame.EditedAt,
+		}
+	case TypeTypingStart, TypeTypingStop:
+		return TypingPayload{ReceiverID: frame.ReceiverID, GroupID: frame.GroupID, UserID: frame.SenderID}
+	case TypePresence:
+		return PresencePayload{UserID: frame.SenderID, Status: frame.Status, LastSeen: frame.LastSeen}
+	case TypeDelivered, TypeRead:
+		at := frame.CreatedAt
+		return ReceiptPayload{MessageID: frame.MessageID, UserID: frame.SenderID, GroupID: frame.GroupID, At: &at}
+	case TypeReactionAdded, TypeReactionRemoved:
+		return ReactionPayload{MessageID: frame.MessageID, UserID: frame.SenderID, GroupID: frame.GroupID, Emoji: frame.Emoji}
+	case TypeModeration:
+		return ModerationPayload{Action: frame.Status, Reason: frame.Content, ExpiresAt: frame.ExpiresAt, GroupID: frame.GroupID}
+	case TypeSent:
+		return SentPayload{MessageID: frame.MessageID, ClientMsgID: frame.ClientMsgID, CreatedAt: frame.CreatedAt}
+	case TypeError:
+		return ErrorPayload{Code: frame.Code, Message: frame.Content, ClientMsgID: frame.ClientMsgID}
+	case TypeCommandResult:
+		return CommandResultPayload{Command: frame.Command, GroupID: frame.GroupID, Content: frame.Content, Members: frame.Members, ClientMsgID: frame.ClientMsgID}
+	case TypeGroupNotice:
+		return GroupNoticePayload{Command: frame.Command, GroupID: frame.GroupID, UserID: frame.SenderID, Content: frame.Content, CreatedAt: frame.CreatedAt}
+	}
+	return frame
+}
+
+// messageOf converts a client envelope to the WsMessage handled by the read loop
+func messageOf(env Envelope) (WsMessage, error) {
+	msg := WsMessage{Type: env.Type, Ref: env.ID}
+
+	switch env.Type {
+	case TypeMessage:
+		var payload SendPayload
+		if err := decodePayload(env, &payload); err != nil {
+			return msg, err
+		}
+		msg.ReceiverID = payload.ReceiverID
+		msg.GroupID = payload.GroupID
+		msg.Content = payload.Content
+		msg.ReplyToID = payload.ReplyToID
+		msg.AttachmentIDs = payload.AttachmentIDs
+		msg.ClientMsgID = payload.ClientMsgID
+		if payload.ThreadRootID != nil {
+			msg.ThreadRootID = *payload.ThreadRootID
+		}
+	case TypeTypingStart, TypeTypingStop:
+		var payload TypingPayload
+		if err := decodePayload(env, &payload); err != nil {
+			return msg, err
+		}
+		msg.ReceiverID = payload.ReceiverID
+		msg.GroupID = payload.GroupID
+	case TypePresence:
+		var payload PresencePayload
+		if err := decodePayload(env, &payload); err != nil {
+			return msg, err
+		}
+		msg.Status = payload.Status
+	case TypeRead:
+		var payload ReceiptPayload
+		if err := decodePayload(env, &payload); err != nil {
+			return msg, err
+		}
+		msg.MessageID = payload.MessageID
+	default:
+		return msg, protocolError("Clients cannot send %s frames", env.Type)
+	}
+	return msg, nil
+}
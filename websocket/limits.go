@@ -0,0 +1,75 @@
+package websocket
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/ratelimit"
+	"github.com/gorilla/websocket"
+)
+
+// Connections that keep exceeding their limits are closed
+const (
+	maxRateLimitViolations   = 20
+	rateLimitViolationWindow = time.Minute
+)
+
+// frameRules picks the rate limit of each frame type, everything else counts as a chat message
+var frameRules = map[string]ratelimit.Rule{
+	TypeTypingStart: ratelimit.RuleTypingFrame,
+	TypeTypingStop:  ratelimit.RuleTypingFrame,
+	TypePresence:    ratelimit.RulePresenceFrame,
+	TypeRead:        ratelimit.RuleReadFrame,
+}
+
+// frameLimiter rate limits the frames read from one connection, the limits are shared by the devices of a user.
+// Bots get the limits of the bot API instead, so a bot has the same budget on every transport.
+type frameLimiter struct {
+	userID      string
+	bot         bool
+	violations  int
+	windowStart time.Time
+}
+
+// rule returns the rate limit of a frame type and the key of its bucket
+func (l *frameLimiter) rule(frameType string) (ratelimit.Rule, string) {
+	rule, ok := frameRules[frameType]
+	if l.bot {
+		// Keyed like RequireBot so frames and REST requests of a bot draw from the same buckets
+		if ok {
+			return ratelimit.RuleBot, ratelimit.RuleBot.Name + ":bot:" + l.userID
+		}
+		return ratelimit.RuleBotMessage, ratelimit.RuleBotMessage.Name + ":bot:" + l.userID
+	}
+	if !ok {
+		rule = ratelimit.RuleChatFrame
+	}
+	return rule, rule.Name + ":user:" + l.userID
+}
+
+// allow reports whether a frame may be handled. Refused frames get an error frame,
+// and the connection is closed once the client ignores too many of them.
+func (l *frameLimiter) allow(c *Client, ref string, frameType string) bool {
+	rule, key := l.rule(frameType)
+	result := ratelimit.Allow(ctx, key, rule)
+	if result.Allowed {
+		return true
+	}
+
+	if time.Since(l.windowStart) > rateLimitViolationWindow {
+		l.violations = 0
+		l.windowStart = time.Now()
+	}
+	l.violations++
+
+	if l.violations > maxRateLimitViolations {
+		log.Printf("Disconnecting user %s after %d rate limit violations", l.userID, l.violations)
+		c.close(websocket.ClosePolicyViolation, "rate limit exceeded")
+		return false
+	}
+
+	sendError(c, ref, apierror.CodeRateLimited, fmt.Sprintf("Too many %s frames, retry in %ds", frameType, ratelimit.RetryAfterSeconds(result.RetryAfter)))
+	return false
+}
@@ -0,0 +1,64 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/ratelimit"
+)
+
+func TestFrameLimiterRule(t *testing.T) {
+	tests := []struct {
+		name      string
+		bot       bool
+		frameType string
+		wantRule  ratelimit.Rule
+		wantKey   string
+	}{
+		{name: "user message", frameType: TypeMessage, wantRule: ratelimit.RuleChatFrame, wantKey: "ws_message:user:7"},
+		{name: "user typing", frameType: TypeTypingStart, wantRule: ratelimit.RuleTypingFrame, wantKey: "ws_typing:user:7"},
+		{name: "user read", frameType: TypeRead, wantRule: ratelimit.RuleReadFrame, wantKey: "ws_read:user:7"},
+		{name: "bot message", bot: true, frameType: TypeMessage, wantRule: ratelimit.RuleBotMessage, wantKey: "bot_message:bot:7"},
+		{name: "bot delivery receipt", bot: true, frameType: TypeDelivered, wantRule: ratelimit.RuleBotMessage, wantKey: "bot_message:bot:7"},
+		{name: "bot typing", bot: true, frameType: TypeTypingStop, wantRule: ratelimit.RuleBot, wantKey: "bot:bot:7"},
+		{name: "bot presence", bot: true, frameType: TypePresence, wantRule: ratelimit.RuleBot, wantKey: "bot:bot:7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := frameLimiter{userID: "7", bot: tt.bot}
+			rule, key := l.rule(tt.frameType)
+			if rule != tt.wantRule || key != tt.wantKey {
+				t.Errorf("rule(%q) = %v, %q, want %v, %q", tt.frameType, rule, key, tt.wantRule, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestFrameLimiterSharesTheBotBudget(t *testing.T) {
+	previous := ratelimit.Default
+	ratelimit.Default = ratelimit.NewMemoryLimiter()
+	t.Cleanup(func() { ratelimit.Default = previous })
+
+	// The bot used up its message budget through the REST API
+	for range ratelimit.RuleBotMessage.Burst {
+		ratelimit.Allow(ctx, "bot_message:bot:9", ratelimit.RuleBotMessage)
+	}
+
+	c := newClient("9", defaultDevice, &recordingTransport{}, legacySession, "", "")
+	bot := frameLimiter{userID: "9", bot: true, windowStart: time.Now()}
+	if bot.allow(c, "1", TypeMessage) {
+		t.Fatal("allow() = true for a bot without budget")
+	}
+	frames := queued(c)
+	if len(frames) != 1 || frames[0].Type != TypeError || frames[0].Code != apierror.CodeRateLimited || frames[0].Ref != "1" {
+		t.Fatalf("queued frames = %+v, want one rate limited error", frames)
+	}
+
+	// A human with the same id has their own buckets
+	human := frameLimiter{userID: "9", windowStart: time.Now()}
+	if !human.allow(c, "2", TypeMessage) {
+		t.Error("allow() = false for a user")
+	}
+}
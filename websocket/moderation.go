@@ -0,0 +1,40 @@
+package websocket
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// sendError tells a client its frame was rejected, ref is the id of that frame in envelope sessions
+func sendError(c *Client, ref string, code string, message string) {
+	c.send(WsMessage{Type: TypeError, Code: code, Content: message, Ref: ref, CreatedAt: time.Now()})
+}
+
+// SendToUser delivers a server generated frame to a user, queueing it if they are offline
+func SendToUser(userID int, frame WsMessage) {
+	if frame.CreatedAt.IsZero() {
+		frame.CreatedAt = time.Now()
+	}
+	deliver(fmt.Sprint(userID), frame)
+}
+
+// DisconnectUser closes the connections of every device of a user, for instance when their
+// account is suspended. The read loops notice the closed connections and run the usual cleanup.
+func DisconnectUser(userID int, reason string) {
+	for _, c := range userClients(fmt.Sprint(userID)) {
+		c.close(websocket.ClosePolicyViolation, reason)
+	}
+}
+
+// closeWithReason sends a close frame with a status code and a reason before closing the connection.
+// Control frames may be written while the client writer is sending a frame.
+func closeWithReason(conn *websocket.Conn, code int, reason string) {
+	err := conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	if err != nil {
+		log.Printf("Error sending close frame to %s: %v", conn.RemoteAddr(), err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,170 @@
+package websocket
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+)
+
+// Presence statuses carried in the status field of presence frames
+const (
+	PresenceOnline   = "online"
+	PresenceAway     = "away"
+	PresenceOffline  = "offline"
+	PresenceLastSeen = "last_seen"
+)
+
+// presenceAudience returns everyone who should hear about a user's presence: their direct
+// message partners and the members of the groups they joined, except users who blocked them
+// or whom they blocked
+func presenceAudience(userID string) []string {
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil
+	}
+
+	var audience []string
+	for _, contactID := range presenceContacts(userID) {
+		otherID, err := strconv.Atoi(contactID)
+		if err != nil {
+			continue
+		}
+		blocked, err := database.IsBlocked(ctx, id, otherID)
+		if err != nil {
+			log.Printf("Error checking blocks between users %d and %d: %v", id, otherID, err)
+			continue
+		}
+		if !blocked {
+			audience = append(audience, contactID)
+		}
+	}
+	return audience
+}
+
+// presenceContacts returns the direct message partners of a user and the members of their groups
+func presenceContacts(userID string) []string {
+	seen := map[string]bool{userID: true}
+	var audience []string
+
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			audience = append(audience, id)
+		}
+	}
+
+	query := `SELECT DISTINCT CASE WHEN sender_id = $1 THEN receiver_id ELSE sender_id END
+	          FROM messages
+	          WHERE receiver_id IS NOT NULL AND (sender_id = $1 OR receiver_id = $1)`
+	rows, err := database.DB.Query(ctx, query, userID)
+	if err != nil {
+		log.Printf("Error fetching direct message partners for user %s: %v", userID, err)
+	} else {
+		for rows.Next() {
+			var partnerID int
+			if err := rows.Scan(&partnerID); err == nil {
+				add(strconv.Itoa(partnerID))
+			}
+		}
+		rows.Close()
+	}
+
+	groups, err := database.RedisClient.SMembers(ctx, fmt.Sprintf("user_groups:%s", userID)).Result()
+	if err != nil {
+		log.Printf("Error fetching groups for user %s: %v", userID, err)
+		return audience
+	}
+
+	for _, groupID := range groups {
+		members, err := database.RedisClient.SMembers(ctx, fmt.Sprintf("group:%s", groupID)).Result()
+		if err != nil {
+			log.Printf("Error fetching members of group %s: %v", groupID, err)
+			continue
+		}
+		for _, memberID := range members {
+			add(memberID)
+		}
+	}
+
+	return audience
+}
+
+// broadcastPresence pushes a presence frame to every connected contact of the user
+func broadcastPresence(userID string, status string, lastSeen *time.Time) {
+	senderID, _ := strconv.Atoi(userID)
+
+	if status == PresenceOffline {
+		database.RedisClient.HDel(ctx, "presence", userID)
+	} else {
+		database.RedisClient.HSet(ctx, "presence", userID, status)
+	}
+
+	frame := WsMessage{
+		Type:      TypePresence,
+		SenderID:  senderID,
+		Status:    status,
+		LastSeen:  lastSeen,
+		CreatedAt: time.Now(),
+	}
+
+	for _, contactID := range presenceAudience(userID) {
+		sendLive(contactID, frame)
+	}
+}
+
+// sendPresenceSnapshot tells a freshly connected device the current status of each contact,
+// offline contacts are reported as last_seen with the time they were last active
+func sendPresenceSnapshot(userID string, c *Client) {
+	audience := presenceAudience(userID)
+	if len(audience) == 0 {
+		return
+	}
+
+	statuses, err := database.RedisClient.HMGet(ctx, "presence", audience...).Result()
+	if err != nil {
+		log.Printf("Error fetching presence for contacts of user %s: %v", userID, err)
+		return
+	}
+
+	for i, contactID := range audience {
+		id, err := strconv.Atoi(contactID)
+		if err != nil {
+			continue
+		}
+
+		frame := WsMessage{Type: TypePresence, SenderID: id, CreatedAt: time.Now()}
+		if status, ok := statuses[i].(string); ok {
+			frame.Status = status
+		} else {
+			var lastActive time.Time
+			err := database.DB.QueryRow(ctx, "SELECT last_active FROM users WHERE id = $1", id).Scan(&lastActive)
+			if err != nil {
+				continue
+			}
+			frame.Status = PresenceLastSeen
+			frame.LastSeen = &lastActive
+		}
+
+		if !c.send(frame) {
+			return
+		}
+	}
+}
+
+// handlePresenceUpdate lets a client switch between online and away
+func handlePresenceUpdate(userID string, msg WsMessage) {
+	if msg.Status != PresenceOnline && msg.Status != PresenceAway {
+		log.Printf("Ignoring presence status %q from user %s", msg.Status, userID)
+		return
+	}
+
+	_, err := database.DB.Exec(ctx, "UPDATE users SET last_active = NOW() WHERE id = $1", userID)
+	if err != nil {
+		log.Printf("Error updating last active for user %s: %v", userID, err)
+	}
+
+	broadcastPresence(userID, msg.Status, nil)
+}
@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+)
+
+// chat stores a direct message so two users become presence contacts
+func chat(t *testing.T, senderID int, receiverID int) {
+	t.Helper()
+
+	if _, err := database.DB.Exec(context.Background(), "INSERT INTO messages (sender_id, receiver_id, content) VALUES ($1, $2, 'hi')", senderID, receiverID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandlePresenceUpdate(t *testing.T) {
+	server := testenv.Postgres(t)
+
+	user := testenv.CreateUser(t)
+	partner := testenv.CreateUser(t)
+	chat(t, partner, user)
+	devices := connect(t, partner)
+
+	tests := []struct {
+		name   string
+		status string
+		want   string
+	}{
+		{"online", PresenceOnline, PresenceOnline},
+		{"away", PresenceAway, PresenceAway},
+		{"offline is set by disconnecting", PresenceOffline, ""},
+		{"unknown status", "busy", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.HDel("presence", strconv.Itoa(user))
+			handlePresenceUpdate(strconv.Itoa(user), WsMessage{Type: TypePresence, Status: tt.status})
+
+			frames := queued(devices[partner])
+			stored := server.HGet("presence", strconv.Itoa(user))
+			if tt.want == "" {
+				if len(frames) != 0 || stored != "" {
+					t.Errorf("partner got %+v and the status is %q, want nothing", frames, stored)
+				}
+				return
+			}
+			if len(frames) != 1 || frames[0].Type != TypePresence || frames[0].SenderID != user || frames[0].Status != tt.want {
+				t.Errorf("partner got %+v, want a %s presence frame", frames, tt.want)
+			}
+			if stored != tt.want {
+				t.Errorf("stored status = %q, want %q", stored, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendPresenceSnapshot(t *testing.T) {
+	server := testenv.Postgres(t)
+
+	user := testenv.CreateUser(t)
+	online := testenv.CreateUser(t)
+	offline := testenv.CreateUser(t)
+	chat(t, user, online)
+	chat(t, offline, user)
+
+	lastActive := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	if _, err := database.DB.Exec(context.Background(), "UPDATE users SET last_active = $2 WHERE id = $1", offline, lastActive); err != nil {
+		t.Fatal(err)
+	}
+	server.HSet("presence", strconv.Itoa(online), PresenceAway)
+
+	c := newClient(strconv.Itoa(user), defaultDevice, &recordingTransport{}, legacySession, "", "")
+	sendPresenceSnapshot(c.userID, c)
+
+	statuses := map[int]WsMessage{}
+	for _, frame := range queued(c) {
+		statuses[frame.SenderID] = frame
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("snapshot = %+v, want the two contacts", statuses)
+	}
+	if frame := statuses[online]; frame.Status != PresenceAway || frame.LastSeen != nil {
+		t.Errorf("online contact = %+v, want away", frame)
+	}
+	if frame := statuses[offline]; frame.Status != PresenceLastSeen || frame.LastSeen == nil || !frame.LastSeen.Equal(lastActive) {
+		t.Errorf("offline contact = %+v, want last seen at %v", frame, lastActive)
+	}
+}
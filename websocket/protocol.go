@@ -0,0 +1,292 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/validation"
+	"github.com/gorilla/websocket"
+)
+
+// Subprotocol is offered by clients that speak the envelope protocol
+const Subprotocol = "proxychat"
+
+// Protocol versions
+//
+// Version 1 is the legacy protocol spoken by clients that connect without a subprotocol:
+// every frame is a flat WsMessage. It is frozen, it keeps working but gets no new frame types
+// or fields, and new clients should not use it.
+//
+// Version 2 wraps every frame in an Envelope carrying an explicit type, a frame id, the
+// protocol version and a typed payload. Clients request it by offering the "proxychat"
+// subprotocol, then send a hello frame listing the versions they speak and the optional
+// features they want. The server answers with a welcome frame naming the highest common
+// version and the accepted features, and closes the connection when there is none or when
+// the hello does not arrive in time. Frames of features that were not negotiated are
+// neither sent nor accepted.
+//
+// Frames sent by clients are checked strictly: unknown types, unknown payload fields, a
+// version other than the negotiated one and frames with both a receiver_id and a group_id
+// are rejected with an error frame whose ref is the id of the offending frame.
+//
+// Compatibility: within a version, payloads only gain fields and new frame types only come
+// behind a feature, so clients must ignore fields they do not know. Changes that would break
+// clients get a new version, and the server keeps accepting the previous one for at least
+// six months after the new one ships.
+const (
+	ProtocolLegacy   = 1
+	ProtocolEnvelope = 2
+)
+
+// supportedVersions lists the envelope versions the server speaks, newest last
+var supportedVersions = []int{ProtocolEnvelope}
+
+// helloTimeout bounds the wait for the hello frame of envelope connections
+const helloTimeout = 10 * time.Second
+
+// Handshake frame types
+const (
+	TypeHello   = "hello"
+	TypeWelcome = "welcome"
+)
+
+// Optional features, chat messages, edits, deletions, moderation and errors are always on
+const (
+	FeatureTyping    = "typing"
+	FeaturePresence  = "presence"
+	FeatureReceipts  = "receipts"
+	FeatureReactions = "reactions"
+	FeatureCommands  = "commands"
+)
+
+var supportedFeatures = []string{FeatureTyping, FeaturePresence, FeatureReceipts, FeatureReactions, FeatureCommands}
+
+// frameFeatures maps the frame types of optional features to the feature they belong to
+var frameFeatures = map[string]string{
+	TypeTypingStart:     FeatureTyping,
+	TypeTypingStop:      FeatureTyping,
+	TypePresence:        FeaturePresence,
+	TypeDelivered:       FeatureReceipts,
+	TypeRead:            FeatureReceipts,
+	TypeReactionAdded:   FeatureReactions,
+	TypeReactionRemoved: FeatureReactions,
+	TypeCommandResult:   FeatureCommands,
+	TypeGroupNotice:     FeatureCommands,
+}
+
+// Envelope is a version 2 frame
+type Envelope struct {
+	Version int    `json:"version"`
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+
+	// Ref is the id of the client frame a server frame answers, such as the hello of a welcome
+	Ref     string          `json:"ref,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// session holds what was negotiated on a connection
+type session struct {
+	version  int
+	features map[string]bool
+
+	// seq numbers the frames sent by the server
+	seq atomic.Int64
+}
+
+var legacySession = &session{version: ProtocolLegacy}
+
+// accepts reports whether frames of a type may be exchanged on the session
+func (s *session) accepts(frameType string) bool {
+	feature, optional := frameFeatures[frameType]
+	return s.version == ProtocolLegacy || !optional || s.features[feature]
+}
+
+// envelope wraps a frame for a version 2 session
+func (s *session) envelope(frame WsMessage) (Envelope, error) {
+	payload, err := json.Marshal(payloadOf(frame))
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{
+		Version: s.version,
+		Type:    frame.Type,
+		ID:      strconv.FormatInt(s.seq.Add(1), 10),
+		Ref:     frame.Ref,
+		Payload: payload,
+	}, nil
+}
+
+// encode converts a frame to what is written on a connection of the session
+func (s *session) encode(frame WsMessage) (interface{}, error) {
+	if s.version == ProtocolLegacy {
+		return frame, nil
+	}
+	return s.envelope(frame)
+}
+
+// handshake runs the hello and welcome exchange of envelope connections. Legacy connections
+// skip it. Failed handshakes are answered with an error frame and a close frame. It runs
+// before the client writer starts, so it writes to the connection directly.
+func handshake(conn *websocket.Conn, userID int) (*session, error) {
+	if conn.Subprotocol() != Subprotocol {
+		return legacySession, nil
+	}
+
+	s := &session{version: supportedVersions[len(supportedVersions)-1], features: make(map[string]bool)}
+	fail := func(ref string, code string, message string) error {
+		if env, err := s.envelope(WsMessage{Type: TypeError, Code: code, Content: message, Ref: ref}); err == nil {
+			conn.WriteJSON(env)
+		}
+		closeWithReason(conn, websocket.CloseProtocolError, message)
+		return errors.New(message)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	var env Envelope
+	err := conn.ReadJSON(&env)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("reading hello: %w", err)
+	}
+	if env.Type != TypeHello {
+		return nil, fail(env.ID, apierror.CodeProtocol, "The first frame must be a hello")
+	}
+
+	var hello HelloPayload
+	if err := decodePayload(env, &hello); err != nil {
+		var invalid *apierror.Error
+		errors.As(err, &invalid)
+		return nil, fail(env.ID, invalid.Code, invalid.Message)
+	}
+
+	// Pick the highest version both sides speak
+	version := 0
+	for _, supported := range supportedVersions {
+		if slices.Contains(hello.Versions, supported) {
+			version = supported
+		}
+	}
+	if version == 0 {
+		return nil, fail(env.ID, apierror.CodeUnsupportedVersion, fmt.Sprintf("Supported versions: %v", supportedVersions))
+	}
+	s.version = version
+	s.features = negotiateFeatures(hello.Features)
+
+	welcome, err := s.welcome(userID, env.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.WriteJSON(welcome); err != nil {
+		return nil, fmt.Errorf("sending welcome: %w", err)
+	}
+
+	log.Printf("User %d negotiated protocol %d with features %v (client %q)", userID, s.version, s.featureList(), hello.Client)
+	return s, nil
+}
+
+// negotiateFeatures keeps the requested features the server supports
+func negotiateFeatures(requested []string) map[string]bool {
+	features := make(map[string]bool)
+	for _, feature := range supportedFeatures {
+		if slices.Contains(requested, feature) {
+			features[feature] = true
+		}
+	}
+	return features
+}
+
+// featureList returns the features enabled on the session, legacy sessions have all of them
+func (s *session) featureList() []string {
+	features := []string{}
+	for _, feature := range supportedFeatures {
+		if s.version == ProtocolLegacy || s.features[feature] {
+			features = append(features, feature)
+		}
+	}
+	return features
+}
+
+// welcome builds the frame telling a client what was negotiated, ref is the id of its hello
+func (s *session) welcome(userID int, ref string) (Envelope, error) {
+	payload, err := json.Marshal(WelcomePayload{Version: s.version, Features: s.featureList(), UserID: userID, ServerTime: time.Now()})
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{Version: s.version, Type: TypeWelcome, ID: strconv.FormatInt(s.seq.Add(1), 10), Ref: ref, Payload: payload}, nil
+}
+
+// readFrame reads the next client frame and converts it to a WsMessage. The returned ref
+// identifies the frame in error replies. Frames that break the protocol return an
+// *apierror.Error, the connection stays usable.
+func readFrame(conn *websocket.Conn, s *session) (WsMessage, string, error) {
+	var msg WsMessage
+	if s.version == ProtocolLegacy {
+		err := conn.ReadJSON(&msg)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			return msg, "", protocolError("Malformed frame")
+		}
+		return msg, "", err
+	}
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return msg, "", err
+	}
+
+	var env Envelope
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&env); err != nil {
+		return msg, "", protocolError("Malformed envelope")
+	}
+	return decodeEnvelope(s, env)
+}
+
+// decodeEnvelope checks a client envelope against the session and converts it to a WsMessage
+func decodeEnvelope(s *session, env Envelope) (WsMessage, string, error) {
+	var msg WsMessage
+	if env.ID == "" || len(env.ID) > 64 {
+		return msg, env.ID, protocolError("Frames need an id of at most 64 characters")
+	}
+	if env.Version != s.version {
+		return msg, env.ID, protocolError("Frame version %d does not match the negotiated version %d", env.Version, s.version)
+	}
+	if !s.accepts(env.Type) {
+		return msg, env.ID, protocolError("Feature %s was not negotiated", frameFeatures[env.Type])
+	}
+
+	msg, err := messageOf(env)
+	return msg, env.ID, err
+}
+
+// decodePayload strictly decodes and validates the payload of a client frame
+func decodePayload(env Envelope, dst interface{}) error {
+	if len(env.Payload) == 0 {
+		return protocolError("%s frames need a payload", env.Type)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(env.Payload))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return protocolError("Invalid %s payload: %v", env.Type, err)
+	}
+	return validation.Struct(dst)
+}
+
+// protocolError rejects a frame that breaks the protocol
+func protocolError(format string, args ...interface{}) *apierror.Error {
+	return apierror.New(http.StatusBadRequest, apierror.CodeProtocol, fmt.Sprintf(format, args...))
+}
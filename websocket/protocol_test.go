@@ -0,0 +1,156 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/clementus360/proxy-chat/apierror"
+)
+
+func TestDecodeEnvelope(t *testing.T) {
+	s := &session{version: ProtocolEnvelope, features: map[string]bool{FeatureTyping: true}}
+
+	tests := []struct {
+		name    string
+		env     Envelope
+		want    WsMessage
+		wantErr bool
+	}{
+		{
+			name: "message",
+			env:  Envelope{Version: 2, Type: TypeMessage, ID: "1", Payload: json.RawMessage(`{"group_id": 4, "content": "hi", "reply_to_id": 7, "client_msg_id": "a"}`)},
+			want: WsMessage{Type: TypeMessage, Ref: "1", GroupID: 4, Content: "hi", ReplyToID: 7, ClientMsgID: "a"},
+		},
+		{
+			name: "message in a thread",
+			env:  Envelope{Version: 2, Type: TypeMessage, ID: "2", Payload: json.RawMessage(`{"receiver_id": 3, "content": "hi", "thread_root_id": 12}`)},
+			want: WsMessage{Type: TypeMessage, Ref: "2", ReceiverID: 3, Content: "hi", ThreadRootID: 12},
+		},
+		{
+			name: "negotiated feature",
+			env:  Envelope{Version: 2, Type: TypeTypingStart, ID: "3", Payload: json.RawMessage(`{"receiver_id": 3}`)},
+			want: WsMessage{Type: TypeTypingStart, Ref: "3", ReceiverID: 3},
+		},
+		{
+			name:    "feature not negotiated",
+			env:     Envelope{Version: 2, Type: TypeRead, ID: "4", Payload: json.RawMessage(`{"message_id": 3}`)},
+			wantErr: true,
+		},
+		{
+			name:    "missing id",
+			env:     Envelope{Version: 2, Type: TypeMessage, Payload: json.RawMessage(`{"receiver_id": 3, "content": "hi"}`)},
+			wantErr: true,
+		},
+		{
+			name:    "other version",
+			env:     Envelope{Version: 1, Type: TypeMessage, ID: "5", Payload: json.RawMessage(`{"receiver_id": 3, "content": "hi"}`)},
+			wantErr: true,
+		},
+		{
+			name:    "server frame",
+			env:     Envelope{Version: 2, Type: TypeSent, ID: "6", Payload: json.RawMessage(`{}`)},
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			env:     Envelope{Version: 2, Type: TypeMessage, ID: "7", Payload: json.RawMessage(`{"receiver_id": 3, "content": "hi", "color": "red"}`)},
+			wantErr: true,
+		},
+		{
+			name:    "receiver and group",
+			env:     Envelope{Version: 2, Type: TypeMessage, ID: "8", Payload: json.RawMessage(`{"receiver_id": 3, "group_id": 4, "content": "hi"}`)},
+			wantErr: true,
+		},
+		{
+			name:    "missing payload",
+			env:     Envelope{Version: 2, Type: TypeMessage, ID: "9"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, ref, err := decodeEnvelope(s, tt.env)
+			if ref != tt.env.ID {
+				t.Errorf("ref = %q, want %q", ref, tt.env.ID)
+			}
+			if tt.wantErr {
+				var invalid *apierror.Error
+				if !errors.As(err, &invalid) {
+					t.Fatalf("error = %v, want an *apierror.Error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type != tt.want.Type || msg.Ref != tt.want.Ref || msg.ReceiverID != tt.want.ReceiverID || msg.GroupID != tt.want.GroupID ||
+				msg.Content != tt.want.Content || msg.ReplyToID != tt.want.ReplyToID || msg.ThreadRootID != tt.want.ThreadRootID || msg.ClientMsgID != tt.want.ClientMsgID {
+				t.Errorf("message = %+v, want %+v", msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegotiateFeatures(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested []string
+		want      []string
+	}{
+		{"none", nil, []string{}},
+		{"supported", []string{FeatureReceipts, FeatureTyping}, []string{FeatureTyping, FeatureReceipts}},
+		{"unknown features are dropped", []string{"telepathy", FeatureCommands}, []string{FeatureCommands}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &session{version: ProtocolEnvelope, features: negotiateFeatures(tt.requested)}
+			if got := s.featureList(); !slices.Equal(got, tt.want) {
+				t.Errorf("features = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionAccepts(t *testing.T) {
+	envelope := &session{version: ProtocolEnvelope, features: map[string]bool{FeatureReactions: true}}
+
+	tests := []struct {
+		s         *session
+		frameType string
+		want      bool
+	}{
+		{legacySession, TypeTypingStart, true},
+		{legacySession, TypeCommandResult, true},
+		{envelope, TypeMessage, true},
+		{envelope, TypeError, true},
+		{envelope, TypeReactionAdded, true},
+		{envelope, TypeTypingStart, false},
+		{envelope, TypeCommandResult, false},
+	}
+	for _, tt := range tests {
+		if got := tt.s.accepts(tt.frameType); got != tt.want {
+			t.Errorf("version %d accepts(%s) = %v, want %v", tt.s.version, tt.frameType, got, tt.want)
+		}
+	}
+}
+
+func TestEnvelopeNumbersFrames(t *testing.T) {
+	s := &session{version: ProtocolEnvelope}
+
+	for i, want := range []string{"1", "2", "3"} {
+		env, err := s.envelope(WsMessage{Type: TypeSent, MessageID: i, Ref: "c" + want})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env.ID != want || env.Ref != "c"+want || env.Version != ProtocolEnvelope {
+			t.Errorf("envelope = %+v, want id %s", env, want)
+		}
+
+		var payload SentPayload
+		if err := json.Unmarshal(env.Payload, &payload); err != nil || payload.MessageID != i {
+			t.Errorf("payload = %s (%v)", env.Payload, err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/models"
+)
+
+// saveMessage persists a chat frame so receipts can refer to its id
+func saveMessage(msg *WsMessage) error {
+	message := models.Message{
+		Content:       msg.Content,
+		GroupID:       msg.GroupID,
+		SenderID:      msg.SenderID,
+		ReceiverID:    msg.ReceiverID,
+		ReplyToID:     msg.ReplyToID,
+		ThreadRootID:  msg.ThreadRootID,
+		AttachmentIDs: msg.AttachmentIDs,
+		ClientMsgID:   msg.ClientMsgID,
+	}
+
+	// Duplicates come back as the stored message along with the error
+	err := database.InsertMessage(ctx, &message)
+	if err != nil && !errors.Is(err, database.ErrDuplicateMessage) {
+		return err
+	}
+
+	msg.ID = message.ID
+	msg.ThreadRootID = message.ThreadRootID
+	msg.ReplyTo = message.ReplyTo
+	msg.Attachments = message.Attachments
+	msg.CreatedAt = message.CreatedAt
+	return err
+}
+
+// acknowledge tells the sender a chat frame was stored, with the id and time it was given.
+// Legacy clients only get acknowledgements for frames carrying a client_msg_id.
+func acknowledge(c *Client, msg WsMessage) {
+	if c.session.version == ProtocolLegacy && msg.ClientMsgID == "" {
+		return
+	}
+
+	frame := WsMessage{
+		Type:        TypeSent,
+		ID:          msg.ID,
+		MessageID:   msg.ID,
+		SenderID:    msg.SenderID,
+		ClientMsgID: msg.ClientMsgID,
+		Ref:         msg.Ref,
+		CreatedAt:   msg.CreatedAt,
+	}
+	c.send(frame)
+}
+
+// rejectMessage tells the sender a chat frame was not stored, echoing its client_msg_id
+func rejectMessage(c *Client, msg WsMessage, code string, message string) {
+	c.send(WsMessage{Type: TypeError, Code: code, Content: message, ClientMsgID: msg.ClientMsgID, Ref: msg.Ref, CreatedAt: time.Now()})
+}
+
+// notifyOnline sends a frame to the connected devices of a user, it is not kept for the others
+func notifyOnline(userID int, frame WsMessage) {
+	sendLive(fmt.Sprint(userID), frame)
+}
+
+// markDelivered records that a direct message reached its recipient and tells the sender
+func markDelivered(msg WsMessage) {
+	if msg.ID == 0 || msg.ReceiverID == 0 {
+		return
+	}
+
+	var deliveredAt time.Time
+	query := `UPDATE message_receipts SET delivered_at = NOW()
+	          WHERE message_id = $1 AND user_id = $2 AND delivered_at IS NULL
+	          RETURNING delivered_at`
+	err := database.DB.QueryRow(ctx, query, msg.ID, msg.ReceiverID).Scan(&deliveredAt)
+	if err != nil {
+		// No row means the message was already marked as delivered
+		return
+	}
+
+	notifyOnline(msg.SenderID, WsMessage{
+		Type:       TypeDelivered,
+		MessageID:  msg.ID,
+		SenderID:   msg.ReceiverID,
+		ReceiverID: msg.SenderID,
+		CreatedAt:  deliveredAt,
+	})
+}
+
+// handleRead marks messages as read up to msg.MessageID and tells the sender.
+// Direct messages are tracked per recipient, groups keep a last-read pointer per member.
+func handleRead(userID string, msg WsMessage) {
+	readerID, _ := strconv.Atoi(userID)
+	if msg.MessageID == 0 {
+		log.Printf("Ignoring read frame from user %s without a message_id", userID)
+		return
+	}
+
+	var senderID int
+	var receiverID, groupID *int
+	err := database.DB.QueryRow(ctx, "SELECT sender_id, receiver_id, group_id FROM messages WHERE id = $1", msg.MessageID).Scan(&senderID, &receiverID, &groupID)
+	if err != nil {
+		log.Printf("Error fetching message %d for read receipt: %v", msg.MessageID, err)
+		return
+	}
+
+	// Only the receiver of a direct message or a member of its group may read it
+	if groupID != nil {
+		member, err := database.IsGroupMember(ctx, *groupID, readerID)
+		if err != nil {
+			log.Printf("Error checking membership of user %s in group %d: %v", userID, *groupID, err)
+			return
+		}
+		if !member {
+			log.Printf("Ignoring read frame from user %s outside group %d", userID, *groupID)
+			return
+		}
+	} else if receiverID == nil || *receiverID != readerID {
+		log.Printf("Ignoring read frame from user %s for message %d sent to someone else", userID, msg.MessageID)
+		return
+	}
+
+	readAt := time.Now()
+	frame := WsMessage{
+		Type:       TypeRead,
+		MessageID:  msg.MessageID,
+		SenderID:   readerID,
+		ReceiverID: senderID,
+		CreatedAt:  readAt,
+	}
+
+	if groupID != nil {
+		query := `INSERT INTO group_read_pointers (group_id, user_id, last_read_message_id, updated_at)
+		          VALUES ($1, $2, $3, $4)
+		          ON CONFLICT (group_id, user_id) DO UPDATE
+		          SET last_read_message_id = GREATEST(group_read_pointers.last_read_message_id, EXCLUDED.last_read_message_id),
+		              updated_at = EXCLUDED.updated_at`
+		_, err = database.DB.Exec(ctx, query, *groupID, readerID, msg.MessageID, readAt)
+		if err != nil {
+			log.Printf("Error updating read pointer of user %s in group %d: %v", userID, *groupID, err)
+			return
+		}
+		frame.GroupID = *groupID
+	} else {
+		// Reading a message implies every earlier message from the same sender was read too
+		query := `UPDATE message_receipts r SET read_at = $3, delivered_at = COALESCE(r.delivered_at, $3)
+		          FROM messages m
+		          WHERE r.message_id = m.id AND r.user_id = $1 AND r.read_at IS NULL
+		            AND m.sender_id = $2 AND m.id <= $4`
+		tag, err := database.DB.Exec(ctx, query, readerID, senderID, readAt, msg.MessageID)
+		if err != nil {
+			log.Printf("Error marking messages as read for user %s: %v", userID, err)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			return
+		}
+	}
+
+	// Senders who blocked the reader are not told, nor are senders the reader blocked
+	if senderID != readerID && !hasBlocked(strconv.Itoa(senderID), readerID) && !hasBlocked(userID, senderID) {
+		notifyOnline(senderID, frame)
+	}
+}
@@ -0,0 +1,132 @@
+package websocket
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+	"github.com/clementus360/proxy-chat/models"
+)
+
+func TestAcknowledge(t *testing.T) {
+	envelope := &session{version: ProtocolEnvelope, features: map[string]bool{}}
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		session *session
+		msg     WsMessage
+		wantAck bool
+	}{
+		{"envelope", envelope, WsMessage{ID: 5, SenderID: 1, Ref: "f1", CreatedAt: createdAt}, true},
+		{"envelope with client id", envelope, WsMessage{ID: 5, SenderID: 1, Ref: "f1", ClientMsgID: "c1", CreatedAt: createdAt}, true},
+		{"legacy with client id", legacySession, WsMessage{ID: 5, SenderID: 1, ClientMsgID: "c1", CreatedAt: createdAt}, true},
+		{"legacy without client id", legacySession, WsMessage{ID: 5, SenderID: 1, CreatedAt: createdAt}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient("1", defaultDevice, &recordingTransport{}, tt.session, "", "")
+			acknowledge(c, tt.msg)
+
+			frames := queued(c)
+			if !tt.wantAck {
+				if len(frames) != 0 {
+					t.Errorf("frames = %+v, want none", frames)
+				}
+				return
+			}
+			if len(frames) != 1 {
+				t.Fatalf("frames = %+v, want one sent frame", frames)
+			}
+			ack := frames[0]
+			if ack.Type != TypeSent || ack.MessageID != tt.msg.ID || ack.ClientMsgID != tt.msg.ClientMsgID || ack.Ref != tt.msg.Ref || !ack.CreatedAt.Equal(createdAt) {
+				t.Errorf("ack = %+v, want a sent frame for %+v", ack, tt.msg)
+			}
+		})
+	}
+}
+
+func TestRejectMessageEchoesClientID(t *testing.T) {
+	c := newClient("1", defaultDevice, &recordingTransport{}, legacySession, "", "")
+	rejectMessage(c, WsMessage{Ref: "f1", ClientMsgID: "c1"}, "muted", "You are muted")
+
+	frames := queued(c)
+	if len(frames) != 1 || frames[0].Type != TypeError || frames[0].Code != "muted" || frames[0].ClientMsgID != "c1" || frames[0].Ref != "f1" {
+		t.Errorf("frames = %+v, want an error frame echoing c1", frames)
+	}
+}
+
+func TestHandleReadAudience(t *testing.T) {
+	testenv.Postgres(t)
+	bg := context.Background()
+
+	sender := testenv.CreateUser(t)
+	receiver := testenv.CreateUser(t)
+	outsider := testenv.CreateUser(t)
+	shunned := testenv.CreateUser(t)
+	blocker := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, sender)
+	if err := database.AddGroupMember(bg, groupID, receiver, database.RoleMember); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.BlockUser(bg, sender, shunned); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.BlockUser(bg, blocker, sender); err != nil {
+		t.Fatal(err)
+	}
+	devices := connect(t, sender)
+
+	// send stores a message from the sender, receiverID or groupID is zero
+	send := func(receiverID int, groupID int) int {
+		t.Helper()
+		message := models.Message{SenderID: sender, ReceiverID: receiverID, GroupID: groupID, Content: "hi"}
+		if err := database.InsertMessage(bg, &message); err != nil {
+			t.Fatal(err)
+		}
+		return message.ID
+	}
+
+	tests := []struct {
+		name      string
+		readerID  int
+		messageID int
+		want      bool
+	}{
+		{"receiver of a direct message", receiver, send(receiver, 0), true},
+		{"outsider of a direct message", outsider, send(receiver, 0), false},
+		{"group member", receiver, send(0, groupID), true},
+		{"outsider of a group", outsider, send(0, groupID), false},
+		{"receiver the sender blocked", shunned, send(shunned, 0), false},
+		{"receiver who blocked the sender", blocker, send(blocker, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handleRead(strconv.Itoa(tt.readerID), WsMessage{Type: TypeRead, MessageID: tt.messageID})
+
+			frames := queued(devices[sender])
+			if !tt.want {
+				if len(frames) != 0 {
+					t.Errorf("sender got %+v, want nothing", frames)
+				}
+				return
+			}
+			if len(frames) != 1 || frames[0].Type != TypeRead || frames[0].MessageID != tt.messageID || frames[0].SenderID != tt.readerID {
+				t.Errorf("sender got %+v, want a read frame from user %d", frames, tt.readerID)
+			}
+		})
+	}
+
+	// Reading a direct message sent to someone else leaves its receipt unread
+	var unread int
+	query := "SELECT COUNT(*) FROM message_receipts WHERE user_id = $1 AND read_at IS NULL"
+	if err := database.DB.QueryRow(bg, query, receiver).Scan(&unread); err != nil {
+		t.Fatal(err)
+	}
+	if unread != 1 {
+		t.Errorf("receiver has %d unread messages, want the one the outsider read", unread)
+	}
+}
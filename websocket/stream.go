@@ -0,0 +1,142 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/redis/go-redis/v9"
+)
+
+// Every frame that must reach a user, such as messages, edits, reactions and moderation notices,
+// is appended to the user's delivery stream in Redis. Each device keeps a cursor to the last
+// stream entry it received and catches up from it when it reconnects, so devices that were
+// offline miss nothing and devices that were online get nothing twice.
+const (
+	streamMaxLen    = 1000
+	streamRetention = 24 * time.Hour
+)
+
+func streamKey(userID string) string {
+	return fmt.Sprintf("stream:%s", userID)
+}
+
+func cursorsKey(userID string) string {
+	return fmt.Sprintf("cursors:%s", userID)
+}
+
+// deliver appends a frame to the user's stream and queues it on their connected devices.
+// It reports whether a device was connected.
+func deliver(userID string, msg WsMessage) bool {
+	return deliverExcept(userID, "", msg)
+}
+
+// deliverExcept is deliver without writing to one device, the one that sent the frame,
+// whose cursor still moves past it
+func deliverExcept(userID string, deviceID string, msg WsMessage) bool {
+	streamID, err := appendToStream(userID, msg)
+	if err != nil {
+		log.Printf("Error storing %s frame for user %s: %v", msg.Type, userID, err)
+	}
+
+	delivered := false
+	for _, c := range userClients(userID) {
+		skip := c.deviceID == deviceID
+		if c.enqueue(outbound{frame: msg, streamID: streamID, skip: skip}) && !skip {
+			delivered = true
+		}
+	}
+	return delivered
+}
+
+func appendToStream(userID string, msg WsMessage) (string, error) {
+	frame, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+
+	key := streamKey(userID)
+	streamID, err := database.RedisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: streamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"frame": frame},
+	}).Result()
+	if err != nil {
+		return "", err
+	}
+
+	// Streams of inactive users expire
+	if err := database.RedisClient.Expire(ctx, key, streamRetention).Err(); err != nil {
+		log.Printf("Error setting TTL for the delivery stream of user %s: %v", userID, err)
+	}
+	return streamID, nil
+}
+
+// readStream returns the frames of a user's stream after a cursor, or all of them without one
+func readStream(userID string, cursor string) ([]outbound, error) {
+	start := "-"
+	if cursor != "" {
+		start = "(" + cursor
+	}
+
+	entries, err := database.RedisClient.XRange(ctx, streamKey(userID), start, "+").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]outbound, 0, len(entries))
+	for _, entry := range entries {
+		raw, _ := entry.Values["frame"].(string)
+		var frame WsMessage
+		if err := json.Unmarshal([]byte(raw), &frame); err != nil {
+			log.Printf("Error decoding stream entry %s of user %s: %v", entry.ID, userID, err)
+			continue
+		}
+		items = append(items, outbound{frame: frame, streamID: entry.ID})
+	}
+	return items, nil
+}
+
+func loadCursor(userID string, deviceID string) string {
+	cursor, err := database.RedisClient.HGet(ctx, cursorsKey(userID), deviceID).Result()
+	if err != nil && err != redis.Nil {
+		log.Printf("Error loading the cursor of device %s of user %s: %v", deviceID, userID, err)
+	}
+	return cursor
+}
+
+func saveCursor(userID string, deviceID string, streamID string) {
+	key := cursorsKey(userID)
+	if err := database.RedisClient.HSet(ctx, key, deviceID, streamID).Err(); err != nil {
+		log.Printf("Error saving the cursor of device %s of user %s: %v", deviceID, userID, err)
+		return
+	}
+	database.RedisClient.Expire(ctx, key, streamRetention)
+}
+
+// streamIDAfter reports whether stream id a comes after b, every id comes after the empty one
+func streamIDAfter(a string, b string) bool {
+	if b == "" {
+		return true
+	}
+
+	aMillis, aSeq := splitStreamID(a)
+	bMillis, bSeq := splitStreamID(b)
+	if aMillis != bMillis {
+		return aMillis > bMillis
+	}
+	return aSeq > bSeq
+}
+
+// splitStreamID parses the "<milliseconds>-<sequence>" ids assigned by Redis
+func splitStreamID(id string) (uint64, uint64) {
+	millis, seq, _ := strings.Cut(id, "-")
+	m, _ := strconv.ParseUint(millis, 10, 64)
+	s, _ := strconv.ParseUint(seq, 10, 64)
+	return m, s
+}
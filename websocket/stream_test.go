@@ -0,0 +1,200 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+)
+
+func TestStreamIDAfter(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1-0", "", true},
+		{"2-0", "1-0", true},
+		{"1-0", "2-0", false},
+		{"1-1", "1-0", true},
+		{"1-0", "1-0", false},
+		{"10-0", "9-5", true},
+		{"1700000000000-2", "1700000000000-10", false},
+	}
+	for _, tt := range tests {
+		if got := streamIDAfter(tt.a, tt.b); got != tt.want {
+			t.Errorf("streamIDAfter(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterClient(t *testing.T) {
+	testenv.Redis(t)
+
+	phone := newClient("41", "phone", &recordingTransport{}, legacySession, "", "")
+	laptop := newClient("41", "laptop", &recordingTransport{}, legacySession, "", "")
+	phoneAgain := newClient("41", "phone", &recordingTransport{}, legacySession, "", "")
+
+	steps := []struct {
+		name string
+		run  func() bool
+		want bool
+	}{
+		{"first device", func() bool { return registerClient(phone) }, true},
+		{"second device", func() bool { return registerClient(laptop) }, false},
+		{"reconnecting device", func() bool { return registerClient(phoneAgain) }, false},
+		{"replaced connection leaves", func() bool { return unregisterClient(phone) }, false},
+		{"one device left", func() bool { return unregisterClient(laptop) }, false},
+		{"last device leaves", func() bool { return unregisterClient(phoneAgain) }, true},
+	}
+	for _, step := range steps {
+		if got := step.run(); got != step.want {
+			t.Errorf("%s = %v, want %v", step.name, got, step.want)
+		}
+		if step.name == "reconnecting device" {
+			select {
+			case <-phone.done:
+			default:
+				t.Error("the replaced connection was not closed")
+			}
+		}
+	}
+
+	if len(userClients("41")) != 0 {
+		t.Errorf("devices left = %d", len(userClients("41")))
+	}
+}
+
+func TestDeliverExceptSkipsTheSendingDevice(t *testing.T) {
+	testenv.Redis(t)
+
+	phone := newClient("42", "phone", &recordingTransport{}, legacySession, "", "")
+	laptop := newClient("42", "laptop", &recordingTransport{}, legacySession, "", "")
+	for _, c := range []*Client{phone, laptop} {
+		registerClient(c)
+		t.Cleanup(func() { unregisterClient(c) })
+	}
+
+	if !deliverExcept("42", "phone", WsMessage{Type: TypeMessage, GroupID: 3, Content: "from the phone"}) {
+		t.Error("deliverExcept() = false, want true")
+	}
+
+	// The phone still gets the entry, marked as skipped, so its cursor moves past it
+	for _, tt := range []struct {
+		c        *Client
+		wantSkip bool
+	}{{phone, true}, {laptop, false}} {
+		select {
+		case item := <-tt.c.outbox:
+			if item.skip != tt.wantSkip || item.streamID == "" || item.frame.Content != "from the phone" {
+				t.Errorf("device %s got %+v", tt.c.deviceID, item)
+			}
+		default:
+			t.Errorf("device %s got nothing", tt.c.deviceID)
+		}
+	}
+
+	entries, err := readStream("42", "")
+	if err != nil || len(entries) != 1 {
+		t.Errorf("stream = %+v, %v, want one entry", entries, err)
+	}
+}
+
+func TestWriteLoopReplaysMissedFrames(t *testing.T) {
+	testenv.Redis(t)
+
+	var ids []string
+	for _, content := range []string{"seen", "missed 1", "missed 2"} {
+		id, err := appendToStream("43", WsMessage{Type: TypeMessage, GroupID: 3, Content: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	saveCursor("43", "phone", ids[0])
+
+	transport := &recordingTransport{}
+	c := newClient("43", "phone", transport, legacySession, "", "")
+
+	// Frames queued while the replay runs are written once
+	c.enqueue(outbound{frame: WsMessage{Type: TypeMessage, GroupID: 3, Content: "missed 2"}, streamID: ids[2]})
+	c.enqueue(outbound{frame: WsMessage{Type: TypeMessage, GroupID: 3, Content: "live"}})
+	done := make(chan struct{})
+	go func() {
+		c.writeLoop(loadCursor("43", "phone"))
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		transport.mu.Lock()
+		n := len(transport.frames)
+		transport.mu.Unlock()
+		if n >= 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.close(1000, "")
+	<-done
+
+	var got []string
+	for _, frame := range transport.frames {
+		got = append(got, frame.(WsMessage).Content)
+	}
+	want := []string{"missed 1", "missed 2", "live"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("written = %q, want %q", got, want)
+	}
+	if cursor := loadCursor("43", "phone"); cursor != ids[2] {
+		t.Errorf("cursor = %q, want %q", cursor, ids[2])
+	}
+}
+
+func TestSessionsAndRevoke(t *testing.T) {
+	testenv.Redis(t)
+
+	phone := newClient("44", "phone", &recordingTransport{}, legacySession, "10.0.0.1", "phone app")
+	laptop := newClient("44", "laptop", &recordingTransport{}, &session{version: ProtocolEnvelope, features: map[string]bool{FeatureTyping: true}}, "10.0.0.2", "browser")
+	laptop.connectedAt = phone.connectedAt.Add(time.Second)
+	for _, c := range []*Client{phone, laptop} {
+		registerClient(c)
+		t.Cleanup(func() { unregisterClient(c) })
+	}
+	saveCursor("44", "phone", "1-0")
+
+	sessions, err := Sessions(44)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].DeviceID != "phone" || sessions[1].DeviceID != "laptop" ||
+		sessions[1].Protocol != ProtocolEnvelope || len(sessions[1].Features) != 1 || sessions[0].Transport != "test" {
+		t.Errorf("Sessions() = %+v", sessions)
+	}
+
+	tests := []struct {
+		deviceID string
+		want     bool
+	}{
+		{"phone", true},
+		{"tablet", false},
+	}
+	for _, tt := range tests {
+		revoked, err := RevokeSession(44, tt.deviceID)
+		if err != nil || revoked != tt.want {
+			t.Errorf("RevokeSession(%s) = %v, %v, want %v", tt.deviceID, revoked, err, tt.want)
+		}
+	}
+
+	select {
+	case <-phone.done:
+	default:
+		t.Error("the revoked device is still connected")
+	}
+	if cursor := loadCursor("44", "phone"); cursor != "" {
+		t.Errorf("cursor of the revoked device = %q, want none", cursor)
+	}
+	if remaining, _ := database.RedisClient.HLen(ctx, devicesKey("44")).Result(); remaining != 1 {
+		t.Errorf("sessions left = %d, want 1", remaining)
+	}
+}
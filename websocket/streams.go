@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/gorilla/websocket"
+)
+
+// FrameStream is a bidirectional stream of version 2 envelopes, such as the gRPC Chat stream
+type FrameStream interface {
+	Context() context.Context
+	Send(*Envelope) error
+	Recv() (*Envelope, error)
+}
+
+// streamTransport writes frames to a FrameStream and remembers why it was closed
+type streamTransport struct {
+	stream FrameStream
+
+	mu     sync.Mutex
+	reason string
+}
+
+func (t *streamTransport) name() string {
+	return "grpc"
+}
+
+func (t *streamTransport) write(v interface{}, streamID string) error {
+	env, ok := v.(Envelope)
+	if !ok {
+		return fmt.Errorf("unexpected %T frame", v)
+	}
+	return t.stream.Send(&env)
+}
+
+// close cannot end the stream from another goroutine, ServeStream returns the reason instead
+func (t *streamTransport) close(code int, reason string) {
+	t.mu.Lock()
+	t.reason = reason
+	t.mu.Unlock()
+}
+
+// ServeStream serves a device over a stream of envelopes, for transports other than HTTP. It
+// behaves like an envelope WebSocket whose hello asked for the features: the stream opens with
+// a welcome frame, replays what the device missed and handles client frames the same way.
+// Bots pass their "Bot <token>" authorization. Users who may not connect and devices closed by
+// the server get an *apierror.Error.
+func ServeStream(stream FrameStream, userID int, deviceID string, features []string, authorization string, remoteAddr string, userAgent string) error {
+	if deviceID == "" {
+		deviceID = defaultDevice
+	} else if !validDeviceID.MatchString(deviceID) {
+		return apierror.Invalid("device_id", "Invalid device_id")
+	}
+	bot, err := checkConnect(userID, authorization)
+	if err != nil {
+		return err
+	}
+
+	s := &session{version: ProtocolEnvelope, features: negotiateFeatures(features)}
+	welcome, err := s.welcome(userID, "")
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&welcome); err != nil {
+		return err
+	}
+
+	id := fmt.Sprint(userID)
+	t := &streamTransport{stream: stream}
+	client := newClient(id, deviceID, t, s, remoteAddr, userAgent)
+	connectDevice(client)
+	defer disconnectDevice(client)
+
+	finished := make(chan struct{})
+	go func() {
+		client.writeLoop(loadCursor(id, deviceID))
+		close(finished)
+	}()
+
+	// Frames are read on their own goroutine so a device closed by the server ends the stream
+	received := make(chan error, 1)
+	go func() {
+		limiter := frameLimiter{userID: id, bot: bot, windowStart: time.Now()}
+		for {
+			env, err := stream.Recv()
+			if err != nil {
+				received <- err
+				return
+			}
+
+			msg, ref, err := decodeEnvelope(s, *env)
+			var invalid *apierror.Error
+			if err != nil && !errors.As(err, &invalid) {
+				received <- err
+				return
+			}
+			client.handleFrame(&limiter, msg, ref, invalid)
+		}
+	}()
+
+	select {
+	case err := <-received:
+		client.close(websocket.CloseNormalClosure, "")
+		<-finished
+		if !errors.Is(err, io.EOF) {
+			log.Printf("Stream of device %s of user %d ended: %v", deviceID, userID, err)
+		}
+		return nil
+	case <-client.done:
+		<-finished
+	}
+
+	t.mu.Lock()
+	reason := t.reason
+	t.mu.Unlock()
+	if reason == "" {
+		return nil
+	}
+	return apierror.New(http.StatusForbidden, apierror.CodeForbidden, reason)
+}
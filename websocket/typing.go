@@ -0,0 +1,117 @@
+package websocket
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clementus360/proxy-chat/database"
+)
+
+// typingThrottle is the minimum interval between two relayed typing_start frames
+// from the same user to the same conversation
+const typingThrottle = 3 * time.Second
+
+var (
+	typingMu   sync.Mutex
+	typingSent = make(map[string]time.Time)
+)
+
+func typingKey(userID string, msg WsMessage) string {
+	return fmt.Sprintf("%s:%d:%d", userID, msg.ReceiverID, msg.GroupID)
+}
+
+// handleTyping relays typing indicators to online recipients, they are never persisted or queued
+func handleTyping(userID string, msg WsMessage) {
+	if (msg.ReceiverID == 0) == (msg.GroupID == 0) {
+		log.Printf("Ignoring typing frame from user %s without a single target", userID)
+		return
+	}
+
+	senderID, _ := strconv.Atoi(userID)
+
+	// Users who blocked each other do not see each other typing
+	if msg.ReceiverID != 0 {
+		blocked, err := database.IsBlocked(ctx, senderID, msg.ReceiverID)
+		if err != nil {
+			log.Printf("Error checking blocks between users %d and %d: %v", senderID, msg.ReceiverID, err)
+			return
+		}
+		if blocked {
+			return
+		}
+	}
+
+	key := typingKey(userID, msg)
+	now := time.Now()
+
+	typingMu.Lock()
+	last, typing := typingSent[key]
+	if msg.Type == TypeTypingStart {
+		if typing && now.Sub(last) < typingThrottle {
+			typingMu.Unlock()
+			return
+		}
+		typingSent[key] = now
+	} else {
+		if !typing {
+			typingMu.Unlock()
+			return
+		}
+		delete(typingSent, key)
+	}
+	typingMu.Unlock()
+
+	msg.SenderID = senderID
+	msg.Content = ""
+	msg.CreatedAt = now
+
+	if msg.ReceiverID != 0 {
+		relayTyping(fmt.Sprint(msg.ReceiverID), msg)
+		return
+	}
+
+	members, err := GroupMembers(msg.GroupID)
+	if err != nil {
+		log.Printf("Error fetching group members: %v", err)
+		return
+	}
+	if !slices.Contains(members, userID) {
+		log.Printf("Ignoring typing frame from user %s outside group %d", userID, msg.GroupID)
+		return
+	}
+	for _, memberID := range members {
+		if memberID != userID && !hasBlocked(memberID, senderID) {
+			relayTyping(memberID, msg)
+		}
+	}
+}
+
+func relayTyping(userID string, msg WsMessage) {
+	sendLive(userID, msg)
+}
+
+// clearTyping stops every typing indicator a user left running when they disconnected
+func clearTyping(userID string) {
+	prefix := userID + ":"
+
+	typingMu.Lock()
+	var pending []WsMessage
+	for key := range typingSent {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var receiverID, groupID int
+		fmt.Sscanf(strings.TrimPrefix(key, prefix), "%d:%d", &receiverID, &groupID)
+		pending = append(pending, WsMessage{Type: TypeTypingStop, ReceiverID: receiverID, GroupID: groupID})
+	}
+	typingMu.Unlock()
+
+	for _, msg := range pending {
+		handleTyping(userID, msg)
+	}
+}
@@ -0,0 +1,71 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/clementus360/proxy-chat/internal/testenv"
+)
+
+func TestTypingThrottle(t *testing.T) {
+	server := testenv.Redis(t)
+	for _, userID := range []string{"1", "3"} {
+		server.SAdd("blocks:"+userID, "-")
+	}
+	server.SAdd("group:9", "1", "3")
+	devices := connect(t, 1, 3)
+
+	t.Cleanup(func() {
+		typingMu.Lock()
+		clear(typingSent)
+		typingMu.Unlock()
+	})
+
+	// The steps run in order, each relays at most one frame to user 3
+	tests := []struct {
+		name  string
+		frame WsMessage
+		want  string
+	}{
+		{"start", WsMessage{Type: TypeTypingStart, ReceiverID: 3}, TypeTypingStart},
+		{"start again", WsMessage{Type: TypeTypingStart, ReceiverID: 3}, ""},
+		{"start in a group", WsMessage{Type: TypeTypingStart, GroupID: 9}, TypeTypingStart},
+		{"stop", WsMessage{Type: TypeTypingStop, ReceiverID: 3}, TypeTypingStop},
+		{"stop again", WsMessage{Type: TypeTypingStop, ReceiverID: 3}, ""},
+		{"start after stopping", WsMessage{Type: TypeTypingStart, ReceiverID: 3, Content: "draft"}, TypeTypingStart},
+		{"no target", WsMessage{Type: TypeTypingStart}, ""},
+		{"two targets", WsMessage{Type: TypeTypingStart, ReceiverID: 3, GroupID: 9}, ""},
+		{"group without the sender", WsMessage{Type: TypeTypingStart, GroupID: 10}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handleTyping("1", tt.frame)
+
+			frames := queued(devices[3])
+			if tt.want == "" {
+				if len(frames) != 0 {
+					t.Errorf("user 3 got %+v, want nothing", frames)
+				}
+				return
+			}
+			if len(frames) != 1 || frames[0].Type != tt.want || frames[0].SenderID != 1 || frames[0].Content != "" {
+				t.Errorf("user 3 got %+v, want one %s frame from user 1 without content", frames, tt.want)
+			}
+			if len(queued(devices[1])) != 0 {
+				t.Error("the sender got their own typing frame")
+			}
+		})
+	}
+
+	// Disconnecting stops the indicators left running, in the direct chat and the group
+	clearTyping("1")
+	frames := queued(devices[3])
+	if len(frames) != 2 || frames[0].Type != TypeTypingStop || frames[1].Type != TypeTypingStop {
+		t.Errorf("user 3 got %+v, want two typing_stop frames", frames)
+	}
+	typingMu.Lock()
+	running := len(typingSent)
+	typingMu.Unlock()
+	if running != 0 {
+		t.Errorf("%d typing indicators still running", running)
+	}
+}
@@ -2,21 +2,27 @@ package websocket
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"fmt"
 
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/bots"
 	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/filters"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/push"
+	"github.com/clementus360/proxy-chat/validation"
+	"github.com/clementus360/proxy-chat/webhooks"
 	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5"
 )
 
-var (
-	ctx         = context.Background()
-	userSockets = make(map[string]*websocket.Conn)
-)
+var ctx = context.Background()
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
@@ -27,37 +33,79 @@ var upgrader = websocket.Upgrader{
 	},
 	EnableCompression: false, // Disable compression for now
 	HandshakeTimeout:  10 * time.Second,
+
+	// Clients offering the subprotocol speak the envelope protocol, the others the legacy one
+	Subprotocols: []string{Subprotocol},
 }
 
+// Frame types understood by the server
+const (
+	TypeMessage     = "message"
+	TypeTypingStart = "typing_start"
+	TypeTypingStop  = "typing_stop"
+	TypePresence    = "presence"
+	TypeDelivered   = "delivered"
+	TypeRead        = "read"
+
+	TypeMessageEdited  = "message_edited"
+	TypeMessageDeleted = "message_deleted"
+
+	TypeReactionAdded   = "reaction_added"
+	TypeReactionRemoved = "reaction_removed"
+
+	TypeModeration = "moderation"
+	TypeError      = "error"
+
+	// TypeSent acknowledges a stored chat message to its sender
+	TypeSent = "sent"
+
+	// TypeCommandResult answers a slash command, only the invoker gets it
+	TypeCommandResult = "command_result"
+	// TypeGroupNotice tells the members of a group what a command changed, such as its topic
+	TypeGroupNotice = "group_notice"
+)
+
 type WsMessage struct {
-	Type       string    `json:"type"`
-	GroupID    int       `json:"group_id,omitempty"`
-	SenderID   int       `json:"sender_id"`
-	SenderName string    `json:"sender_name"`
-	ReceiverID int       `json:"receiver_id,omitempty"`
-	Content    string    `json:"content"`
-	CreatedAt  time.Time `json:"created_at"`
-}
+	ID         int        `json:"id,omitempty"`
+	Type       string     `json:"type"`
+	MessageID  int        `json:"message_id,omitempty"`
+	GroupID    int        `json:"group_id,omitempty" validate:"required_without=receiver_id,excluded_with=receiver_id"`
+	SenderID   int        `json:"sender_id"`
+	SenderName string     `json:"sender_name"`
+	ReceiverID int        `json:"receiver_id,omitempty"`
+	Content    string     `json:"content" validate:"max=4000,required_without=attachment_ids"`
+	Status     string     `json:"status,omitempty"`
+	LastSeen   *time.Time `json:"last_seen,omitempty"`
+	EditedAt   *time.Time `json:"edited_at,omitempty"`
+	Emoji      string     `json:"emoji,omitempty"`
+	Code       string     `json:"code,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
 
-func StoreWSConnection(userID string, conn *websocket.Conn) error {
-	userSockets[userID] = conn
-	return database.RedisClient.HSet(ctx, "active_users", userID, conn.RemoteAddr().String()).Err()
-}
+	// Reply metadata lets clients render quotes without fetching the original message
+	ReplyToID    int                  `json:"reply_to_id,omitempty"`
+	ReplyTo      *models.ReplyPreview `json:"reply_to,omitempty"`
+	ThreadRootID int                  `json:"thread_root_id,omitempty"`
 
-func RemoveWSConnection(userID string) error {
-	delete(userSockets, userID)
-	return database.RedisClient.HDel(ctx, "active_users", userID).Err()
-}
+	// Files uploaded through the REST API before sending the message
+	AttachmentIDs []int               `json:"attachment_ids,omitempty" validate:"max=10"`
+	Attachments   []models.Attachment `json:"attachments,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+
+	// ClientMsgID is chosen by the sender to deduplicate retries, sent and error frames echo it
+	ClientMsgID string `json:"client_msg_id,omitempty" validate:"max=64"`
 
-func GetWSConnection(userID string) (*websocket.Conn, bool) {
-	conn, exists := userSockets[userID]
-	return conn, exists
+	// Command names the slash command of command_result and group_notice frames,
+	// the results of /who list the members it found
+	Command string                `json:"command,omitempty"`
+	Members []models.NearbyMember `json:"members,omitempty"`
+
+	// Ref is the id of the envelope frame an error answers, legacy clients never see it
+	Ref string `json:"-"`
 }
 
 func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		http.Error(w, "Missing user_id", http.StatusBadRequest)
+	userID, userIDInt, deviceID, bot, ok := authorizeDevice(w, r)
+	if !ok {
 		return
 	}
 
@@ -67,175 +115,446 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = StoreWSConnection(userID, conn)
+	// Negotiate the protocol before anything is sent to the client
+	session, err := handshake(conn, userIDInt)
 	if err != nil {
-		log.Printf("Error storing websocket connection: %v", err)
+		log.Printf("WebSocket handshake failed for user %s: %v", userID, err)
+		conn.Close()
 		return
 	}
 
-	// Set the user as online in postgres
-	_, err = database.DB.Exec(ctx, "UPDATE users SET online = true WHERE id = $1", userID)
-	if err != nil {
-		log.Printf("Error setting user %s as online: %v", userID, err)
+	// The writer catches the device up on what it missed before sending new frames
+	client := newClient(userID, deviceID, wsTransport{conn: conn}, session, r.RemoteAddr, r.UserAgent())
+	connectDevice(client)
+	go client.writeLoop(loadCursor(userID, deviceID))
+	defer disconnectDevice(client)
+
+	limiter := frameLimiter{userID: userID, bot: bot, windowStart: time.Now()}
+	for {
+		// Frames breaking the protocol are answered with an error, other read errors end the connection
+		msg, ref, err := readFrame(conn, session)
+		var invalid *apierror.Error
+		if err != nil && !errors.As(err, &invalid) {
+			log.Printf("Error reading message: %v", err)
+			break
+		}
+		client.handleFrame(&limiter, msg, ref, invalid)
+	}
+}
+
+// handleFrame handles a frame read from a device, invalid is set when the frame broke the protocol
+func (c *Client) handleFrame(limiter *frameLimiter, msg WsMessage, ref string, invalid *apierror.Error) {
+	userID := c.userID
+	senderID, _ := strconv.Atoi(userID)
+
+	if !limiter.allow(c, ref, msg.Type) {
+		return
+	}
+	if invalid != nil {
+		sendError(c, ref, invalid.Code, invalid.Message)
 		return
 	}
 
-	defer func() {
-		err := RemoveWSConnection(userID)
+	// The sender is the connected user whatever the frame claims, and the server sets the time
+	msg.SenderID = senderID
+	msg.SenderName = ""
+	msg.CreatedAt = time.Now()
+
+	// Ephemeral frames are relayed to online users only and never stored
+	switch msg.Type {
+	case TypeTypingStart, TypeTypingStop:
+		handleTyping(userID, msg)
+		return
+	case TypePresence:
+		handlePresenceUpdate(userID, msg)
+		return
+	case TypeRead:
+		handleRead(userID, msg)
+		return
+	case TypeDelivered, TypeMessageEdited, TypeMessageDeleted, TypeReactionAdded, TypeReactionRemoved, TypeModeration, TypeError, TypeSent, TypeCommandResult, TypeGroupNotice:
+		// Server generated frames, edits and reactions go through the REST API
+		return
+	}
+
+	// Chat frames are validated like messages sent through the REST API,
+	// which also rejects ambiguous frames naming both a receiver and a group
+	if err := validation.Struct(msg); errors.As(err, &invalid) {
+		rejectMessage(c, msg, invalid.Code, invalid.Message)
+		return
+	}
+
+	c.postMessage(msg)
+}
+
+// postMessage stores a valid chat frame and delivers it, or runs the command it starts with,
+// and tells the sender why it was refused
+func (c *Client) postMessage(msg WsMessage) {
+	userID := c.userID
+
+	// A retried send is acknowledged again without being stored or delivered twice
+	if msg.ClientMsgID != "" {
+		stored, err := database.MessageByClientID(ctx, msg.SenderID, msg.ClientMsgID)
+		if err == nil {
+			msg.ID, msg.CreatedAt = stored.ID, stored.CreatedAt
+			acknowledge(c, msg)
+			return
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Error looking up client message id of user %s: %v", userID, err)
+			rejectMessage(c, msg, apierror.CodeInternal, "Unable to send message")
+			return
+		}
+	}
+
+	if !c.admit(msg) || !c.screen(&msg) {
+		return
+	}
+
+	// Group messages starting with a slash run a command instead of being posted,
+	// unless a bot of the group handles the command
+	if msg.GroupID != 0 {
+		if command, ok := bots.ParseCommand(msg.Content); ok && c.runCommand(msg, command) {
+			return
+		}
+	}
+	c.publishMessage(msg)
+}
+
+// admit checks that the sender may post to the conversation of a chat frame, before its content
+// is screened so refused frames are not counted by the filters. It reports false when the frame
+// was refused.
+func (c *Client) admit(msg WsMessage) bool {
+	// Only members may post to a group, unless a moderator muted them there
+	if msg.GroupID != 0 {
+		membership, err := database.GroupMembership(ctx, msg.GroupID, msg.SenderID)
 		if err != nil {
-			log.Printf("Error removing websocket connection: %v", err)
+			log.Printf("Error checking membership of user %s in group %d: %v", c.userID, msg.GroupID, err)
+			rejectMessage(c, msg, apierror.CodeInternal, "Unable to send message")
+			return false
+		}
+		if membership.Role == "" {
+			rejectMessage(c, msg, apierror.CodeForbidden, "You are not a member of this group")
+			return false
+		}
+		if membership.Muted() {
+			rejectMessage(c, msg, apierror.CodeMuted, fmt.Sprintf("You are muted in this group until %s", membership.MutedUntil.Format(time.RFC3339)))
+			return false
 		}
+	}
 
-		// Set the user as offline in postgres
-		_, err = database.DB.Exec(ctx, "UPDATE users SET online = false WHERE id = $1", userID)
+	// Drop direct messages between users who blocked each other
+	if msg.ReceiverID != 0 {
+		blocked, err := database.IsBlocked(ctx, msg.SenderID, msg.ReceiverID)
 		if err != nil {
-			log.Printf("Error setting user %s as offline: %v", userID, err)
+			log.Printf("Error checking blocks between users %d and %d: %v", msg.SenderID, msg.ReceiverID, err)
+			rejectMessage(c, msg, apierror.CodeInternal, "Unable to send message")
+			return false
+		}
+		if blocked {
+			log.Printf("Dropped message from user %d to user %d: blocked", msg.SenderID, msg.ReceiverID)
+			rejectMessage(c, msg, apierror.CodeBlocked, "Unable to message this user")
+			return false
 		}
+	}
+	return true
+}
 
-		// Close the connection
-		conn.Close()
-		log.Printf("WebSocket connection closed for user %s", userID)
-	}()
+// screen applies the account restrictions and content filters to a chat frame, commands included,
+// so muted users cannot run them and the filters count them. It reports false when the frame
+// was refused.
+func (c *Client) screen(msg *WsMessage) bool {
+	// Muted users may not post until their mute expires
+	restrictions, err := database.UserRestrictions(ctx, msg.SenderID)
+	if err != nil {
+		log.Printf("Error fetching restrictions of user %s: %v", c.userID, err)
+		rejectMessage(c, *msg, apierror.CodeInternal, "Unable to send message")
+		return false
+	}
+	if restrictions.Muted() {
+		rejectMessage(c, *msg, apierror.CodeMuted, fmt.Sprintf("You are muted until %s", restrictions.MutedUntil.Format(time.RFC3339)))
+		return false
+	}
+
+	// Run the content filters, they may mask parts of the message
+	filtered := filters.Message{SenderID: msg.SenderID, GroupID: msg.GroupID, ReceiverID: msg.ReceiverID, Content: msg.Content}
+	if err := filters.Run(ctx, &filtered); err != nil {
+		var rejection *filters.Rejection
+		if errors.As(err, &rejection) {
+			rejectMessage(c, *msg, rejection.Code, rejection.Reason)
+		} else {
+			log.Printf("Error filtering message from user %s: %v", c.userID, err)
+			rejectMessage(c, *msg, apierror.CodeInternal, "Unable to send message")
+		}
+		return false
+	}
+	msg.Content = filtered.Content
+	return true
+}
 
-	// Fetch and send stored messages for offline users (RIGHT AFTER STORING CONNECTION)
-	offlineKey := fmt.Sprintf("offline:%s", userID)
-	messages, err := database.RedisClient.LRange(ctx, offlineKey, 0, -1).Result()
+// publishMessage stores an admitted and screened chat frame and delivers it
+func (c *Client) publishMessage(msg WsMessage) {
+	userID := c.userID
+	senderID := msg.SenderID
+
+	// Recipients see the current display name of the sender, their nickname in groups
+	var err error
+	msg.SenderName, err = database.DisplayName(ctx, senderID, msg.GroupID)
 	if err != nil {
-		log.Printf("Error fetching stored messages for user %s: %v", userID, err)
-	} else {
-		for _, msgStr := range messages {
-			var storedMsg WsMessage
-			if err := json.Unmarshal([]byte(msgStr), &storedMsg); err == nil {
-				err = conn.WriteJSON(storedMsg)
-				if err != nil {
-					log.Printf("Error sending stored message to user %s: %v", userID, err)
-				}
-			}
+		log.Printf("Error fetching username of user %s: %v", userID, err)
+		rejectMessage(c, msg, apierror.CodeInternal, "Unable to send message")
+		return
+	}
+
+	// Persist chat messages so they get an id receipts can refer to
+	msg.Type = TypeMessage
+	err = saveMessage(&msg)
+	switch {
+	case errors.Is(err, database.ErrDuplicateMessage):
+		// A concurrent retry stored it first and delivers it
+		acknowledge(c, msg)
+		return
+	case errors.Is(err, database.ErrInvalidReply):
+		rejectMessage(c, msg, apierror.CodeValidation, "Invalid reply_to_id or thread_root_id")
+		return
+	case errors.Is(err, database.ErrInvalidAttachment):
+		rejectMessage(c, msg, apierror.CodeValidation, "Invalid attachment_ids")
+		return
+	case err != nil:
+		log.Printf("Error saving message from user %s: %v", userID, err)
+		rejectMessage(c, msg, apierror.CodeInternal, "Unable to send message")
+		return
+	}
+	acknowledge(c, msg)
+	dispatch(msg, c.deviceID)
+}
+
+// authorizeDevice reads the user and device of a realtime connection from the query string and
+// reports whether the user connected as a bot. Suspended accounts cannot connect, refused
+// requests are answered with an error.
+func authorizeDevice(w http.ResponseWriter, r *http.Request) (string, int, string, bool, bool) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Missing user_id"))
+		return "", 0, "", false, false
+	}
+
+	userIDInt, err := strconv.Atoi(userID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Invalid("user_id", "Invalid user_id"))
+		return "", 0, "", false, false
+	}
+	bot, err := checkConnect(userIDInt, r.Header.Get("Authorization"))
+	if err != nil {
+		apierror.Write(w, r, err)
+		return "", 0, "", false, false
+	}
+
+	// Each device keeps its own connection and delivery cursor
+	deviceID := r.URL.Query().Get("device_id")
+	if deviceID == "" {
+		deviceID = defaultDevice
+	} else if !validDeviceID.MatchString(deviceID) {
+		apierror.Write(w, r, apierror.Invalid("device_id", "Invalid device_id"))
+		return "", 0, "", false, false
+	}
+	return userID, userIDInt, deviceID, bot, true
+}
+
+// checkConnect refuses connections of unknown and suspended users, and of bots that do not send
+// their token in the authorization header. It reports whether the user is a bot.
+func checkConnect(userID int, authorization string) (bool, error) {
+	bot, err := bots.Authenticate(ctx, authorization)
+	switch {
+	case errors.Is(err, bots.ErrNoToken):
+		isBot, err := database.IsBot(ctx, userID)
+		if err != nil {
+			log.Printf("Error checking whether user %d is a bot: %v", userID, err)
+			return false, apierror.From(err, "Unable to connect")
+		}
+		if isBot {
+			return false, apierror.Unauthorized("Bots must connect with their token")
 		}
-		// Clear stored messages after delivery
-		database.RedisClient.Del(ctx, offlineKey)
+	case errors.Is(err, database.ErrBotNotFound):
+		return false, apierror.Unauthorized("Invalid bot token")
+	case err != nil:
+		log.Printf("Error authenticating bot: %v", err)
+		return false, apierror.From(err, "Unable to connect")
+	case bot.ID != userID:
+		return false, apierror.Unauthorized("The bot token belongs to another user")
 	}
+	authenticated := err == nil
 
-	for {
-		var msg WsMessage
-		err := conn.ReadJSON(&msg)
+	restrictions, err := database.UserRestrictions(ctx, userID)
+	if errors.Is(err, database.ErrUserNotFound) {
+		return false, apierror.NotFound("User not found")
+	}
+	if err != nil {
+		log.Printf("Error fetching restrictions of user %d: %v", userID, err)
+		return false, apierror.From(err, "Unable to connect")
+	}
+	if restrictions.Suspended() {
+		return false, apierror.New(http.StatusForbidden, apierror.CodeSuspended, "Account suspended")
+	}
+	return authenticated, nil
+}
+
+// connectDevice registers a device, the user comes online with their first device
+func connectDevice(c *Client) {
+	if registerClient(c) {
+		_, err := database.DB.Exec(ctx, "UPDATE users SET online = true WHERE id = $1", c.userID)
 		if err != nil {
-			log.Printf("Error reading message: %v", err)
-			break
+			log.Printf("Error setting user %s as online: %v", c.userID, err)
 		}
+		broadcastPresence(c.userID, PresenceOnline, nil)
+	}
+	sendPresenceSnapshot(c.userID, c)
+}
 
-		// handle one to one messages
-		if msg.ReceiverID != 0 {
-			recieverConn, exists := GetWSConnection(fmt.Sprint(msg.ReceiverID))
-			if exists {
-				err = recieverConn.WriteJSON(msg)
-				if err != nil {
-					log.Printf("Error sending message to user %d: %v", msg.ReceiverID, err)
-				}
-			} else {
-				// Store the message in Redis for offline users
-				msgJSON, err := json.Marshal(msg)
-				if err != nil {
-					log.Printf("Error marshaling message: %v", err)
-					continue
-				}
-
-				// Store the message in Redis with a TTL of 1 hour
-				offlineKey := fmt.Sprintf("offline:%d", msg.ReceiverID)
-				err = database.RedisClient.LPush(ctx, offlineKey, msgJSON).Err()
-				if err != nil {
-					log.Printf("Error storing offline message for user %d: %v", msg.ReceiverID, err)
-					continue
-				}
-
-				// Set a TTL for the offline message
-				err = database.RedisClient.Expire(ctx, offlineKey, time.Hour).Err()
-				if err != nil {
-					log.Printf("Error setting TTL for offline message for user %d: %v", msg.ReceiverID, err)
-					continue
-				}
-				log.Printf("Stored offline message for user %d", msg.ReceiverID)
-
-				// publish the message to the receiver's channel
-				err = database.RedisClient.Publish(ctx, fmt.Sprintf("ws:%d", msg.ReceiverID), msgJSON).Err()
-				if err != nil {
-					log.Printf("Error publishing message to user %d: %v", msg.ReceiverID, err)
-				}
-			}
+// disconnectDevice closes and unregisters a device, the user goes offline with their last one
+func disconnectDevice(c *Client) {
+	last := unregisterClient(c)
+	c.close(websocket.CloseNormalClosure, "")
+
+	if last {
+		lastSeen := time.Now()
+		_, err := database.DB.Exec(ctx, "UPDATE users SET online = false, last_active = $2 WHERE id = $1", c.userID, lastSeen)
+		if err != nil {
+			log.Printf("Error setting user %s as offline: %v", c.userID, err)
+		}
+
+		clearTyping(c.userID)
+		broadcastPresence(c.userID, PresenceOffline, &lastSeen)
+	}
+	log.Printf("Closed the %s connection of device %s of user %s", c.transport.name(), c.deviceID, c.userID)
+}
+
+// dispatch delivers a stored chat message to its recipients and to the devices of its sender
+// other than the one it was sent from
+func dispatch(msg WsMessage, deviceID string) {
+	webhooks.Emit(ctx, models.WebhookMessageCreated, msg.GroupID, webhookData(msg))
+	bots.Dispatch(ctx, models.Message{ID: msg.ID, GroupID: msg.GroupID, SenderID: msg.SenderID, Content: msg.Content})
+	deliverExcept(fmt.Sprint(msg.SenderID), deviceID, msg)
+
+	// handle one to one messages
+	if msg.ReceiverID != 0 {
+		if !deliver(fmt.Sprint(msg.ReceiverID), msg) {
+			notifyOffline(msg.ReceiverID, msg)
 		}
+	}
 
-		if msg.GroupID != 0 {
-			// Handle group messages
-			groupKey := fmt.Sprintf("group:%d", msg.GroupID)
+	if msg.GroupID != 0 {
+		// Handle group messages
+		groupMembers, err := GroupMembers(msg.GroupID)
+		if err != nil {
+			log.Printf("Error fetching group members: %v", err)
+			return
+		}
 
-			groupMembers, err := database.RedisClient.SMembers(ctx, groupKey).Result()
-			if err != nil {
-				log.Printf("Error fetching group members: %v", err)
-				continue
+		for _, memberID := range groupMembers {
+			if memberID == fmt.Sprintf("%d", msg.SenderID) {
+				continue // The sender's devices were handled above
 			}
-
-			for _, userID := range groupMembers {
-				if userID == fmt.Sprintf("%d", msg.SenderID) {
-					continue // Skip sending the message to the sender
-				}
-				receiverConn, exists := GetWSConnection(userID)
-				if exists {
-					err := receiverConn.WriteJSON(msg)
-					if err != nil {
-						log.Printf("Error delivering message to group member %s: %v", userID, err)
-						continue
-					}
-				} else {
-					// store the message in Redis for offline users
-					msgJSON, err := json.Marshal(msg)
-					if err != nil {
-						log.Printf("Error marshaling message for group %d: %v", msg.GroupID, err)
-						continue
-					}
-
-					// Store the message in Redis with a TTL of 1 hour
-					offlineKey := fmt.Sprintf("offline:%s", userID)
-					err = database.RedisClient.LPush(ctx, offlineKey, msgJSON).Err()
-					if err != nil {
-						log.Printf("Error storing offline message for group %d: %v", msg.GroupID, err)
-						continue
-					}
-					// Set a TTL for the offline message
-					err = database.RedisClient.Expire(ctx, offlineKey, time.Hour).Err()
-					if err != nil {
-						log.Printf("Error setting TTL for offline message for group %d: %v", msg.GroupID, err)
-						continue
-					}
-					log.Printf("Stored offline message for group %d", msg.GroupID)
-					// publish the message to the receiver's channel
-					err = database.RedisClient.Publish(ctx, fmt.Sprintf("ws:%s", userID), msgJSON).Err()
-					if err != nil {
-						log.Printf("Error publishing message to group %d member %v: %v", msg.GroupID, userID, err)
-					}
-				}
+			if hasBlocked(memberID, msg.SenderID) {
+				continue // Hide the message from members who blocked the sender
+			}
+			if !deliver(memberID, msg) {
+				id, _ := strconv.Atoi(memberID)
+				notifyOffline(id, msg)
 			}
 		}
 	}
 }
 
-func SubscribeToMessages() {
-	pubsub := database.RedisClient.Subscribe(ctx, "ws:*") // Subscribe to all user channels
-	ch := pubsub.Channel()
-	for msg := range ch {
-		var wsMsg WsMessage
-		err := json.Unmarshal([]byte(msg.Payload), &wsMsg)
+// webhookData is the data of the message.created event of a chat frame. Direct messages only
+// reach server webhooks, which do not get their content.
+func webhookData(msg WsMessage) interface{} {
+	if msg.GroupID != 0 {
+		return msg
+	}
+	return webhooks.DirectMessage{ID: msg.ID, SenderID: msg.SenderID, ReceiverID: msg.ReceiverID, CreatedAt: msg.CreatedAt}
+}
+
+// notifyOffline queues a push notification for a recipient with no device connected here
+func notifyOffline(userID int, msg WsMessage) {
+	err := push.Enqueue(ctx, userID, push.Message{
+		ID:          msg.ID,
+		GroupID:     msg.GroupID,
+		SenderID:    msg.SenderID,
+		SenderName:  msg.SenderName,
+		Content:     msg.Content,
+		Attachments: len(msg.Attachments),
+	})
+	if err != nil {
+		log.Printf("Error queueing push notification for user %d: %v", userID, err)
+	}
+}
+
+// DeliverMessage fans out a message sent through the REST API like a WebSocket message,
+// every device of the sender gets it too. Clients on the event stream send messages this way.
+func DeliverMessage(message models.Message) {
+	senderName, err := database.DisplayName(ctx, message.SenderID, message.GroupID)
+	if err != nil {
+		log.Printf("Error fetching username of user %d: %v", message.SenderID, err)
+		return
+	}
+
+	dispatch(WsMessage{
+		ID:           message.ID,
+		Type:         TypeMessage,
+		SenderID:     message.SenderID,
+		SenderName:   senderName,
+		ReceiverID:   message.ReceiverID,
+		GroupID:      message.GroupID,
+		Content:      message.Content,
+		ReplyToID:    message.ReplyToID,
+		ReplyTo:      message.ReplyTo,
+		ThreadRootID: message.ThreadRootID,
+		Attachments:  message.Attachments,
+		CreatedAt:    message.CreatedAt,
+		ClientMsgID:  message.ClientMsgID,
+	}, "")
+}
+
+// hasBlocked reports whether a user blocked the sender, the check is served from the Redis cache
+func hasBlocked(userID string, senderID int) bool {
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return false
+	}
+
+	blocked, err := database.HasBlocked(ctx, id, senderID)
+	if err != nil {
+		log.Printf("Error checking blocks of user %s: %v", userID, err)
+		return false
+	}
+	return blocked
+}
+
+// GroupMembers returns the ids of the users who joined a group
+func GroupMembers(groupID int) ([]string, error) {
+	return database.RedisClient.SMembers(ctx, fmt.Sprintf("group:%d", groupID)).Result()
+}
+
+// BroadcastEvent fans a frame about an existing message out to everyone in its conversation,
+// including the sender so their other devices stay in sync. Offline devices catch up from the stream.
+func BroadcastEvent(frame WsMessage) {
+	recipients := []string{fmt.Sprint(frame.SenderID)}
+
+	if frame.GroupID != 0 {
+		members, err := GroupMembers(frame.GroupID)
 		if err != nil {
-			log.Printf("Error decoding WebSocket message: %v", err)
-			continue
+			log.Printf("Error fetching members of group %d: %v", frame.GroupID, err)
+			return
 		}
+		recipients = members
+	} else if frame.ReceiverID != 0 {
+		recipients = append(recipients, fmt.Sprint(frame.ReceiverID))
+	}
 
-		// Deliver the message to the connected client (if they are online)
-		receiverConn, exists := GetWSConnection(fmt.Sprint(wsMsg.ReceiverID))
-		if exists {
-			err := receiverConn.WriteJSON(wsMsg)
-			if err != nil {
-				log.Printf("Error delivering message to user %d: %v", wsMsg.ReceiverID, err)
-			}
+	for _, userID := range recipients {
+		if frame.GroupID != 0 && hasBlocked(userID, frame.SenderID) {
+			continue
 		}
+		deliver(userID, frame)
 	}
 }
@@ -0,0 +1,205 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clementus360/proxy-chat/apierror"
+	"github.com/clementus360/proxy-chat/database"
+	"github.com/clementus360/proxy-chat/internal/testenv"
+	"github.com/clementus360/proxy-chat/models"
+	"github.com/clementus360/proxy-chat/ratelimit"
+	"github.com/jackc/pgx/v5"
+)
+
+func TestHandleFrameSetsSenderIdentity(t *testing.T) {
+	testenv.Postgres(t)
+	previous := ratelimit.Default
+	ratelimit.Default = ratelimit.NewMemoryLimiter()
+	t.Cleanup(func() { ratelimit.Default = previous })
+
+	sender := testenv.CreateUser(t)
+	victim := testenv.CreateUser(t)
+	receiver := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, victim)
+	memberGroupID := testenv.CreateGroup(t, sender)
+
+	var username string
+	if err := database.DB.QueryRow(context.Background(), "SELECT username FROM users WHERE id = $1", sender).Scan(&username); err != nil {
+		t.Fatal(err)
+	}
+
+	backdated := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		frame    WsMessage
+		wantCode string
+	}{
+		{"spoofed direct message", WsMessage{Type: TypeMessage, SenderID: victim, SenderName: "admin", ReceiverID: receiver, Content: "hi", CreatedAt: backdated}, ""},
+		{"spoofed group message", WsMessage{Type: TypeMessage, SenderID: victim, GroupID: memberGroupID, Content: "hello group", CreatedAt: backdated}, ""},
+		{"group of the spoofed sender", WsMessage{Type: TypeMessage, SenderID: victim, GroupID: groupID, Content: "let me in"}, apierror.CodeForbidden},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient(strconv.Itoa(sender), defaultDevice, &recordingTransport{}, legacySession, "", "")
+			limiter := frameLimiter{userID: c.userID, windowStart: time.Now()}
+			tt.frame.ClientMsgID = "identity-" + strconv.Itoa(i)
+			started := time.Now()
+			c.handleFrame(&limiter, tt.frame, "", nil)
+
+			frames := queued(c)
+			if len(frames) != 1 {
+				t.Fatalf("frames = %+v, want one", frames)
+			}
+			if tt.wantCode != "" {
+				if frames[0].Type != TypeError || frames[0].Code != tt.wantCode {
+					t.Errorf("frame = %+v, want a %s error", frames[0], tt.wantCode)
+				}
+				return
+			}
+			if frames[0].Type != TypeSent {
+				t.Fatalf("frame = %+v, want a sent frame", frames[0])
+			}
+
+			stored, err := database.MessageByClientID(context.Background(), sender, tt.frame.ClientMsgID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.SenderID != sender || stored.CreatedAt.Before(started.Add(-time.Minute)) {
+				t.Errorf("stored = %+v, want sender %d and a current time", stored, sender)
+			}
+		})
+	}
+
+	// Recipients see the name of the connected user, not the one in the frame
+	devices := connect(t, receiver)
+	c := newClient(strconv.Itoa(sender), defaultDevice, &recordingTransport{}, legacySession, "", "")
+	limiter := frameLimiter{userID: c.userID, windowStart: time.Now()}
+	c.handleFrame(&limiter, WsMessage{Type: TypeMessage, SenderID: victim, SenderName: "admin", ReceiverID: receiver, Content: "it is me"}, "", nil)
+	delivered := queued(devices[receiver])
+	if len(delivered) != 1 || delivered[0].SenderID != sender || delivered[0].SenderName != username {
+		t.Errorf("delivered = %+v, want a message from %d (%s)", delivered, sender, username)
+	}
+}
+
+func TestRefusedMessagesAreNotScreened(t *testing.T) {
+	server := testenv.Postgres(t)
+	previous := ratelimit.Default
+	ratelimit.Default = ratelimit.NewMemoryLimiter()
+	t.Cleanup(func() { ratelimit.Default = previous })
+
+	sender := testenv.CreateUser(t)
+	blocker := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, blocker)
+	if err := database.BlockUser(context.Background(), blocker, sender); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		frame    WsMessage
+		wantCode string
+	}{
+		{"group of other users", WsMessage{Type: TypeMessage, GroupID: groupID, Content: "hello"}, apierror.CodeForbidden},
+		{"same message to the group", WsMessage{Type: TypeMessage, GroupID: groupID, Content: "hello"}, apierror.CodeForbidden},
+		{"user who blocked the sender", WsMessage{Type: TypeMessage, ReceiverID: blocker, Content: "hello"}, apierror.CodeBlocked},
+		{"same message to that user", WsMessage{Type: TypeMessage, ReceiverID: blocker, Content: "hello"}, apierror.CodeBlocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClient(strconv.Itoa(sender), defaultDevice, &recordingTransport{}, legacySession, "", "")
+			limiter := frameLimiter{userID: c.userID, windowStart: time.Now()}
+			c.handleFrame(&limiter, tt.frame, "", nil)
+
+			frames := queued(c)
+			if len(frames) != 1 || frames[0].Type != TypeError || frames[0].Code != tt.wantCode {
+				t.Errorf("frames = %+v, want a %s error", frames, tt.wantCode)
+			}
+		})
+	}
+
+	// The spam filters never saw the refused messages
+	if server.Exists("filter:flood:" + strconv.Itoa(sender)) {
+		t.Error("the refused messages were counted by the flood filter")
+	}
+}
+
+func TestWebhookDataLeavesOutDirectMessageContent(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		msg         WsMessage
+		wantContent bool
+	}{
+		{"group message", WsMessage{Type: TypeMessage, ID: 1, SenderID: 2, GroupID: 3, Content: "hello group", CreatedAt: createdAt}, true},
+		{"direct message", WsMessage{Type: TypeMessage, ID: 1, SenderID: 2, ReceiverID: 4, Content: "just between us", Attachments: []models.Attachment{{ID: 5, Filename: "private.jpg"}}, CreatedAt: createdAt}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(webhookData(tt.msg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(string(data), tt.msg.Content); got != tt.wantContent {
+				t.Errorf("data = %s, want content %v", data, tt.wantContent)
+			}
+			if strings.Contains(string(data), "private.jpg") {
+				t.Errorf("data = %s, want no attachments", data)
+			}
+
+			var event struct {
+				ID       int `json:"id"`
+				SenderID int `json:"sender_id"`
+			}
+			json.Unmarshal(data, &event)
+			if event.ID != tt.msg.ID || event.SenderID != tt.msg.SenderID {
+				t.Errorf("data = %s, want the message metadata", data)
+			}
+		})
+	}
+}
+
+func TestServerWebhooksGetDirectMessagesWithoutContent(t *testing.T) {
+	testenv.Postgres(t)
+	ctx := context.Background()
+
+	sender := testenv.CreateUser(t)
+	receiver := testenv.CreateUser(t)
+	groupID := testenv.CreateGroup(t, sender)
+	hook := models.Webhook{URL: "https://hooks.example.com/" + testenv.Name("server"), Secret: "whsec_test", Events: []string{models.WebhookMessageCreated}}
+	if err := database.CreateWebhook(ctx, &hook); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.DeleteWebhook(ctx, hook.ID) })
+
+	dispatch(WsMessage{Type: TypeMessage, ID: 1, SenderID: sender, ReceiverID: receiver, Content: "just between us", CreatedAt: time.Now()}, "")
+	dispatch(WsMessage{Type: TypeMessage, ID: 2, SenderID: sender, GroupID: groupID, Content: "hello group", CreatedAt: time.Now()}, "")
+
+	rows, err := database.DB.Query(ctx, "SELECT payload FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id", hook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloads, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("deliveries = %q, want two", payloads)
+	}
+	var direct, group struct {
+		Data map[string]any `json:"data"`
+	}
+	json.Unmarshal([]byte(payloads[0]), &direct)
+	json.Unmarshal([]byte(payloads[1]), &group)
+	if _, ok := direct.Data["content"]; ok || direct.Data["receiver_id"] != float64(receiver) {
+		t.Errorf("direct message payload = %s, want the metadata only", payloads[0])
+	}
+	if group.Data["content"] != "hello group" {
+		t.Errorf("group message payload = %s, want the content", payloads[1])
+	}
+}